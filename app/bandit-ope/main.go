@@ -0,0 +1,98 @@
+// Command bandit-ope estimates the reward of candidate bandit configs by
+// replaying the bandit_events log of a slot (off-policy evaluation).
+//
+//	go run ./app/bandit-ope -slot home_top -from 2025-01-01 -to 2025-01-08 -candidates candidates.json
+//
+// candidates.json holds a JSON array of BanditConfig objects, the same shape
+// accepted by PUT /api/v1/admin/bandit/config.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"myGreenMarket/business/bandit"
+	"myGreenMarket/domain"
+	psqlRepo "myGreenMarket/internal/repository/postgres"
+	"myGreenMarket/pkg/config"
+	"myGreenMarket/pkg/database"
+)
+
+func main() {
+	slot := flag.String("slot", "", "slot to evaluate (required)")
+	from := flag.String("from", "", "start of the log window, YYYY-MM-DD or RFC3339 (default: 7 days before -to)")
+	to := flag.String("to", "", "end of the log window, YYYY-MM-DD or RFC3339 (default: now)")
+	candidatesPath := flag.String("candidates", "", "path to a JSON array of BanditConfig candidates (required)")
+	slateSize := flag.Int("slate", 10, "number of products shown per request")
+	maxWeight := flag.Float64("max-weight", 20, "importance weight clipping")
+	flag.Parse()
+
+	if *slot == "" || *candidatesPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	req := domain.OffPolicyEvalRequest{
+		Slot:      *slot,
+		SlateSize: *slateSize,
+		MaxWeight: *maxWeight,
+	}
+
+	var err error
+	if req.From, err = parseTime(*from); err != nil {
+		log.Fatalf("invalid -from: %v", err)
+	}
+	if req.To, err = parseTime(*to); err != nil {
+		log.Fatalf("invalid -to: %v", err)
+	}
+
+	raw, err := os.ReadFile(*candidatesPath)
+	if err != nil {
+		log.Fatalf("read candidates: %v", err)
+	}
+	if err := json.Unmarshal(raw, &req.Candidates); err != nil {
+		log.Fatalf("parse candidates: %v", err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	db, err := database.InitPostgres(cfg)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	evaluator := bandit.NewOffPolicyEvaluator(
+		psqlRepo.NewBanditRepository(db),
+		psqlRepo.NewBanditImpressionRepository(db),
+		psqlRepo.NewMockRecommendationRepository(db),
+		bandit.NewProductFeatureProvider(psqlRepo.NewProductRepository(db), cfg.Bandit.ProductCacheTTL),
+		bandit.DefaultConfig(),
+	)
+
+	report, err := evaluator.Evaluate(context.Background(), req)
+	if err != nil {
+		log.Fatalf("evaluate: %v", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		log.Fatalf("write report: %v", err)
+	}
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,84 @@
+// Command bandit-sim runs synthetic users through an in-memory
+// BanditService and writes each policy's learning curve as CSV: cumulative
+// regret, CTR and state growth per checkpoint.
+//
+//	go run ./app/bandit-sim -rounds 10000 -out sim.csv
+//	go run ./app/bandit-sim -policies policies.json -out sim.csv
+//
+// policies.json holds a JSON array of {"name": ..., "config": BanditConfig}
+// objects; config has the shape accepted by PUT /api/v1/admin/bandit/config.
+// Without it every registered policy is compared on the default config.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"myGreenMarket/business/bandit/simulation"
+	"myGreenMarket/pkg/logger"
+)
+
+func main() {
+	sc := simulation.DefaultScenario()
+
+	flag.IntVar(&sc.Rounds, "rounds", sc.Rounds, "number of Recommend → feedback rounds per policy")
+	flag.IntVar(&sc.Users, "users", sc.Users, "number of synthetic users")
+	flag.IntVar(&sc.Products, "products", sc.Products, "number of synthetic products")
+	flag.IntVar(&sc.Segments, "segments", sc.Segments, "number of user preference clusters")
+	flag.IntVar(&sc.SlateSize, "slate", sc.SlateSize, "number of products shown per request")
+	flag.IntVar(&sc.Checkpoint, "checkpoint", sc.Checkpoint, "rounds between two CSV rows")
+	flag.Float64Var(&sc.BaseCTR, "base-ctr", sc.BaseCTR, "click probability of an average product at the top position")
+	flag.Float64Var(&sc.Affinity, "affinity", sc.Affinity, "weight of user preferences in the click model")
+	flag.Float64Var(&sc.OfflineNoise, "offline-noise", sc.OfflineNoise, "noise between true popularity and the offline score")
+	flag.Int64Var(&sc.Seed, "seed", sc.Seed, "random seed of the synthetic world")
+	policiesPath := flag.String("policies", "", "path to a JSON array of policies to compare (default: every registered policy)")
+	outPath := flag.String("out", "-", "CSV output file, - for stdout")
+	flag.Parse()
+
+	logger.Init("production")
+
+	var policies []simulation.Policy
+	if *policiesPath != "" {
+		raw, err := os.ReadFile(*policiesPath)
+		if err != nil {
+			log.Fatalf("read policies: %v", err)
+		}
+		if err := json.Unmarshal(raw, &policies); err != nil {
+			log.Fatalf("parse policies: %v", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	results, err := simulation.Run(ctx, sc, policies)
+	if err != nil {
+		log.Fatalf("simulate: %v", err)
+	}
+
+	var out io.Writer = os.Stdout
+	if *outPath != "-" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			log.Fatalf("create output: %v", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	if err := simulation.WriteCSV(out, results); err != nil {
+		log.Fatalf("write csv: %v", err)
+	}
+
+	for _, res := range results {
+		final := res.Final()
+		log.Printf("%-16s regret=%.1f ctr=%.4f states=%d arms=%d state_bytes=%d",
+			res.Policy, final.Regret, final.CTR, final.States, final.Arms, final.StateBytes)
+	}
+}
@@ -0,0 +1,191 @@
+// Command bandit-warmstart bootstraps bandit states: it rebuilds a slot's
+// states by replaying its bandit_events log, and exports and imports
+// states so one environment can be seeded from another.
+//
+//	go run ./app/bandit-warmstart rebuild -slot home_top -from 2025-01-01 -users
+//	go run ./app/bandit-warmstart export -slot home_top -users -out home_top.json
+//	go run ./app/bandit-warmstart import -in home_top.json [-slot home_top_v2]
+//
+// rebuild and import overwrite the stored states; snapshot the slot first
+// (POST /api/v1/admin/bandit/snapshots) to be able to roll back.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"myGreenMarket/business/bandit"
+	"myGreenMarket/domain"
+	psqlRepo "myGreenMarket/internal/repository/postgres"
+	"myGreenMarket/pkg/config"
+	"myGreenMarket/pkg/database"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: bandit-warmstart rebuild|export|import [flags]")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd, args := os.Args[1], os.Args[2:]
+
+	switch cmd {
+	case "rebuild":
+		rebuild(args)
+	case "export":
+		export(args)
+	case "import":
+		importStates(args)
+	default:
+		usage()
+	}
+}
+
+func newWarmStarter() *bandit.StateWarmStarter {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	db, err := database.InitPostgres(cfg)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	banditRepo := psqlRepo.NewBanditRepository(db)
+	productsRepo := psqlRepo.NewProductRepository(db)
+	svc := bandit.NewBanditService(
+		banditRepo,
+		productsRepo,
+		banditRepo,
+		bandit.NoopEligibilityChecker{},
+		psqlRepo.NewMockRecommendationRepository(db),
+		psqlRepo.NewBanditConfigRepository(db),
+		psqlRepo.NewUserSegmentRepository(db),
+		psqlRepo.NewUserContextRepository(db),
+		bandit.DefaultConfig(),
+		bandit.WithProductFeatures(bandit.NewProductFeatureProvider(productsRepo, cfg.Bandit.ProductCacheTTL)),
+	)
+	return bandit.NewStateWarmStarter(svc, banditRepo, banditRepo)
+}
+
+func rebuild(args []string) {
+	fs := flag.NewFlagSet("rebuild", flag.ExitOnError)
+	slot := fs.String("slot", "", "slot to rebuild (required)")
+	segment := fs.Int("segment", -1, "segment to rebuild (default: all)")
+	from := fs.String("from", "", "start of the log window, YYYY-MM-DD or RFC3339 (default: 30 days before -to)")
+	to := fs.String("to", "", "end of the log window, YYYY-MM-DD or RFC3339 (default: now)")
+	users := fs.Bool("users", false, "rebuild the per-user states too")
+	dryRun := fs.Bool("dry-run", false, "replay without saving")
+	_ = fs.Parse(args)
+
+	if *slot == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	req := domain.StateRebuildRequest{
+		Slot:         *slot,
+		IncludeUsers: *users,
+		DryRun:       *dryRun,
+	}
+	if *segment >= 0 {
+		req.Segment = segment
+	}
+
+	var err error
+	if req.From, err = parseTime(*from); err != nil {
+		log.Fatalf("invalid -from: %v", err)
+	}
+	if req.To, err = parseTime(*to); err != nil {
+		log.Fatalf("invalid -to: %v", err)
+	}
+
+	report, err := newWarmStarter().Rebuild(context.Background(), req)
+	if err != nil {
+		log.Fatalf("rebuild: %v", err)
+	}
+	writeJSON(os.Stdout, report)
+}
+
+func export(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	slot := fs.String("slot", "", "slot to export (required)")
+	users := fs.Bool("users", false, "export the per-user states too")
+	out := fs.String("out", "", "output file (default: stdout)")
+	_ = fs.Parse(args)
+
+	if *slot == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	exp, err := newWarmStarter().Export(context.Background(), *slot, *users)
+	if err != nil {
+		log.Fatalf("export: %v", err)
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatalf("create %s: %v", *out, err)
+		}
+		defer f.Close()
+		w = f
+	}
+	writeJSON(w, exp)
+}
+
+func importStates(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	in := fs.String("in", "", "export file to import (required)")
+	slot := fs.String("slot", "", "slot to import into (default: the exported slot)")
+	_ = fs.Parse(args)
+
+	if *in == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	raw, err := os.ReadFile(*in)
+	if err != nil {
+		log.Fatalf("read %s: %v", *in, err)
+	}
+	var exp bandit.StateExport
+	if err := json.Unmarshal(raw, &exp); err != nil {
+		log.Fatalf("parse %s: %v", *in, err)
+	}
+
+	n, err := newWarmStarter().Import(context.Background(), exp, *slot)
+	if err != nil {
+		log.Fatalf("import: %v", err)
+	}
+	log.Printf("imported %d states", n)
+}
+
+func writeJSON(w io.Writer, v any) {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Fatalf("write output: %v", err)
+	}
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
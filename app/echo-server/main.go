@@ -98,16 +98,42 @@ func main() {
 	segmentRepo := psqlRepo.NewUserSegmentRepository(db)
 	categoryRepo := psqlRepo.NewCategoryRepository(db)
 	userCtxRepo := psqlRepo.NewUserContextRepository(db)
+	impressionRepo := psqlRepo.NewBanditImpressionRepository(db)
+	experimentRepo := psqlRepo.NewBanditExperimentRepository(db)
+	overrideRepo := psqlRepo.NewBanditOverrideRepository(db)
 
 	// Init service
 	userService := userService.NewUserService(userRepo, tokenRepo, validate, mailjetEmail, cfg.App.AppEmailVerificationKey, cfg.App.AppDeploymentUrl)
 	ordersService := orders.NewOrdersService(ordersRepo, productsRepo)
-	paymentsService := payments.NewPaymentsService(paymentsRepo, xenditRepo, userRepo, ordersRepo, productsRepo)
 	productService := product.NewProductService(productsRepo)
 	categoryService := category.NewCategoryService(categoryRepo)
 
-	eligChecker := bandit.NoopEligibilityChecker{}
+	eligibilityRepo := psqlRepo.NewBanditEligibilityRepository(db)
+	eligChecker := bandit.NewCatalogEligibilityChecker(eligibilityRepo, bandit.EligibilityConfig{
+		CacheTTL:         cfg.Bandit.EligibilityCacheTTL,
+		PurchaseLookback: cfg.Bandit.EligibilityPurchaseLookback,
+	})
 	defaultCfg := bandit.DefaultConfig()
+	productFeatures := bandit.NewProductFeatureProvider(productsRepo, cfg.Bandit.ProductCacheTTL)
+	experimentAllocator := bandit.NewExperimentAllocator(experimentRepo, cfg.Bandit.ExperimentCacheTTL)
+	merchandiser := bandit.NewMerchandiser(psqlRepo.NewBanditMerchRuleRepository(db), cfg.Bandit.MerchRuleCacheTTL)
+	experimentReporter := bandit.NewExperimentReporter(impressionRepo, banditRepo, experimentRepo, experimentRepo)
+	guardrailMonitor := bandit.NewGuardrailMonitor(
+		experimentReporter,
+		impressionRepo,
+		overrideRepo,
+		mailjetEmail,
+		bandit.GuardrailConfig{
+			Interval:       cfg.Bandit.GuardrailInterval,
+			Window:         cfg.Bandit.GuardrailWindow,
+			MinImpressions: int64(cfg.Bandit.GuardrailMinImpressions),
+			MaxDrop:        cfg.Bandit.GuardrailMaxDrop,
+			AlertEmail:     cfg.Bandit.GuardrailAlertEmail,
+		},
+	)
+	if err := guardrailMonitor.Reload(context.Background()); err != nil {
+		logger.Error("Failed to load bandit guardrail overrides", "error", err)
+	}
 	banditService := bandit.NewBanditService(
 		banditRepo,   // BanditRepository (events + state)
 		productsRepo, // ProductRepository
@@ -118,8 +144,69 @@ func main() {
 		segmentRepo,  // SegmentRepository
 		userCtxRepo,  //segment
 		defaultCfg,   // base Config
+		bandit.WithImpressionRepository(impressionRepo),
+		bandit.WithProductFeatures(productFeatures),
+		bandit.WithExperiments(experimentAllocator),
+		bandit.WithGuardrails(guardrailMonitor),
+		bandit.WithMerchandising(merchandiser),
+		bandit.WithExposureTracker(redisRepo.NewBanditExposureTracker(redisClient)),
+		bandit.WithDismissals(eligibilityRepo),
+		bandit.WithScoring(bandit.ScoringConfig{
+			Workers:     cfg.Bandit.ScoringWorkers,
+			ParallelMin: cfg.Bandit.ScoringParallelMin,
+			Timeout:     cfg.Bandit.ScoringTimeout,
+		}),
 	)
+	// feedback from the API and attributed orders is queued and learned by
+	// a worker pool when async ingestion is on, so failed events are
+	// retried and dead-lettered
+	var feedbackSink rest.FeedbackSink
+	var feedbackIngestor *bandit.FeedbackIngestor
+	var attributionFeedback bandit.FeedbackLogger = banditService
+	if cfg.Bandit.FeedbackAsync {
+		feedbackQueue := redisRepo.NewBanditFeedbackQueue(redisClient, cfg.Bandit.FeedbackStream, "bandit-feedback")
+		if err := feedbackQueue.EnsureGroup(context.Background()); err != nil {
+			log.Fatalf("Failed to init bandit feedback queue: %v", err)
+		}
+		feedbackIngestor = bandit.NewFeedbackIngestor(feedbackQueue, banditService, bandit.IngestConfig{
+			Workers:     cfg.Bandit.FeedbackWorkers,
+			BatchSize:   cfg.Bandit.FeedbackBatchSize,
+			MaxBacklog:  int64(cfg.Bandit.FeedbackMaxBacklog),
+			MaxAttempts: cfg.Bandit.FeedbackMaxAttempts,
+		})
+		feedbackSink = feedbackIngestor
+		attributionFeedback = feedbackIngestor
+	}
+
+	attributionEngine := bandit.NewAttributionEngine(
+		impressionRepo,
+		banditRepo,
+		banditRepo,
+		attributionFeedback,
+		bandit.AttributionConfig{
+			Lookback: cfg.Bandit.AttributionLookback,
+			Rule:     cfg.Bandit.AttributionRule,
+			Timeout:  cfg.Bandit.AttributionTimeout,
+		},
+	)
+
+	paymentsService := payments.NewPaymentsService(paymentsRepo, xenditRepo, userRepo, ordersRepo, productsRepo, attributionEngine)
 	mockRecoService := mockreco.NewService(mockRecoRepo)
+	banditEvaluator := bandit.NewOffPolicyEvaluator(banditRepo, impressionRepo, mockRecoRepo, productFeatures, defaultCfg)
+	jobRepo := psqlRepo.NewBanditJobRepository(db)
+	stateSnapshotter := bandit.NewStateSnapshotter(psqlRepo.NewBanditSnapshotRepository(db), banditService, jobRepo, bandit.SnapshotConfig{
+		Interval: cfg.Bandit.SnapshotInterval,
+		MaxAge:   cfg.Bandit.SnapshotMaxAge,
+		KeepLast: cfg.Bandit.SnapshotKeepLast,
+	})
+	stateWarmStarter := bandit.NewStateWarmStarter(banditService, banditRepo, banditRepo)
+	stateCompactor := bandit.NewStateCompactor(banditRepo, jobRepo, bandit.StateGCConfig{
+		Interval: cfg.Bandit.StateGCInterval,
+		IdleTTL:  cfg.Bandit.StateGCIdleTTL,
+		ArmTTL:   cfg.Bandit.StateGCArmTTL,
+		FoldArms: cfg.Bandit.StateGCFoldArms,
+		MaxArms:  cfg.Bandit.StateGCMaxArms,
+	})
 
 	// Init handler
 	userHandler := rest.NewUserHandler(userService)
@@ -127,9 +214,9 @@ func main() {
 	ordersHandler := rest.NewOrdersHandler(ordersService)
 	paymentsHandler := rest.NewPaymentsHandler(paymentsService)
 	webhookHandler := rest.NewWebhookHandler(paymentsService, cfg.Xendit.XenditWebhookVerificationToken)
-	banditHandler := rest.NewBanditHandler(banditService)
+	banditHandler := rest.NewBanditHandler(banditService, feedbackSink)
 	mockRecoHandler := rest.NewMockRecommendationHandler(mockRecoService)
-	banditAdminHandler := rest.NewBanditAdminHandler(cfgRepo, segmentRepo)
+	banditAdminHandler := rest.NewBanditAdminHandler(cfgRepo, segmentRepo, banditEvaluator, experimentAllocator, experimentReporter, guardrailMonitor, merchandiser, stateSnapshotter, stateWarmStarter)
 	categoryHandler := rest.NewCategoryHandler(categoryService)
 
 	// Init echo
@@ -198,12 +285,46 @@ func main() {
 	router.SetPaymentsRoutes(api, paymentsHandler)
 	router.SetWebhookHandler(api, webhookHandler)
 	router.SetBanditRoutes(api, banditHandler)
-	router.SetBanditAdminRoutes(api, banditAdminHandler)
+	router.SetBanditAdminRoutes(api, banditAdminHandler, authRequired, adminOnly)
 	router.SetMockRecommendationRoutes(api, mockRecoHandler)
 	router.SetupCategoryRoutes(api, categoryHandler)
 	router.SetPaymentsRoutes(api, paymentsHandler)
 	router.SetWebhookHandler(api, webhookHandler)
 
+	// Background workers, stopped after the server
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+
+	// Feedback workers
+	ingestDone := make(chan struct{})
+	if feedbackIngestor != nil {
+		hostname, _ := os.Hostname()
+		go func() {
+			defer close(ingestDone)
+			logger.Info("Bandit feedback workers starting", "workers", cfg.Bandit.FeedbackWorkers)
+			feedbackIngestor.Run(bgCtx, hostname)
+		}()
+	} else {
+		close(ingestDone)
+	}
+
+	// Guardrail monitor
+	if cfg.Bandit.GuardrailEnabled {
+		go guardrailMonitor.Run(bgCtx)
+	} else {
+		// still pick up pauses made elsewhere and cleared overrides
+		go guardrailMonitor.RunReload(bgCtx)
+	}
+
+	// Periodic state snapshots
+	if cfg.Bandit.SnapshotEnabled {
+		go stateSnapshotter.Run(bgCtx)
+	}
+
+	// Per-user state GC and compaction
+	if cfg.Bandit.StateGCEnabled {
+		go stateCompactor.Run(bgCtx)
+	}
+
 	// Goroutine server
 	go func() {
 		addr := fmt.Sprintf(":%s", cfg.Server.Port)
@@ -228,5 +349,13 @@ func main() {
 		logger.Error("Server shutdown error", "error", err)
 	}
 
+	// Stop background workers after the server so no queued event is orphaned
+	stopBackground()
+	select {
+	case <-ingestDone:
+	case <-ctx.Done():
+		logger.Error("Bandit feedback workers did not stop in time")
+	}
+
 	logger.Info("Server stopped")
 }
@@ -69,6 +69,7 @@ func SetWebhookHandler(api *echo.Group, webhookHandler *rest.WebhookHandler) {
 func SetBanditRoutes(api *echo.Group, handler *rest.BanditHandler) {
 	reco := api.Group("/recommendations", middleware.AuthMiddleware())
 	reco.GET("", handler.Recommend)
+	reco.POST("/page", handler.RecommendPage)
 	reco.GET("/debug", handler.DebugRecommend)
 	reco.POST("/feedback", handler.Feedback)
 }
@@ -78,14 +79,43 @@ func SetMockRecommendationRoutes(api *echo.Group, h *rest.MockRecommendationHand
 	grp.GET("", h.Get)
 }
 
-func SetBanditAdminRoutes(api *echo.Group, handler *rest.BanditAdminHandler) {
+func SetBanditAdminRoutes(api *echo.Group, handler *rest.BanditAdminHandler, authRequired echo.MiddlewareFunc, adminOnly echo.MiddlewareFunc) {
 
-	admin := api.Group("/admin/bandit", middleware.AuthMiddleware())
+	// Admin only: these routes change live ranking and bandit state
+	admin := api.Group("/admin/bandit", authRequired, adminOnly)
 
 	admin.GET("/config", handler.GetConfig)
 	admin.PUT("/config", handler.UpsertConfig)
 	admin.GET("/segment", handler.GetSegment)
 	admin.PUT("/segment", handler.UpsertSegment)
+	admin.POST("/evaluate", handler.Evaluate)
+
+	admin.GET("/experiments", handler.ListExperiments)
+	admin.POST("/experiments", handler.CreateExperiment)
+	admin.GET("/experiments/:id", handler.GetExperiment)
+	admin.POST("/experiments/:id/ramp", handler.RampExperiment)
+	admin.POST("/experiments/:id/stop", handler.StopExperiment)
+	admin.GET("/experiments/:slot/report", handler.ExperimentReport)
+
+	admin.GET("/guardrails", handler.ListGuardrailOverrides)
+	admin.DELETE("/guardrails/:slot/:variant", handler.ResumeVariant)
+
+	admin.GET("/merch-rules", handler.ListMerchRules)
+	admin.POST("/merch-rules", handler.CreateMerchRule)
+	admin.GET("/merch-rules/:id", handler.GetMerchRule)
+	admin.PUT("/merch-rules/:id", handler.UpdateMerchRule)
+	admin.DELETE("/merch-rules/:id", handler.DeleteMerchRule)
+	admin.GET("/merch-rules/:id/audit", handler.MerchRuleAudit)
+
+	admin.GET("/snapshots", handler.ListSnapshots)
+	admin.POST("/snapshots", handler.CreateSnapshot)
+	admin.GET("/snapshots/:id", handler.GetSnapshot)
+	admin.GET("/snapshots/:id/diff", handler.DiffSnapshots)
+	admin.POST("/snapshots/:id/restore", handler.RestoreSnapshot)
+
+	admin.POST("/states/rebuild", handler.RebuildStates)
+	admin.GET("/states/export", handler.ExportStates)
+	admin.POST("/states/import", handler.ImportStates)
 }
 
 func SetupCategoryRoutes(api *echo.Group, handler *rest.CategoryHandler) {
@@ -0,0 +1,340 @@
+package bandit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+)
+
+const (
+	AttributionLastTouch        = "last_touch"
+	AttributionPositionWeighted = "position_weighted"
+
+	defaultAttributionLookback = 7 * 24 * time.Hour
+	defaultAttributionTimeout  = 2 * time.Second
+)
+
+// ImpressionLookup finds the recent impressions that showed a product to a user.
+type ImpressionLookup interface {
+	ListRecentForProduct(ctx context.Context, userID uint, productID uint64, since time.Time) ([]domain.RecommendationImpression, error)
+}
+
+// UserEventLookup finds a user's recent feedback events on a product.
+type UserEventLookup interface {
+	ListUserEvents(ctx context.Context, userID uint, productID uint64, since time.Time, eventTypes []string) ([]domain.BanditEvent, error)
+}
+
+// AttributedOrderStore records which slots an order was credited to, so a
+// payment notification delivered twice credits each slot once.
+type AttributedOrderStore interface {
+	// MarkOrderAttributed claims the order's credit for a slot and reports
+	// whether it was not claimed before.
+	MarkOrderAttributed(ctx context.Context, orderID int, slot string) (bool, error)
+
+	// UnmarkOrderAttributed releases a claim whose feedback could not be
+	// logged, so a later notification of the order credits the slot.
+	UnmarkOrderAttributed(ctx context.Context, orderID int, slot string) error
+}
+
+// FeedbackLogger is the learning entry point attributed rewards are sent to:
+// the service itself, or the FeedbackIngestor when feedback is queued, in
+// which case failed events are retried and dead-lettered by its workers.
+type FeedbackLogger interface {
+	LogFeedback(ctx context.Context, event domain.BanditEvent) error
+}
+
+type AttributionConfig struct {
+	// how far back an impression / click may be to earn credit for an order
+	Lookback time.Duration
+
+	// AttributionLastTouch or AttributionPositionWeighted
+	Rule string
+
+	// bounds one AttributeOrder call, which runs on the payment request path
+	Timeout time.Duration
+}
+
+// AttributionEngine joins paid orders back to the recommendations that led
+// to them and feeds the order value to the bandit as "order" feedback, so the
+// reward signal does not depend on frontend instrumentation.
+type AttributionEngine struct {
+	impressions ImpressionLookup
+	events      UserEventLookup
+	orders      AttributedOrderStore
+	feedback    FeedbackLogger
+	cfg         AttributionConfig
+}
+
+// NewAttributionEngine builds an engine; orders may be nil, in which case
+// repeated notifications of an order are not detected.
+func NewAttributionEngine(
+	impressions ImpressionLookup,
+	events UserEventLookup,
+	orders AttributedOrderStore,
+	feedback FeedbackLogger,
+	cfg AttributionConfig,
+) *AttributionEngine {
+	if cfg.Lookback <= 0 {
+		cfg.Lookback = defaultAttributionLookback
+	}
+	if cfg.Rule == "" {
+		cfg.Rule = AttributionLastTouch
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultAttributionTimeout
+	}
+	return &AttributionEngine{
+		impressions: impressions,
+		events:      events,
+		orders:      orders,
+		feedback:    feedback,
+		cfg:         cfg,
+	}
+}
+
+// touch is one recommendation exposure or engagement that preceded an order.
+type touch struct {
+	slot     string
+	at       time.Time
+	position int // slate position, 0 for click/atc
+	engaged  bool
+}
+
+// AttributeOrder credits a paid order to the slots that recommended its
+// product. Orders without any touch in the lookback window, and slots the
+// order was already credited to, are ignored. Slots whose feedback failed
+// stay unclaimed and are credited when the order is attributed again. The
+// call gives up after the configured timeout.
+func (a *AttributionEngine) AttributeOrder(ctx context.Context, order domain.Orders) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, a.cfg.Timeout)
+	defer cancel()
+	if order.UserID <= 0 || order.ProductID <= 0 {
+		return fmt.Errorf("order %d has no user or product", order.ID)
+	}
+
+	userID := uint(order.UserID)
+	productID := uint64(order.ProductID)
+
+	paidAt := order.UpdatedAt
+	if paidAt.IsZero() {
+		paidAt = time.Now()
+	}
+	since := paidAt.Add(-a.cfg.Lookback)
+
+	touches, err := a.loadTouches(ctx, userID, productID, since, paidAt)
+	if err != nil {
+		return err
+	}
+	if len(touches) == 0 {
+		return nil
+	}
+
+	credits := a.credit(touches)
+
+	// deterministic order for logging & feedback
+	slots := make([]string, 0, len(credits))
+	for slot := range credits {
+		slots = append(slots, slot)
+	}
+	sort.Strings(slots)
+
+	// every slot is claimed before its feedback is logged, so concurrent
+	// duplicates cannot both credit it, and released when logging fails;
+	// a failing slot does not stop the others from being credited
+	var errs []error
+	credited := 0
+	for _, slot := range slots {
+		c := credits[slot]
+		event := domain.BanditEvent{
+			UserID:    userID,
+			Slot:      slot,
+			ProductID: productID,
+			EventType: "order",
+			Value:     order.Subtotal * c.share,
+			Context: map[string]any{
+				"order_id":            order.ID,
+				"attribution":         a.cfg.Rule,
+				"attribution_credit":  c.share,
+				"attributed_touch_at": c.at.Format(time.RFC3339),
+			},
+		}
+
+		ok, err := a.creditSlot(ctx, order.ID, event)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("slot %s: %w", slot, err))
+			continue
+		}
+		if !ok {
+			logger.Debug("bandit_order_already_attributed",
+				"trace_id", TraceIDFromContext(ctx),
+				"order_id", order.ID,
+				"slot", slot,
+			)
+			continue
+		}
+
+		credited++
+		BanditAttributedOrdersTotal.WithLabelValues(slot, a.cfg.Rule).Inc()
+	}
+
+	logger.Debug("bandit_order_attributed",
+		"trace_id", TraceIDFromContext(ctx),
+		"order_id", order.ID,
+		"user_id", userID,
+		"product_id", productID,
+		"rule", a.cfg.Rule,
+		"touches", len(touches),
+		"slots", len(slots),
+		"credited", credited,
+		"failed", len(errs),
+	)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("attribute order %d: %w", order.ID, errors.Join(errs...))
+	}
+	return nil
+}
+
+// creditSlot claims the order for the event's slot and logs the event,
+// releasing the claim when logging fails. It reports false when the slot
+// was already credited.
+func (a *AttributionEngine) creditSlot(ctx context.Context, orderID int, event domain.BanditEvent) (bool, error) {
+	if a.orders != nil {
+		first, err := a.orders.MarkOrderAttributed(ctx, orderID, event.Slot)
+		if err != nil {
+			return false, fmt.Errorf("mark order attributed: %w", err)
+		}
+		if !first {
+			return false, nil
+		}
+	}
+
+	if err := a.feedback.LogFeedback(ctx, event); err != nil {
+		err = fmt.Errorf("log attributed order feedback: %w", err)
+		if a.orders != nil {
+			// the claim outlives a cancelled request context
+			if uerr := a.orders.UnmarkOrderAttributed(context.WithoutCancel(ctx), orderID, event.Slot); uerr != nil {
+				err = errors.Join(err, fmt.Errorf("release order attribution: %w", uerr))
+			}
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (a *AttributionEngine) loadTouches(
+	ctx context.Context,
+	userID uint,
+	productID uint64,
+	since, until time.Time,
+) ([]touch, error) {
+
+	touches := make([]touch, 0)
+
+	if a.impressions != nil {
+		imps, err := a.impressions.ListRecentForProduct(ctx, userID, productID, since)
+		if err != nil {
+			return nil, fmt.Errorf("load impressions: %w", err)
+		}
+		for _, imp := range imps {
+			if imp.CreatedAt.After(until) {
+				continue
+			}
+			for _, item := range imp.Items {
+				// only slates that actually showed the product count
+				if item.ProductID != productID || item.Position < 0 {
+					continue
+				}
+				touches = append(touches, touch{
+					slot:     imp.Slot,
+					at:       imp.CreatedAt,
+					position: item.Position,
+				})
+			}
+		}
+	}
+
+	if a.events != nil {
+		evs, err := a.events.ListUserEvents(ctx, userID, productID, since, []string{"click", "atc"})
+		if err != nil {
+			return nil, fmt.Errorf("load user events: %w", err)
+		}
+		for _, ev := range evs {
+			if ev.CreatedAt.After(until) {
+				continue
+			}
+			touches = append(touches, touch{
+				slot:    ev.Slot,
+				at:      ev.CreatedAt,
+				engaged: true,
+			})
+		}
+	}
+
+	return touches, nil
+}
+
+type slotCredit struct {
+	share float64
+	at    time.Time // most recent touch in the slot
+}
+
+// credit splits one order across slots according to the configured rule.
+func (a *AttributionEngine) credit(touches []touch) map[string]slotCredit {
+	out := make(map[string]slotCredit)
+
+	switch a.cfg.Rule {
+	case AttributionPositionWeighted:
+		// every touch earns 1/(position+1); clicks & add-to-carts count as
+		// position 0. Shares are normalised to sum to 1.
+		total := 0.0
+		weights := make(map[string]float64)
+		for _, t := range touches {
+			w := 1.0 / float64(t.position+1)
+			weights[t.slot] += w
+			total += w
+
+			c := out[t.slot]
+			if t.at.After(c.at) {
+				c.at = t.at
+			}
+			out[t.slot] = c
+		}
+		for slot, w := range weights {
+			c := out[slot]
+			c.share = w / total
+			out[slot] = c
+		}
+
+	case AttributionLastTouch:
+		fallthrough
+	default:
+		// the most recent engagement wins; impressions only when the user
+		// never clicked
+		var last *touch
+		for i := range touches {
+			t := &touches[i]
+			switch {
+			case last == nil:
+				last = t
+			case t.engaged != last.engaged:
+				if t.engaged {
+					last = t
+				}
+			case t.at.After(last.at):
+				last = t
+			}
+		}
+		out[last.slot] = slotCredit{share: 1.0, at: last.at}
+	}
+
+	return out
+}
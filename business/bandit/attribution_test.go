@@ -0,0 +1,93 @@
+//go:build !integration
+
+package bandit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+)
+
+// memImpressions returns a fixed set of impressions.
+type memImpressions struct {
+	imps []domain.RecommendationImpression
+}
+
+func (r *memImpressions) ListRecentForProduct(_ context.Context, _ uint, _ uint64, _ time.Time) ([]domain.RecommendationImpression, error) {
+	return r.imps, nil
+}
+
+// memAttributedOrders keeps order/slot claims in memory.
+type memAttributedOrders struct {
+	claims map[string]bool
+}
+
+func (r *memAttributedOrders) key(orderID int, slot string) string {
+	return fmt.Sprintf("%d|%s", orderID, slot)
+}
+
+func (r *memAttributedOrders) MarkOrderAttributed(_ context.Context, orderID int, slot string) (bool, error) {
+	k := r.key(orderID, slot)
+	if r.claims[k] {
+		return false, nil
+	}
+	r.claims[k] = true
+	return true, nil
+}
+
+func (r *memAttributedOrders) UnmarkOrderAttributed(_ context.Context, orderID int, slot string) error {
+	delete(r.claims, r.key(orderID, slot))
+	return nil
+}
+
+// slotFailingLogger fails feedback for the slots in fail.
+type slotFailingLogger struct {
+	fail   map[string]bool
+	logged map[string]int
+}
+
+func (l *slotFailingLogger) LogFeedback(_ context.Context, ev domain.BanditEvent) error {
+	if l.fail[ev.Slot] {
+		return errors.New("state conflict")
+	}
+	l.logged[ev.Slot]++
+	return nil
+}
+
+// A slot whose feedback fails is released and credited when the order is
+// attributed again; slots already credited are not credited twice.
+func TestAttributeOrder_ReleasesFailedSlots(t *testing.T) {
+	logger.Init("test")
+
+	now := time.Now()
+	imps := &memImpressions{imps: []domain.RecommendationImpression{
+		{Slot: "home", CreatedAt: now.Add(-time.Hour), Items: []domain.ImpressionItem{{ProductID: 7, Position: 0}}},
+		{Slot: "pdp", CreatedAt: now.Add(-time.Hour), Items: []domain.ImpressionItem{{ProductID: 7, Position: 1}}},
+	}}
+	orders := &memAttributedOrders{claims: map[string]bool{}}
+	fb := &slotFailingLogger{fail: map[string]bool{"pdp": true}, logged: map[string]int{}}
+
+	engine := NewAttributionEngine(imps, nil, orders, fb, AttributionConfig{Rule: AttributionPositionWeighted})
+	order := domain.Orders{ID: 42, UserID: 1, ProductID: 7, Subtotal: 100, UpdatedAt: now}
+
+	ctx := context.Background()
+	if err := engine.AttributeOrder(ctx, order); err == nil {
+		t.Fatal("first attribution succeeded, want the pdp slot to fail")
+	}
+	if fb.logged["home"] != 1 || fb.logged["pdp"] != 0 {
+		t.Fatalf("logged = %v, want home only", fb.logged)
+	}
+
+	fb.fail = nil
+	if err := engine.AttributeOrder(ctx, order); err != nil {
+		t.Fatalf("second attribution: %v", err)
+	}
+	if fb.logged["home"] != 1 || fb.logged["pdp"] != 1 {
+		t.Errorf("logged = %v, want each slot once", fb.logged)
+	}
+}
@@ -2,11 +2,13 @@ package bandit
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"myGreenMarket/domain"
 	"myGreenMarket/pkg/logger"
 
+	"slices"
 	"strconv"
 	"time"
 
@@ -21,6 +23,10 @@ type FeatureFlags struct {
 	UseSegment     bool
 	UseProductHash bool
 	UseUserHash    bool
+
+	// learn one shared arm per global state from every event and score
+	// products with little history of their own with it
+	UseSharedArm bool
 }
 
 const (
@@ -68,8 +74,25 @@ type ProductRepository interface {
 	FindAll(ctx context.Context) ([]domain.Product, error)
 }
 
+// ImpressionRepository persists what every Recommend call served.
+type ImpressionRepository interface {
+	SaveImpression(ctx context.Context, imp domain.RecommendationImpression) error
+}
+
+// ErrStateConflict is returned by SaveState when the stored state changed
+// since it was read.
+var ErrStateConflict = errors.New("bandit state was modified concurrently")
+
+const (
+	maxStateRetries    = 8
+	stateRetryJitterMs = 5
+)
+
 type BanditStateRepository interface {
 	GetState(ctx context.Context, key string) (*LinUCBState, error)
+
+	// SaveState stores the state if it is still at state.Revision, and
+	// bumps the revision; otherwise it returns ErrStateConflict.
 	SaveState(ctx context.Context, key string, state *LinUCBState) error
 }
 
@@ -94,6 +117,64 @@ type BanditService struct {
 	segmentRepo SegmentRepository
 	userCtxRepo UserContextRepository
 	defaultCfg  Config
+
+	impressionRepo  ImpressionRepository
+	productFeatures ProductFeatureSource
+	allocator       *ExperimentAllocator
+	guardrails      *GuardrailMonitor
+	merchandiser    *Merchandiser
+	scoring         ScoringConfig
+	exposures       ExposureTracker
+	dismissals      DismissalReader
+}
+
+// Option configures optional BanditService dependencies.
+type Option func(*BanditService)
+
+// WithImpressionRepository logs a RecommendationImpression for every Recommend call.
+func WithImpressionRepository(repo ImpressionRepository) Option {
+	return func(s *BanditService) {
+		s.impressionRepo = repo
+	}
+}
+
+// WithProductFeatures feeds catalogue attributes (green tag, price, category)
+// to the product feature extractors.
+func WithProductFeatures(src ProductFeatureSource) Option {
+	return func(s *BanditService) {
+		s.productFeatures = src
+	}
+}
+
+// WithExperiments assigns variants through experiments instead of hashing
+// users evenly across NumVariants.
+func WithExperiments(allocator *ExperimentAllocator) Option {
+	return func(s *BanditService) {
+		s.allocator = allocator
+	}
+}
+
+// WithGuardrails serves paused variants' users the offline-only variant.
+func WithGuardrails(monitor *GuardrailMonitor) Option {
+	return func(s *BanditService) {
+		s.guardrails = monitor
+	}
+}
+
+// WithMerchandising applies merchandisers' pin / boost / bury / block rules
+// to every slate after scoring.
+func WithMerchandising(m *Merchandiser) Option {
+	return func(s *BanditService) {
+		s.merchandiser = m
+	}
+}
+
+// WithScoring parallelises the scoring of large candidate sets and bounds
+// its time.
+func WithScoring(cfg ScoringConfig) Option {
+	return func(s *BanditService) {
+		s.scoring = cfg
+	}
 }
 
 func NewBanditService(
@@ -106,8 +187,9 @@ func NewBanditService(
 	segmentRepo SegmentRepository,
 	userCtxRepo UserContextRepository,
 	defaultCfg Config,
+	opts ...Option,
 ) *BanditService {
-	return &BanditService{
+	s := &BanditService{
 		banditRepo:  banditRepo,
 		productRepo: productRepo,
 		stateRepo:   stateRepo,
@@ -118,10 +200,39 @@ func NewBanditService(
 		userCtxRepo: userCtxRepo,
 		defaultCfg:  defaultCfg,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 //  Feedback / learning
 
+// ErrInvalidFeedback marks events that can never be applied (unknown event
+// type, missing fields); retrying them is pointless.
+var ErrInvalidFeedback = errors.New("invalid bandit feedback")
+
+// feedbackUpdate is one event resolved into everything needed to learn from it.
+type feedbackUpdate struct {
+	event     domain.BanditEvent // enriched, as persisted to bandit_events
+	cfg       Config
+	pipe      *featurePipeline
+	policy    Policy
+	segment   int
+	variant   int
+	globalKey string
+	userKey   string
+	x         []float64
+	z         []float64
+	reward    float64
+	at        time.Time
+}
+
+// learn folds the update into a state; global marks the global state.
+func (u *feedbackUpdate) learn(st *LinUCBState, global bool) {
+	learnState(u.policy, u.cfg, st, global, u.event.ProductID, u.x, u.z, u.reward, u.at)
+}
+
 func (s *BanditService) LogFeedback(
 	ctx context.Context,
 	event domain.BanditEvent,
@@ -129,14 +240,68 @@ func (s *BanditService) LogFeedback(
 	if err := ctx.Err(); err != nil {
 		return fmt.Errorf("context error: %w", err)
 	}
+
+	u, err := s.prepareFeedback(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	// 4) persist updated states + raw event log
+	if err := s.updateState(ctx, u.globalKey, u.cfg, u.pipe, func(st *LinUCBState) {
+		u.learn(st, true)
+	}); err != nil {
+		return fmt.Errorf("failed to save global bandit state: %w", err)
+	}
+	if err := s.updateState(ctx, u.userKey, u.cfg, u.pipe, func(st *LinUCBState) {
+		u.learn(st, false)
+	}); err != nil {
+		return fmt.Errorf("failed to save user bandit state: %w", err)
+	}
+
+	if err := s.banditRepo.SaveEvent(ctx, u.event); err != nil {
+		return fmt.Errorf("failed to save bandit event: %w", err)
+	}
+
+	countFeedback(u)
+	return nil
+}
+
+// ValidateFeedback checks, without learning from the event, that its type
+// is rewarded by the config the user is served in the slot, so feedback
+// that is only queued is still rejected up front.
+func (s *BanditService) ValidateFeedback(ctx context.Context, event domain.BanditEvent) error {
+	if event.EventType == "" {
+		return fmt.Errorf("%w: event_type is required", ErrInvalidFeedback)
+	}
+	if slices.Contains(builtinEventTypes, event.EventType) {
+		return nil
+	}
+
+	cfg, _, _, _ := s.loadConfigForUser(ctx, event.UserID, event.Slot)
+	if _, err := cfg.RewardForEvent(event); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidFeedback, err)
+	}
+	return nil
+}
+
+// prepareFeedback enriches an event and computes its reward and feature
+// vector. The event's CreatedAt is used as its time, so events applied
+// asynchronously are learned with the context they happened in.
+func (s *BanditService) prepareFeedback(
+	ctx context.Context,
+	event domain.BanditEvent,
+) (*feedbackUpdate, error) {
 	if event.EventType == "" {
-		return fmt.Errorf("event_type is required")
+		return nil, fmt.Errorf("%w: event_type is required", ErrInvalidFeedback)
 	}
 
 	// 1) derive cfg + segment + variant
-	cfg, seg, variant := s.loadConfigForUser(ctx, event.UserID, event.Slot)
+	cfg, seg, variant, assigned := s.loadConfigForUser(ctx, event.UserID, event.Slot)
 
-	now := time.Now()
+	now := event.CreatedAt
+	if now.IsZero() {
+		now = time.Now()
+	}
 
 	// convert event.Context (JSONMap) into plain map[string]any for merging
 	eventCtxMap := map[string]any{}
@@ -168,13 +333,22 @@ func (s *BanditService) LogFeedback(
 	// merged feedback context = base + client-provided context
 	mergedCtx := mergeContext(baseCtx, eventCtxMap)
 
+	// Value has no column of its own; keep it in the context so the
+	// event log can be replayed with the same reward.
+	if event.Value != 0 {
+		mergedCtx["value"] = event.Value
+	}
+
+	// the experiment group, which reports compare; "variant" is what served
+	mergedCtx["assigned_variant"] = assigned
+
 	// write back into event.Context as JSONMap for DB persistence
 	event.Context = datatypes.JSONMap(mergedCtx)
 
 	// 2) compute reward using config-aware business rules
 	reward, err := cfg.RewardForEvent(event)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("%w: %w", ErrInvalidFeedback, err)
 	}
 
 	// keep variant info in event for later analysis
@@ -193,88 +367,122 @@ func (s *BanditService) LogFeedback(
 		"reward", reward,
 	)
 
-	// 3) load global + user states
-	globalKey := stateGlobalKey(event.Slot, seg)
-	userKey := stateUserKey(event.Slot, seg, event.UserID)
+	// 3) feature vector for the global + user states
+	pipe := pipelineFor(cfg)
 
-	globalState, err := s.stateRepo.GetState(ctx, globalKey)
-	if err != nil {
-		return fmt.Errorf("load global state: %w", err)
-	}
-	if globalState == nil {
-		globalState = newDefaultState()
-	}
+	pid := event.ProductID
+	products := productAttributes(ctx, s.productFeatures, pid)
 
-	userState, err := s.stateRepo.GetState(ctx, userKey)
-	if err != nil {
-		return fmt.Errorf("load user state: %w", err)
-	}
-	if userState == nil {
-		userState = newDefaultState()
-	}
+	// feature vector using merged event.Context
+	x := pipe.vector(FeatureInput{
+		UserID:    event.UserID,
+		Slot:      event.Slot,
+		ProductID: pid,
+		Segment:   seg,
+		Now:       now,
+		Ctx:       mergedCtx,
+		Product:   products[pid],
+	})
+
+	// Apply decay then update both arms (+ shared arm / block)
+	policy := policyFor(cfg, variant)
+
+	return &feedbackUpdate{
+		event:     event,
+		cfg:       cfg,
+		pipe:      pipe,
+		policy:    policy,
+		segment:   seg,
+		variant:   variant,
+		globalKey: stateGlobalKey(event.Slot, seg),
+		userKey:   stateUserKey(event.Slot, seg, event.UserID),
+		x:         x,
+		z:         crossFeatures(policy, x, products[pid]),
+		reward:    reward,
+		at:        now,
+	}, nil
+}
 
-	pid := event.ProductID
+// countFeedback increments the Prometheus counter AFTER an event was
+// successfully processed.
+func countFeedback(u *feedbackUpdate) {
+	segLabel := strconv.Itoa(u.segment)
+	varLabel := strconv.Itoa(u.variant)
 
-	// GLOBAL arm
-	gArm, ok := globalState.Arms[pid]
-	if !ok {
-		gArm = newArmState()
-		globalState.Arms[pid] = gArm
-	}
+	BanditFeedbackEventsTotal.
+		WithLabelValues(u.event.Slot, u.event.EventType, segLabel, varLabel).
+		Inc()
+}
 
-	// USER arm
-	uArm, ok := userState.Arms[pid]
-	if !ok {
-		uArm = newArmState()
-		userState.Arms[pid] = uArm
-	}
+// updateState applies mutate to the latest version of a state and saves it
+// with compare-and-swap. When another writer saved the state in between,
+// the state is reloaded and mutate re-applied on top of the winner's, so
+// both updates' A/b contributions are kept.
+func (s *BanditService) updateState(
+	ctx context.Context,
+	key string,
+	cfg Config,
+	pipe *featurePipeline,
+	mutate func(st *LinUCBState),
+) error {
+	for attempt := 0; ; attempt++ {
+		st, err := s.loadState(ctx, key, cfg, pipe)
+		if err != nil {
+			return fmt.Errorf("load state: %w", err)
+		}
 
-	// feature vector using merged event.Context
-	x := buildFeatureVector(event.UserID, event.Slot, event.ProductID, cfg, seg, mergedCtx)
+		mutate(st)
 
-	// Apply decay then update both arms
-	applyDecay(gArm)
-	applyDecay(uArm)
+		err = s.stateRepo.SaveState(ctx, key, st)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, ErrStateConflict) || attempt >= maxStateRetries {
+			return err
+		}
 
-	addOuter(&gArm.A, x)
-	addScaled(&gArm.B, x, reward)
-	gArm.Count++
-	gArm.LastUpdated = time.Now()
+		BanditStateConflictsTotal.Inc()
 
-	addOuter(&uArm.A, x)
-	addScaled(&uArm.B, x, reward)
-	uArm.Count++
-	uArm.LastUpdated = time.Now()
+		// jittered backoff so colliding writers spread out
+		backoff := time.Duration(rand.Intn(stateRetryJitterMs*(attempt+1))+1) * time.Millisecond
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("context error: %w", ctx.Err())
+		case <-time.After(backoff):
+		}
+	}
+}
 
-	maxArms := cfg.MaxArmsPerState
-	capArms(globalState, maxArms)
-	capArms(userState, maxArms)
+//  Recommendation / serving
 
-	// 4) persist updated states + raw event log
-	if err := s.stateRepo.SaveState(ctx, globalKey, globalState); err != nil {
-		return fmt.Errorf("failed to save global bandit state: %w", err)
+// loadState reads a state and migrates it onto the config's feature layout.
+// Missing states start empty.
+func (s *BanditService) loadState(
+	ctx context.Context,
+	key string,
+	cfg Config,
+	pipe *featurePipeline,
+) (*LinUCBState, error) {
+	st, err := s.stateRepo.GetState(ctx, key)
+	if err != nil {
+		return nil, err
 	}
-	if err := s.stateRepo.SaveState(ctx, userKey, userState); err != nil {
-		return fmt.Errorf("failed to save user bandit state: %w", err)
+	if st == nil {
+		return newDefaultState(pipe.dims), nil
 	}
 
-	if err := s.banditRepo.SaveEvent(ctx, event); err != nil {
-		return fmt.Errorf("failed to save bandit event: %w", err)
+	from := len(st.Features)
+	if migrateState(st, cfg.Features, pipe.dims) {
+		logger.Debug("bandit_state_migrated",
+			"key", key,
+			"from_dim", from,
+			"to_dim", len(pipe.dims),
+		)
 	}
-
-	// increment Prometheus counter AFTER we successfully process the event
-	segLabel := strconv.Itoa(seg)
-	varLabel := strconv.Itoa(variant)
-
-	BanditFeedbackEventsTotal.
-		WithLabelValues(event.Slot, event.EventType, segLabel, varLabel).
-		Inc()
-
-	return nil
+	ensureInverses(st)
+	return st, nil
 }
 
-//  Recommendation / serving
-
 // Recommend returns N products for a user & slot using LinUCB
 // on top of offline recommendations from mock_recommendations.
 func (s *BanditService) Recommend(
@@ -292,17 +500,57 @@ func (s *BanditService) Recommend(
 		limit = 10
 	}
 
-	// 1) load offline candidates
-	offlineRows, limit, err := s.loadCandidates(ctx, slot, limit)
+	return s.recommendSlot(ctx, s.loadRequestUser(ctx, userID), slot, limit, reqCtx, nil)
+}
+
+// requestUser is what serving knows about a user, loaded once per request
+// however many slots it fills.
+type requestUser struct {
+	id           uint
+	storedSeg    int
+	hasStoredSeg bool
+	tier         string
+	campaignID   string
+}
+
+func (s *BanditService) loadRequestUser(ctx context.Context, userID uint) requestUser {
+	u := requestUser{id: userID}
+	u.storedSeg, u.hasStoredSeg = s.storedSegment(ctx, userID)
+
+	if s.userCtxRepo != nil {
+		if uc, err := s.userCtxRepo.GetUserContext(ctx, userID); err == nil {
+			u.tier = uc.Tier
+			u.campaignID = uc.CampaignID
+		}
+	}
+	return u
+}
+
+// recommendSlot fills one slot for the user, leaving out the products in
+// exclude, and logs the impression.
+func (s *BanditService) recommendSlot(
+	ctx context.Context,
+	user requestUser,
+	slot string,
+	limit int,
+	reqCtx map[string]any,
+	exclude map[uint64]struct{},
+) ([]domain.BanditRecommendation, error) {
+
+	userID := user.id
+
+	// 1) load offline candidates, with spares for the excluded products
+	offlineRows, candidateLimit, err := s.loadCandidates(ctx, slot, limit+len(exclude))
 	if err != nil {
 		return nil, err
 	}
 	if len(offlineRows) == 0 {
 		return []domain.BanditRecommendation{}, nil
 	}
+	limit = min(limit, candidateLimit)
 
 	// 2) config + segment + variant for this user & slot
-	cfg, seg, variant := s.loadConfigForUser(ctx, userID, slot)
+	cfg, seg, variant, assigned := s.loadSlotConfig(ctx, userID, user.storedSeg, user.hasStoredSeg, slot)
 
 	// build base context (time, dow, segment, variant, platform)
 	now := time.Now()
@@ -314,15 +562,11 @@ func (s *BanditService) Recommend(
 	}
 	baseCtx := buildBaseContext(now, platform, seg, variant)
 
-	if s.userCtxRepo != nil {
-		if uc, err := s.userCtxRepo.GetUserContext(ctx, userID); err == nil {
-			if uc.Tier != "" {
-				baseCtx["user_tier"] = uc.Tier
-			}
-			if uc.CampaignID != "" {
-				baseCtx["campaign_id"] = uc.CampaignID
-			}
-		}
+	if user.tier != "" {
+		baseCtx["user_tier"] = user.tier
+	}
+	if user.campaignID != "" {
+		baseCtx["campaign_id"] = user.campaignID
 	}
 
 	// fullCtx = base + request-provided ctx (page_name, device_type, etc.)
@@ -332,21 +576,17 @@ func (s *BanditService) Recommend(
 	globalKey := stateGlobalKey(slot, seg)
 	userKey := stateUserKey(slot, seg, userID)
 
-	globalState, err := s.stateRepo.GetState(ctx, globalKey)
+	pipe := pipelineFor(cfg)
+
+	globalState, err := s.loadState(ctx, globalKey, cfg, pipe)
 	if err != nil {
 		return nil, fmt.Errorf("load global state: %w", err)
 	}
-	if globalState == nil {
-		globalState = newDefaultState()
-	}
 
-	userState, err := s.stateRepo.GetState(ctx, userKey)
+	userState, err := s.loadState(ctx, userKey, cfg, pipe)
 	if err != nil {
 		return nil, fmt.Errorf("load user state: %w", err)
 	}
-	if userState == nil {
-		userState = newDefaultState()
-	}
 
 	// trace logging
 	tid := TraceIDFromContext(ctx)
@@ -361,50 +601,74 @@ func (s *BanditService) Recommend(
 	)
 
 	// 4) score candidates with global + user state
-	recs := s.scoreCandidates(
+	recs, items := s.scoreCandidates(
 		ctx,
 		userID,
 		slot,
 		offlineRows,
+		exclude,
 		globalState,
 		userState,
 		cfg,
+		pipe,
 		seg,
 		variant,
 		limit,
 		fullCtx,
 	)
 
-	// after scoring, save both states
-	if err := s.stateRepo.SaveState(ctx, globalKey, globalState); err != nil {
-		return nil, fmt.Errorf("save global state: %w", err)
-	}
-	if err := s.stateRepo.SaveState(ctx, userKey, userState); err != nil {
-		return nil, fmt.Errorf("save user state: %w", err)
+	// 5) record what was served, for reward attribution & off-policy analysis
+	if s.impressionRepo != nil {
+		imp := domain.RecommendationImpression{
+			TraceID:         tid,
+			UserID:          userID,
+			Slot:            slot,
+			Segment:         seg,
+			Variant:         variant,
+			AssignedVariant: assigned,
+			ConfigHash:      configHash(cfg),
+			Items:           items,
+		}
+		if err := s.impressionRepo.SaveImpression(ctx, imp); err != nil {
+			logger.Warn("bandit_impression_save_failed",
+				"trace_id", tid,
+				"slot", slot,
+				"error", err,
+			)
+		}
 	}
 
+	// 6) count the impressions towards the slot's frequency cap
+	s.recordExposures(ctx, userID, slot, cfg, recs, now)
+
+	// states were only read: nothing to save
 	return recs, nil
 }
 
 // ---- Scoring ----
 
 // scoreCandidates combines offline score + (global + user) bandit UCB into final scores.
+// It returns the top-N recommendations and the full scored candidate list,
+// with slate positions and the serving policy's propensity for each item.
+// Products in exclude are never candidates.
 func (s *BanditService) scoreCandidates(
 	ctx context.Context,
 	userID uint,
 	slot string,
 	offlineRows []domain.MockRecommendation,
+	exclude map[uint64]struct{},
 	globalState *LinUCBState,
 	userState *LinUCBState,
 	cfg Config,
+	pipe *featurePipeline,
 	segment int,
 	variant int,
 	limit int,
 	ctxMap map[string]any,
-) []domain.BanditRecommendation {
+) ([]domain.BanditRecommendation, []domain.ImpressionItem) {
 
 	if len(offlineRows) == 0 || limit <= 0 {
-		return []domain.BanditRecommendation{}
+		return []domain.BanditRecommendation{}, []domain.ImpressionItem{}
 	}
 	if limit > len(offlineRows) {
 		limit = len(offlineRows)
@@ -421,116 +685,138 @@ func (s *BanditService) scoreCandidates(
 		maxScore = 1
 	}
 
-	type scored struct {
-		prodID uint64
-		score  float64
-	}
-
-	scoredList := make([]scored, 0, len(offlineRows))
+	// merchandising rules: pinned products join the candidates
+	now := time.Now()
+	merch := s.merchandiser.plan(ctx, slot, segment, stringFromContext(ctxMap, "campaign_id"), now)
+	offlineRows = merch.withPinned(offlineRows)
+	fatigue := s.loadFatigue(ctx, userID, slot, cfg, now)
 
-	wGlobal := cfg.WGlobal
-	wUser := cfg.WUser
-	if wGlobal == 0 && wUser == 0 {
-		wGlobal = 0.7
-		wUser = 0.3
+	ids := make([]uint64, len(offlineRows))
+	for i, row := range offlineRows {
+		ids[i] = row.ProductID
 	}
+	products := productAttributes(ctx, s.productFeatures, ids...)
+	eligible := filterEligible(ctx, s.eligChecker, userID, slot, ids)
+
+	policy := policyFor(cfg, variant)
+	states := newScoringStates(policy, cfg, globalState, userState)
+	cands := make([]preparedArm, 0, len(offlineRows))
+	blocked, capped := 0, 0
 
 	for _, row := range offlineRows {
 		pid := row.ProductID
 
-		// eligibility filter (stock, hub, etc.)
-		if s.eligChecker != nil {
-			ok, err := s.eligChecker.IsEligible(ctx, userID, pid, slot)
-			if err != nil || !ok {
-				continue
-			}
+		// eligibility filter (stock, visibility, user exclusions)
+		if !eligible[pid] {
+			continue
 		}
-
-		// GLOBAL arm (read-only for scoring)
-		gArm, ok := globalState.Arms[pid]
-		if !ok {
-			gArm = newArmState()
+		// already shown by another slot of the page
+		if _, ok := exclude[pid]; ok {
+			continue
 		}
-
-		// USER arm (read-only for scoring)
-		uArm, ok := userState.Arms[pid]
-		if !ok {
-			uArm = newArmState()
+		// dismissed in this slot lately
+		if fatigue.isDismissed(pid) {
+			continue
 		}
-
-		// feature vector for this impression
-		x := buildFeatureVector(userID, slot, pid, cfg, segment, ctxMap)
-
-		// global A^-1 / theta
-		gAInv, err := invert4x4(gArm.A)
-		if err != nil {
-			gArm = newArmState()
-			gAInv, _ = invert4x4(gArm.A)
+		if _, ok := merch.blocked(pid, products[pid]); ok {
+			blocked++
+			continue
 		}
-		gTheta := matVecMul(gAInv, gArm.B)
-
-		// user A^-1 / theta
-		uAInv, err := invert4x4(uArm.A)
-		if err != nil {
-			uArm = newArmState()
-			uAInv, _ = invert4x4(uArm.A)
-		}
-		uTheta := matVecMul(uAInv, uArm.B)
-
-		offlineNorm := row.Score / maxScore
-
-		var gBandit, uBandit float64
-
-		switch variant {
-		case VariantOfflineOnly:
-			// pure offline; no bandit contribution
-			gBandit = 0.0
-			uBandit = 0.0
-		case VariantThompson:
-			gBandit = thompsonScore(gTheta, x, gAInv)
-			uBandit = thompsonScore(uTheta, x, uAInv)
-		case VariantUCB:
-			fallthrough
-		default:
-			gBandit = ucbScore(gTheta, x, gAInv, cfg.Alpha)
-			uBandit = ucbScore(uTheta, x, uAInv, cfg.Alpha)
+		// shown to the user too often lately
+		if fatigue.capped(pid) {
+			capped++
+			continue
 		}
+		cands = append(cands, preparedArm{
+			productID:   pid,
+			product:     products[pid],
+			offlineNorm: row.Score / maxScore,
+		})
+	}
 
-		banditScore := wGlobal*gBandit + wUser*uBandit
-		final := cfg.WBandit*banditScore + cfg.WOffline*offlineNorm
+	// top-N by final score, penalised for repeated impressions, adjusted by
+	// merchandising rules and re-ranked by the slot's diversity steps
+	rerankers := fatigue.rerankers(merch.rerankers(rerankersFor(cfg)))
+	if capped > 0 {
+		BanditFatigueCappedTotal.WithLabelValues(slot).Add(float64(capped))
+	}
 
-		// optional: exploration noise only for bandit variants
-		if variant != VariantOfflineOnly && cfg.ExploreNoise > 0 {
-			final += cfg.ExploreNoise * rand.Float64()
-		}
+	scoreCtx, cancel := s.scoring.withDeadline(ctx)
+	defer cancel()
 
-		scoredList = append(scoredList, scored{
-			prodID: pid,
-			score:  final,
+	arms, err := s.scoring.prepareArms(scoreCtx, cands, func(c preparedArm) preparedArm {
+		// feature vector for this impression
+		x := pipe.vector(FeatureInput{
+			UserID:    userID,
+			Slot:      slot,
+			ProductID: c.productID,
+			Segment:   segment,
+			Ctx:       ctxMap,
+			Product:   c.product,
 		})
-	}
 
-	// sort top-N by final score (simple selection)
-	if len(scoredList) < limit {
-		limit = len(scoredList)
-	}
-	for i := 0; i < limit; i++ {
-		maxIdx := i
-		for j := i + 1; j < len(scoredList); j++ {
-			if scoredList[j].score > scoredList[maxIdx].score {
-				maxIdx = j
-			}
+		z := crossFeatures(policy, x, c.product)
+
+		// GLOBAL + USER arms (read-only for scoring)
+		return states.prepare(c.productID, c.product, x, z, c.offlineNorm)
+	})
+
+	var scores, propensity []float64
+	var top []int
+	if err == nil {
+		scores = scoreArms(policy, cfg, arms)
+		// the deadline is checked up to ranking only: once ranking starts
+		// its slate is served, even if the deadline passes meanwhile
+		err = scoreCtx.Err()
+	}
+	if err == nil {
+		top = rankSlateObserved(arms, scores, limit, rerankers, rerankCost(slot, scores, limit))
+		propensity = slateInclusion(arms, cfg, policy, rerankers, len(top), top)
+	} else {
+		// out of time: serve the candidates by offline score, which is
+		// deterministic, rather than fail the request
+		logger.Warn("bandit_scoring_degraded",
+			"trace_id", TraceIDFromContext(ctx),
+			"slot", slot,
+			"candidates", len(cands),
+			"error", err,
+		)
+		BanditScoringDegradedTotal.WithLabelValues(slot).Inc()
+
+		arms, scores = cands, offlineScores(cands)
+		top = rankSlate(arms, scores, limit, rerankers)
+		propensity = make([]float64, len(arms))
+		for _, i := range top {
+			propensity[i] = 1
 		}
-		scoredList[i], scoredList[maxIdx] = scoredList[maxIdx], scoredList[i]
 	}
 
-	out := make([]domain.BanditRecommendation, 0, limit)
-	for i := 0; i < limit; i++ {
+	position := make(map[int]int, len(top))
+	served := make([]preparedArm, 0, len(top))
+	out := make([]domain.BanditRecommendation, 0, len(top))
+	for pos, i := range top {
+		position[i] = pos
+		served = append(served, arms[i])
 		out = append(out, domain.BanditRecommendation{
-			ProductID: scoredList[i].prodID,
-			Score:     scoredList[i].score,
+			ProductID: arms[i].productID,
+			Score:     scores[i],
 		})
 	}
+	merch.count(served, blocked)
 
-	return out
+	items := make([]domain.ImpressionItem, 0, len(arms))
+	for i, a := range arms {
+		pos, shown := position[i]
+		if !shown {
+			pos = -1
+		}
+		items = append(items, domain.ImpressionItem{
+			ProductID:  a.productID,
+			Position:   pos,
+			Score:      scores[i],
+			Propensity: propensity[i],
+		})
+	}
+
+	return out, items
 }
@@ -2,6 +2,9 @@ package bandit
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"myGreenMarket/domain"
 )
 
@@ -28,14 +31,27 @@ type Config struct {
 	RewardClick      float64
 	RewardATC        float64
 	RewardOrder      float64
+	RewardDismiss    float64
+
+	// per-event reward rules; event types without one use the flat
+	// rewards above
+	RewardModel domain.BanditRewardModel
 
 	Features FeatureFlags
-}
 
-type VariantConfig struct {
-	PctOfflineOnly int
-	PctUCB         int
-	PctThompson    int
+	// ordered feature extractor names; empty means the legacy layout
+	// derived from Features
+	FeatureList []string
+
+	// scoring policy by registered name; empty means the variant's default
+	Policy       string
+	PolicyParams map[string]float64
+
+	// re-ranking steps applied to the scored candidates, in order
+	Rerank []domain.BanditRerankStep
+
+	// per-user frequency cap / impression penalty; zero disables
+	Fatigue domain.BanditFatigue
 }
 
 const (
@@ -50,6 +66,7 @@ const (
 	defaultRewardClick      = 1.0
 	defaultRewardATC        = 3.0
 	defaultRewardOrder      = 5.0
+	defaultRewardDismiss    = -1.0
 	defaultNumSegments      = 3
 	defaultNumVariants      = 3
 	defaultMaxArmsPerState  = 300
@@ -73,6 +90,7 @@ func DefaultConfig() Config {
 		RewardClick:      defaultRewardClick,
 		RewardATC:        defaultRewardATC,
 		RewardOrder:      defaultRewardOrder,
+		RewardDismiss:    defaultRewardDismiss,
 
 		Features: FeatureFlags{
 			UseBias:        true,
@@ -86,6 +104,16 @@ func DefaultConfig() Config {
 	}
 }
 
+// configHash identifies the effective config that served a request.
+func configHash(cfg Config) string {
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:8])
+}
+
 // read per-slot/per-variant bandit config from DB.
 type ConfigRepository interface {
 	GetConfig(ctx context.Context, slot string, variant int) (domain.BanditConfig, bool, error)
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"hash/fnv"
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
 )
 
 // main entry point used by Recommend / LogFeedback / DebugRecommend
@@ -11,20 +13,41 @@ func (s *BanditService) loadConfigForUser(
 	ctx context.Context,
 	userID uint,
 	slot string,
-) (Config, int, int) {
+) (Config, int, int, int) {
+	stored, ok := s.storedSegment(ctx, userID)
+	return s.loadSlotConfig(ctx, userID, stored, ok, slot)
+}
+
+// loadSlotConfig resolves the config, segment, served variant and assigned
+// variant of a slot for a user whose stored segment was already looked up.
+// The two variants differ only while the assigned one is paused.
+func (s *BanditService) loadSlotConfig(
+	ctx context.Context,
+	userID uint,
+	storedSeg int,
+	hasStoredSeg bool,
+	slot string,
+) (Config, int, int, int) {
 	// 1) base config for slot, variant 0
 	baseCfg := s.loadConfig(ctx, slot, 0)
 
 	// 2) stable variant assignment per (user, slot)
-	variant := s.assignVariant(userID, slot, baseCfg)
+	variant, assigned := s.variantFor(ctx, userID, slot, baseCfg)
 
 	// 3) load variant-specific config (override base)
 	cfg := s.loadConfig(ctx, slot, variant)
+	if variant != assigned {
+		// a paused variant's users get the offline ranking, whatever
+		// config is stored for the fallback variant
+		cfg.Policy = PolicyOffline
+		cfg.PolicyParams = nil
+		cfg.ExploreNoise = 0
+	}
 
-	// 4) derive segment (from repo or hash)
-	seg := s.userSegment(ctx, userID, cfg)
+	// 4) derive segment (stored or hash)
+	seg := segmentFor(userID, storedSeg, hasStoredSeg, cfg)
 
-	return cfg, seg, variant
+	return cfg, seg, variant, assigned
 }
 
 // read config for a given (slot, variant) from repo, falling back to defaultCfg
@@ -42,8 +65,13 @@ func (s *BanditService) loadConfig(
 		return s.defaultCfg
 	}
 
+	return configFromDomain(s.defaultCfg, dbCfg)
+}
+
+// configFromDomain overlays a stored BanditConfig on top of base.
+func configFromDomain(base Config, dbCfg domain.BanditConfig) Config {
 	// start from defaults to keep sane fallbacks for any missing fields
-	cfg := s.defaultCfg
+	cfg := base
 
 	// copy fields from DB config
 	cfg.NumSegments = dbCfg.NumSegments
@@ -60,6 +88,8 @@ func (s *BanditService) loadConfig(
 	cfg.RewardClick = dbCfg.RewardClick
 	cfg.RewardATC = dbCfg.RewardATC
 	cfg.RewardOrder = dbCfg.RewardOrder
+	cfg.RewardDismiss = dbCfg.RewardDismiss
+	cfg.RewardModel = dbCfg.RewardModel
 
 	// feature flags
 	cfg.Features = FeatureFlags{
@@ -70,20 +100,42 @@ func (s *BanditService) loadConfig(
 		UseSegment:     dbCfg.Features.UseSegment,
 		UseProductHash: dbCfg.Features.UseProductHash,
 		UseUserHash:    dbCfg.Features.UseUserHash,
+		UseSharedArm:   dbCfg.Features.UseSharedArm,
 	}
 
+	cfg.FeatureList = dbCfg.FeatureList
+	cfg.Policy = dbCfg.Policy
+	cfg.PolicyParams = dbCfg.PolicyParams
+	cfg.Rerank = dbCfg.Rerank
+	cfg.Fatigue = dbCfg.Fatigue
+
 	return cfg
 }
 
 // userSegment either uses a stored segment or hashes userID into [0, NumSegments)
 func (s *BanditService) userSegment(ctx context.Context, userID uint, cfg Config) int {
-	if s.segmentRepo != nil {
-		if seg, ok, err := s.segmentRepo.GetSegment(ctx, userID); err == nil && ok {
-			if cfg.NumSegments > 0 {
-				return seg % cfg.NumSegments
-			}
-			return seg
+	stored, ok := s.storedSegment(ctx, userID)
+	return segmentFor(userID, stored, ok, cfg)
+}
+
+// storedSegment reads the user's segment from the segment repository.
+func (s *BanditService) storedSegment(ctx context.Context, userID uint) (int, bool) {
+	if s.segmentRepo == nil {
+		return 0, false
+	}
+	seg, ok, err := s.segmentRepo.GetSegment(ctx, userID)
+	if err != nil || !ok {
+		return 0, false
+	}
+	return seg, true
+}
+
+func segmentFor(userID uint, stored int, hasStored bool, cfg Config) int {
+	if hasStored {
+		if cfg.NumSegments > 0 {
+			return stored % cfg.NumSegments
 		}
+		return stored
 	}
 
 	if cfg.NumSegments <= 0 {
@@ -93,6 +145,37 @@ func (s *BanditService) userSegment(ctx context.Context, userID uint, cfg Config
 	return int(userID % uint(cfg.NumSegments))
 }
 
+// variantFor asks the slot's experiment for the user's variant, falling
+// back to hashing when the slot has none or the lookup fails. It returns
+// the variant to serve and the assigned one: variants paused by the
+// guardrail monitor are rerouted, but their users stay assigned to them so
+// reports keep comparing the groups the experiment split.
+func (s *BanditService) variantFor(ctx context.Context, userID uint, slot string, cfg Config) (int, int) {
+	assigned := s.assignedVariant(ctx, userID, slot, cfg)
+	if s.guardrails != nil {
+		return s.guardrails.Route(slot, assigned), assigned
+	}
+	return assigned, assigned
+}
+
+func (s *BanditService) assignedVariant(ctx context.Context, userID uint, slot string, cfg Config) int {
+	if s.allocator != nil {
+		variant, ok, err := s.allocator.Assign(ctx, userID, slot)
+		if err != nil {
+			logger.Warn("bandit_experiment_assign_failed",
+				"trace_id", TraceIDFromContext(ctx),
+				"user_id", userID,
+				"slot", slot,
+				"error", err,
+			)
+		}
+		if ok {
+			return variant
+		}
+	}
+	return s.assignVariant(userID, slot, cfg)
+}
+
 // assignVariant hashes (user, slot) into [0, NumVariants)
 func (s *BanditService) assignVariant(userID uint, slot string, cfg Config) int {
 	if cfg.NumVariants <= 1 {
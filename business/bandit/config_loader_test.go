@@ -0,0 +1,52 @@
+//go:build !integration
+
+package bandit
+
+import (
+	"context"
+	"testing"
+
+	"myGreenMarket/domain"
+)
+
+// memConfigs serves stored configs by variant.
+type memConfigs map[int]domain.BanditConfig
+
+func (r memConfigs) GetConfig(_ context.Context, _ string, variant int) (domain.BanditConfig, bool, error) {
+	cfg, ok := r[variant]
+	return cfg, ok, nil
+}
+
+func (r memConfigs) UpsertConfig(context.Context, domain.BanditConfig) error { return nil }
+
+// Users of a paused variant are served the offline ranking without noise,
+// even when the fallback variant's stored config explores.
+func TestLoadSlotConfig_PausedVariantServesOffline(t *testing.T) {
+	exploring := domain.BanditConfig{Slot: "home_top", NumVariants: 3, Policy: PolicyLinUCB, ExploreNoise: 0.2}
+	s := &BanditService{
+		defaultCfg: DefaultConfig(),
+		cfgRepo:    memConfigs{VariantUCB: exploring, VariantOfflineOnly: exploring, VariantThompson: exploring},
+		guardrails: &GuardrailMonitor{active: map[string]map[int]domain.BanditVariantOverride{}},
+	}
+
+	// find a user hashed into the UCB variant
+	var user uint
+	for ; s.assignVariant(user, "home_top", configFromDomain(s.defaultCfg, exploring)) != VariantUCB; user++ {
+	}
+
+	cfg, _, served, assigned := s.loadSlotConfig(context.Background(), user, 0, false, "home_top")
+	if served != VariantUCB || cfg.Policy != PolicyLinUCB || cfg.ExploreNoise != 0.2 {
+		t.Fatalf("unpaused: served %d with %s/%v, want ucb with its stored config", served, cfg.Policy, cfg.ExploreNoise)
+	}
+
+	s.guardrails.active["home_top"] = map[int]domain.BanditVariantOverride{
+		VariantUCB: {Slot: "home_top", Variant: VariantUCB, RouteTo: VariantOfflineOnly},
+	}
+	cfg, _, served, assigned = s.loadSlotConfig(context.Background(), user, 0, false, "home_top")
+	if served != VariantOfflineOnly || assigned != VariantUCB {
+		t.Fatalf("paused: served %d assigned %d, want offline-only and ucb", served, assigned)
+	}
+	if cfg.Policy != PolicyOffline || cfg.ExploreNoise != 0 {
+		t.Errorf("paused: policy %s noise %v, want offline without noise", cfg.Policy, cfg.ExploreNoise)
+	}
+}
@@ -2,7 +2,6 @@ package bandit
 
 import (
 	"context"
-	"math/rand"
 	"time"
 
 	"myGreenMarket/domain"
@@ -34,7 +33,7 @@ func (s *BanditService) DebugRecommend(
 	}
 
 	// 2) config + segment + variant for this user & slot
-	cfg, seg, variant := s.loadConfigForUser(ctx, userID, slot) // :contentReference[oaicite:1]{index=1}
+	cfg, seg, variant, _ := s.loadConfigForUser(ctx, userID, slot) // :contentReference[oaicite:1]{index=1}
 
 	// 3) build base context (time, dow, segment, variant, platform)
 	now := time.Now()
@@ -65,21 +64,17 @@ func (s *BanditService) DebugRecommend(
 	globalKey := stateGlobalKey(slot, seg)
 	userKey := stateUserKey(slot, seg, userID)
 
-	globalState, err := s.stateRepo.GetState(ctx, globalKey)
+	pipe := pipelineFor(cfg)
+
+	globalState, err := s.loadState(ctx, globalKey, cfg, pipe)
 	if err != nil {
 		return nil, err
 	}
-	if globalState == nil {
-		globalState = newDefaultState()
-	}
 
-	userState, err := s.stateRepo.GetState(ctx, userKey)
+	userState, err := s.loadState(ctx, userKey, cfg, pipe)
 	if err != nil {
 		return nil, err
 	}
-	if userState == nil {
-		userState = newDefaultState()
-	}
 
 	// 5) normalize offline score
 	maxScore := 0.0
@@ -92,124 +87,145 @@ func (s *BanditService) DebugRecommend(
 		maxScore = 1
 	}
 
-	wGlobal := cfg.WGlobal
-	wUser := cfg.WUser
-	if wGlobal == 0 && wUser == 0 {
-		wGlobal = 0.7
-		wUser = 0.3
-	}
+	policy := policyFor(cfg, variant)
+	wGlobal, wUser := blendWeights(cfg)
+
+	merch := s.merchandiser.plan(ctx, slot, seg, stringFromContext(fullCtx, "campaign_id"), now)
+	offlineRows = merch.withPinned(offlineRows)
+	fatigue := s.loadFatigue(ctx, userID, slot, cfg, now)
 
-	type scored struct {
-		rec   domain.DebugRecommendation
-		score float64
+	ids := make([]uint64, len(offlineRows))
+	for i, row := range offlineRows {
+		ids[i] = row.ProductID
 	}
+	products := productAttributes(ctx, s.productFeatures, ids...)
+	eligible := filterEligible(ctx, s.eligChecker, userID, slot, ids)
 
-	scoredList := make([]scored, 0, len(offlineRows))
+	states := newScoringStates(policy, cfg, globalState, userState)
+	arms := make([]preparedArm, 0, len(offlineRows))
+	offline := make([]float64, 0, len(offlineRows))
+	blocked := make([]domain.DebugRecommendation, 0)
 
 	for _, row := range offlineRows {
 		pid := row.ProductID
 
-		// eligibility filter (stock, hub, etc.) :contentReference[oaicite:4]{index=4}
-		if s.eligChecker != nil {
-			ok, err := s.eligChecker.IsEligible(ctx, userID, pid, slot)
-			if err != nil || !ok {
-				continue
-			}
+		// eligibility filter (stock, visibility, user exclusions)
+		if !eligible[pid] || fatigue.isDismissed(pid) {
+			continue
 		}
-
-		// GLOBAL arm
-		gArm, ok := globalState.Arms[pid]
-		if !ok {
-			gArm = newArmState()
+		if _, ok := merch.blocked(pid, products[pid]); ok {
+			blocked = append(blocked, domain.DebugRecommendation{
+				ProductID:        pid,
+				OfflineScore:     row.Score,
+				RankBeforeRerank: -1,
+				RankAfterRerank:  -1,
+				Segment:          seg,
+				Variant:          variant,
+				Policy:           policy.Name(),
+				MerchRules:       merch.fired(pid, products[pid]),
+			})
+			continue
 		}
-
-		// USER arm
-		uArm, ok := userState.Arms[pid]
-		if !ok {
-			uArm = newArmState()
+		if fatigue.capped(pid) {
+			blocked = append(blocked, domain.DebugRecommendation{
+				ProductID:        pid,
+				OfflineScore:     row.Score,
+				RankBeforeRerank: -1,
+				RankAfterRerank:  -1,
+				Segment:          seg,
+				Variant:          variant,
+				Policy:           policy.Name(),
+				Exposures:        fatigue.count(pid),
+			})
+			continue
 		}
 
 		// feature vector for this impression
-		x := buildFeatureVector(userID, slot, pid, cfg, seg, fullCtx)
+		x := pipe.vector(FeatureInput{
+			UserID:    userID,
+			Slot:      slot,
+			ProductID: pid,
+			Segment:   seg,
+			Now:       now,
+			Ctx:       fullCtx,
+			Product:   products[pid],
+		})
 
-		// copy fixed array into slice for JSON
-		fv := make([]float64, len(x))
-		copy(fv, x[:])
+		z := crossFeatures(policy, x, products[pid])
 
-		// global stats
-		gAInv, err := invert4x4(gArm.A)
-		if err != nil {
-			gArm = newArmState()
-			gAInv, _ = invert4x4(gArm.A)
-		}
-		gTheta := matVecMul(gAInv, gArm.B)
+		// GLOBAL + USER arms
+		arms = append(arms, states.prepare(pid, products[pid], x, z, row.Score/maxScore))
+		offline = append(offline, row.Score)
+	}
 
-		// user stats
-		uAInv, err := invert4x4(uArm.A)
-		if err != nil {
-			uArm = newArmState()
-			uAInv, _ = invert4x4(uArm.A)
-		}
-		uTheta := matVecMul(uAInv, uArm.B)
-
-		offlineNorm := row.Score / maxScore
-
-		var gBandit, uBandit float64
-
-		switch variant {
-		case VariantOfflineOnly:
-			gBandit = 0.0
-			uBandit = 0.0
-		case VariantThompson:
-			gBandit = thompsonScore(gTheta, x, gAInv)
-			uBandit = thompsonScore(uTheta, x, uAInv)
-		case VariantUCB:
-			fallthrough
-		default:
-			gBandit = ucbScore(gTheta, x, gAInv, cfg.Alpha)
-			uBandit = ucbScore(uTheta, x, uAInv, cfg.Alpha)
-		}
+	scores := scoreArms(policy, cfg, arms)
 
-		banditScore := wGlobal*gBandit + wUser*uBandit
-		final := cfg.WBandit*banditScore + cfg.WOffline*offlineNorm
+	// 6) top-N by score, then fatigue, merchandising rules & re-ranking (same as scoreCandidates)
+	if len(arms) < limit {
+		limit = len(arms)
+	}
+	before := topKIndices(scores, limit)
+	after := rankSlate(arms, scores, limit, fatigue.rerankers(merch.rerankers(rerankersFor(cfg))))
 
-		if variant != VariantOfflineOnly && cfg.ExploreNoise > 0 {
-			final += cfg.ExploreNoise * rand.Float64()
+	rankBefore := make(map[int]int, len(before))
+	for pos, i := range before {
+		rankBefore[i] = pos
+	}
+	rankAfter := make(map[int]int, len(after))
+	for pos, i := range after {
+		rankAfter[i] = pos
+	}
+	rank := func(ranks map[int]int, i int) int {
+		if pos, ok := ranks[i]; ok {
+			return pos
 		}
+		return -1
+	}
 
-		rec := domain.DebugRecommendation{
-			ProductID:  pid,
-			FinalScore: final,
-			Segment:    seg,
-			Variant:    variant,
-			Context:    fullCtx,
-			Features:   fv,
+	debugRec := func(i int) domain.DebugRecommendation {
+		a := arms[i]
+		unc := wGlobal*uncertainty(a.global) + wUser*uncertainty(a.user)
+		mean := a.mean(cfg)
+		var price float64
+		if a.product != nil {
+			price = a.product.SalePrice
 		}
 
-		scoredList = append(scoredList, scored{
-			rec:   rec,
-			score: final,
-		})
+		return domain.DebugRecommendation{
+			ProductID:         a.productID,
+			OfflineScore:      offline[i],
+			OfflineNormalized: a.offlineNorm,
+			BanditMean:        mean,
+			BanditUncertainty: unc,
+			BanditUCB:         mean + cfg.Alpha*unc,
+			FinalScore:        scores[i],
+			RankBeforeRerank:  rank(rankBefore, i),
+			RankAfterRerank:   rank(rankAfter, i),
+			Segment:           seg,
+			Variant:           variant,
+			Context:           fullCtx,
+			Features:          a.global.X,
+			Policy:            policy.Name(),
+			GlobalExplain:     policy.Explain(a.global),
+			UserExplain:       policy.Explain(a.user),
+			MerchRules:        merch.fired(a.productID, a.product),
+			Exposures:         fatigue.count(a.productID),
+			Rewards:           cfg.RewardTable(price),
+		}
 	}
 
-	// 6) sort top-N by score (simple selection, same as scoreCandidates) :contentReference[oaicite:5]{index=5}
-	if len(scoredList) < limit {
-		limit = len(scoredList)
+	// the served slate, then the products re-ranking pushed out of it and
+	// the products merchandising rules blocked or the frequency cap left out
+	out := make([]domain.DebugRecommendation, 0, len(after)+len(before)+len(blocked))
+	for _, i := range after {
+		out = append(out, debugRec(i))
 	}
-	for i := 0; i < limit; i++ {
-		maxIdx := i
-		for j := i + 1; j < len(scoredList); j++ {
-			if scoredList[j].score > scoredList[maxIdx].score {
-				maxIdx = j
-			}
+	for _, i := range before {
+		if _, kept := rankAfter[i]; !kept {
+			out = append(out, debugRec(i))
 		}
-		scoredList[i], scoredList[maxIdx] = scoredList[maxIdx], scoredList[i]
-	}
-
-	out := make([]domain.DebugRecommendation, 0, limit)
-	for i := 0; i < limit; i++ {
-		out = append(out, scoredList[i].rec)
 	}
+	out = append(out, blocked...)
 
 	return out, nil
 }
@@ -1,11 +1,28 @@
 package bandit
 
-import "context"
+import (
+	"context"
+	"sync"
+	"time"
+
+	"myGreenMarket/pkg/logger"
+)
+
+const (
+	defaultEligibilityCacheTTL = 30 * time.Second
+
+	// user exclusion entries are swept once the cache holds this many users
+	eligibilityUserSweepSize = 10000
+)
 
 // EligibilityChecker decides if a given product is allowed to be recommended
 // for a user in a given slot (stock, visibility, location)
 type EligibilityChecker interface {
 	IsEligible(ctx context.Context, userID uint, productID uint64, slot string) (bool, error)
+
+	// FilterEligible returns the eligible products among productIDs, in
+	// their original order. Scoring calls it once per request.
+	FilterEligible(ctx context.Context, userID uint, slot string, productIDs []uint64) ([]uint64, error)
 }
 
 // NoopEligibilityChecker is the default implementation that allows everything.
@@ -14,3 +31,207 @@ type NoopEligibilityChecker struct{}
 func (NoopEligibilityChecker) IsEligible(ctx context.Context, userID uint, productID uint64, slot string) (bool, error) {
 	return true, nil
 }
+
+func (NoopEligibilityChecker) FilterEligible(ctx context.Context, userID uint, slot string, productIDs []uint64) ([]uint64, error) {
+	return productIDs, nil
+}
+
+// EligibilityRepository reads what makes a product unavailable.
+type EligibilityRepository interface {
+	// AvailableProducts returns the products among ids that are in stock,
+	// not deleted, not hidden and not in a hidden category.
+	AvailableProducts(ctx context.Context, ids []uint64) ([]uint64, error)
+
+	// UserExclusions returns the products a user paid for since
+	// purchasedSince.
+	UserExclusions(ctx context.Context, userID uint, purchasedSince time.Time) ([]uint64, error)
+}
+
+type EligibilityConfig struct {
+	CacheTTL time.Duration
+
+	// products bought within PurchaseLookback are not recommended again;
+	// 0 keeps purchased products eligible. Dismissed products are left out
+	// per slot by the slot's fatigue dismiss_seconds, not here.
+	PurchaseLookback time.Duration
+}
+
+// CatalogEligibilityChecker is the production EligibilityChecker. Catalogue
+// availability and per-user exclusions are each loaded in one query per
+// request and cached for a short TTL, so stock changes are picked up
+// within CacheTTL.
+type CatalogEligibilityChecker struct {
+	repo EligibilityRepository
+	cfg  EligibilityConfig
+
+	mu       sync.RWMutex
+	products map[uint64]cachedEligibility
+	users    map[uint]cachedExclusions
+}
+
+type cachedEligibility struct {
+	available bool
+	expires   time.Time
+}
+
+type cachedExclusions struct {
+	products map[uint64]struct{}
+	expires  time.Time
+}
+
+var _ EligibilityChecker = (*CatalogEligibilityChecker)(nil)
+
+func NewCatalogEligibilityChecker(repo EligibilityRepository, cfg EligibilityConfig) *CatalogEligibilityChecker {
+	if cfg.CacheTTL <= 0 {
+		cfg.CacheTTL = defaultEligibilityCacheTTL
+	}
+	return &CatalogEligibilityChecker{
+		repo:     repo,
+		cfg:      cfg,
+		products: make(map[uint64]cachedEligibility),
+		users:    make(map[uint]cachedExclusions),
+	}
+}
+
+func (c *CatalogEligibilityChecker) IsEligible(ctx context.Context, userID uint, productID uint64, slot string) (bool, error) {
+	ok, err := c.FilterEligible(ctx, userID, slot, []uint64{productID})
+	if err != nil {
+		return false, err
+	}
+	return len(ok) == 1, nil
+}
+
+func (c *CatalogEligibilityChecker) FilterEligible(ctx context.Context, userID uint, slot string, productIDs []uint64) ([]uint64, error) {
+	if len(productIDs) == 0 {
+		return nil, nil
+	}
+
+	available, err := c.available(ctx, productIDs)
+	if err != nil {
+		return nil, err
+	}
+	excluded, err := c.exclusions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]uint64, 0, len(productIDs))
+	for _, id := range productIDs {
+		if !available[id] {
+			continue
+		}
+		if _, ok := excluded[id]; ok {
+			continue
+		}
+		out = append(out, id)
+	}
+	return out, nil
+}
+
+// available reports the catalogue availability of ids, loading expired or
+// missing entries in one query. Products missing from the catalogue are
+// unavailable.
+func (c *CatalogEligibilityChecker) available(ctx context.Context, ids []uint64) (map[uint64]bool, error) {
+	now := time.Now()
+	out := make(map[uint64]bool, len(ids))
+	missing := make([]uint64, 0)
+
+	c.mu.RLock()
+	for _, id := range ids {
+		e, ok := c.products[id]
+		if ok && now.Before(e.expires) {
+			out[id] = e.available
+			continue
+		}
+		missing = append(missing, id)
+	}
+	c.mu.RUnlock()
+
+	if len(missing) == 0 {
+		return out, nil
+	}
+
+	rows, err := c.repo.AvailableProducts(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	loaded := make(map[uint64]bool, len(rows))
+	for _, id := range rows {
+		loaded[id] = true
+	}
+
+	expires := now.Add(c.cfg.CacheTTL)
+	c.mu.Lock()
+	for _, id := range missing {
+		c.products[id] = cachedEligibility{available: loaded[id], expires: expires}
+		out[id] = loaded[id]
+	}
+	c.mu.Unlock()
+
+	return out, nil
+}
+
+// exclusions returns the products a user must not be shown.
+func (c *CatalogEligibilityChecker) exclusions(ctx context.Context, userID uint) (map[uint64]struct{}, error) {
+	if userID == 0 || c.cfg.PurchaseLookback <= 0 {
+		return nil, nil
+	}
+
+	now := time.Now()
+	c.mu.RLock()
+	e, ok := c.users[userID]
+	c.mu.RUnlock()
+	if ok && now.Before(e.expires) {
+		return e.products, nil
+	}
+
+	ids, err := c.repo.UserExclusions(ctx, userID, now.Add(-c.cfg.PurchaseLookback))
+	if err != nil {
+		return nil, err
+	}
+	products := make(map[uint64]struct{}, len(ids))
+	for _, id := range ids {
+		products[id] = struct{}{}
+	}
+
+	c.mu.Lock()
+	if len(c.users) >= eligibilityUserSweepSize {
+		for id, u := range c.users {
+			if !now.Before(u.expires) {
+				delete(c.users, id)
+			}
+		}
+	}
+	c.users[userID] = cachedExclusions{products: products, expires: now.Add(c.cfg.CacheTTL)}
+	c.mu.Unlock()
+
+	return products, nil
+}
+
+// filterEligible applies the checker to the offline candidates in one
+// call. A failed check keeps every candidate: an unavailable catalogue must
+// not empty the slate.
+func filterEligible(ctx context.Context, checker EligibilityChecker, userID uint, slot string, ids []uint64) map[uint64]bool {
+	out := make(map[uint64]bool, len(ids))
+	if checker == nil {
+		for _, id := range ids {
+			out[id] = true
+		}
+		return out
+	}
+
+	eligible, err := checker.FilterEligible(ctx, userID, slot, ids)
+	if err != nil {
+		logger.Warn("bandit_eligibility_failed",
+			"trace_id", TraceIDFromContext(ctx),
+			"slot", slot,
+			"products", len(ids),
+			"error", err,
+		)
+		eligible = ids
+	}
+	for _, id := range eligible {
+		out[id] = true
+	}
+	return out
+}
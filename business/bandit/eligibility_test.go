@@ -0,0 +1,81 @@
+//go:build !integration
+
+package bandit
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"myGreenMarket/pkg/logger"
+)
+
+// memEligibility serves fixed availability and purchases, counting
+// catalogue queries.
+type memEligibility struct {
+	available map[uint64]bool
+	purchased map[uint][]uint64
+	queries   int
+	err       error
+}
+
+func (r *memEligibility) AvailableProducts(_ context.Context, ids []uint64) ([]uint64, error) {
+	r.queries++
+	if r.err != nil {
+		return nil, r.err
+	}
+	var out []uint64
+	for _, id := range ids {
+		if r.available[id] {
+			out = append(out, id)
+		}
+	}
+	return out, nil
+}
+
+func (r *memEligibility) UserExclusions(_ context.Context, userID uint, _ time.Time) ([]uint64, error) {
+	return r.purchased[userID], nil
+}
+
+// Unavailable and recently purchased products are filtered out, and
+// availability is cached between requests.
+func TestCatalogEligibility_FiltersUnavailableAndPurchased(t *testing.T) {
+	repo := &memEligibility{
+		available: map[uint64]bool{1: true, 2: true, 3: false, 4: true},
+		purchased: map[uint][]uint64{7: {2}},
+	}
+	checker := NewCatalogEligibilityChecker(repo, EligibilityConfig{CacheTTL: time.Minute, PurchaseLookback: 24 * time.Hour})
+	ctx := context.Background()
+
+	got, err := checker.FilterEligible(ctx, 7, "home_top", []uint64{1, 2, 3, 4, 5})
+	if err != nil {
+		t.Fatalf("FilterEligible: %v", err)
+	}
+	if want := []uint64{1, 4}; !slices.Equal(got, want) {
+		t.Errorf("user 7 eligible = %v, want %v", got, want)
+	}
+
+	// another user did not buy product 2; availability comes from the cache
+	got, _ = checker.FilterEligible(ctx, 8, "home_top", []uint64{1, 2, 3})
+	if want := []uint64{1, 2}; !slices.Equal(got, want) {
+		t.Errorf("user 8 eligible = %v, want %v", got, want)
+	}
+	if repo.queries != 1 {
+		t.Errorf("catalogue queried %d times, want 1", repo.queries)
+	}
+}
+
+// A failing check keeps every candidate rather than emptying the slate.
+func TestFilterEligible_FailsOpen(t *testing.T) {
+	logger.Init("test")
+
+	repo := &memEligibility{err: errors.New("db down")}
+	checker := NewCatalogEligibilityChecker(repo, EligibilityConfig{})
+
+	got := filterEligible(context.Background(), checker, 7, "home_top", []uint64{1, 2})
+	if !got[1] || !got[2] {
+		t.Errorf("eligible = %v, want every candidate", got)
+	}
+}
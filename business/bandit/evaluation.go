@@ -0,0 +1,586 @@
+package bandit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"myGreenMarket/domain"
+)
+
+// EventLogRepository reads the raw bandit_events log back for replay.
+type EventLogRepository interface {
+	ListEvents(ctx context.Context, slot string, from, to time.Time) ([]domain.BanditEvent, error)
+}
+
+// ImpressionLogRepository reads the logged bandit_impressions back, for the
+// propensities the serving policy showed each product with.
+type ImpressionLogRepository interface {
+	// ListImpressions returns the slot's impressions in [from, to), oldest
+	// first.
+	ListImpressions(ctx context.Context, slot string, from, to time.Time) ([]domain.RecommendationImpression, error)
+}
+
+const (
+	defaultEvalSlateSize = 10
+	defaultEvalMaxWeight = 20.0
+	defaultEvalWindow    = 7 * 24 * time.Hour
+
+	// how long after an impression an event on a product it served is
+	// joined to it, unless the product is served to the user again first
+	evalImpressionLookback = 24 * time.Hour
+
+	z95 = 1.96
+)
+
+// ErrInvalidEvalRequest marks evaluation requests that can never succeed:
+// missing fields, a bad window or an invalid candidate config.
+var ErrInvalidEvalRequest = errors.New("invalid off-policy evaluation request")
+
+// OffPolicyEvaluator estimates how candidate configs would have performed
+// on the logged traffic of a slot, without shipping them to live users.
+//
+// Every item a logged impression served is one (context, product, reward)
+// sample: its reward is the sum of the rewards of the events the user had
+// on it before they were shown it again, 0 when there were none. Each
+// candidate is replayed over the log in time order, learning from the
+// events exactly as LogFeedback would, and its probability of showing each
+// served product is compared with the logging policy's, as recorded on the
+// impression, to form IPS, self-normalised IPS and doubly-robust estimates.
+// Events that match no impression are learned from but earn no sample any
+// reward.
+type OffPolicyEvaluator struct {
+	eventRepo      EventLogRepository
+	impressionRepo ImpressionLogRepository
+	offlineRepo    OfflineRecommendationRepository
+	products       ProductFeatureSource
+	defaultCfg     Config
+}
+
+// NewOffPolicyEvaluator builds an evaluator; products may be nil, in which
+// case product features are replayed as unknown.
+func NewOffPolicyEvaluator(
+	eventRepo EventLogRepository,
+	impressionRepo ImpressionLogRepository,
+	offlineRepo OfflineRecommendationRepository,
+	products ProductFeatureSource,
+	defaultCfg Config,
+) *OffPolicyEvaluator {
+	return &OffPolicyEvaluator{
+		eventRepo:      eventRepo,
+		impressionRepo: impressionRepo,
+		offlineRepo:    offlineRepo,
+		products:       products,
+		defaultCfg:     defaultCfg,
+	}
+}
+
+// loggedImpression is a served slate with the context it was served in.
+type loggedImpression struct {
+	userID  uint
+	at      time.Time
+	segment int
+	ctx     map[string]any
+	items   []loggedItem
+}
+
+// loggedItem is one served product of an impression: a replay sample.
+type loggedItem struct {
+	productID uint64
+
+	// logging policy's probability of showing the product in a given slate
+	// position: its logged inclusion over the served slate size
+	propensity float64
+
+	// summed reward of the events joined to the item
+	reward float64
+}
+
+// loggedEvent is a logged event replayed for learning.
+type loggedEvent struct {
+	event   domain.BanditEvent
+	ctx     map[string]any
+	segment int
+	reward  float64
+}
+
+// Evaluate replays the slot's impressions and events between req.From and
+// req.To for every candidate config and reports estimated reward per served
+// item.
+func (e *OffPolicyEvaluator) Evaluate(
+	ctx context.Context,
+	req domain.OffPolicyEvalRequest,
+) (domain.OffPolicyEvalReport, error) {
+
+	if err := ctx.Err(); err != nil {
+		return domain.OffPolicyEvalReport{}, fmt.Errorf("context error: %w", err)
+	}
+	if req.Slot == "" {
+		return domain.OffPolicyEvalReport{}, fmt.Errorf("%w: slot is required", ErrInvalidEvalRequest)
+	}
+	if len(req.Candidates) == 0 {
+		return domain.OffPolicyEvalReport{}, fmt.Errorf("%w: at least one candidate config is required", ErrInvalidEvalRequest)
+	}
+	if req.To.IsZero() {
+		req.To = time.Now()
+	}
+	if req.From.IsZero() {
+		req.From = req.To.Add(-defaultEvalWindow)
+	}
+	if !req.From.Before(req.To) {
+		return domain.OffPolicyEvalReport{}, fmt.Errorf("%w: from must be before to", ErrInvalidEvalRequest)
+	}
+	if req.SlateSize <= 0 {
+		req.SlateSize = defaultEvalSlateSize
+	}
+	if req.MaxWeight <= 0 {
+		req.MaxWeight = defaultEvalMaxWeight
+	}
+	for i := range req.Candidates {
+		req.Candidates[i].Slot = req.Slot
+		if err := ValidateConfig(req.Candidates[i]); err != nil {
+			return domain.OffPolicyEvalReport{}, fmt.Errorf("%w: candidate %d: %w", ErrInvalidEvalRequest, i, err)
+		}
+	}
+
+	impressions, err := e.impressionRepo.ListImpressions(ctx, req.Slot, req.From, req.To)
+	if err != nil {
+		return domain.OffPolicyEvalReport{}, fmt.Errorf("load bandit impressions: %w", err)
+	}
+
+	// events up to a lookback past the window still reward its last
+	// impressions
+	events, err := e.eventRepo.ListEvents(ctx, req.Slot, req.From, req.To.Add(evalImpressionLookback))
+	if err != nil {
+		return domain.OffPolicyEvalReport{}, fmt.Errorf("load bandit events: %w", err)
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].CreatedAt.Before(events[j].CreatedAt)
+	})
+
+	report := domain.OffPolicyEvalReport{
+		Slot:       req.Slot,
+		From:       req.From,
+		To:         req.To,
+		Candidates: make([]domain.OffPolicyCandidateResult, 0, len(req.Candidates)),
+	}
+
+	served, learned, matched := e.prepareLog(impressions, events, req.To)
+	report.Impressions = len(served)
+	report.Events = len(learned)
+	report.MatchedEvents = matched
+
+	total := 0.0
+	for _, imp := range served {
+		for _, item := range imp.items {
+			total += item.reward
+			report.Samples++
+		}
+	}
+	if report.Samples == 0 {
+		return report, nil
+	}
+	report.LoggedReward = total / float64(report.Samples)
+
+	pool, err := e.candidatePool(ctx, req.Slot, req.SlateSize, served)
+	if err != nil {
+		return domain.OffPolicyEvalReport{}, err
+	}
+
+	ids := make([]uint64, 0, len(pool)+len(learned))
+	for _, row := range pool {
+		ids = append(ids, row.ProductID)
+	}
+	for _, le := range learned {
+		ids = append(ids, le.event.ProductID)
+	}
+	products := productAttributes(ctx, e.products, ids...)
+
+	for _, cand := range req.Candidates {
+		res, err := e.replay(ctx, cand, served, learned, pool, products, req.SlateSize, req.MaxWeight)
+		if err != nil {
+			return domain.OffPolicyEvalReport{}, err
+		}
+		report.Candidates = append(report.Candidates, res)
+	}
+
+	return report, nil
+}
+
+// prepareLog turns the impressions into samples and joins every event to
+// the user's latest impression that served its product, at most
+// evalImpressionLookback before it, adding the event's reward to the item.
+// It returns the impressions with served items (oldest first), the events
+// to learn from before `until`, and how many events were joined.
+func (e *OffPolicyEvaluator) prepareLog(
+	impressions []domain.RecommendationImpression,
+	events []domain.BanditEvent,
+	until time.Time,
+) ([]loggedImpression, []loggedEvent, int) {
+
+	sort.SliceStable(impressions, func(i, j int) bool {
+		return impressions[i].CreatedAt.Before(impressions[j].CreatedAt)
+	})
+
+	// (user, product) -> the items that served it, oldest first
+	type itemRef struct {
+		imp, item int
+	}
+	type userProduct struct {
+		userID    uint
+		productID uint64
+	}
+	servedBy := make(map[userProduct][]itemRef)
+
+	served := make([]loggedImpression, 0, len(impressions))
+	for _, imp := range impressions {
+		slate := 0
+		for _, item := range imp.Items {
+			if item.Position >= 0 {
+				slate++
+			}
+		}
+		if slate == 0 {
+			continue
+		}
+
+		li := loggedImpression{
+			userID:  imp.UserID,
+			at:      imp.CreatedAt,
+			segment: imp.Segment,
+			ctx:     buildBaseContext(imp.CreatedAt, "", imp.Segment, imp.Variant),
+			items:   make([]loggedItem, 0, slate),
+		}
+		for _, item := range imp.Items {
+			if item.Position < 0 || item.Propensity <= 0 {
+				continue
+			}
+			key := userProduct{imp.UserID, item.ProductID}
+			servedBy[key] = append(servedBy[key], itemRef{imp: len(served), item: len(li.items)})
+			li.items = append(li.items, loggedItem{
+				productID:  item.ProductID,
+				propensity: item.Propensity / float64(slate),
+			})
+		}
+		if len(li.items) > 0 {
+			served = append(served, li)
+		}
+	}
+
+	learned := make([]loggedEvent, 0, len(events))
+	matched := 0
+	for _, ev := range events {
+		ctxMap := map[string]any{}
+		for k, v := range ev.Context {
+			ctxMap[k] = v
+		}
+
+		if v, ok := ctxMap["value"].(float64); ok {
+			ev.Value = v
+		}
+		seg, _ := intFromContext(ctxMap, "segment")
+
+		// reward is always measured with the default config so that all
+		// candidates are compared on the same scale
+		reward, err := e.defaultCfg.RewardForEvent(ev)
+		if err != nil {
+			continue
+		}
+
+		if ev.CreatedAt.Before(until) {
+			learned = append(learned, loggedEvent{
+				event:   ev,
+				ctx:     ctxMap,
+				segment: seg,
+				reward:  reward,
+			})
+		}
+
+		// the impression itself is the sample; impression events add nothing
+		if ev.EventType == "impression" {
+			continue
+		}
+		refs := servedBy[userProduct{ev.UserID, ev.ProductID}]
+		i := sort.Search(len(refs), func(i int) bool {
+			return served[refs[i].imp].at.After(ev.CreatedAt)
+		})
+		if i == 0 {
+			continue
+		}
+		ref := refs[i-1]
+		if ev.CreatedAt.Sub(served[ref.imp].at) > evalImpressionLookback {
+			continue
+		}
+		served[ref.imp].items[ref.item].reward += reward
+		matched++
+	}
+
+	return served, learned, matched
+}
+
+// candidatePool is the product set each candidate ranks at every replayed
+// impression: the slot's offline candidates, or the served products when
+// there is no offline source.
+func (e *OffPolicyEvaluator) candidatePool(
+	ctx context.Context,
+	slot string,
+	slateSize int,
+	served []loggedImpression,
+) ([]domain.MockRecommendation, error) {
+
+	if e.offlineRepo != nil {
+		rows, err := e.offlineRepo.GetBySlot(ctx, slot, slateSize*3)
+		if err != nil {
+			return nil, fmt.Errorf("load offline recommendations: %w", err)
+		}
+		if len(rows) > 0 {
+			return rows, nil
+		}
+	}
+
+	seen := make(map[uint64]struct{})
+	rows := make([]domain.MockRecommendation, 0)
+	for _, imp := range served {
+		for _, item := range imp.items {
+			if _, ok := seen[item.productID]; ok {
+				continue
+			}
+			seen[item.productID] = struct{}{}
+			rows = append(rows, domain.MockRecommendation{
+				Slot:      slot,
+				ProductID: item.productID,
+				Score:     1.0,
+			})
+		}
+	}
+	return rows, nil
+}
+
+// replay runs one candidate config over the log and returns its estimates.
+// Impressions and events are walked in time order; an impression is
+// estimated before the events at the same instant are learned.
+func (e *OffPolicyEvaluator) replay(
+	ctx context.Context,
+	cand domain.BanditConfig,
+	served []loggedImpression,
+	learned []loggedEvent,
+	pool []domain.MockRecommendation,
+	products map[uint64]*ProductAttributes,
+	slateSize int,
+	maxWeight float64,
+) (domain.OffPolicyCandidateResult, error) {
+
+	cfg := configFromDomain(e.defaultCfg, cand)
+	variant := cand.Variant
+	policy := policyFor(cfg, variant)
+	pipe := pipelineFor(cfg)
+	rerankers := rerankersFor(cfg)
+
+	k := slateSize
+	if k > len(pool) {
+		k = len(pool)
+	}
+
+	maxScore := 0.0
+	poolIdx := make(map[uint64]int, len(pool))
+	for j, row := range pool {
+		if row.Score > maxScore {
+			maxScore = row.Score
+		}
+		poolIdx[row.ProductID] = j
+	}
+	if maxScore == 0 {
+		maxScore = 1
+	}
+
+	states := make(map[string]*LinUCBState)
+
+	weights := make([]float64, 0)
+	rewards := make([]float64, 0)
+	drTerms := make([]float64, 0)
+
+	next := 0 // next event to learn
+	for i, imp := range served {
+		if i%256 == 0 {
+			if err := ctx.Err(); err != nil {
+				return domain.OffPolicyCandidateResult{}, fmt.Errorf("context error: %w", err)
+			}
+		}
+
+		// learn from the logged events before the impression, like
+		// LogFeedback does
+		for ; next < len(learned) && learned[next].event.CreatedAt.Before(imp.at); next++ {
+			e.learnEvent(cand.Slot, cfg, policy, pipe, states, learned[next], products)
+		}
+
+		gState := replayState(states, stateGlobalKey(cand.Slot, imp.segment), pipe)
+		uState := replayState(states, stateUserKey(cand.Slot, imp.segment, imp.userID), pipe)
+
+		// target policy: inclusion of every pool product in the
+		// candidate's top-k, plus the model's mean reward for the DR
+		// baseline
+		scoring := newScoringStates(policy, cfg, gState, uState)
+		arms := make([]preparedArm, len(pool))
+		means := make([]float64, len(pool))
+		for j, row := range pool {
+			pid := row.ProductID
+			x := pipe.vector(FeatureInput{
+				UserID:    imp.userID,
+				Slot:      cand.Slot,
+				ProductID: pid,
+				Segment:   imp.segment,
+				Now:       imp.at,
+				Ctx:       imp.ctx,
+				Product:   products[pid],
+			})
+			z := crossFeatures(policy, x, products[pid])
+			arms[j] = scoring.prepare(pid, products[pid], x, z, row.Score/maxScore)
+			means[j] = arms[j].mean(cfg)
+		}
+
+		inclusion := slateInclusion(arms, cfg, policy, rerankers, k, nil)
+
+		// direct-method value of the target policy at this context, per
+		// slate position
+		dm := 0.0
+		for j := range pool {
+			dm += inclusion[j] / float64(k) * means[j]
+		}
+
+		for _, item := range imp.items {
+			w, rHat := 0.0, 0.0
+			if j, ok := poolIdx[item.productID]; ok {
+				w = (inclusion[j] / float64(k)) / item.propensity
+				if w > maxWeight {
+					w = maxWeight
+				}
+				rHat = means[j]
+			}
+
+			weights = append(weights, w)
+			rewards = append(rewards, item.reward)
+			drTerms = append(drTerms, dm+w*(item.reward-rHat))
+		}
+	}
+
+	ipsTerms := make([]float64, len(weights))
+	sumW, sumW2 := 0.0, 0.0
+	for i := range weights {
+		ipsTerms[i] = weights[i] * rewards[i]
+		sumW += weights[i]
+		sumW2 += weights[i] * weights[i]
+	}
+
+	ess := 0.0
+	if sumW2 > 0 {
+		ess = sumW * sumW / sumW2
+	}
+
+	return domain.OffPolicyCandidateResult{
+		Slot:                cand.Slot,
+		Variant:             variant,
+		Policy:              policy.Name(),
+		EffectiveSampleSize: ess,
+		Estimates: []domain.OffPolicyEstimate{
+			meanEstimate("ips", ipsTerms),
+			snipsEstimate(weights, rewards),
+			meanEstimate("dr", drTerms),
+		},
+	}, nil
+}
+
+// learnEvent folds one logged event into the replayed states.
+func (e *OffPolicyEvaluator) learnEvent(
+	slot string,
+	cfg Config,
+	policy Policy,
+	pipe *featurePipeline,
+	states map[string]*LinUCBState,
+	le loggedEvent,
+	products map[uint64]*ProductAttributes,
+) {
+	ev := le.event
+	gState := replayState(states, stateGlobalKey(slot, le.segment), pipe)
+	uState := replayState(states, stateUserKey(slot, le.segment, ev.UserID), pipe)
+
+	x := pipe.vector(FeatureInput{
+		UserID:    ev.UserID,
+		Slot:      slot,
+		ProductID: ev.ProductID,
+		Segment:   le.segment,
+		Now:       ev.CreatedAt,
+		Ctx:       le.ctx,
+		Product:   products[ev.ProductID],
+	})
+	z := crossFeatures(policy, x, products[ev.ProductID])
+	learn(policy, cfg, gState, uState, ev.ProductID, x, z, le.reward, ev.CreatedAt)
+}
+
+func replayState(states map[string]*LinUCBState, key string, pipe *featurePipeline) *LinUCBState {
+	st, ok := states[key]
+	if !ok {
+		st = newDefaultState(pipe.dims)
+		states[key] = st
+	}
+	return st
+}
+
+// meanEstimate is the sample mean of per-sample terms with a normal 95% CI.
+func meanEstimate(name string, terms []float64) domain.OffPolicyEstimate {
+	n := float64(len(terms))
+	if n == 0 {
+		return domain.OffPolicyEstimate{Estimator: name}
+	}
+
+	mean := 0.0
+	for _, t := range terms {
+		mean += t
+	}
+	mean /= n
+
+	variance := 0.0
+	for _, t := range terms {
+		variance += (t - mean) * (t - mean)
+	}
+	if n > 1 {
+		variance /= n - 1
+	}
+	half := z95 * math.Sqrt(variance/n)
+
+	return domain.OffPolicyEstimate{
+		Estimator: name,
+		Value:     mean,
+		CILow:     mean - half,
+		CIHigh:    mean + half,
+	}
+}
+
+// snipsEstimate is Σwr / Σw with a delta-method 95% CI.
+func snipsEstimate(weights, rewards []float64) domain.OffPolicyEstimate {
+	sumW, sumWR := 0.0, 0.0
+	for i := range weights {
+		sumW += weights[i]
+		sumWR += weights[i] * rewards[i]
+	}
+	if sumW == 0 {
+		return domain.OffPolicyEstimate{Estimator: "snips"}
+	}
+
+	value := sumWR / sumW
+	variance := 0.0
+	for i := range weights {
+		d := weights[i] * (rewards[i] - value)
+		variance += d * d
+	}
+	half := z95 * math.Sqrt(variance) / sumW
+
+	return domain.OffPolicyEstimate{
+		Estimator: "snips",
+		Value:     value,
+		CILow:     value - half,
+		CIHigh:    value + half,
+	}
+}
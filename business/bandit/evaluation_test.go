@@ -0,0 +1,210 @@
+//go:build !integration
+
+package bandit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+
+	"gorm.io/datatypes"
+)
+
+type staticEventLog []domain.BanditEvent
+
+func (l staticEventLog) ListEvents(context.Context, string, time.Time, time.Time) ([]domain.BanditEvent, error) {
+	return l, nil
+}
+
+type staticImpressionLog []domain.RecommendationImpression
+
+func (l staticImpressionLog) ListImpressions(context.Context, string, time.Time, time.Time) ([]domain.RecommendationImpression, error) {
+	return l, nil
+}
+
+type staticOffline []domain.MockRecommendation
+
+func (o staticOffline) GetBySlot(context.Context, string, int) ([]domain.MockRecommendation, error) {
+	return o, nil
+}
+
+// TestEvaluate_SyntheticLog replays a log served by a uniform random policy
+// over two products, one clicked 80% of the time and the other 20%, and
+// checks the estimates of a policy that always shows the better product.
+func TestEvaluate_SyntheticLog(t *testing.T) {
+	logger.Init("test")
+
+	const (
+		slot   = "home_top"
+		rounds = 4000
+	)
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	rng := rand.New(rand.NewSource(1))
+
+	var events staticEventLog
+	var impressions staticImpressionLog
+	for r := 0; r < rounds; r++ {
+		at := start.Add(time.Duration(r) * time.Minute)
+		userID := uint(rng.Intn(50) + 1)
+
+		// the logging policy shows product 1 or 2 with probability 1/2
+		shown, other := uint64(1), uint64(2)
+		clicked := rng.Float64() < 0.8
+		if rng.Intn(2) == 1 {
+			shown, other = 2, 1
+			clicked = rng.Float64() < 0.2
+		}
+		impressions = append(impressions, domain.RecommendationImpression{
+			UserID: userID,
+			Slot:   slot,
+			Items: []domain.ImpressionItem{
+				{ProductID: shown, Position: 0, Propensity: 0.5},
+				{ProductID: other, Position: -1, Propensity: 0.5},
+			},
+			CreatedAt: at,
+		})
+
+		// unclicked impressions log no event and count as reward 0
+		if clicked {
+			events = append(events, domain.BanditEvent{
+				UserID:    userID,
+				Slot:      slot,
+				ProductID: shown,
+				EventType: "click",
+				Context:   datatypes.JSONMap{"segment": float64(0)},
+				CreatedAt: at.Add(30 * time.Second),
+			})
+		}
+	}
+
+	// events no impression served are learned from but not estimated on
+	for r := 0; r < 10; r++ {
+		events = append(events, domain.BanditEvent{
+			UserID:    99,
+			Slot:      slot,
+			ProductID: 2,
+			EventType: "order",
+			Value:     1000,
+			Context:   datatypes.JSONMap{"segment": float64(0)},
+			CreatedAt: start.Add(time.Duration(r) * time.Minute),
+		})
+	}
+
+	evaluator := NewOffPolicyEvaluator(
+		events,
+		impressions,
+		staticOffline{
+			{Slot: slot, ProductID: 1, Score: 1.0},
+			{Slot: slot, ProductID: 2, Score: 0.5},
+		},
+		nil,
+		DefaultConfig(),
+	)
+
+	report, err := evaluator.Evaluate(context.Background(), domain.OffPolicyEvalRequest{
+		Slot:      slot,
+		From:      start,
+		To:        start.Add(rounds * time.Minute),
+		SlateSize: 1,
+		Candidates: []domain.BanditConfig{{
+			Policy:      PolicyOffline,
+			NumSegments: 1,
+			NumVariants: 1,
+			WOffline:    1,
+			Features:    domain.BanditFeatureFlags{UseBias: true},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Evaluate: %v", err)
+	}
+
+	if report.Samples != rounds {
+		t.Errorf("samples = %d, want %d", report.Samples, rounds)
+	}
+	if math.Abs(report.LoggedReward-0.5) > 0.05 {
+		t.Errorf("logged reward = %.4f, want about 0.5", report.LoggedReward)
+	}
+
+	// true value of always showing product 1
+	const want = 0.8
+	for _, est := range report.Candidates[0].Estimates {
+		if math.Abs(est.Value-want) > 0.05 {
+			t.Errorf("%s = %.4f, want %.2f", est.Estimator, est.Value, want)
+		}
+		if est.CILow > want || est.CIHigh < want {
+			t.Errorf("%s CI [%.4f, %.4f] does not cover %.2f", est.Estimator, est.CILow, est.CIHigh, want)
+		}
+	}
+}
+
+// TestEvaluate_OneSamplePerServedItem checks that every served item is one
+// sample: several events on it add up to one reward, and an item without
+// events is a zero-reward sample.
+func TestEvaluate_OneSamplePerServedItem(t *testing.T) {
+	logger.Init("test")
+
+	const slot = "home_top"
+	at := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := DefaultConfig()
+
+	impressions := staticImpressionLog{{
+		UserID: 1,
+		Slot:   slot,
+		Items: []domain.ImpressionItem{
+			{ProductID: 1, Position: 0, Propensity: 1},
+			{ProductID: 2, Position: 1, Propensity: 1},
+		},
+		CreatedAt: at,
+	}}
+	events := staticEventLog{
+		{UserID: 1, Slot: slot, ProductID: 1, EventType: "click", CreatedAt: at.Add(time.Second)},
+		{UserID: 1, Slot: slot, ProductID: 1, EventType: "atc", CreatedAt: at.Add(2 * time.Second)},
+		// never served to the user: learned from only
+		{UserID: 1, Slot: slot, ProductID: 3, EventType: "click", CreatedAt: at.Add(3 * time.Second)},
+	}
+
+	evaluator := NewOffPolicyEvaluator(events, impressions, nil, nil, cfg)
+	report, err := evaluator.Evaluate(context.Background(), domain.OffPolicyEvalRequest{
+		Slot: slot,
+		From: at,
+		To:   at.Add(time.Hour),
+		Candidates: []domain.BanditConfig{{
+			Policy:      PolicyOffline,
+			NumSegments: 1,
+			NumVariants: 1,
+			WOffline:    1,
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Evaluate: %v", err)
+	}
+
+	if report.Impressions != 1 || report.Samples != 2 || report.MatchedEvents != 2 || report.Events != 3 {
+		t.Fatalf("impressions/samples/matched/events = %d/%d/%d/%d, want 1/2/2/3",
+			report.Impressions, report.Samples, report.MatchedEvents, report.Events)
+	}
+	want := (cfg.RewardClick + cfg.RewardATC) / 2
+	if math.Abs(report.LoggedReward-want) > 1e-9 {
+		t.Errorf("logged reward = %v, want %v", report.LoggedReward, want)
+	}
+}
+
+// TestEvaluate_RejectsInvalidCandidates checks that a candidate with an
+// unknown policy is rejected instead of replayed as LinUCB.
+func TestEvaluate_RejectsInvalidCandidates(t *testing.T) {
+	evaluator := NewOffPolicyEvaluator(staticEventLog{}, staticImpressionLog{}, nil, nil, DefaultConfig())
+	_, err := evaluator.Evaluate(context.Background(), domain.OffPolicyEvalRequest{
+		Slot:       "home_top",
+		Candidates: []domain.BanditConfig{{Policy: "no_such_policy", NumSegments: 1, NumVariants: 1}},
+	})
+	if !errors.Is(err, ErrInvalidEvalRequest) {
+		t.Fatalf("err = %v, want ErrInvalidEvalRequest", err)
+	}
+}
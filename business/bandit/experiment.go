@@ -0,0 +1,487 @@
+package bandit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+)
+
+var (
+	ErrExperimentNotFound = errors.New("experiment not found")
+	ErrExperimentRunning  = errors.New("slot already has a running experiment")
+	ErrInvalidExperiment  = errors.New("invalid experiment")
+)
+
+// how long a slot's experiment, and a user's sticky assignment to it, is
+// cached by the allocator
+const defaultExperimentCacheTTL = 30 * time.Second
+
+// cached assignments are swept of expired entries once there are this many
+const assignmentSweepSize = 10000
+
+// ExperimentRepository stores experiments and sticky assignments.
+type ExperimentRepository interface {
+	// LatestExperiment returns the slot's most recently created experiment.
+	LatestExperiment(ctx context.Context, slot string) (domain.BanditExperiment, bool, error)
+	GetExperiment(ctx context.Context, id uint) (domain.BanditExperiment, bool, error)
+	ListExperiments(ctx context.Context, slot string) ([]domain.BanditExperiment, error)
+	CreateExperiment(ctx context.Context, exp *domain.BanditExperiment) error
+	UpdateExperiment(ctx context.Context, exp domain.BanditExperiment) error
+
+	GetAssignment(ctx context.Context, experimentID uint, userID uint) (domain.BanditAssignment, bool, error)
+
+	// CreateAssignment stores an assignment unless the user already has one,
+	// and returns the stored assignment either way.
+	CreateAssignment(ctx context.Context, a domain.BanditAssignment) (domain.BanditAssignment, error)
+}
+
+// VariantConfig is a traffic split across the built-in variants, in percent.
+type VariantConfig struct {
+	PctOfflineOnly int `json:"pct_offline_only"`
+	PctUCB         int `json:"pct_ucb"`
+	PctThompson    int `json:"pct_thompson"`
+}
+
+// Arms turns the split into experiment arms, leaving out empty variants.
+func (v VariantConfig) Arms() []domain.ExperimentArm {
+	arms := make([]domain.ExperimentArm, 0, 3)
+	for _, a := range []domain.ExperimentArm{
+		{Variant: VariantUCB, Weight: float64(v.PctUCB)},
+		{Variant: VariantThompson, Weight: float64(v.PctThompson)},
+		{Variant: VariantOfflineOnly, Weight: float64(v.PctOfflineOnly)},
+	} {
+		if a.Weight > 0 {
+			arms = append(arms, a)
+		}
+	}
+	return arms
+}
+
+// ExperimentAllocator assigns users to experiment variants.
+type ExperimentAllocator struct {
+	repo ExperimentRepository
+	ttl  time.Duration
+
+	mu          sync.RWMutex
+	cache       map[string]cachedExperiment // by slot
+	assignments map[assignmentKey]cachedAssignment
+}
+
+type cachedExperiment struct {
+	exp     *domain.BanditExperiment // nil when the slot has none
+	expires time.Time
+}
+
+type assignmentKey struct {
+	experimentID uint
+	userID       uint
+}
+
+// cachedAssignment is a stored, and so sticky, assignment, or (pending)
+// a user the ramp has not exposed yet
+type cachedAssignment struct {
+	variant int
+	pending bool
+	expires time.Time
+}
+
+func NewExperimentAllocator(repo ExperimentRepository, ttl time.Duration) *ExperimentAllocator {
+	if ttl <= 0 {
+		ttl = defaultExperimentCacheTTL
+	}
+	return &ExperimentAllocator{
+		repo:        repo,
+		ttl:         ttl,
+		cache:       make(map[string]cachedExperiment),
+		assignments: make(map[assignmentKey]cachedAssignment),
+	}
+}
+
+// Assign returns the user's variant for the slot. ok is false when the slot
+// has no experiment and the caller should use its default assignment.
+func (a *ExperimentAllocator) Assign(ctx context.Context, userID uint, slot string) (int, bool, error) {
+	exp, err := a.experiment(ctx, slot)
+	if err != nil || exp == nil {
+		return 0, false, err
+	}
+	if exp.Status != domain.ExperimentRunning {
+		return exp.ControlVariant, true, nil
+	}
+
+	key := assignmentKey{experimentID: exp.ID, userID: userID}
+	if variant, ok := a.cachedAssignment(key); ok {
+		return variant, true, nil
+	}
+
+	stored, ok, err := a.repo.GetAssignment(ctx, exp.ID, userID)
+	if err != nil {
+		return 0, false, fmt.Errorf("load assignment: %w", err)
+	}
+	if ok {
+		a.cacheAssignment(key, cachedAssignment{variant: stored.Variant})
+		return stored.Variant, true, nil
+	}
+
+	now := time.Now()
+	bucket, variant, enter := allocate(*exp, userID, now)
+	if !enter {
+		// not exposed yet: control, and free to enter as the ramp grows;
+		// cached no longer than until the next ramp step
+		a.cacheAssignment(key, cachedAssignment{
+			variant: exp.ControlVariant,
+			pending: true,
+			expires: nextRampStep(exp.Ramp, now),
+		})
+		return exp.ControlVariant, true, nil
+	}
+
+	stored, err = a.repo.CreateAssignment(ctx, domain.BanditAssignment{
+		ExperimentID: exp.ID,
+		UserID:       userID,
+		Slot:         slot,
+		Variant:      variant,
+		Bucket:       bucket,
+	})
+	if err != nil {
+		return 0, false, fmt.Errorf("save assignment: %w", err)
+	}
+
+	BanditExperimentAssignmentsTotal.WithLabelValues(slot, exp.Name, stored.Bucket).Inc()
+	a.cacheAssignment(key, cachedAssignment{variant: stored.Variant})
+	return stored.Variant, true, nil
+}
+
+// cachedAssignment returns a user's cached variant in an experiment.
+func (a *ExperimentAllocator) cachedAssignment(key assignmentKey) (int, bool) {
+	a.mu.RLock()
+	c, ok := a.assignments[key]
+	a.mu.RUnlock()
+	if ok && time.Now().Before(c.expires) {
+		return c.variant, true
+	}
+	return 0, false
+}
+
+// cacheAssignment caches c for the TTL, or until c.expires when that is
+// sooner.
+func (a *ExperimentAllocator) cacheAssignment(key assignmentKey, c cachedAssignment) {
+	now := time.Now()
+	if expires := now.Add(a.ttl); c.expires.IsZero() || expires.Before(c.expires) {
+		c.expires = expires
+	}
+
+	a.mu.Lock()
+	if len(a.assignments) >= assignmentSweepSize {
+		for k, c := range a.assignments {
+			if !now.Before(c.expires) {
+				delete(a.assignments, k)
+			}
+		}
+	}
+	a.assignments[key] = c
+	a.mu.Unlock()
+}
+
+// dropPending forgets the experiment's cached users not exposed yet, so a
+// ramp reaches them at once.
+func (a *ExperimentAllocator) dropPending(experimentID uint) {
+	a.mu.Lock()
+	for k, c := range a.assignments {
+		if k.experimentID == experimentID && c.pending {
+			delete(a.assignments, k)
+		}
+	}
+	a.mu.Unlock()
+}
+
+func (a *ExperimentAllocator) experiment(ctx context.Context, slot string) (*domain.BanditExperiment, error) {
+	now := time.Now()
+
+	a.mu.RLock()
+	c, ok := a.cache[slot]
+	a.mu.RUnlock()
+	if ok && now.Before(c.expires) {
+		return c.exp, nil
+	}
+
+	exp, found, err := a.repo.LatestExperiment(ctx, slot)
+	if err != nil {
+		return nil, fmt.Errorf("load experiment: %w", err)
+	}
+	c = cachedExperiment{expires: now.Add(a.ttl)}
+	if found {
+		c.exp = &exp
+	}
+
+	a.mu.Lock()
+	a.cache[slot] = c
+	a.mu.Unlock()
+	return c.exp, nil
+}
+
+func (a *ExperimentAllocator) invalidate(slot string) {
+	a.mu.Lock()
+	delete(a.cache, slot)
+	a.mu.Unlock()
+}
+
+// allocate places a user who has no stored assignment: into the holdout,
+// into a treatment arm, or (enter false) nowhere yet.
+func allocate(exp domain.BanditExperiment, userID uint, now time.Time) (bucket string, variant int, enter bool) {
+	if unitHash(exp.Salt, userID, "holdout") < exp.HoldoutPct/100 {
+		return domain.AssignmentHoldout, exp.ControlVariant, true
+	}
+	if unitHash(exp.Salt, userID, "exposure") >= rampPct(exp.Ramp, now)/100 {
+		return "", exp.ControlVariant, false
+	}
+	return domain.AssignmentTreatment, pickArm(exp.Arms, unitHash(exp.Salt, userID, "arm")), true
+}
+
+// rampPct is the exposure of the last ramp step that has started; a missing
+// schedule exposes everyone.
+func rampPct(ramp []domain.RampStep, now time.Time) float64 {
+	if len(ramp) == 0 {
+		return 100
+	}
+	pct := 0.0
+	for _, step := range ramp {
+		if !step.At.After(now) {
+			pct = step.Pct
+		}
+	}
+	return pct
+}
+
+// nextRampStep is the start of the first ramp step after now, or the zero
+// time when none is scheduled.
+func nextRampStep(ramp []domain.RampStep, now time.Time) time.Time {
+	for _, step := range ramp {
+		if step.At.After(now) {
+			return step.At
+		}
+	}
+	return time.Time{}
+}
+
+// pickArm maps u in [0, 1) onto the arms by weight.
+func pickArm(arms []domain.ExperimentArm, u float64) int {
+	total := 0.0
+	for _, arm := range arms {
+		total += arm.Weight
+	}
+	acc := 0.0
+	for _, arm := range arms {
+		acc += arm.Weight / total
+		if u < acc {
+			return arm.Variant
+		}
+	}
+	return arms[len(arms)-1].Variant
+}
+
+// unitHash maps (salt, user, purpose) uniformly onto [0, 1). Independent
+// purposes keep holdout, exposure and arm choice uncorrelated.
+func unitHash(salt string, userID uint, purpose string) float64 {
+	h := fnv.New64a()
+	_, _ = fmt.Fprintf(h, "%s:%d:%s", salt, userID, purpose)
+	return float64(h.Sum64()>>11) / float64(1<<53)
+}
+
+// ---- admin ----
+
+func (a *ExperimentAllocator) ListExperiments(ctx context.Context, slot string) ([]domain.BanditExperiment, error) {
+	return a.repo.ListExperiments(ctx, slot)
+}
+
+func (a *ExperimentAllocator) GetExperiment(ctx context.Context, id uint) (domain.BanditExperiment, error) {
+	exp, ok, err := a.repo.GetExperiment(ctx, id)
+	if err != nil {
+		return exp, err
+	}
+	if !ok {
+		return exp, ErrExperimentNotFound
+	}
+	return exp, nil
+}
+
+// CreateExperiment validates and starts an experiment. A slot runs at most
+// one experiment at a time.
+func (a *ExperimentAllocator) CreateExperiment(ctx context.Context, exp domain.BanditExperiment) (domain.BanditExperiment, error) {
+	if err := validateExperiment(exp); err != nil {
+		return exp, err
+	}
+
+	latest, ok, err := a.repo.LatestExperiment(ctx, exp.Slot)
+	if err != nil {
+		return exp, err
+	}
+	if ok && latest.Status == domain.ExperimentRunning {
+		return exp, ErrExperimentRunning
+	}
+
+	if exp.Salt == "" {
+		exp.Salt = newSalt()
+	}
+	exp.ID = 0
+	exp.Status = domain.ExperimentRunning
+	exp.StoppedAt = nil
+	sortRamp(exp.Ramp)
+
+	if err := a.repo.CreateExperiment(ctx, &exp); err != nil {
+		return exp, err
+	}
+	a.invalidate(exp.Slot)
+
+	logger.Info("bandit_experiment_created",
+		"id", exp.ID,
+		"slot", exp.Slot,
+		"name", exp.Name,
+		"arms", len(exp.Arms),
+		"holdout_pct", exp.HoldoutPct,
+	)
+	return exp, nil
+}
+
+// RampRequest changes a running experiment's exposure: Pct takes effect
+// now, Schedule replaces the remaining steps, and Arms (when set) replaces
+// the weights for users not assigned yet.
+type RampRequest struct {
+	Pct      *float64               `json:"pct"`
+	Schedule []domain.RampStep      `json:"schedule"`
+	Arms     []domain.ExperimentArm `json:"arms"`
+}
+
+func (a *ExperimentAllocator) RampExperiment(ctx context.Context, id uint, req RampRequest) (domain.BanditExperiment, error) {
+	exp, err := a.GetExperiment(ctx, id)
+	if err != nil {
+		return exp, err
+	}
+	if exp.Status != domain.ExperimentRunning {
+		return exp, fmt.Errorf("%w: experiment %d is %s", ErrInvalidExperiment, id, exp.Status)
+	}
+
+	now := time.Now()
+	if req.Pct != nil || len(req.Schedule) > 0 {
+		// keep the steps that already happened, so the history stays visible
+		ramp := make([]domain.RampStep, 0, len(exp.Ramp)+len(req.Schedule)+1)
+		for _, step := range exp.Ramp {
+			if !step.At.After(now) {
+				ramp = append(ramp, step)
+			}
+		}
+		if req.Pct != nil {
+			ramp = append(ramp, domain.RampStep{At: now, Pct: *req.Pct})
+		}
+		ramp = append(ramp, req.Schedule...)
+		sortRamp(ramp)
+		exp.Ramp = ramp
+	}
+	if len(req.Arms) > 0 {
+		exp.Arms = req.Arms
+	}
+
+	if err := validateExperiment(exp); err != nil {
+		return exp, err
+	}
+	if err := a.repo.UpdateExperiment(ctx, exp); err != nil {
+		return exp, err
+	}
+	a.invalidate(exp.Slot)
+	a.dropPending(exp.ID)
+
+	logger.Info("bandit_experiment_ramped",
+		"id", exp.ID,
+		"slot", exp.Slot,
+		"pct", rampPct(exp.Ramp, now),
+	)
+	return exp, nil
+}
+
+// StopExperiment ends an experiment. All of the slot's traffic then goes to
+// winner when given, otherwise to the control variant.
+func (a *ExperimentAllocator) StopExperiment(ctx context.Context, id uint, winner *int) (domain.BanditExperiment, error) {
+	exp, err := a.GetExperiment(ctx, id)
+	if err != nil {
+		return exp, err
+	}
+	if exp.Status != domain.ExperimentRunning {
+		return exp, fmt.Errorf("%w: experiment %d is %s", ErrInvalidExperiment, id, exp.Status)
+	}
+
+	now := time.Now()
+	exp.Status = domain.ExperimentStopped
+	exp.StoppedAt = &now
+	if winner != nil {
+		exp.ControlVariant = *winner
+	}
+
+	if err := a.repo.UpdateExperiment(ctx, exp); err != nil {
+		return exp, err
+	}
+	a.invalidate(exp.Slot)
+
+	logger.Info("bandit_experiment_stopped",
+		"id", exp.ID,
+		"slot", exp.Slot,
+		"serving_variant", exp.ControlVariant,
+	)
+	return exp, nil
+}
+
+func validateExperiment(exp domain.BanditExperiment) error {
+	if exp.Slot == "" || exp.Name == "" {
+		return fmt.Errorf("%w: slot and name are required", ErrInvalidExperiment)
+	}
+	if len(exp.Arms) == 0 {
+		return fmt.Errorf("%w: at least one arm is required", ErrInvalidExperiment)
+	}
+	seen := make(map[int]bool, len(exp.Arms))
+	total := 0.0
+	for _, arm := range exp.Arms {
+		if arm.Variant < 0 {
+			return fmt.Errorf("%w: variant must be >= 0", ErrInvalidExperiment)
+		}
+		if seen[arm.Variant] {
+			return fmt.Errorf("%w: variant %d listed twice", ErrInvalidExperiment, arm.Variant)
+		}
+		seen[arm.Variant] = true
+		if arm.Weight < 0 || math.IsNaN(arm.Weight) {
+			return fmt.Errorf("%w: arm weights must be >= 0", ErrInvalidExperiment)
+		}
+		total += arm.Weight
+	}
+	if total <= 0 {
+		return fmt.Errorf("%w: arm weights must not all be zero", ErrInvalidExperiment)
+	}
+	if exp.HoldoutPct < 0 || exp.HoldoutPct > 100 {
+		return fmt.Errorf("%w: holdout_pct must be in [0, 100]", ErrInvalidExperiment)
+	}
+	for _, step := range exp.Ramp {
+		if step.Pct < 0 || step.Pct > 100 {
+			return fmt.Errorf("%w: ramp pct must be in [0, 100]", ErrInvalidExperiment)
+		}
+	}
+	return nil
+}
+
+func sortRamp(ramp []domain.RampStep) {
+	sort.SliceStable(ramp, func(i, j int) bool {
+		return ramp[i].At.Before(ramp[j].At)
+	})
+}
+
+func newSalt() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,141 @@
+//go:build !integration
+
+package bandit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+)
+
+// memExperimentRepo holds one running experiment and counts assignment
+// lookups.
+type memExperimentRepo struct {
+	exp         domain.BanditExperiment
+	assignments map[uint]domain.BanditAssignment
+	lookups     int
+}
+
+func (r *memExperimentRepo) LatestExperiment(context.Context, string) (domain.BanditExperiment, bool, error) {
+	return r.exp, true, nil
+}
+
+func (r *memExperimentRepo) GetExperiment(context.Context, uint) (domain.BanditExperiment, bool, error) {
+	return r.exp, true, nil
+}
+
+func (r *memExperimentRepo) ListExperiments(context.Context, string) ([]domain.BanditExperiment, error) {
+	return []domain.BanditExperiment{r.exp}, nil
+}
+
+func (r *memExperimentRepo) CreateExperiment(context.Context, *domain.BanditExperiment) error {
+	return nil
+}
+
+func (r *memExperimentRepo) UpdateExperiment(_ context.Context, exp domain.BanditExperiment) error {
+	r.exp = exp
+	return nil
+}
+
+func (r *memExperimentRepo) GetAssignment(_ context.Context, _ uint, userID uint) (domain.BanditAssignment, bool, error) {
+	r.lookups++
+	a, ok := r.assignments[userID]
+	return a, ok, nil
+}
+
+func (r *memExperimentRepo) CreateAssignment(_ context.Context, a domain.BanditAssignment) (domain.BanditAssignment, error) {
+	if stored, ok := r.assignments[a.UserID]; ok {
+		return stored, nil
+	}
+	r.assignments[a.UserID] = a
+	return a, nil
+}
+
+// A user's sticky assignment is read from the repository once per TTL, not
+// on every request.
+func TestAssignCachesStickyAssignments(t *testing.T) {
+	ctx := context.Background()
+	repo := &memExperimentRepo{
+		exp: domain.BanditExperiment{
+			ID:     1,
+			Slot:   "home_top",
+			Name:   "ucb_vs_ts",
+			Salt:   "s",
+			Status: domain.ExperimentRunning,
+			Arms:   []domain.ExperimentArm{{Variant: VariantUCB, Weight: 1}, {Variant: VariantThompson, Weight: 1}},
+		},
+		assignments: make(map[uint]domain.BanditAssignment),
+	}
+	alloc := NewExperimentAllocator(repo, time.Minute)
+
+	first, ok, err := alloc.Assign(ctx, 7, "home_top")
+	if err != nil || !ok {
+		t.Fatalf("Assign = %v, %v", ok, err)
+	}
+	for i := 0; i < 10; i++ {
+		v, _, err := alloc.Assign(ctx, 7, "home_top")
+		if err != nil || v != first {
+			t.Fatalf("Assign = %d, %v; want sticky %d", v, err, first)
+		}
+	}
+	if repo.lookups != 1 {
+		t.Fatalf("assignment looked up %d times, want 1", repo.lookups)
+	}
+
+	// a user stored by another instance is cached on first read
+	repo.assignments[8] = domain.BanditAssignment{ExperimentID: 1, UserID: 8, Variant: VariantThompson}
+	for i := 0; i < 3; i++ {
+		if v, _, _ := alloc.Assign(ctx, 8, "home_top"); v != VariantThompson {
+			t.Fatalf("Assign(8) = %d, want %d", v, VariantThompson)
+		}
+	}
+	if repo.lookups != 2 {
+		t.Fatalf("assignment looked up %d times, want 2", repo.lookups)
+	}
+}
+
+// A user the ramp has not exposed is cached as control too, and enters as
+// soon as the experiment is ramped.
+func TestAssignCachesUnexposedUntilRamp(t *testing.T) {
+	logger.Init("test")
+
+	ctx := context.Background()
+	repo := &memExperimentRepo{
+		exp: domain.BanditExperiment{
+			ID:             1,
+			Slot:           "home_top",
+			Name:           "ucb_ramp",
+			Salt:           "s",
+			Status:         domain.ExperimentRunning,
+			ControlVariant: VariantOfflineOnly,
+			Arms:           []domain.ExperimentArm{{Variant: VariantUCB, Weight: 1}},
+			Ramp:           []domain.RampStep{{At: time.Now().Add(-time.Hour), Pct: 0}},
+		},
+		assignments: make(map[uint]domain.BanditAssignment),
+	}
+	alloc := NewExperimentAllocator(repo, time.Minute)
+
+	for i := 0; i < 5; i++ {
+		v, ok, err := alloc.Assign(ctx, 7, "home_top")
+		if err != nil || !ok || v != VariantOfflineOnly {
+			t.Fatalf("Assign = %d, %v, %v; want control", v, ok, err)
+		}
+	}
+	if repo.lookups != 1 {
+		t.Fatalf("assignment looked up %d times, want 1", repo.lookups)
+	}
+
+	full := 100.0
+	if _, err := alloc.RampExperiment(ctx, 1, RampRequest{Pct: &full}); err != nil {
+		t.Fatalf("RampExperiment: %v", err)
+	}
+	if v, _, _ := alloc.Assign(ctx, 7, "home_top"); v != VariantUCB {
+		t.Errorf("Assign after ramp = %d, want %d", v, VariantUCB)
+	}
+	if _, ok := repo.assignments[7]; !ok {
+		t.Error("assignment not stored after ramp")
+	}
+}
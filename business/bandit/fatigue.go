@@ -0,0 +1,169 @@
+package bandit
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+)
+
+// ExposureTracker counts how often each user was shown each product in a
+// slot, over a sliding window.
+type ExposureTracker interface {
+	// Exposures returns the user's impressions per product in the slot
+	// since `since`. Products never shown are left out.
+	Exposures(ctx context.Context, userID uint, slot string, since time.Time) (map[uint64]int, error)
+
+	// RecordExposures adds one impression of each product at `at` and
+	// forgets the slot's impressions older than window.
+	RecordExposures(ctx context.Context, userID uint, slot string, productIDs []uint64, at time.Time, window time.Duration) error
+}
+
+// WithExposureTracker enables the slots' fatigue settings: served products
+// are tracked per user, and products shown too often are capped or
+// penalised.
+func WithExposureTracker(t ExposureTracker) Option {
+	return func(s *BanditService) {
+		s.exposures = t
+	}
+}
+
+// DismissalReader lists the products a user dismissed in a slot.
+type DismissalReader interface {
+	Dismissed(ctx context.Context, userID uint, slot string, since time.Time) ([]uint64, error)
+}
+
+// WithDismissals enables the slots' dismiss_seconds: products a user
+// dismissed in the slot are left out for that long.
+func WithDismissals(r DismissalReader) Option {
+	return func(s *BanditService) {
+		s.dismissals = r
+	}
+}
+
+// fatigue holds one request's impression counts and dismissals under the
+// slot's settings. A nil fatigue applies nothing.
+type fatigue struct {
+	cfg       domain.BanditFatigue
+	counts    map[uint64]int
+	dismissed map[uint64]struct{}
+}
+
+// loadFatigue reads the user's exposures and dismissals when the slot has
+// fatigue set. A part whose read fails is skipped for the request.
+func (s *BanditService) loadFatigue(ctx context.Context, userID uint, slot string, cfg Config, now time.Time) *fatigue {
+	f := &fatigue{cfg: cfg.Fatigue}
+
+	if s.exposures != nil && cfg.Fatigue.Enabled() {
+		window := time.Duration(cfg.Fatigue.WindowSeconds) * time.Second
+		counts, err := s.exposures.Exposures(ctx, userID, slot, now.Add(-window))
+		if err != nil {
+			logger.Warn("bandit_exposures_load_failed",
+				"trace_id", TraceIDFromContext(ctx),
+				"slot", slot,
+				"error", err,
+			)
+		}
+		f.counts = counts
+	}
+
+	if s.dismissals != nil && userID != 0 && cfg.Fatigue.DismissSeconds > 0 {
+		window := time.Duration(cfg.Fatigue.DismissSeconds) * time.Second
+		ids, err := s.dismissals.Dismissed(ctx, userID, slot, now.Add(-window))
+		if err != nil {
+			logger.Warn("bandit_dismissals_load_failed",
+				"trace_id", TraceIDFromContext(ctx),
+				"slot", slot,
+				"error", err,
+			)
+		}
+		for _, id := range ids {
+			if f.dismissed == nil {
+				f.dismissed = make(map[uint64]struct{}, len(ids))
+			}
+			f.dismissed[id] = struct{}{}
+		}
+	}
+
+	if f.counts == nil && f.dismissed == nil {
+		return nil
+	}
+	return f
+}
+
+func (f *fatigue) count(productID uint64) int {
+	if f == nil {
+		return 0
+	}
+	return f.counts[productID]
+}
+
+// capped reports whether the user has seen the product the slot's maximum
+// number of times.
+func (f *fatigue) capped(productID uint64) bool {
+	if f == nil || f.cfg.MaxImpressions <= 0 {
+		return false
+	}
+	return f.counts[productID] >= f.cfg.MaxImpressions
+}
+
+// isDismissed reports whether the user dismissed the product in the slot
+// within its dismiss window.
+func (f *fatigue) isDismissed(productID uint64) bool {
+	if f == nil {
+		return false
+	}
+	_, ok := f.dismissed[productID]
+	return ok
+}
+
+// rerankers puts the impression penalty in front of the re-ranking steps,
+// so boosts, burials and pins act on the penalised scores.
+func (f *fatigue) rerankers(steps []Reranker) []Reranker {
+	if f == nil || f.counts == nil || f.cfg.Penalty <= 0 {
+		return steps
+	}
+	return append([]Reranker{fatigueReranker{fatigue: f}}, steps...)
+}
+
+// recordExposures tracks the products a slot served.
+func (s *BanditService) recordExposures(ctx context.Context, userID uint, slot string, cfg Config, recs []domain.BanditRecommendation, now time.Time) {
+	if s.exposures == nil || !cfg.Fatigue.Enabled() || len(recs) == 0 {
+		return
+	}
+
+	ids := make([]uint64, len(recs))
+	for i, r := range recs {
+		ids[i] = r.ProductID
+	}
+	window := time.Duration(cfg.Fatigue.WindowSeconds) * time.Second
+	if err := s.exposures.RecordExposures(ctx, userID, slot, ids, now, window); err != nil {
+		logger.Warn("bandit_exposures_save_failed",
+			"trace_id", TraceIDFromContext(ctx),
+			"slot", slot,
+			"error", err,
+		)
+	}
+}
+
+// fatigueReranker lowers each candidate's score by the penalty per
+// impression the user already had of it.
+type fatigueReranker struct {
+	fatigue *fatigue
+}
+
+func (fatigueReranker) Name() string { return "fatigue" }
+
+func (r fatigueReranker) Rerank(items []RerankItem, k int) []RerankItem {
+	out := make([]RerankItem, len(items))
+	copy(out, items)
+	for i := range out {
+		out[i].Score -= r.fatigue.cfg.Penalty * float64(r.fatigue.count(out[i].ProductID))
+	}
+	sort.SliceStable(out, func(a, b int) bool {
+		return out[a].Score > out[b].Score
+	})
+	return out
+}
@@ -0,0 +1,57 @@
+//go:build !integration
+
+package bandit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"myGreenMarket/domain"
+)
+
+// memDismissals answers Dismissed from a fixed log.
+type memDismissals struct {
+	log []domain.BanditEvent
+}
+
+func (r *memDismissals) Dismissed(_ context.Context, userID uint, slot string, since time.Time) ([]uint64, error) {
+	var out []uint64
+	for _, ev := range r.log {
+		if ev.UserID == userID && ev.Slot == slot && ev.EventType == "dismiss" && !ev.CreatedAt.Before(since) {
+			out = append(out, ev.ProductID)
+		}
+	}
+	return out, nil
+}
+
+// A slot's dismiss_seconds leaves out what the user dismissed in that slot
+// within the window, with no impression fatigue configured.
+func TestFatigueDismissSeconds(t *testing.T) {
+	now := time.Now()
+	repo := &memDismissals{log: []domain.BanditEvent{
+		{UserID: 1, Slot: "home_top", ProductID: 10, EventType: "dismiss", CreatedAt: now.Add(-time.Minute)},
+		{UserID: 1, Slot: "home_top", ProductID: 11, EventType: "dismiss", CreatedAt: now.Add(-2 * time.Hour)},
+		{UserID: 1, Slot: "pdp_similar", ProductID: 12, EventType: "dismiss", CreatedAt: now.Add(-time.Minute)},
+	}}
+	s := &BanditService{dismissals: repo}
+
+	fc := domain.BanditFatigue{DismissSeconds: 3600}
+	if err := ValidateConfig(domain.BanditConfig{Slot: "home_top", Fatigue: fc}); err != nil {
+		t.Fatalf("dismiss-only fatigue rejected: %v", err)
+	}
+
+	cfg := DefaultConfig()
+	cfg.Fatigue = fc
+	f := s.loadFatigue(context.Background(), 1, "home_top", cfg, now)
+	for pid, want := range map[uint64]bool{10: true, 11: false, 12: false} {
+		if got := f.isDismissed(pid); got != want {
+			t.Errorf("isDismissed(%d) = %v, want %v", pid, got, want)
+		}
+	}
+
+	cfg.Fatigue.DismissSeconds = 0
+	if f := s.loadFatigue(context.Background(), 1, "home_top", cfg, now); f.isDismissed(10) {
+		t.Error("dismissal honoured with dismiss_seconds 0")
+	}
+}
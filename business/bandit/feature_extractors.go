@@ -0,0 +1,298 @@
+package bandit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+const (
+	FeatureBias         = "bias"
+	FeatureTimeBucket   = "time_bucket"
+	FeatureDow          = "dow"
+	FeaturePlatformHash = "platform_hash" // legacy single-value platform encoding
+	FeatureSlotHash     = "slot_hash"
+	FeatureSegment      = "segment"
+	FeatureProductHash  = "product_hash"
+	FeatureUserHash     = "user_hash" // legacy user×product hash seasoned with tier & campaign
+	FeaturePlatform     = "platform"
+	FeatureDeviceType   = "device_type"
+	FeaturePageName     = "page_name"
+	FeatureUserTier     = "user_tier"
+	FeatureCampaignID   = "campaign_id"
+	FeaturePriceBand    = "price_band"
+	FeatureIsGreenTag   = "is_green_tag"
+	FeatureCategory     = "category"
+	FeatureDiscount     = "discount"
+	FeatureCategoryEmb  = "category_embedding"
+)
+
+// hashed one-hot widths for open vocabularies
+const (
+	pageNameBuckets = 8
+	userTierBuckets = 4
+	campaignBuckets = 8
+	categoryBuckets = 16
+
+	// width of the dense hashed category embedding
+	categoryEmbDim = 4
+)
+
+// upper bounds (sale price, IDR) of every price band but the last
+var priceBands = []float64{10000, 25000, 50000, 100000, 250000}
+
+func init() {
+	RegisterFeature(FeatureBias, scalar(FeatureBias, func(FeatureInput) float64 { return 1.0 }))
+	RegisterFeature(FeatureTimeBucket, scalar(FeatureTimeBucket, timeBucketFeature))
+	RegisterFeature(FeatureDow, scalar(FeatureDow, dowFeature))
+	RegisterFeature(FeaturePlatformHash, scalar(FeaturePlatformHash, func(in FeatureInput) float64 {
+		return platformBucket(stringFromContext(in.Ctx, "platform"))
+	}))
+	RegisterFeature(FeatureSlotHash, scalar(FeatureSlotHash, func(in FeatureInput) float64 {
+		return slotHash(in.Slot)
+	}))
+	RegisterFeature(FeatureSegment, segmentFeature)
+	RegisterFeature(FeatureProductHash, scalar(FeatureProductHash, func(in FeatureInput) float64 {
+		return productHash(in.ProductID)
+	}))
+	RegisterFeature(FeatureUserHash, scalar(FeatureUserHash, userProductHashFeature))
+
+	RegisterFeature(FeaturePlatform, oneHot(FeaturePlatform, "platform", []string{"android", "ios", "web"}))
+	RegisterFeature(FeatureDeviceType, oneHot(FeatureDeviceType, "device_type", []string{"mobile", "tablet", "desktop"}))
+	RegisterFeature(FeaturePageName, hashedOneHot(FeaturePageName, pageNameBuckets, func(in FeatureInput) string {
+		return stringFromContext(in.Ctx, "page_name")
+	}))
+	RegisterFeature(FeatureUserTier, hashedOneHot(FeatureUserTier, userTierBuckets, func(in FeatureInput) string {
+		return stringFromContext(in.Ctx, "user_tier")
+	}))
+	RegisterFeature(FeatureCampaignID, hashedOneHot(FeatureCampaignID, campaignBuckets, func(in FeatureInput) string {
+		return stringFromContext(in.Ctx, "campaign_id")
+	}))
+
+	RegisterFeature(FeaturePriceBand, priceBandFeature)
+	RegisterFeature(FeatureIsGreenTag, scalar(FeatureIsGreenTag, func(in FeatureInput) float64 {
+		if in.Product != nil && in.Product.IsGreenTag {
+			return 1.0
+		}
+		return 0
+	}))
+	RegisterFeature(FeatureCategory, hashedOneHot(FeatureCategory, categoryBuckets, func(in FeatureInput) string {
+		if in.Product == nil || in.Product.CategoryID == 0 {
+			return ""
+		}
+		return strconv.FormatUint(in.Product.CategoryID, 10)
+	}))
+	RegisterFeature(FeatureDiscount, scalar(FeatureDiscount, discountFeature))
+	RegisterFeature(FeatureCategoryEmb, categoryEmbeddingFeature)
+}
+
+func stringFromContext(ctxMap map[string]any, key string) string {
+	s, _ := ctxMap[key].(string)
+	return s
+}
+
+// ---- generic extractors ----
+
+// funcExtractor is an extractor backed by a plain function.
+type funcExtractor struct {
+	name    string
+	dims    []string
+	extract func(in FeatureInput, out []float64)
+}
+
+func (f *funcExtractor) Name() string                           { return f.name }
+func (f *funcExtractor) Dims() []string                         { return f.dims }
+func (f *funcExtractor) Extract(in FeatureInput, out []float64) { f.extract(in, out) }
+
+// scalar is a single-dimension feature.
+func scalar(name string, fn func(FeatureInput) float64) FeatureFactory {
+	return func(Config) FeatureExtractor {
+		return &funcExtractor{
+			name: name,
+			dims: []string{name},
+			extract: func(in FeatureInput, out []float64) {
+				out[0] = fn(in)
+			},
+		}
+	}
+}
+
+// oneHot encodes a context string over a fixed vocabulary plus "other".
+// A missing value leaves every dimension at zero.
+func oneHot(name, ctxKey string, vocab []string) FeatureFactory {
+	dims := make([]string, 0, len(vocab)+1)
+	index := make(map[string]int, len(vocab))
+	for i, v := range vocab {
+		dims = append(dims, name+"="+v)
+		index[v] = i
+	}
+	dims = append(dims, name+"=other")
+
+	return func(Config) FeatureExtractor {
+		return &funcExtractor{
+			name: name,
+			dims: dims,
+			extract: func(in FeatureInput, out []float64) {
+				v := stringFromContext(in.Ctx, ctxKey)
+				if v == "" {
+					return
+				}
+				i, ok := index[v]
+				if !ok {
+					i = len(vocab)
+				}
+				out[i] = 1.0
+			},
+		}
+	}
+}
+
+// hashedOneHot encodes an open-vocabulary string into a fixed number of
+// buckets. An empty value leaves every dimension at zero.
+func hashedOneHot(name string, buckets int, value func(FeatureInput) string) FeatureFactory {
+	dims := make([]string, buckets)
+	for i := range dims {
+		dims[i] = fmt.Sprintf("%s#%d", name, i)
+	}
+
+	return func(Config) FeatureExtractor {
+		return &funcExtractor{
+			name: name,
+			dims: dims,
+			extract: func(in FeatureInput, out []float64) {
+				v := value(in)
+				if v == "" {
+					return
+				}
+				i := int(hashToUnit(name+":"+v) * float64(buckets))
+				if i >= buckets {
+					i = buckets - 1
+				}
+				out[i] = 1.0
+			},
+		}
+	}
+}
+
+// ---- specific extractors ----
+
+func timeBucketFeature(in FeatureInput) float64 {
+	if label, ok := in.Ctx["time_bucket"].(string); ok {
+		if v, ok := timeBucketFromLabel(label); ok {
+			return v
+		}
+	}
+	return timeBucketFromHour(in.Now.Hour())
+}
+
+func dowFeature(in FeatureInput) float64 {
+	if d, ok := intFromContext(in.Ctx, "dow"); ok {
+		return dowBucket(d)
+	}
+	return dowBucket(int(in.Now.Weekday()))
+}
+
+func segmentFeature(cfg Config) FeatureExtractor {
+	numSegments := cfg.NumSegments
+	return &funcExtractor{
+		name: FeatureSegment,
+		dims: []string{FeatureSegment},
+		extract: func(in FeatureInput, out []float64) {
+			if numSegments > 0 {
+				out[0] = float64(in.Segment) / float64(numSegments)
+			}
+		},
+	}
+}
+
+func userProductHashFeature(in FeatureInput) float64 {
+	// Build a composite string that includes tier & campaign from context
+	extra := ""
+	if tier := stringFromContext(in.Ctx, "user_tier"); tier != "" {
+		extra += "|tier:" + tier
+	}
+	if camp := stringFromContext(in.Ctx, "campaign_id"); camp != "" {
+		extra += "|camp:" + camp
+	}
+	return hashToUnit(fmt.Sprintf("user:%d|prod:%d%s", in.UserID, in.ProductID, extra))
+}
+
+func priceBandFeature(Config) FeatureExtractor {
+	dims := make([]string, len(priceBands)+1)
+	for i := range dims {
+		dims[i] = fmt.Sprintf("%s#%d", FeaturePriceBand, i)
+	}
+	return &funcExtractor{
+		name: FeaturePriceBand,
+		dims: dims,
+		extract: func(in FeatureInput, out []float64) {
+			if band, ok := priceBand(in.Product); ok {
+				out[band] = 1.0
+			}
+		},
+	}
+}
+
+// priceBand returns the index of the product's price band, by sale price
+// when it has one; false when the price is unknown.
+func priceBand(p *ProductAttributes) (int, bool) {
+	if p == nil {
+		return 0, false
+	}
+	price := p.SalePrice
+	if price <= 0 {
+		price = p.NormalPrice
+	}
+	if price <= 0 {
+		return 0, false
+	}
+	for i, limit := range priceBands {
+		if price < limit {
+			return i, true
+		}
+	}
+	return len(priceBands), true
+}
+
+// discountFeature is the product's discount as a fraction of its normal
+// price, in [0, 1].
+func discountFeature(in FeatureInput) float64 {
+	if in.Product == nil {
+		return 0
+	}
+	p := in.Product
+
+	d := 0.0
+	switch {
+	case p.NormalPrice > 0 && p.SalePrice > 0 && p.SalePrice < p.NormalPrice:
+		d = 1 - p.SalePrice/p.NormalPrice
+	case p.Discount > 1 && p.Discount <= 100:
+		// stored as a percentage
+		d = p.Discount / 100
+	case p.Discount > 0 && p.Discount <= 1:
+		d = p.Discount
+	}
+	return math.Min(math.Max(d, 0), 1)
+}
+
+// categoryEmbeddingFeature maps a category onto a fixed pseudo-random point
+// in [-1, 1]^categoryEmbDim. Unlike the one-hot "category" feature it keeps
+// the vector small, at the cost of hash collisions between categories.
+func categoryEmbeddingFeature(Config) FeatureExtractor {
+	dims := make([]string, categoryEmbDim)
+	for i := range dims {
+		dims[i] = fmt.Sprintf("%s#%d", FeatureCategoryEmb, i)
+	}
+	return &funcExtractor{
+		name: FeatureCategoryEmb,
+		dims: dims,
+		extract: func(in FeatureInput, out []float64) {
+			if in.Product == nil || in.Product.CategoryID == 0 {
+				return
+			}
+			for i := range out {
+				out[i] = 2*hashToUnit(fmt.Sprintf("category:%d:%d", in.Product.CategoryID, i)) - 1
+			}
+		},
+	}
+}
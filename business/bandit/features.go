@@ -1,9 +1,14 @@
 package bandit
 
 import (
+	"encoding/json"
 	"fmt"
 	"hash/fnv"
+	"sort"
+	"sync"
 	"time"
+
+	"myGreenMarket/pkg/logger"
 )
 
 // global key
@@ -109,89 +114,215 @@ func productHash(productID uint64) float64 {
 	return hashToUnit(fmt.Sprintf("product:%d", productID))
 }
 
-func buildFeatureVector(
-	userID uint,
-	slot string,
-	productID uint64,
-	cfg Config,
-	seg int,
-	ctxMap map[string]any,
-) [linUCBFeatureDim]float64 {
-
-	// Defaults from "now"; can be overridden by ctxMap.
-	now := time.Now()
-	hour := now.Hour()
-	dow := int(now.Weekday())
-	platform := ""
-
-	var tbFromLabel float64
-	hasTbLabel := false
-
-	if ctxMap != nil {
-		if tbLabel, ok := ctxMap["time_bucket"].(string); ok {
-			if v, ok2 := timeBucketFromLabel(tbLabel); ok2 {
-				tbFromLabel = v
-				hasTbLabel = true
-			}
-		}
-		if d, ok := ctxMap["dow"].(int); ok {
-			dow = d
-		}
-		if p, ok := ctxMap["platform"].(string); ok {
-			platform = p
+// intFromContext reads an integer context value. Contexts replayed from the
+// bandit_events JSONB column carry numbers as float64.
+func intFromContext(ctxMap map[string]any, key string) (int, bool) {
+	switch v := ctxMap[key].(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			return 0, false
 		}
+		return int(n), true
+	default:
+		return 0, false
 	}
+}
+
+// ProductAttributes are the catalogue attributes product features read.
+type ProductAttributes struct {
+	IsGreenTag  bool
+	CategoryID  uint64
+	NormalPrice float64
+	SalePrice   float64
+	Discount    float64
+	CostPrice   float64   // 0 when unknown
+	EcoScore    float64   // 0–1, 0 when unrated
+	AddedAt     time.Time // catalogue creation time
+}
 
-	var x [linUCBFeatureDim]float64
+// FeatureInput is everything a feature extractor may read for one
+// (user, slot, product) impression.
+type FeatureInput struct {
+	UserID    uint
+	Slot      string
+	ProductID uint64
+	Segment   int
+	Now       time.Time
+	Ctx       map[string]any
 
-	// index 0: bias
-	if cfg.Features.UseBias {
-		x[0] = 1.0
-	}
+	// nil when the product's attributes are unknown
+	Product *ProductAttributes
+}
 
-	// index 1: time bucket
-	if cfg.Features.UseTimeBucket {
-		if hasTbLabel {
-			x[1] = tbFromLabel
-		} else {
-			x[1] = timeBucketFromHour(hour)
-		}
-	}
+// FeatureExtractor encodes one named feature into one or more dimensions
+// of the context vector.
+type FeatureExtractor interface {
+	Name() string
+
+	// Dims names every dimension the extractor writes, in order. Stored
+	// states remember these names so they can be migrated when a slot's
+	// feature list changes.
+	Dims() []string
 
-	// index 2: day-of-week bucket
-	if cfg.Features.UseDowBucket {
-		x[2] = dowBucket(dow)
+	// Extract writes len(Dims()) values into out.
+	Extract(in FeatureInput, out []float64)
+}
+
+// FeatureFactory builds an extractor for a config.
+type FeatureFactory func(cfg Config) FeatureExtractor
+
+var (
+	featureMu        sync.RWMutex
+	featureFactories = make(map[string]FeatureFactory)
+)
+
+// RegisterFeature makes an extractor selectable by name from bandit_config.
+func RegisterFeature(name string, factory FeatureFactory) {
+	featureMu.Lock()
+	defer featureMu.Unlock()
+
+	if _, dup := featureFactories[name]; dup {
+		panic("bandit: RegisterFeature called twice for " + name)
 	}
+	featureFactories[name] = factory
+}
 
-	// index 3: platform (always encoded if present)
-	x[3] = platformBucket(platform)
+// RegisteredFeatures lists the selectable feature names.
+func RegisteredFeatures() []string {
+	featureMu.RLock()
+	defer featureMu.RUnlock()
 
-	// index 4: slot hash
-	if cfg.Features.UseSlotHash {
-		x[4] = slotHash(slot)
+	names := make([]string, 0, len(featureFactories))
+	for name := range featureFactories {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
+}
 
-	// index 5: segment
-	if cfg.Features.UseSegment && cfg.NumSegments > 0 {
-		x[5] = float64(seg) / float64(cfg.NumSegments)
+// featurePipeline is the ordered list of extractors of a slot's config.
+type featurePipeline struct {
+	extractors []FeatureExtractor
+	dims       []string
+}
+
+func newFeaturePipeline(cfg Config, names []string) (*featurePipeline, error) {
+	p := &featurePipeline{
+		extractors: make([]FeatureExtractor, 0, len(names)),
 	}
 
-	// index 6: user/product hash with tier & campaign seasoning
-	if cfg.Features.UseUserHash {
-		// Build a composite string that includes tier & campaign from context
-		extra := ""
-		if tier, ok := ctxMap["user_tier"].(string); ok && tier != "" {
-			extra += "|tier:" + tier
+	seen := make(map[string]struct{}, len(names))
+	featureMu.RLock()
+	defer featureMu.RUnlock()
+
+	for _, name := range names {
+		if _, dup := seen[name]; dup {
+			return nil, fmt.Errorf("duplicate bandit feature: %s", name)
 		}
-		if camp, ok := ctxMap["campaign_id"].(string); ok && camp != "" {
-			extra += "|camp:" + camp
+		seen[name] = struct{}{}
+
+		factory, ok := featureFactories[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown bandit feature: %s", name)
 		}
+		ex := factory(cfg)
+		p.extractors = append(p.extractors, ex)
+		p.dims = append(p.dims, ex.Dims()...)
+	}
+	if len(p.dims) == 0 {
+		return nil, fmt.Errorf("feature list is empty")
+	}
+	return p, nil
+}
 
-		base := fmt.Sprintf("user:%d|prod:%d%s", userID, productID, extra)
-		x[6] = hashToUnit(base) // hashToUnit should map string → [0,1] float
-	} else if cfg.Features.UseProductHash {
-		x[6] = productHash(productID)
+// pipelineFor resolves the config's feature list, falling back to the
+// legacy layout when it names unknown features.
+func pipelineFor(cfg Config) *featurePipeline {
+	names := cfg.FeatureList
+	if len(names) == 0 {
+		names = legacyFeatureList(cfg.Features)
 	}
 
+	p, err := newFeaturePipeline(cfg, names)
+	if err != nil {
+		logger.Warn("bandit_feature_fallback",
+			"features", names,
+			"error", err,
+		)
+		p, _ = newFeaturePipeline(cfg, legacyFeatureList(cfg.Features))
+	}
+	return p
+}
+
+// vector builds the context vector for one impression.
+func (p *featurePipeline) vector(in FeatureInput) []float64 {
+	if in.Now.IsZero() {
+		in.Now = time.Now()
+	}
+	x := make([]float64, len(p.dims))
+	off := 0
+	for _, ex := range p.extractors {
+		n := len(ex.Dims())
+		ex.Extract(in, x[off:off+n])
+		off += n
+	}
 	return x
 }
+
+// legacyFeatureList is the feature list of configs that predate
+// feature_list, derived from their FeatureFlags. With the default flags it
+// reproduces the original 7-dim vector exactly.
+func legacyFeatureList(flags FeatureFlags) []string {
+	names := make([]string, 0, linUCBLegacyDim)
+	if flags.UseBias {
+		names = append(names, FeatureBias)
+	}
+	if flags.UseTimeBucket {
+		names = append(names, FeatureTimeBucket)
+	}
+	if flags.UseDowBucket {
+		names = append(names, FeatureDow)
+	}
+	// platform was always encoded
+	names = append(names, FeaturePlatformHash)
+	if flags.UseSlotHash {
+		names = append(names, FeatureSlotHash)
+	}
+	if flags.UseSegment {
+		names = append(names, FeatureSegment)
+	}
+	if flags.UseUserHash {
+		names = append(names, FeatureUserHash)
+	} else if flags.UseProductHash {
+		names = append(names, FeatureProductHash)
+	}
+	return names
+}
+
+// dimension count of version-0 states
+const linUCBLegacyDim = 7
+
+// legacyFeatureDims names the positions of a version-0 state. Index 6 held
+// the user hash or the product hash depending on the config's flags.
+func legacyFeatureDims(flags FeatureFlags) []string {
+	last := FeatureProductHash
+	if flags.UseUserHash {
+		last = FeatureUserHash
+	}
+	return []string{
+		FeatureBias,
+		FeatureTimeBucket,
+		FeatureDow,
+		FeaturePlatformHash,
+		FeatureSlotHash,
+		FeatureSegment,
+		last,
+	}
+}
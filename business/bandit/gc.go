@@ -1,8 +1,14 @@
 package bandit
 
 import (
+	"context"
+	"errors"
+	"slices"
 	"sort"
+	"strings"
 	"time"
+
+	"myGreenMarket/pkg/logger"
 )
 
 func capArms(state *LinUCBState, maxArms int) {
@@ -40,7 +46,309 @@ func capArms(state *LinUCBState, maxArms int) {
 	})
 
 	// keep [0:maxArms), delete the rest
+	refresh := false
 	for i := maxArms; i < len(list); i++ {
-		delete(state.Arms, list[i].productID)
+		refresh = removeArm(state, list[i].productID) || refresh
+	}
+	if refresh {
+		state.Hybrid.refreshInverse()
+	}
+}
+
+const (
+	defaultStateGCInterval  = time.Hour
+	defaultStateGCIdleTTL   = 30 * 24 * time.Hour
+	defaultStateGCArmTTL    = 7 * 24 * time.Hour
+	defaultStateGCMaxArms   = 50
+	defaultStateGCBatchSize = 500
+)
+
+// StoredState is a stored state with its key and stored size.
+type StoredState struct {
+	Key   string
+	State *LinUCBState
+	Bytes int
+}
+
+// StateGCRepository is what the state compactor needs from storage.
+type StateGCRepository interface {
+	BanditStateRepository
+
+	// DeleteIdleUserStates deletes the user states not saved since before,
+	// and returns how many it deleted and their stored size.
+	DeleteIdleUserStates(ctx context.Context, before time.Time) (states, bytes int64, err error)
+
+	// ListUserStates returns up to limit user states with keys after
+	// afterKey, in key order.
+	ListUserStates(ctx context.Context, afterKey string, limit int) ([]StoredState, error)
+
+	// CompactState is SaveState without counting as activity: the state
+	// keeps its idle time. It returns the new stored size.
+	CompactState(ctx context.Context, key string, state *LinUCBState) (int, error)
+
+	// DeleteState deletes the state if it is still at revision; otherwise
+	// it returns ErrStateConflict.
+	DeleteState(ctx context.Context, key string, revision int64) error
+}
+
+type StateGCConfig struct {
+	// how often a compaction pass runs
+	Interval time.Duration
+
+	// user states not saved for IdleTTL are deleted
+	IdleTTL time.Duration
+
+	// user arms not updated for ArmTTL are removed from their state; with
+	// FoldArms they are moved into the segment's global state when it has
+	// no arm for the product
+	ArmTTL   time.Duration
+	FoldArms bool
+
+	// user states with more arms are shrunk to their MaxArms most
+	// recently updated
+	MaxArms int
+
+	// user states read per page
+	BatchSize int
+}
+
+// StateGCReport sums up one compaction pass.
+type StateGCReport struct {
+	IdleDeleted    int64
+	EmptyDeleted   int64
+	Compacted      int64
+	ArmsFolded     int64
+	ArmsDropped    int64
+	BytesReclaimed int64
+}
+
+// StateCompactor keeps per-user states from growing without bound: it
+// deletes idle ones and removes decayed arms from the rest.
+type StateCompactor struct {
+	repo StateGCRepository
+	jobs JobRunClaimer
+	cfg  StateGCConfig
+}
+
+// NewStateCompactor builds a compactor; with jobs, scheduled passes are run
+// by one replica per Interval.
+func NewStateCompactor(repo StateGCRepository, jobs JobRunClaimer, cfg StateGCConfig) *StateCompactor {
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultStateGCInterval
+	}
+	if cfg.IdleTTL <= 0 {
+		cfg.IdleTTL = defaultStateGCIdleTTL
+	}
+	if cfg.ArmTTL <= 0 {
+		cfg.ArmTTL = defaultStateGCArmTTL
+	}
+	if cfg.MaxArms <= 0 {
+		cfg.MaxArms = defaultStateGCMaxArms
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultStateGCBatchSize
+	}
+	return &StateCompactor{repo: repo, jobs: jobs, cfg: cfg}
+}
+
+// Run compacts the user states each Interval until ctx is cancelled. Only
+// the replica that claims a pass runs it, so replicas neither repeat the
+// scan nor conflict on each other's writes.
+func (c *StateCompactor) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !claimJobRun(ctx, c.jobs, "bandit_state_gc", c.cfg.Interval) {
+				continue
+			}
+			report, err := c.Compact(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					logger.Error("bandit_state_gc_failed", "error", err)
+				}
+				continue
+			}
+			logger.Info("bandit_state_gc_done",
+				"idle_deleted", report.IdleDeleted,
+				"empty_deleted", report.EmptyDeleted,
+				"compacted", report.Compacted,
+				"arms_folded", report.ArmsFolded,
+				"arms_dropped", report.ArmsDropped,
+				"bytes_reclaimed", report.BytesReclaimed,
+			)
+		}
+	}
+}
+
+// Compact runs one pass: idle user states are deleted, then every other
+// user state loses its decayed arms and is shrunk to MaxArms. States left
+// without arms are deleted. A state saved while it is being compacted is
+// skipped until the next pass. Bytes reclaimed count user states only;
+// folded arms grow the global states.
+func (c *StateCompactor) Compact(ctx context.Context) (StateGCReport, error) {
+	var report StateGCReport
+	now := time.Now()
+
+	states, bytes, err := c.repo.DeleteIdleUserStates(ctx, now.Add(-c.cfg.IdleTTL))
+	if err != nil {
+		return report, err
+	}
+	report.IdleDeleted = states
+	report.BytesReclaimed += bytes
+	BanditStateGCStatesTotal.WithLabelValues("deleted_idle").Add(float64(states))
+	BanditStateGCReclaimedBytesTotal.WithLabelValues("deleted_idle").Add(float64(bytes))
+
+	armCutoff := now.Add(-c.cfg.ArmTTL)
+	afterKey := ""
+	for {
+		page, err := c.repo.ListUserStates(ctx, afterKey, c.cfg.BatchSize)
+		if err != nil {
+			return report, err
+		}
+
+		// arms to fold, by global state key
+		folds := make(map[string][]foldedArm)
+		for _, stored := range page {
+			c.compactState(ctx, stored, armCutoff, folds, &report)
+		}
+		for key, arms := range folds {
+			c.foldArms(ctx, key, arms, &report)
+		}
+
+		if len(page) < c.cfg.BatchSize {
+			return report, nil
+		}
+		afterKey = page[len(page)-1].Key
+	}
+}
+
+// foldedArm is a decayed user arm on its way to the global state.
+type foldedArm struct {
+	productID uint64
+	features  []string
+	arm       *LinUCBArmState
+}
+
+func (c *StateCompactor) compactState(
+	ctx context.Context,
+	stored StoredState,
+	armCutoff time.Time,
+	folds map[string][]foldedArm,
+	report *StateGCReport,
+) {
+
+	st := stored.State
+	var decayed []foldedArm
+	refresh := false
+	for pid, arm := range st.Arms {
+		if arm.LastUpdated.Before(armCutoff) {
+			decayed = append(decayed, foldedArm{productID: pid, features: st.Features, arm: arm})
+			refresh = removeArm(st, pid) || refresh
+		}
+	}
+	if refresh {
+		st.Hybrid.refreshInverse()
+	}
+	before := len(st.Arms)
+	capArms(st, c.cfg.MaxArms)
+	dropped := before - len(st.Arms)
+
+	if len(decayed) == 0 && dropped == 0 {
+		return
+	}
+
+	if len(st.Arms) == 0 {
+		if err := c.repo.DeleteState(ctx, stored.Key, st.Revision); err != nil {
+			c.logSkipped(stored.Key, err)
+			return
+		}
+		report.EmptyDeleted++
+		report.BytesReclaimed += int64(stored.Bytes)
+		BanditStateGCStatesTotal.WithLabelValues("deleted_empty").Inc()
+		BanditStateGCReclaimedBytesTotal.WithLabelValues("deleted_empty").Add(float64(stored.Bytes))
+	} else {
+		size, err := c.repo.CompactState(ctx, stored.Key, st)
+		if err != nil {
+			c.logSkipped(stored.Key, err)
+			return
+		}
+		report.Compacted++
+		if reclaimed := stored.Bytes - size; reclaimed > 0 {
+			report.BytesReclaimed += int64(reclaimed)
+			BanditStateGCReclaimedBytesTotal.WithLabelValues("compacted").Add(float64(reclaimed))
+		}
+		BanditStateGCStatesTotal.WithLabelValues("compacted").Inc()
+	}
+
+	if key, ok := globalKeyOfUserState(stored.Key); ok && c.cfg.FoldArms && len(decayed) > 0 {
+		folds[key] = append(folds[key], decayed...)
+	} else {
+		dropped += len(decayed)
+	}
+	report.ArmsDropped += int64(dropped)
+	BanditStateGCArmsTotal.WithLabelValues("dropped").Add(float64(dropped))
+}
+
+// foldArms moves decayed user arms into a global state. Only products the
+// global state has no arm for are folded: the global state learned every
+// event its users' states did, so merging into an existing arm would count
+// them twice. Arms on another feature layout, or coupled to the user's
+// hybrid block, are dropped.
+func (c *StateCompactor) foldArms(ctx context.Context, key string, arms []foldedArm, report *StateGCReport) {
+	for attempt := 0; ; attempt++ {
+		st, err := c.repo.GetState(ctx, key)
+		if err != nil || st == nil {
+			break
+		}
+
+		folded := 0
+		for _, f := range arms {
+			if _, ok := st.Arms[f.productID]; ok || f.arm.BZ != nil || !slices.Equal(f.features, st.Features) {
+				continue
+			}
+			st.Arms[f.productID] = f.arm
+			folded++
+		}
+		if folded == 0 {
+			break
+		}
+
+		err = c.repo.SaveState(ctx, key, st)
+		if err == nil {
+			report.ArmsFolded += int64(folded)
+			report.ArmsDropped += int64(len(arms) - folded)
+			BanditStateGCArmsTotal.WithLabelValues("folded").Add(float64(folded))
+			BanditStateGCArmsTotal.WithLabelValues("dropped").Add(float64(len(arms) - folded))
+			return
+		}
+		if !errors.Is(err, ErrStateConflict) || attempt >= maxStateRetries {
+			c.logSkipped(key, err)
+			break
+		}
+		BanditStateConflictsTotal.Inc()
+	}
+
+	report.ArmsDropped += int64(len(arms))
+	BanditStateGCArmsTotal.WithLabelValues("dropped").Add(float64(len(arms)))
+}
+
+func (c *StateCompactor) logSkipped(key string, err error) {
+	if errors.Is(err, ErrStateConflict) {
+		return
+	}
+	logger.Warn("bandit_state_gc_skipped", "state", key, "error", err)
+}
+
+// globalKeyOfUserState maps "slot|seg=N|user=U" to "slot|seg=N|global".
+func globalKeyOfUserState(key string) (string, bool) {
+	i := strings.LastIndex(key, "|user=")
+	if i < 0 {
+		return "", false
 	}
+	return key[:i] + "|global", true
 }
@@ -0,0 +1,166 @@
+//go:build !integration
+
+package bandit
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memGCRepo adds the compactor's queries to memStateRepo. Rows saved with
+// SaveState are stamped with the repo's clock; CompactState keeps the stamp.
+type memGCRepo struct {
+	*memStateRepo
+	now     time.Time
+	updated map[string]time.Time
+}
+
+func newMemGCRepo(now time.Time) *memGCRepo {
+	return &memGCRepo{memStateRepo: newMemStateRepo(), now: now, updated: make(map[string]time.Time)}
+}
+
+func (r *memGCRepo) SaveState(ctx context.Context, key string, st *LinUCBState) error {
+	if err := r.memStateRepo.SaveState(ctx, key, st); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.updated[key] = r.now
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *memGCRepo) DeleteIdleUserStates(_ context.Context, before time.Time) (int64, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var states, bytes int64
+	for key, row := range r.rows {
+		if strings.Contains(key, "|user=") && r.updated[key].Before(before) {
+			states++
+			bytes += int64(len(row.raw))
+			delete(r.rows, key)
+		}
+	}
+	return states, bytes, nil
+}
+
+func (r *memGCRepo) ListUserStates(ctx context.Context, afterKey string, limit int) ([]StoredState, error) {
+	r.mu.Lock()
+	var keys []string
+	for key := range r.rows {
+		if strings.Contains(key, "|user=") && key > afterKey {
+			keys = append(keys, key)
+		}
+	}
+	r.mu.Unlock()
+
+	sort.Strings(keys)
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+	out := make([]StoredState, 0, len(keys))
+	for _, key := range keys {
+		st, err := r.GetState(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, StoredState{Key: key, State: st, Bytes: len(r.rows[key].raw)})
+	}
+	return out, nil
+}
+
+func (r *memGCRepo) CompactState(ctx context.Context, key string, st *LinUCBState) (int, error) {
+	if err := r.memStateRepo.SaveState(ctx, key, st); err != nil {
+		return 0, err
+	}
+	raw, _ := json.Marshal(st)
+	return len(raw), nil
+}
+
+func (r *memGCRepo) DeleteState(_ context.Context, key string, revision int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.rows[key].version != revision {
+		return ErrStateConflict
+	}
+	delete(r.rows, key)
+	return nil
+}
+
+func TestStateCompactor(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	repo := newMemGCRepo(now)
+	features := []string{"bias", "price"}
+
+	stateWith := func(arms map[uint64]time.Time) *LinUCBState {
+		st := newDefaultState(features)
+		for pid, updated := range arms {
+			arm := newArmState(len(features))
+			arm.Count = 3
+			arm.LastUpdated = updated
+			st.Arms[pid] = arm
+		}
+		return st
+	}
+	save := func(key string, st *LinUCBState, at time.Time) {
+		repo.now = at
+		if err := repo.SaveState(ctx, key, st); err != nil {
+			t.Fatalf("save %s: %v", key, err)
+		}
+	}
+
+	fresh, stale := now.Add(-time.Hour), now.Add(-10*24*time.Hour)
+	save("home|seg=1|global", stateWith(map[uint64]time.Time{1: fresh}), now)
+	save("home|seg=1|user=1", stateWith(map[uint64]time.Time{1: stale}), now.Add(-60*24*time.Hour)) // idle
+	save("home|seg=1|user=2", stateWith(map[uint64]time.Time{1: stale, 2: stale, 3: fresh}), fresh)
+	save("home|seg=1|user=3", stateWith(map[uint64]time.Time{4: stale}), stale)
+	save("home|seg=1|user=4", stateWith(map[uint64]time.Time{5: fresh, 6: fresh.Add(-time.Minute), 7: fresh.Add(-2 * time.Minute)}), fresh)
+
+	c := NewStateCompactor(repo, nil, StateGCConfig{
+		IdleTTL:   30 * 24 * time.Hour,
+		ArmTTL:    7 * 24 * time.Hour,
+		FoldArms:  true,
+		MaxArms:   2,
+		BatchSize: 2,
+	})
+	report, err := c.Compact(ctx)
+	if err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+
+	if report.IdleDeleted != 1 || report.EmptyDeleted != 1 || report.Compacted != 2 {
+		t.Errorf("report = %+v, want 1 idle, 1 empty and 2 compacted states", report)
+	}
+	// arms 2 and 4 fold; arm 1 stays in the global state only once; arm 7
+	// is over the cap
+	if report.ArmsFolded != 2 || report.ArmsDropped != 2 {
+		t.Errorf("report = %+v, want 2 arms folded and 2 dropped", report)
+	}
+	if report.BytesReclaimed <= 0 {
+		t.Errorf("reclaimed %d bytes, want > 0", report.BytesReclaimed)
+	}
+
+	for _, key := range []string{"home|seg=1|user=1", "home|seg=1|user=3"} {
+		if st, _ := repo.GetState(ctx, key); st != nil {
+			t.Errorf("%s still stored", key)
+		}
+	}
+	user2, _ := repo.GetState(ctx, "home|seg=1|user=2")
+	if len(user2.Arms) != 1 || user2.Arms[3] == nil {
+		t.Errorf("user 2 arms = %v, want only arm 3", user2.Arms)
+	}
+	user4, _ := repo.GetState(ctx, "home|seg=1|user=4")
+	if len(user4.Arms) != 2 || user4.Arms[7] != nil {
+		t.Errorf("user 4 arms = %v, want arms 5 and 6", user4.Arms)
+	}
+	global, _ := repo.GetState(ctx, "home|seg=1|global")
+	if len(global.Arms) != 3 || !global.Arms[1].LastUpdated.Equal(fresh) {
+		t.Errorf("global arms = %v, want its own arm 1 plus folded arms 2 and 4", global.Arms)
+	}
+}
@@ -0,0 +1,356 @@
+package bandit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+)
+
+const (
+	defaultGuardrailInterval       = 10 * time.Minute
+	defaultGuardrailWindow         = 24 * time.Hour
+	defaultGuardrailMinImpressions = 1000
+	defaultGuardrailMaxDrop        = 0.2
+	defaultGuardrailAlpha          = 0.05
+)
+
+// NotificationRepository sends alert emails.
+type NotificationRepository interface {
+	SendEmail(toName, toEmail, subject, message string) (err error)
+}
+
+// OverrideRepository stores guardrail pauses.
+type OverrideRepository interface {
+	ActiveOverrides(ctx context.Context) ([]domain.BanditVariantOverride, error)
+
+	// CreateOverride stores the override unless the variant is already
+	// paused; created reports whether this call paused it.
+	CreateOverride(ctx context.Context, o domain.BanditVariantOverride) (created bool, err error)
+
+	ClearOverride(ctx context.Context, slot string, variant int) error
+}
+
+// SlotLister lists the slots that served traffic since a time.
+type SlotLister interface {
+	ActiveSlots(ctx context.Context, since time.Time) ([]string, error)
+}
+
+// VariantReporter computes per-variant metrics against a control.
+type VariantReporter interface {
+	Report(ctx context.Context, req ReportRequest) (domain.ExperimentReport, error)
+}
+
+type GuardrailConfig struct {
+	// how often variants are evaluated and overrides reloaded
+	Interval time.Duration
+
+	// how much recent traffic a variant is judged on
+	Window time.Duration
+
+	// both the variant and the control need this many impressions
+	MinImpressions int64
+
+	// pause when CTR or conversion is this much lower than control
+	// (relative, 0.2 = 20%) and the drop is significant at Alpha
+	MaxDrop float64
+	Alpha   float64
+
+	// alert recipient; empty disables emails
+	AlertEmail string
+	AlertName  string
+}
+
+// GuardrailMonitor compares every bandit variant with the offline-only
+// control and pauses variants that do clearly worse, routing their users
+// to VariantOfflineOnly until an admin clears the override.
+type GuardrailMonitor struct {
+	reporter  VariantReporter
+	slots     SlotLister
+	overrides OverrideRepository
+	notifier  NotificationRepository
+	cfg       GuardrailConfig
+
+	mu     sync.RWMutex
+	active map[string]map[int]domain.BanditVariantOverride // slot -> variant
+}
+
+func NewGuardrailMonitor(
+	reporter VariantReporter,
+	slots SlotLister,
+	overrides OverrideRepository,
+	notifier NotificationRepository,
+	cfg GuardrailConfig,
+) *GuardrailMonitor {
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultGuardrailInterval
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = defaultGuardrailWindow
+	}
+	if cfg.MinImpressions <= 0 {
+		cfg.MinImpressions = defaultGuardrailMinImpressions
+	}
+	if cfg.MaxDrop <= 0 {
+		cfg.MaxDrop = defaultGuardrailMaxDrop
+	}
+	if cfg.Alpha <= 0 {
+		cfg.Alpha = defaultGuardrailAlpha
+	}
+	if cfg.AlertName == "" {
+		cfg.AlertName = "Bandit on-call"
+	}
+	return &GuardrailMonitor{
+		reporter:  reporter,
+		slots:     slots,
+		overrides: overrides,
+		notifier:  notifier,
+		cfg:       cfg,
+		active:    make(map[string]map[int]domain.BanditVariantOverride),
+	}
+}
+
+// Route returns the variant to serve: VariantOfflineOnly (the override's
+// target) for a paused variant, the variant itself otherwise.
+func (g *GuardrailMonitor) Route(slot string, variant int) int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if o, ok := g.active[slot][variant]; ok {
+		return o.RouteTo
+	}
+	return variant
+}
+
+// Run reloads overrides and evaluates every active slot each Interval
+// until ctx is cancelled.
+func (g *GuardrailMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(g.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := g.Reload(ctx); err != nil && ctx.Err() == nil {
+			logger.Error("bandit_guardrail_reload_failed", "error", err)
+		}
+		if err := g.Evaluate(ctx); err != nil && ctx.Err() == nil {
+			logger.Error("bandit_guardrail_evaluate_failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunReload only reloads overrides each Interval until ctx is cancelled,
+// for instances that serve pauses but do not evaluate guardrails.
+func (g *GuardrailMonitor) RunReload(ctx context.Context) {
+	ticker := time.NewTicker(g.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := g.Reload(ctx); err != nil && ctx.Err() == nil {
+			logger.Error("bandit_guardrail_reload_failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reload refreshes the in-memory overrides, so pauses made or cleared by
+// other instances take effect here.
+func (g *GuardrailMonitor) Reload(ctx context.Context) error {
+	list, err := g.overrides.ActiveOverrides(ctx)
+	if err != nil {
+		return fmt.Errorf("load overrides: %w", err)
+	}
+
+	active := make(map[string]map[int]domain.BanditVariantOverride)
+	for _, o := range list {
+		if active[o.Slot] == nil {
+			active[o.Slot] = make(map[int]domain.BanditVariantOverride)
+		}
+		active[o.Slot][o.Variant] = o
+	}
+
+	g.mu.Lock()
+	prev := g.active
+	g.active = active
+	g.mu.Unlock()
+
+	// keep the alert gauge in step with what is paused
+	for slot, variants := range prev {
+		for v := range variants {
+			if _, ok := active[slot][v]; !ok {
+				BanditGuardrailPaused.WithLabelValues(slot, strconv.Itoa(v)).Set(0)
+			}
+		}
+	}
+	for slot, variants := range active {
+		for v := range variants {
+			BanditGuardrailPaused.WithLabelValues(slot, strconv.Itoa(v)).Set(1)
+		}
+	}
+	return nil
+}
+
+// Overrides lists the active pauses.
+func (g *GuardrailMonitor) Overrides(ctx context.Context) ([]domain.BanditVariantOverride, error) {
+	return g.overrides.ActiveOverrides(ctx)
+}
+
+// Resume clears a pause.
+func (g *GuardrailMonitor) Resume(ctx context.Context, slot string, variant int) error {
+	if err := g.overrides.ClearOverride(ctx, slot, variant); err != nil {
+		return err
+	}
+	logger.Info("bandit_guardrail_resumed", "slot", slot, "variant", variant)
+	return g.Reload(ctx)
+}
+
+// Evaluate checks every slot that served traffic in the window.
+func (g *GuardrailMonitor) Evaluate(ctx context.Context) error {
+	now := time.Now()
+	from := now.Add(-g.cfg.Window)
+
+	slots, err := g.slots.ActiveSlots(ctx, from)
+	if err != nil {
+		return fmt.Errorf("list slots: %w", err)
+	}
+
+	for _, slot := range slots {
+		if err := g.evaluateSlot(ctx, slot, from, now); err != nil {
+			logger.Error("bandit_guardrail_slot_failed", "slot", slot, "error", err)
+		}
+	}
+	return nil
+}
+
+// evaluateSlot compares the slot's variants with the offline-only control.
+// The report groups traffic by assignment, so users rerouted to offline-only
+// by an earlier pause are not counted in the control.
+func (g *GuardrailMonitor) evaluateSlot(ctx context.Context, slot string, from, to time.Time) error {
+	control := VariantOfflineOnly
+	report, err := g.reporter.Report(ctx, ReportRequest{
+		Slot:    slot,
+		From:    from,
+		To:      to,
+		Control: &control,
+	})
+	if err != nil {
+		return err
+	}
+
+	var ctl *domain.VariantReport
+	for i := range report.Variants {
+		if report.Variants[i].Variant == control {
+			ctl = &report.Variants[i]
+		}
+	}
+	if ctl == nil || ctl.Impressions < g.cfg.MinImpressions {
+		return nil
+	}
+
+	for _, vr := range report.Variants {
+		if vr.Variant == control || vr.Impressions < g.cfg.MinImpressions {
+			continue
+		}
+		if g.Route(slot, vr.Variant) != vr.Variant {
+			continue // already paused
+		}
+
+		metric, reason, breached := g.breach(vr)
+		if !breached {
+			continue
+		}
+		BanditGuardrailBreachesTotal.WithLabelValues(slot, strconv.Itoa(vr.Variant), metric).Inc()
+
+		if err := g.pause(ctx, slot, vr.Variant, metric, reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// breach reports the first guarded metric on which the variant does
+// significantly worse than control by more than MaxDrop.
+func (g *GuardrailMonitor) breach(vr domain.VariantReport) (string, string, bool) {
+	for _, metric := range []string{"ctr", "conversion_rate"} {
+		cmp, ok := vr.VsControl[metric]
+		if !ok {
+			continue
+		}
+		if cmp.Lift <= -g.cfg.MaxDrop && cmp.ZScore < 0 && cmp.PValue < g.cfg.Alpha {
+			reason := fmt.Sprintf(
+				"%s %.1f%% vs offline-only control (p=%.4f, %d impressions)",
+				metric, cmp.Lift*100, cmp.PValue, vr.Impressions,
+			)
+			return metric, reason, true
+		}
+	}
+	return "", "", false
+}
+
+func (g *GuardrailMonitor) pause(ctx context.Context, slot string, variant int, metric, reason string) error {
+	o := domain.BanditVariantOverride{
+		Slot:    slot,
+		Variant: variant,
+		RouteTo: VariantOfflineOnly,
+		Metric:  metric,
+		Reason:  reason,
+	}
+
+	created, err := g.overrides.CreateOverride(ctx, o)
+	if err != nil {
+		return fmt.Errorf("save override: %w", err)
+	}
+
+	g.mu.Lock()
+	if g.active[slot] == nil {
+		g.active[slot] = make(map[int]domain.BanditVariantOverride)
+	}
+	g.active[slot][variant] = o
+	g.mu.Unlock()
+	BanditGuardrailPaused.WithLabelValues(slot, strconv.Itoa(variant)).Set(1)
+
+	// another instance may have paused it first; only one alert is sent
+	if !created {
+		return nil
+	}
+
+	logger.Warn("bandit_guardrail_paused",
+		"slot", slot,
+		"variant", variant,
+		"metric", metric,
+		"reason", reason,
+	)
+	g.notify(slot, variant, reason)
+	return nil
+}
+
+func (g *GuardrailMonitor) notify(slot string, variant int, reason string) {
+	if g.notifier == nil || g.cfg.AlertEmail == "" {
+		return
+	}
+
+	subject := fmt.Sprintf("[bandit guardrail] %s variant %d paused", slot, variant)
+	message := fmt.Sprintf(
+		"<p>Variant <b>%d</b> of slot <b>%s</b> was paused and its users are now served the offline-only variant.</p>"+
+			"<p>Reason: %s</p>"+
+			"<p>Clear the override with DELETE /api/v1/admin/bandit/guardrails/%s/%d once the config is fixed.</p>",
+		variant, slot, reason, slot, variant,
+	)
+	if err := g.notifier.SendEmail(g.cfg.AlertName, g.cfg.AlertEmail, subject, message); err != nil {
+		logger.Error("bandit_guardrail_email_failed", "slot", slot, "variant", variant, "error", err)
+	}
+}
@@ -0,0 +1,301 @@
+package bandit
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Hybrid LinUCB (Li et al. 2010, algorithm 2).
+//
+// Every arm keeps its own ridge block (A, b) over the context x, and every
+// global state keeps one shared block (A0, b0) over cross features z = x ⊗ p,
+// where p describes the product. User states see too few events to fit a
+// block of that size, so their arms stay plain ridge arms. The shared coefficients β generalise across
+// products, so an arm with few events is still scored by what similar
+// products taught the model. B_z couples each arm to the shared block.
+
+// HybridState is the shared block of a state.
+type HybridState struct {
+	A0 [][]float64 `json:"A0"`
+	B0 []float64   `json:"b0"`
+
+	// A0⁻¹ and β, recomputed after every update so serving never inverts
+	A0Inv [][]float64 `json:"A0_inv,omitempty"`
+	Beta  []float64   `json:"beta,omitempty"`
+}
+
+// SharedStats are the per-request inverses of a state's shared block.
+type SharedStats struct {
+	A0Inv [][]float64
+	Beta  []float64 // A0⁻¹ b0
+}
+
+func newHybridState(k int) *HybridState {
+	A0 := newMatrix(k)
+	A0Inv := newMatrix(k)
+	for i := 0; i < k; i++ {
+		A0[i][i] = armPrior
+		A0Inv[i][i] = 1 / armPrior
+	}
+	return &HybridState{A0: A0, B0: make([]float64, k), A0Inv: A0Inv, Beta: make([]float64, k)}
+}
+
+func (h *HybridState) hasInverse() bool {
+	k := len(h.B0)
+	return len(h.A0Inv) == k && len(h.Beta) == k
+}
+
+// refreshInverse recomputes A0⁻¹ and β. The Schur updates to A0 are not
+// rank-one, so there is no cheap incremental form; this runs once per
+// learned event instead of once per request.
+func (h *HybridState) refreshInverse() {
+	A0Inv, ok := invertSPD(h.A0)
+	if !ok {
+		*h = *newHybridState(len(h.B0))
+		return
+	}
+	h.A0Inv = A0Inv
+	h.Beta = matVecMul(A0Inv, h.B0)
+}
+
+// productCrossDim is the width of the product descriptor p in z = x ⊗ p.
+const productCrossDim = 3 + categoryEmbDim
+
+// productDescriptor is p: a constant, green tag, discount and the category
+// embedding. The constant makes z contain x itself, so the shared block also
+// learns a product-independent context model.
+func productDescriptor(product *ProductAttributes) []float64 {
+	p := make([]float64, productCrossDim)
+	p[0] = 1.0
+	if product == nil {
+		return p
+	}
+	in := FeatureInput{Product: product}
+	if product.IsGreenTag {
+		p[1] = 1.0
+	}
+	p[2] = discountFeature(in)
+	categoryEmbeddingFeature(Config{}).Extract(in, p[3:])
+	return p
+}
+
+// crossFeatures returns z = x ⊗ p for shared policies, nil otherwise.
+func crossFeatures(policy Policy, x []float64, product *ProductAttributes) []float64 {
+	if _, ok := policy.(SharedPolicy); !ok {
+		return nil
+	}
+	p := productDescriptor(product)
+	z := make([]float64, 0, len(x)*len(p))
+	for _, xi := range x {
+		for _, pj := range p {
+			z = append(z, xi*pj)
+		}
+	}
+	return z
+}
+
+// sharedStats returns a state's shared block statistics for shared
+// policies. A state without a block yet is scored with the prior.
+func sharedStats(policy Policy, st *LinUCBState) *SharedStats {
+	if _, ok := policy.(SharedPolicy); !ok {
+		return nil
+	}
+	h := st.Hybrid
+	if h == nil {
+		h = newHybridState(len(st.Features) * productCrossDim)
+	}
+	if !h.hasInverse() {
+		// never mutate a state being served; loadState fills these in
+		tmp := &HybridState{A0: h.A0, B0: h.B0}
+		tmp.refreshInverse()
+		h = tmp
+	}
+	return &SharedStats{A0Inv: h.A0Inv, Beta: h.Beta}
+}
+
+// ---- policy ----
+
+type hybridLinUCBPolicy struct {
+	ridgeUpdate
+	alpha float64
+}
+
+var _ SharedPolicy = (*hybridLinUCBPolicy)(nil)
+
+func newHybridLinUCBPolicy(params map[string]float64) (Policy, error) {
+	alpha := param(params, "alpha", defaultAlpha)
+	if alpha < 0 {
+		return nil, fmt.Errorf("hybrid_linucb: alpha must be >= 0")
+	}
+	return &hybridLinUCBPolicy{alpha: alpha}, nil
+}
+
+func (p *hybridLinUCBPolicy) Name() string     { return PolicyHybridLinUCB }
+func (p *hybridLinUCBPolicy) Stochastic() bool { return false }
+
+func (p *hybridLinUCBPolicy) Score(arms []PolicyArm) []float64 {
+	out := make([]float64, len(arms))
+	for i, a := range arms {
+		out[i] = a.Mean() + p.alpha*hybridUncertainty(a)
+	}
+	return out
+}
+
+func (p *hybridLinUCBPolicy) Explain(arm PolicyArm) map[string]float64 {
+	shared := 0.0
+	if arm.Shared != nil && len(arm.Z) > 0 {
+		shared = dot(arm.Shared.Beta, arm.Z)
+	}
+	u := hybridUncertainty(arm)
+	return map[string]float64{
+		"mean_shared": shared,
+		"mean_arm":    dot(arm.Theta, arm.X),
+		"uncertainty": u,
+		"alpha":       p.alpha,
+		"score":       arm.Mean() + p.alpha*u,
+	}
+}
+
+// hybridUncertainty is sqrt(s) with
+//
+//	s = zᵀA0⁻¹z − 2zᵀA0⁻¹B_zᵀA⁻¹x + xᵀA⁻¹x + xᵀA⁻¹B_z A0⁻¹B_zᵀA⁻¹x
+func hybridUncertainty(a PolicyArm) float64 {
+	u := matVecMul(a.AInv, a.X) // A⁻¹x
+	s := dot(a.X, u)
+
+	if a.Shared != nil && len(a.Z) > 0 {
+		w := make([]float64, len(a.Z)) // B_zᵀA⁻¹x
+		if a.BZ != nil {
+			w = matTVecMul(a.BZ, u)
+		}
+		A0z := matVecMul(a.Shared.A0Inv, a.Z)
+		A0w := matVecMul(a.Shared.A0Inv, w)
+		s += dot(a.Z, A0z) - 2*dot(a.Z, A0w) + dot(w, A0w)
+	}
+	return math.Sqrt(math.Max(s, 0))
+}
+
+// UpdateShared is the hybrid update: take the arm's Schur term out of the
+// shared block, update the arm, then put the new term back.
+func (p *hybridLinUCBPolicy) UpdateShared(
+	st *LinUCBState,
+	arm *LinUCBArmState,
+	x, z []float64,
+	reward float64,
+	now time.Time,
+) {
+	k := len(z)
+	if st.Hybrid == nil || len(st.Hybrid.B0) != k {
+		st.Hybrid = newHybridState(k)
+	}
+	if len(arm.BZ) != len(x) || (len(arm.BZ) > 0 && len(arm.BZ[0]) != k) {
+		arm.BZ = make([][]float64, len(x))
+		for i := range arm.BZ {
+			arm.BZ[i] = make([]float64, k)
+		}
+	}
+	h := st.Hybrid
+
+	// A0 += B_zᵀA⁻¹B_z ; b0 += B_zᵀA⁻¹b
+	addSchur(h, arm, 1)
+
+	// the shared block forgets at the arms' rate. Arms decay when they
+	// learn, so the Schur terms other arms left in A0 fade with the block
+	// until their next update replaces them.
+	decayShared(h)
+	applyDecay(arm)
+	observe(arm, x, reward)
+	for i := range x {
+		for j := range z {
+			arm.BZ[i][j] += x[i] * z[j]
+		}
+	}
+	arm.Count++
+	arm.LastUpdated = now
+
+	// A0 += zzᵀ − B_zᵀA⁻¹B_z ; b0 += r z − B_zᵀA⁻¹b
+	addOuter(h.A0, z)
+	addScaled(h.B0, z, reward)
+	addSchur(h, arm, -1)
+	h.refreshInverse()
+}
+
+// dropHybrid strips the shared block and every arm's coupling to it from a
+// state, for user states written while they still carried one.
+func dropHybrid(st *LinUCBState) {
+	if st.Hybrid == nil {
+		return
+	}
+	st.Hybrid = nil
+	for _, arm := range st.Arms {
+		arm.BZ = nil
+	}
+}
+
+// decayShared scales A0 and b0 by the arms' decay factor.
+func decayShared(h *HybridState) {
+	if decayRate <= 0 {
+		return
+	}
+	decay := 1.0 - decayRate
+
+	for i := range h.A0 {
+		for j := range h.A0[i] {
+			h.A0[i][j] *= decay
+		}
+		h.B0[i] *= decay
+	}
+}
+
+// removeArm deletes an arm from a state. An arm coupled to the shared block
+// takes its Schur term out of A0 and b0 with it, leaving the block its
+// events taught as though they had no arm of their own. It reports whether
+// the block changed and needs refreshInverse.
+func removeArm(st *LinUCBState, productID uint64) bool {
+	arm, ok := st.Arms[productID]
+	delete(st.Arms, productID)
+
+	h := st.Hybrid
+	if !ok || h == nil || len(arm.BZ) == 0 || len(arm.BZ) != len(arm.B) || len(arm.BZ[0]) != len(h.B0) {
+		return false
+	}
+	addSchur(h, arm, 1)
+	return true
+}
+
+// addSchur adds sign·B_zᵀA⁻¹B_z to A0 and sign·B_zᵀA⁻¹b to b0.
+func addSchur(h *HybridState, arm *LinUCBArmState, sign float64) {
+	ensureInverse(arm)
+	AInv := arm.AInv
+	k := len(h.B0)
+
+	// C = A⁻¹ B_z (d×k)
+	C := make([][]float64, len(arm.A))
+	for i := range C {
+		C[i] = make([]float64, k)
+		for j := range arm.BZ {
+			if AInv[i][j] == 0 {
+				continue
+			}
+			for c := 0; c < k; c++ {
+				C[i][c] += AInv[i][j] * arm.BZ[j][c]
+			}
+		}
+	}
+
+	for r := range arm.BZ {
+		for i := 0; i < k; i++ {
+			bri := arm.BZ[r][i]
+			if bri == 0 {
+				continue
+			}
+			for j := 0; j < k; j++ {
+				h.A0[i][j] += sign * bri * C[r][j]
+			}
+		}
+	}
+
+	w := matTVecMul(arm.BZ, arm.Theta)
+	addScaled(h.B0, w, sign)
+}
@@ -0,0 +1,107 @@
+//go:build !integration
+
+package bandit
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// hybridEvents returns a hybrid policy, its config and feature layout, and
+// a source of random (x, z, reward) events for one product.
+func hybridEvents(t *testing.T) (Policy, Config, []string, func() ([]float64, []float64, float64)) {
+	t.Helper()
+
+	cfg := DefaultConfig()
+	dims := pipelineFor(cfg).dims
+	policy, err := NewPolicy(PolicyHybridLinUCB, nil)
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+
+	rng := rand.New(rand.NewSource(3))
+	product := &ProductAttributes{IsGreenTag: true, CategoryID: 4, Discount: 0.2}
+	next := func() ([]float64, []float64, float64) {
+		x := make([]float64, len(dims))
+		x[0] = 1
+		for i := 1; i < len(x); i++ {
+			x[i] = rng.Float64()
+		}
+		reward := 0.0
+		if rng.Float64() < 0.4 {
+			reward = 1
+		}
+		return x, crossFeatures(policy, x, product), reward
+	}
+	return policy, cfg, dims, next
+}
+
+// Removing the only arm of a global state leaves the decayed sum of the
+// events' zzᵀ on the prior: the block without the arm's Schur term.
+func TestRemoveArmTakesSchurTermOutOfSharedBlock(t *testing.T) {
+	policy, cfg, dims, next := hybridEvents(t)
+	global := newDefaultState(dims)
+	user := newDefaultState(dims)
+
+	k := len(dims) * productCrossDim
+	want := newMatrix(k)
+	for i := range want {
+		want[i][i] = armPrior
+	}
+
+	now := time.Now()
+	for n := 0; n < 60; n++ {
+		x, z, reward := next()
+		learn(policy, cfg, global, user, 1, x, z, reward, now)
+
+		for i := range want {
+			for j := range want[i] {
+				want[i][j] = want[i][j]*(1-decayRate) + z[i]*z[j]
+			}
+		}
+	}
+
+	if global.Hybrid == nil || global.Arms[1].BZ == nil {
+		t.Fatal("global state learned no hybrid block")
+	}
+	if user.Hybrid != nil || user.Arms[1].BZ != nil {
+		t.Fatal("user state carries a hybrid block")
+	}
+
+	if !removeArm(global, 1) {
+		t.Fatal("removeArm did not touch the shared block")
+	}
+	for i := range want {
+		for j := range want[i] {
+			if diff := math.Abs(global.Hybrid.A0[i][j] - want[i][j]); diff > 1e-7*math.Max(1, math.Abs(want[i][j])) {
+				t.Fatalf("A0[%d][%d] = %v, want %v", i, j, global.Hybrid.A0[i][j], want[i][j])
+			}
+		}
+	}
+}
+
+// A user state stored with a hybrid block loses it on its next update.
+func TestUserStateDropsHybridBlock(t *testing.T) {
+	policy, cfg, dims, next := hybridEvents(t)
+	global := newDefaultState(dims)
+	user := newDefaultState(dims)
+
+	x, z, reward := next()
+	learnState(policy, cfg, user, true, 1, x, z, reward, time.Now())
+	if user.Hybrid == nil {
+		t.Fatal("setup: no hybrid block")
+	}
+
+	x, z, reward = next()
+	learn(policy, cfg, global, user, 2, x, z, reward, time.Now())
+	if user.Hybrid != nil {
+		t.Fatal("user state kept its hybrid block")
+	}
+	for pid, arm := range user.Arms {
+		if arm.BZ != nil {
+			t.Fatalf("user arm %d kept B_z", pid)
+		}
+	}
+}
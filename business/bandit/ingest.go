@@ -0,0 +1,451 @@
+package bandit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+)
+
+// ErrQueueFull is returned when the feedback backlog is over its limit;
+// clients should retry later.
+var ErrQueueFull = errors.New("bandit feedback queue is full")
+
+// QueuedFeedback is one event read back from the feedback queue.
+type QueuedFeedback struct {
+	ID         string
+	Event      domain.BanditEvent
+	Attempts   int
+	EnqueuedAt time.Time
+
+	// parts of the event (feedbackPart*) applied by earlier attempts; a
+	// retry applies only the rest, so no state learns an event twice
+	Applied []string
+
+	// set when the payload could not be decoded; such messages are
+	// dead-lettered
+	DecodeErr error
+}
+
+// QueueStats describe the backlog of a feedback queue.
+type QueueStats struct {
+	Depth       int64         // events waiting, in flight or waiting to be retried
+	OldestAge   time.Duration // age of the oldest waiting event
+	DeadLetters int64
+}
+
+// FeedbackQueue is a durable at-least-once queue of feedback events.
+type FeedbackQueue interface {
+	Enqueue(ctx context.Context, event domain.BanditEvent) error
+
+	// Read returns up to count messages for the consumer, blocking up to
+	// block when none are available. Messages left unacknowledged by a
+	// crashed consumer are redelivered.
+	Read(ctx context.Context, consumer string, count int, block time.Duration) ([]QueuedFeedback, error)
+
+	Ack(ctx context.Context, ids ...string) error
+
+	// Retry re-enqueues a message with one more attempt, to be read again
+	// after a backoff that grows with its attempts, and acks the original.
+	Retry(ctx context.Context, msg QueuedFeedback) error
+
+	// DeadLetter moves a message to the dead-letter queue and acks it.
+	DeadLetter(ctx context.Context, msg QueuedFeedback, reason string) error
+
+	Stats(ctx context.Context) (QueueStats, error)
+}
+
+// The parts an event is applied in. Each is saved on its own, so a failed
+// event may be partly applied.
+const (
+	feedbackPartGlobal = "global" // the segment's global state
+	feedbackPartUser   = "user"   // the user's state
+	feedbackPartEvent  = "event"  // the bandit_events row, written last
+)
+
+// FeedbackResult is the outcome of one queued event.
+type FeedbackResult struct {
+	// parts applied so far, including by earlier attempts
+	Applied []string
+	Err     error
+}
+
+// FeedbackValidator is implemented by appliers that can tell, before an
+// event is queued, whether it could ever be applied.
+type FeedbackValidator interface {
+	ValidateFeedback(ctx context.Context, event domain.BanditEvent) error
+}
+
+// FeedbackBatchApplier learns from a batch of queued events, skipping the
+// parts each already had applied; results[i] is the outcome of msgs[i].
+type FeedbackBatchApplier interface {
+	ApplyFeedbackBatch(ctx context.Context, msgs []QueuedFeedback) []FeedbackResult
+}
+
+// BatchEventRepository is implemented by event stores that can insert many
+// events at once.
+type BatchEventRepository interface {
+	SaveEvents(ctx context.Context, events []domain.BanditEvent) error
+}
+
+const (
+	defaultIngestWorkers     = 4
+	defaultIngestBatchSize   = 100
+	defaultIngestBlock       = 2 * time.Second
+	defaultIngestMaxBacklog  = 100000
+	defaultIngestMaxAttempts = 5
+	defaultIngestStatsEvery  = 5 * time.Second
+)
+
+type IngestConfig struct {
+	Workers   int
+	BatchSize int
+
+	// how long a worker waits for new events before polling again
+	Block time.Duration
+
+	// Enqueue rejects events with ErrQueueFull above this backlog
+	MaxBacklog int64
+
+	// events failing this many times are dead-lettered
+	MaxAttempts int
+
+	// how often queue depth & lag are sampled for metrics / backpressure
+	StatsInterval time.Duration
+}
+
+// FeedbackIngestor takes feedback off the request path: LogFeedback only
+// enqueues, and a pool of workers applies the queued events in
+// micro-batches with one state load/save per state key.
+type FeedbackIngestor struct {
+	queue   FeedbackQueue
+	applier FeedbackBatchApplier
+	cfg     IngestConfig
+
+	// last sampled depth plus events enqueued since
+	backlog atomic.Int64
+}
+
+func NewFeedbackIngestor(queue FeedbackQueue, applier FeedbackBatchApplier, cfg IngestConfig) *FeedbackIngestor {
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultIngestWorkers
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultIngestBatchSize
+	}
+	if cfg.Block <= 0 {
+		cfg.Block = defaultIngestBlock
+	}
+	if cfg.MaxBacklog <= 0 {
+		cfg.MaxBacklog = defaultIngestMaxBacklog
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultIngestMaxAttempts
+	}
+	if cfg.StatsInterval <= 0 {
+		cfg.StatsInterval = defaultIngestStatsEvery
+	}
+	return &FeedbackIngestor{
+		queue:   queue,
+		applier: applier,
+		cfg:     cfg,
+	}
+}
+
+// LogFeedback enqueues an event for asynchronous learning. The event is
+// stamped with the current time so it is learned in the context it
+// happened in, however late it is applied. Events the applier reports as
+// invalid are rejected with ErrInvalidFeedback instead of being queued.
+func (i *FeedbackIngestor) LogFeedback(ctx context.Context, event domain.BanditEvent) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+	if event.EventType == "" {
+		return fmt.Errorf("%w: event_type is required", ErrInvalidFeedback)
+	}
+	if v, ok := i.applier.(FeedbackValidator); ok {
+		if err := v.ValidateFeedback(ctx, event); err != nil {
+			BanditFeedbackIngestTotal.WithLabelValues("invalid").Inc()
+			return err
+		}
+	}
+
+	if i.backlog.Load() >= i.cfg.MaxBacklog {
+		BanditFeedbackIngestTotal.WithLabelValues("rejected").Inc()
+		return ErrQueueFull
+	}
+
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	if err := i.queue.Enqueue(ctx, event); err != nil {
+		return fmt.Errorf("enqueue bandit feedback: %w", err)
+	}
+
+	i.backlog.Add(1)
+	BanditFeedbackIngestTotal.WithLabelValues("enqueued").Inc()
+	return nil
+}
+
+// Run starts the workers and the stats sampler and blocks until ctx is
+// cancelled and every in-flight batch is finished.
+func (i *FeedbackIngestor) Run(ctx context.Context, consumerPrefix string) {
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		i.sampleStats(ctx)
+	}()
+
+	for w := 0; w < i.cfg.Workers; w++ {
+		wg.Add(1)
+		go func(consumer string) {
+			defer wg.Done()
+			i.work(ctx, consumer)
+		}(fmt.Sprintf("%s-%d", consumerPrefix, w))
+	}
+
+	wg.Wait()
+}
+
+func (i *FeedbackIngestor) work(ctx context.Context, consumer string) {
+	for ctx.Err() == nil {
+		msgs, err := i.queue.Read(ctx, consumer, i.cfg.BatchSize, i.cfg.Block)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Error("bandit_ingest_read_failed", "consumer", consumer, "error", err)
+			sleepCtx(ctx, time.Second)
+			continue
+		}
+		if len(msgs) == 0 {
+			continue
+		}
+
+		// a batch that was read is finished even during shutdown, so its
+		// messages are not left for redelivery
+		i.process(context.WithoutCancel(ctx), msgs)
+	}
+}
+
+// process applies one batch and settles every message: ack, retry or
+// dead-letter.
+func (i *FeedbackIngestor) process(ctx context.Context, msgs []QueuedFeedback) {
+	valid := make([]QueuedFeedback, 0, len(msgs))
+
+	for _, m := range msgs {
+		if m.DecodeErr != nil {
+			i.deadLetter(ctx, m, m.DecodeErr.Error())
+			continue
+		}
+		valid = append(valid, m)
+	}
+
+	results := i.applier.ApplyFeedbackBatch(ctx, valid)
+
+	ack := make([]string, 0, len(valid))
+	now := time.Now()
+	for j, m := range valid {
+		err := results[j].Err
+		m.Applied = results[j].Applied
+		switch {
+		case err == nil:
+			ack = append(ack, m.ID)
+			BanditFeedbackIngestTotal.WithLabelValues("applied").Inc()
+			if !m.EnqueuedAt.IsZero() {
+				BanditFeedbackIngestLatency.Observe(now.Sub(m.EnqueuedAt).Seconds())
+			}
+
+		case errors.Is(err, ErrInvalidFeedback) || m.Attempts+1 >= i.cfg.MaxAttempts:
+			i.deadLetter(ctx, m, err.Error())
+
+		default:
+			if rerr := i.queue.Retry(ctx, m); rerr != nil {
+				// left pending: redelivered once the claim timeout passes
+				logger.Error("bandit_ingest_retry_failed", "id", m.ID, "error", rerr)
+				continue
+			}
+			BanditFeedbackIngestTotal.WithLabelValues("retried").Inc()
+		}
+	}
+
+	if len(ack) > 0 {
+		if err := i.queue.Ack(ctx, ack...); err != nil {
+			logger.Error("bandit_ingest_ack_failed", "count", len(ack), "error", err)
+			return
+		}
+		i.backlog.Add(-int64(len(ack)))
+	}
+}
+
+func (i *FeedbackIngestor) deadLetter(ctx context.Context, m QueuedFeedback, reason string) {
+	if err := i.queue.DeadLetter(ctx, m, reason); err != nil {
+		logger.Error("bandit_ingest_dead_letter_failed", "id", m.ID, "error", err)
+		return
+	}
+	i.backlog.Add(-1)
+	BanditFeedbackIngestTotal.WithLabelValues("dead_lettered").Inc()
+	logger.Warn("bandit_feedback_dead_lettered",
+		"id", m.ID,
+		"slot", m.Event.Slot,
+		"event_type", m.Event.EventType,
+		"attempts", m.Attempts+1,
+		"reason", reason,
+	)
+}
+
+// sampleStats refreshes the lag metrics and the backlog used for
+// backpressure.
+func (i *FeedbackIngestor) sampleStats(ctx context.Context) {
+	ticker := time.NewTicker(i.cfg.StatsInterval)
+	defer ticker.Stop()
+
+	for {
+		stats, err := i.queue.Stats(ctx)
+		if err == nil {
+			i.backlog.Store(stats.Depth)
+			BanditFeedbackQueueDepth.Set(float64(stats.Depth))
+			BanditFeedbackQueueLagSeconds.Set(stats.OldestAge.Seconds())
+			BanditFeedbackDeadLetters.Set(float64(stats.DeadLetters))
+		} else if ctx.Err() == nil {
+			logger.Warn("bandit_ingest_stats_failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
+
+// ---- batch apply ----
+
+// ApplyFeedbackBatch learns from many events with one load/save per state
+// key. Events touching the same state are applied in order within a single
+// compare-and-swap update. The raw event is persisted once both of its
+// states are saved.
+func (s *BanditService) ApplyFeedbackBatch(ctx context.Context, msgs []QueuedFeedback) []FeedbackResult {
+	results := make([]FeedbackResult, len(msgs))
+	updates := make([]*feedbackUpdate, len(msgs))
+
+	for i, m := range msgs {
+		results[i].Applied = append([]string(nil), m.Applied...)
+		u, err := s.prepareFeedback(ctx, m.Event)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		updates[i] = u
+	}
+	applied := func(i int, part string) bool {
+		return slices.Contains(results[i].Applied, part)
+	}
+
+	// group by state key (and layout, in case variants disagree on it),
+	// keeping first-seen order
+	type group struct {
+		key     string
+		global  bool
+		members []int
+	}
+	groups := make([]*group, 0)
+	index := make(map[string]*group)
+
+	add := func(key string, global bool, u *feedbackUpdate, i int) {
+		gk := key + "|" + strings.Join(u.pipe.dims, ",")
+		g, ok := index[gk]
+		if !ok {
+			g = &group{key: key, global: global}
+			index[gk] = g
+			groups = append(groups, g)
+		}
+		g.members = append(g.members, i)
+	}
+	for i, u := range updates {
+		if u == nil {
+			continue
+		}
+		if !applied(i, feedbackPartGlobal) {
+			add(u.globalKey, true, u, i)
+		}
+		if !applied(i, feedbackPartUser) {
+			add(u.userKey, false, u, i)
+		}
+	}
+
+	for _, g := range groups {
+		first := updates[g.members[0]]
+		err := s.updateState(ctx, g.key, first.cfg, first.pipe, func(st *LinUCBState) {
+			for _, i := range g.members {
+				updates[i].learn(st, g.global)
+			}
+		})
+
+		part := feedbackPartUser
+		if g.global {
+			part = feedbackPartGlobal
+		}
+		for _, i := range g.members {
+			if err == nil {
+				results[i].Applied = append(results[i].Applied, part)
+			} else if results[i].Err == nil {
+				results[i].Err = fmt.Errorf("failed to save bandit state %s: %w", g.key, err)
+			}
+		}
+	}
+
+	// persist the raw events of every fully learned update
+	saved := make([]int, 0, len(msgs))
+	for i, u := range updates {
+		if u != nil && results[i].Err == nil && !applied(i, feedbackPartEvent) {
+			saved = append(saved, i)
+		}
+	}
+	if len(saved) == 0 {
+		return results
+	}
+
+	if batchRepo, ok := s.banditRepo.(BatchEventRepository); ok {
+		rows := make([]domain.BanditEvent, len(saved))
+		for j, i := range saved {
+			rows[j] = updates[i].event
+		}
+		if err := batchRepo.SaveEvents(ctx, rows); err != nil {
+			for _, i := range saved {
+				results[i].Err = fmt.Errorf("failed to save bandit events: %w", err)
+			}
+			return results
+		}
+	} else {
+		for _, i := range saved {
+			if err := s.banditRepo.SaveEvent(ctx, updates[i].event); err != nil {
+				results[i].Err = fmt.Errorf("failed to save bandit event: %w", err)
+			}
+		}
+	}
+
+	for _, i := range saved {
+		if results[i].Err == nil {
+			results[i].Applied = append(results[i].Applied, feedbackPartEvent)
+			countFeedback(updates[i])
+		}
+	}
+	return results
+}
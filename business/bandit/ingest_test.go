@@ -0,0 +1,113 @@
+//go:build !integration
+
+package bandit
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+)
+
+// flakyEventRepo fails the first SaveEvent.
+type flakyEventRepo struct {
+	failed bool
+	saved  int
+}
+
+func (r *flakyEventRepo) SaveEvent(context.Context, domain.BanditEvent) error {
+	if !r.failed {
+		r.failed = true
+		return errors.New("connection reset")
+	}
+	r.saved++
+	return nil
+}
+
+// TestApplyFeedbackBatch_RetryAppliesOnlyFailedParts checks that an event
+// whose states were saved but whose event row was not is not learned again
+// when retried.
+func TestApplyFeedbackBatch_RetryAppliesOnlyFailedParts(t *testing.T) {
+	logger.Init("test")
+
+	stateRepo := newMemStateRepo()
+	eventRepo := &flakyEventRepo{}
+	cfg := DefaultConfig()
+	svc := NewBanditService(eventRepo, nil, stateRepo, nil, nil, nil, nil, nil, cfg)
+
+	ctx := context.Background()
+	msg := QueuedFeedback{
+		ID:    "1-0",
+		Event: domain.BanditEvent{UserID: 1, Slot: concurrentSlot, ProductID: 7, EventType: "click"},
+	}
+
+	res := svc.ApplyFeedbackBatch(ctx, []QueuedFeedback{msg})[0]
+	if res.Err == nil {
+		t.Fatal("first attempt succeeded, want the event save to fail")
+	}
+	if len(res.Applied) != 2 {
+		t.Fatalf("applied = %v, want both states", res.Applied)
+	}
+
+	msg.Applied = res.Applied
+	if res = svc.ApplyFeedbackBatch(ctx, []QueuedFeedback{msg})[0]; res.Err != nil {
+		t.Fatalf("retry: %v", res.Err)
+	}
+	if eventRepo.saved != 1 {
+		t.Errorf("saved events = %d, want 1", eventRepo.saved)
+	}
+
+	seg := svc.userSegment(ctx, 1, cfg)
+	for _, key := range []string{stateGlobalKey(concurrentSlot, seg), stateUserKey(concurrentSlot, seg, 1)} {
+		st, err := stateRepo.GetState(ctx, key)
+		if err != nil || st == nil {
+			t.Fatalf("state %s missing: %v", key, err)
+		}
+		if got := st.Arms[7].Count; got != 1 {
+			t.Errorf("%s: count = %d, want 1", key, got)
+		}
+	}
+}
+
+// memQueue records enqueued events.
+type memQueue struct {
+	FeedbackQueue
+	events []domain.BanditEvent
+}
+
+func (q *memQueue) Enqueue(_ context.Context, ev domain.BanditEvent) error {
+	q.events = append(q.events, ev)
+	return nil
+}
+
+// TestFeedbackIngestor_RejectsUnknownEventTypes checks that only event
+// types the slot's config rewards are queued.
+func TestFeedbackIngestor_RejectsUnknownEventTypes(t *testing.T) {
+	logger.Init("test")
+
+	cfg := DefaultConfig()
+	cfg.RewardModel = domain.BanditRewardModel{Events: map[string]domain.BanditRewardRule{
+		"wishlist": {Base: 0.3},
+	}}
+	svc := NewBanditService(&flakyEventRepo{}, nil, newMemStateRepo(), nil, nil, nil, nil, nil, cfg)
+	queue := &memQueue{}
+	ingestor := NewFeedbackIngestor(queue, svc, IngestConfig{})
+
+	ctx := context.Background()
+	for _, typ := range []string{"click", "wishlist"} {
+		ev := domain.BanditEvent{UserID: 1, Slot: concurrentSlot, ProductID: 7, EventType: typ}
+		if err := ingestor.LogFeedback(ctx, ev); err != nil {
+			t.Fatalf("%s: %v", typ, err)
+		}
+	}
+
+	ev := domain.BanditEvent{UserID: 1, Slot: concurrentSlot, ProductID: 7, EventType: "wishlsit"}
+	if err := ingestor.LogFeedback(ctx, ev); !errors.Is(err, ErrInvalidFeedback) {
+		t.Fatalf("unknown type: err = %v, want ErrInvalidFeedback", err)
+	}
+	if len(queue.events) != 2 {
+		t.Errorf("queued %d events, want 2", len(queue.events))
+	}
+}
@@ -0,0 +1,153 @@
+package bandit
+
+import (
+	"math"
+)
+
+// Every arm stores A⁻¹ and θ = A⁻¹b next to A and b. Each observation is a
+// rank-one update A += xxᵀ, folded into A⁻¹ in O(d²) with Sherman–Morrison,
+// and decay scales A⁻¹ by the inverse factor, so serving never inverts.
+// Rounding error accumulates across updates, so A⁻¹ is recomputed from A
+// every reinvertEvery updates.
+
+// rank-one updates between full re-inversions of an arm
+const reinvertEvery = 200
+
+// hasInverse reports whether the arm's cached A⁻¹ and θ match its layout.
+func (a *LinUCBArmState) hasInverse() bool {
+	d := len(a.B)
+	return len(a.AInv) == d && len(a.Theta) == d && (d == 0 || len(a.AInv[0]) == d)
+}
+
+// refreshInverse recomputes A⁻¹ and θ from A and b. An A that has lost
+// positive definiteness (e.g. decayed to nothing) gets the ridge prior added
+// back to its diagonal instead of losing what the arm learned.
+func refreshInverse(arm *LinUCBArmState) {
+	AInv, ok := invertSPD(arm.A)
+	if !ok {
+		for i := range arm.A {
+			arm.A[i][i] += armPrior
+		}
+		AInv, ok = invertSPD(arm.A)
+	}
+	if !ok {
+		fresh := newArmState(len(arm.B))
+		arm.A, arm.B, arm.BZ = fresh.A, fresh.B, nil
+		AInv = fresh.AInv
+	}
+	arm.AInv = AInv
+	arm.Theta = matVecMul(AInv, arm.B)
+	arm.InvAge = 0
+}
+
+// ensureInverse fills in A⁻¹ and θ for arms stored before they were cached.
+func ensureInverse(arm *LinUCBArmState) {
+	if !arm.hasInverse() {
+		refreshInverse(arm)
+	}
+}
+
+// ensureInverses fills in every cached inverse of a state.
+func ensureInverses(st *LinUCBState) {
+	for _, arm := range st.Arms {
+		ensureInverse(arm)
+	}
+	if st.Shared != nil {
+		ensureInverse(st.Shared)
+	}
+	if st.Hybrid != nil && !st.Hybrid.hasInverse() {
+		st.Hybrid.refreshInverse()
+	}
+}
+
+// observe folds one observation into an arm: A += xxᵀ, b += r x, with A⁻¹
+// and θ updated to match.
+func observe(arm *LinUCBArmState, x []float64, reward float64) {
+	ensureInverse(arm)
+	addOuter(arm.A, x)
+	addScaled(arm.B, x, reward)
+
+	arm.InvAge++
+	if arm.InvAge >= reinvertEvery || !shermanMorrison(arm.AInv, x) {
+		refreshInverse(arm)
+		return
+	}
+	arm.Theta = matVecMul(arm.AInv, arm.B)
+}
+
+// shermanMorrison applies (A + xxᵀ)⁻¹ = A⁻¹ − (A⁻¹x)(A⁻¹x)ᵀ / (1 + xᵀA⁻¹x)
+// to AInv in place. It reports false, leaving AInv unusable, when the
+// denominator shows A⁻¹ has drifted from positive definite.
+func shermanMorrison(AInv [][]float64, x []float64) bool {
+	u := matVecMul(AInv, x)
+	denom := 1 + dot(x, u)
+	if denom <= 0 || math.IsNaN(denom) || math.IsInf(denom, 0) {
+		return false
+	}
+	for i := range u {
+		if u[i] == 0 {
+			continue
+		}
+		s := u[i] / denom
+		for j := range u {
+			AInv[i][j] -= s * u[j]
+		}
+	}
+	return true
+}
+
+// scaleInverse keeps A⁻¹ in step with A *= factor.
+func scaleInverse(arm *LinUCBArmState, factor float64) {
+	if !arm.hasInverse() || factor == 0 {
+		return
+	}
+	inv := 1 / factor
+	for i := range arm.AInv {
+		for j := range arm.AInv[i] {
+			arm.AInv[i][j] *= inv
+		}
+	}
+	// θ = A⁻¹b is unchanged: both factors scale away
+}
+
+// invertSPD inverts a symmetric positive definite matrix through its
+// Cholesky factor, which is better conditioned than Gauss–Jordan without
+// pivoting. It falls back to Gauss–Jordan for matrices that are invertible
+// but not positive definite.
+func invertSPD(A [][]float64) ([][]float64, bool) {
+	n := len(A)
+	L, ok := cholesky(A)
+	if !ok {
+		inv, err := invert(A)
+		return inv, err == nil
+	}
+
+	// Linv = L⁻¹ by forward substitution, column by column
+	Linv := newMatrix(n)
+	for c := 0; c < n; c++ {
+		for i := c; i < n; i++ {
+			sum := 0.0
+			if i == c {
+				sum = 1
+			}
+			for k := c; k < i; k++ {
+				sum -= L[i][k] * Linv[k][c]
+			}
+			Linv[i][c] = sum / L[i][i]
+		}
+	}
+
+	// A⁻¹ = L⁻ᵀ L⁻¹
+	inv := newMatrix(n)
+	for i := 0; i < n; i++ {
+		for j := 0; j <= i; j++ {
+			sum := 0.0
+			for k := i; k < n; k++ {
+				sum += Linv[k][i] * Linv[k][j]
+			}
+			inv[i][j] = sum
+			inv[j][i] = sum
+		}
+	}
+	return inv, true
+}
@@ -0,0 +1,151 @@
+//go:build !integration
+
+package bandit
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+const (
+	benchArms   = 300
+	benchEvents = 40 // learned events per arm
+)
+
+// benchStates builds a global and a user state with benchArms trained arms
+// over the default feature pipeline. With cached false the arms drop their
+// stored A⁻¹ and θ, so scoring falls back to inverting A per candidate,
+// which is what every request used to do.
+func benchStates(b *testing.B, cached bool) (Policy, Config, scoringStates, [][]float64) {
+	b.Helper()
+
+	cfg := DefaultConfig()
+	pipe := pipelineFor(cfg)
+	dim := len(pipe.dims)
+	policy := policyFor(cfg, VariantUCB)
+
+	rng := rand.New(rand.NewSource(1))
+	vec := func() []float64 {
+		x := make([]float64, dim)
+		x[0] = 1
+		for i := 1; i < dim; i++ {
+			if rng.Float64() < 0.3 {
+				x[i] = rng.Float64()
+			}
+		}
+		return x
+	}
+
+	global := newDefaultState(pipe.dims)
+	user := newDefaultState(pipe.dims)
+	now := time.Now()
+	xs := make([][]float64, benchArms)
+	for pid := uint64(1); pid <= benchArms; pid++ {
+		for e := 0; e < benchEvents; e++ {
+			reward := 0.0
+			if rng.Float64() < 0.2 {
+				reward = 1
+			}
+			learn(policy, cfg, global, user, pid, vec(), nil, reward, now)
+		}
+		xs[pid-1] = vec()
+	}
+
+	if !cached {
+		for _, st := range []*LinUCBState{global, user} {
+			for _, arm := range st.Arms {
+				arm.AInv, arm.Theta = nil, nil
+			}
+		}
+	}
+	return policy, cfg, newScoringStates(policy, cfg, global, user), xs
+}
+
+// The incrementally kept A⁻¹ and θ must match inverting A from scratch
+// after every learned event, on both sides of each periodic re-inversion.
+func TestIncrementalInverseMatchesInvert(t *testing.T) {
+	const tol = 1e-8
+
+	dim := len(pipelineFor(DefaultConfig()).dims)
+	arm := newArmState(dim)
+	rng := rand.New(rand.NewSource(7))
+	now := time.Now()
+
+	for n := 1; n <= 2*reinvertEvery+50; n++ {
+		x := make([]float64, dim)
+		x[0] = 1
+		for i := 1; i < dim; i++ {
+			if rng.Float64() < 0.5 {
+				x[i] = rng.Float64()
+			}
+		}
+		reward := 0.0
+		if rng.Float64() < 0.3 {
+			reward = 1
+		}
+		updateArm(arm, x, reward, now)
+
+		want, ok := invertSPD(arm.A)
+		if !ok {
+			t.Fatalf("update %d: A is not positive definite", n)
+		}
+		theta := matVecMul(want, arm.B)
+		for i := range want {
+			for j := range want[i] {
+				if diff := math.Abs(arm.AInv[i][j] - want[i][j]); diff > tol*math.Max(1, math.Abs(want[i][j])) {
+					t.Fatalf("update %d (inv age %d): A⁻¹[%d][%d] = %v, want %v", n, arm.InvAge, i, j, arm.AInv[i][j], want[i][j])
+				}
+			}
+			if diff := math.Abs(arm.Theta[i] - theta[i]); diff > tol*math.Max(1, math.Abs(theta[i])) {
+				t.Fatalf("update %d (inv age %d): θ[%d] = %v, want %v", n, arm.InvAge, i, arm.Theta[i], theta[i])
+			}
+		}
+	}
+	if arm.InvAge != 50 {
+		t.Fatalf("inv age = %d, want 50 after two re-inversions", arm.InvAge)
+	}
+}
+
+func benchmarkScore(b *testing.B, cached bool) {
+	policy, cfg, states, xs := benchStates(b, cached)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		arms := make([]preparedArm, benchArms)
+		for i := range arms {
+			arms[i] = states.prepare(uint64(i+1), nil, xs[i], nil, 0.5)
+		}
+		scoreArms(policy, cfg, arms)
+	}
+}
+
+// BenchmarkScore300Arms compares scoring a 300-arm slate from the stored
+// incremental inverses against inverting every arm's A on the request path.
+//
+//	go test ./business/bandit -run '^$' -bench Score300Arms
+func BenchmarkScore300Arms(b *testing.B) {
+	b.Run("incremental", func(b *testing.B) { benchmarkScore(b, true) })
+	b.Run("invert", func(b *testing.B) { benchmarkScore(b, false) })
+}
+
+// BenchmarkUpdateArm measures one learned event on an arm, Sherman–Morrison
+// included.
+func BenchmarkUpdateArm(b *testing.B) {
+	cfg := DefaultConfig()
+	dim := len(pipelineFor(cfg).dims)
+	arm := newArmState(dim)
+	x := make([]float64, dim)
+	for i := range x {
+		x[i] = 1 / float64(i+1)
+	}
+	now := time.Now()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		updateArm(arm, x, 1, now)
+	}
+}
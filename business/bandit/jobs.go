@@ -0,0 +1,34 @@
+package bandit
+
+import (
+	"context"
+	"time"
+
+	"myGreenMarket/pkg/logger"
+)
+
+// JobRunClaimer lets one of the API replicas run a periodic job per
+// interval, so scheduled work is not repeated by every replica.
+type JobRunClaimer interface {
+	// ClaimJobRun records a run of job unless one was recorded within the
+	// last `every`, and reports whether the caller claimed it.
+	ClaimJobRun(ctx context.Context, job string, every time.Duration) (bool, error)
+}
+
+// claimJobRun reports whether this replica runs the job now. The claim
+// window is a tenth shorter than the interval, so a replica whose ticker
+// drifts behind the last claimer's still finds the job due next time.
+// Without a claimer every replica runs it.
+func claimJobRun(ctx context.Context, jobs JobRunClaimer, job string, interval time.Duration) bool {
+	if jobs == nil {
+		return true
+	}
+	ok, err := jobs.ClaimJobRun(ctx, job, interval-interval/10)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Error("bandit_job_claim_failed", "job", job, "error", err)
+		}
+		return false
+	}
+	return ok
+}
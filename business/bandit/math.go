@@ -3,16 +3,17 @@ package bandit
 import (
 	"fmt"
 	"math"
+	"time"
 )
 
 const decayRate = 0.001 // soft forgetting
 
 // y = A * x
-func matVecMul(A [linUCBFeatureDim][linUCBFeatureDim]float64, x [linUCBFeatureDim]float64) [linUCBFeatureDim]float64 {
-	var y [linUCBFeatureDim]float64
-	for i := 0; i < linUCBFeatureDim; i++ {
+func matVecMul(A [][]float64, x []float64) []float64 {
+	y := make([]float64, len(A))
+	for i := range A {
 		sum := 0.0
-		for j := 0; j < linUCBFeatureDim; j++ {
+		for j := range x {
 			sum += A[i][j] * x[j]
 		}
 		y[i] = sum
@@ -20,30 +21,55 @@ func matVecMul(A [linUCBFeatureDim][linUCBFeatureDim]float64, x [linUCBFeatureDi
 	return y
 }
 
-func dot(a, b [linUCBFeatureDim]float64) float64 {
+func dot(a, b []float64) float64 {
 	sum := 0.0
-	for i := 0; i < linUCBFeatureDim; i++ {
+	for i := range a {
 		sum += a[i] * b[i]
 	}
 	return sum
 }
 
 // A := A + x x^T
-func addOuter(A *[linUCBFeatureDim][linUCBFeatureDim]float64, x [linUCBFeatureDim]float64) {
-	for i := 0; i < linUCBFeatureDim; i++ {
-		for j := 0; j < linUCBFeatureDim; j++ {
-			(*A)[i][j] += x[i] * x[j]
+func addOuter(A [][]float64, x []float64) {
+	for i := range x {
+		for j := range x {
+			A[i][j] += x[i] * x[j]
 		}
 	}
 }
 
 // b := b + r x
-func addScaled(b *[linUCBFeatureDim]float64, x [linUCBFeatureDim]float64, r float64) {
-	for i := 0; i < linUCBFeatureDim; i++ {
-		(*b)[i] += r * x[i]
+func addScaled(b []float64, x []float64, r float64) {
+	for i := range x {
+		b[i] += r * x[i]
 	}
 }
 
+// y = Bᵀ v
+func matTVecMul(B [][]float64, v []float64) []float64 {
+	if len(B) == 0 {
+		return nil
+	}
+	y := make([]float64, len(B[0]))
+	for i := range B {
+		if v[i] == 0 {
+			continue
+		}
+		for j := range B[i] {
+			y[j] += B[i][j] * v[i]
+		}
+	}
+	return y
+}
+
+func newMatrix(n int) [][]float64 {
+	M := make([][]float64, n)
+	for i := range M {
+		M[i] = make([]float64, n)
+	}
+	return M
+}
+
 // Decay old contributions in A and b (soft forgetting)
 func applyDecay(arm *LinUCBArmState) {
 	if decayRate <= 0 {
@@ -51,61 +77,98 @@ func applyDecay(arm *LinUCBArmState) {
 	}
 	decay := 1.0 - decayRate
 
-	for i := 0; i < linUCBFeatureDim; i++ {
-		for j := 0; j < linUCBFeatureDim; j++ {
+	for i := range arm.A {
+		for j := range arm.A[i] {
 			arm.A[i][j] *= decay
 		}
 		arm.B[i] *= decay
 	}
+	for i := range arm.BZ {
+		for j := range arm.BZ[i] {
+			arm.BZ[i][j] *= decay
+		}
+	}
+	scaleInverse(arm, decay)
 
+	// round rather than truncate: int(n * decay) drops every count below
+	// 1/decayRate by one on each update, so counts never grew past 1
 	if arm.Count > 0 {
-		arm.Count = int(float64(arm.Count) * decay)
+		arm.Count = int(math.Round(float64(arm.Count) * decay))
 	}
 }
 
-// "invert4x4" now inverts a linUCBFeatureDim x linUCBFeatureDim matrix using Gauss–Jordan.
+// updateArm applies decay and one (x, reward) observation to an arm.
+func updateArm(arm *LinUCBArmState, x []float64, reward float64, now time.Time) {
+	applyDecay(arm)
+	observe(arm, x, reward)
+	arm.Count++
+	arm.LastUpdated = now
+}
 
-func invert4x4(A [linUCBFeatureDim][linUCBFeatureDim]float64) ([linUCBFeatureDim][linUCBFeatureDim]float64, error) {
-	var aug [linUCBFeatureDim][2 * linUCBFeatureDim]float64
+// invert inverts a square matrix using Gauss–Jordan elimination.
+func invert(A [][]float64) ([][]float64, error) {
+	n := len(A)
+	aug := make([][]float64, n)
 
 	// Build augmented [A | I]
-	for i := 0; i < linUCBFeatureDim; i++ {
-		for j := 0; j < linUCBFeatureDim; j++ {
-			aug[i][j] = A[i][j]
-		}
-		aug[i][linUCBFeatureDim+i] = 1.0
+	for i := 0; i < n; i++ {
+		aug[i] = make([]float64, 2*n)
+		copy(aug[i], A[i])
+		aug[i][n+i] = 1.0
 	}
 
 	// Gauss–Jordan elimination
-	for col := 0; col < linUCBFeatureDim; col++ {
+	for col := 0; col < n; col++ {
 		pivot := aug[col][col]
 		if math.Abs(pivot) < 1e-9 {
-			return [linUCBFeatureDim][linUCBFeatureDim]float64{}, fmt.Errorf("matrix is singular")
+			return nil, fmt.Errorf("matrix is singular")
 		}
 
 		// Normalize pivot row
-		for j := 0; j < 2*linUCBFeatureDim; j++ {
+		for j := 0; j < 2*n; j++ {
 			aug[col][j] /= pivot
 		}
 
 		// Eliminate other rows
-		for i := 0; i < linUCBFeatureDim; i++ {
+		for i := 0; i < n; i++ {
 			if i == col {
 				continue
 			}
 			factor := aug[i][col]
-			for j := 0; j < 2*linUCBFeatureDim; j++ {
+			for j := 0; j < 2*n; j++ {
 				aug[i][j] -= factor * aug[col][j]
 			}
 		}
 	}
 
 	// Extract inverse
-	var inv [linUCBFeatureDim][linUCBFeatureDim]float64
-	for i := 0; i < linUCBFeatureDim; i++ {
-		for j := 0; j < linUCBFeatureDim; j++ {
-			inv[i][j] = aug[i][linUCBFeatureDim+j]
-		}
+	inv := newMatrix(n)
+	for i := 0; i < n; i++ {
+		copy(inv[i], aug[i][n:])
 	}
 	return inv, nil
 }
+
+// cholesky returns lower-triangular L with L L^T = M, or false when M is not
+// positive definite.
+func cholesky(M [][]float64) ([][]float64, bool) {
+	n := len(M)
+	L := newMatrix(n)
+	for i := 0; i < n; i++ {
+		for j := 0; j <= i; j++ {
+			sum := M[i][j]
+			for k := 0; k < j; k++ {
+				sum -= L[i][k] * L[j][k]
+			}
+			if i == j {
+				if sum <= 0 {
+					return L, false
+				}
+				L[i][i] = math.Sqrt(sum)
+			} else {
+				L[i][j] = sum / L[j][j]
+			}
+		}
+	}
+	return L, true
+}
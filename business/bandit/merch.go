@@ -0,0 +1,511 @@
+package bandit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+)
+
+var (
+	ErrMerchRuleNotFound = errors.New("merchandising rule not found")
+	ErrInvalidMerchRule  = errors.New("invalid merchandising rule")
+)
+
+// how long a slot's rules are cached by the merchandiser
+const defaultMerchRuleCacheTTL = 30 * time.Second
+
+// MerchRuleRepository stores merchandising rules and their audit trail.
+type MerchRuleRepository interface {
+	// ListRules returns the slot's rules, or every rule when slot is empty.
+	ListRules(ctx context.Context, slot string) ([]domain.BanditMerchRule, error)
+	GetRule(ctx context.Context, id uint) (domain.BanditMerchRule, bool, error)
+
+	// CreateRule, UpdateRule and DeleteRule store the change and its audit
+	// entry in one transaction; CreateRule fills in the entry's RuleID.
+	CreateRule(ctx context.Context, rule *domain.BanditMerchRule, audit domain.BanditMerchRuleAudit) error
+	UpdateRule(ctx context.Context, rule *domain.BanditMerchRule, audit domain.BanditMerchRuleAudit) error
+	DeleteRule(ctx context.Context, id uint, audit domain.BanditMerchRuleAudit) error
+
+	// ListRuleAudit returns a rule's audit entries, newest first.
+	ListRuleAudit(ctx context.Context, ruleID uint) ([]domain.BanditMerchRuleAudit, error)
+}
+
+// Merchandiser applies merchandisers' pin / boost / bury / block rules to
+// scored slates, and manages the rules.
+type Merchandiser struct {
+	repo MerchRuleRepository
+	ttl  time.Duration
+
+	mu    sync.RWMutex
+	cache map[string]cachedRules // by slot
+}
+
+type cachedRules struct {
+	rules   []domain.BanditMerchRule
+	expires time.Time
+}
+
+func NewMerchandiser(repo MerchRuleRepository, ttl time.Duration) *Merchandiser {
+	if ttl <= 0 {
+		ttl = defaultMerchRuleCacheTTL
+	}
+	return &Merchandiser{
+		repo:  repo,
+		ttl:   ttl,
+		cache: make(map[string]cachedRules),
+	}
+}
+
+func (m *Merchandiser) rules(ctx context.Context, slot string) ([]domain.BanditMerchRule, error) {
+	now := time.Now()
+
+	m.mu.RLock()
+	c, ok := m.cache[slot]
+	m.mu.RUnlock()
+	if ok && now.Before(c.expires) {
+		return c.rules, nil
+	}
+
+	rules, err := m.repo.ListRules(ctx, slot)
+	if err != nil {
+		return nil, fmt.Errorf("load merchandising rules: %w", err)
+	}
+
+	m.mu.Lock()
+	m.cache[slot] = cachedRules{rules: rules, expires: now.Add(m.ttl)}
+	m.mu.Unlock()
+	return rules, nil
+}
+
+func (m *Merchandiser) invalidate(slot string) {
+	m.mu.Lock()
+	delete(m.cache, slot)
+	m.mu.Unlock()
+}
+
+// plan resolves the rules that apply to one request. When the rules cannot
+// be loaded the request is served without them.
+func (m *Merchandiser) plan(ctx context.Context, slot string, segment int, campaignID string, now time.Time) *merchPlan {
+	if m == nil {
+		return nil
+	}
+
+	rules, err := m.rules(ctx, slot)
+	if err != nil {
+		logger.Warn("bandit_merch_rules_unavailable",
+			"trace_id", TraceIDFromContext(ctx),
+			"slot", slot,
+			"error", err,
+		)
+		return nil
+	}
+
+	active := make([]domain.BanditMerchRule, 0, len(rules))
+	for _, r := range rules {
+		if ruleActive(r, segment, campaignID, now) {
+			active = append(active, r)
+		}
+	}
+	if len(active) == 0 {
+		return nil
+	}
+
+	// higher priority first; older rules break ties
+	sort.SliceStable(active, func(i, j int) bool {
+		if active[i].Priority != active[j].Priority {
+			return active[i].Priority > active[j].Priority
+		}
+		return active[i].ID < active[j].ID
+	})
+	return &merchPlan{slot: slot, rules: active}
+}
+
+func ruleActive(r domain.BanditMerchRule, segment int, campaignID string, now time.Time) bool {
+	switch {
+	case r.Disabled:
+		return false
+	case r.Segment != nil && *r.Segment != segment:
+		return false
+	case r.CampaignID != "" && r.CampaignID != campaignID:
+		return false
+	case r.StartsAt != nil && now.Before(*r.StartsAt):
+		return false
+	case r.EndsAt != nil && !now.Before(*r.EndsAt):
+		return false
+	}
+	return true
+}
+
+// ruleTargets reports whether a rule targets a product.
+func ruleTargets(r domain.BanditMerchRule, productID uint64, product *ProductAttributes) bool {
+	if r.ProductID != nil {
+		return *r.ProductID == productID
+	}
+	if r.CategoryID != nil {
+		cat, ok := categoryOf(product)
+		return ok && cat == *r.CategoryID
+	}
+	return false
+}
+
+// merchPlan holds the rules active for one request, highest priority first.
+// A nil plan applies nothing.
+type merchPlan struct {
+	slot  string
+	rules []domain.BanditMerchRule
+}
+
+// withPinned appends products pinned by the plan that are missing from the
+// offline candidates, so they can be scored and placed.
+func (p *merchPlan) withPinned(rows []domain.MockRecommendation) []domain.MockRecommendation {
+	if p == nil {
+		return rows
+	}
+	have := make(map[uint64]struct{}, len(rows))
+	for _, row := range rows {
+		have[row.ProductID] = struct{}{}
+	}
+	for _, r := range p.rules {
+		if r.Action != domain.MerchRulePin || r.ProductID == nil {
+			continue
+		}
+		if _, ok := have[*r.ProductID]; ok {
+			continue
+		}
+		have[*r.ProductID] = struct{}{}
+		rows = append(rows, domain.MockRecommendation{
+			Slot:      p.slot,
+			ProductID: *r.ProductID,
+		})
+	}
+	return rows
+}
+
+// blocked returns the rule blocking a product, if any.
+func (p *merchPlan) blocked(productID uint64, product *ProductAttributes) (uint, bool) {
+	if p == nil {
+		return 0, false
+	}
+	for _, r := range p.rules {
+		if r.Action == domain.MerchRuleBlock && ruleTargets(r, productID, product) {
+			return r.ID, true
+		}
+	}
+	return 0, false
+}
+
+// fired returns the IDs of the rules that act on a product.
+func (p *merchPlan) fired(productID uint64, product *ProductAttributes) []uint {
+	if p == nil {
+		return nil
+	}
+	var ids []uint
+	for _, r := range p.rules {
+		if ruleTargets(r, productID, product) {
+			ids = append(ids, r.ID)
+		}
+	}
+	return ids
+}
+
+// count increments the applied-rules metric for the products served and
+// the candidates blocked.
+func (p *merchPlan) count(served []preparedArm, blocked int) {
+	if p == nil {
+		return
+	}
+	if blocked > 0 {
+		BanditMerchRulesAppliedTotal.WithLabelValues(p.slot, domain.MerchRuleBlock).Add(float64(blocked))
+	}
+	for _, a := range served {
+		for _, r := range p.rules {
+			if r.Action != domain.MerchRuleBlock && ruleTargets(r, a.productID, a.product) {
+				BanditMerchRulesAppliedTotal.WithLabelValues(p.slot, r.Action).Inc()
+			}
+		}
+	}
+}
+
+// rerankers wraps the slot's re-ranking steps: boosts and burials adjust
+// scores before them, and burials and pins are enforced again after them,
+// since steps that renormalise scores can lift a buried product or move a
+// pinned one.
+func (p *merchPlan) rerankers(steps []Reranker) []Reranker {
+	if p == nil {
+		return steps
+	}
+	out := make([]Reranker, 0, len(steps)+3)
+	out = append(out, merchAdjustReranker{plan: p})
+	out = append(out, steps...)
+	out = append(out, merchBuryReranker{plan: p}, merchPinReranker{plan: p})
+	return out
+}
+
+// buries reports whether the plan buries a product.
+func (p *merchPlan) buries(productID uint64, product *ProductAttributes) bool {
+	for _, r := range p.rules {
+		if r.Action == domain.MerchRuleBury && ruleTargets(r, productID, product) {
+			return true
+		}
+	}
+	return false
+}
+
+// merchAdjustReranker applies boosts and burials. Boost multipliers scale
+// positive scores up and negative scores towards zero; buried products
+// rank below every other candidate.
+type merchAdjustReranker struct {
+	plan *merchPlan
+}
+
+func (merchAdjustReranker) Name() string { return "merch_adjust" }
+
+func (r merchAdjustReranker) Rerank(items []RerankItem, k int) []RerankItem {
+	out := make([]RerankItem, len(items))
+	buried := make([]bool, len(items))
+	copy(out, items)
+
+	for i := range out {
+		for _, rule := range r.plan.rules {
+			if rule.Action != domain.MerchRuleBoost || !ruleTargets(rule, out[i].ProductID, out[i].Product) {
+				continue
+			}
+			if out[i].Score >= 0 {
+				out[i].Score *= rule.Multiplier
+			} else {
+				out[i].Score /= rule.Multiplier
+			}
+		}
+		buried[i] = r.plan.buries(out[i].ProductID, out[i].Product)
+	}
+
+	idx := make([]int, len(out))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		if buried[idx[a]] != buried[idx[b]] {
+			return !buried[idx[a]]
+		}
+		return out[idx[a]].Score > out[idx[b]].Score
+	})
+
+	sorted := make([]RerankItem, len(out))
+	for i, j := range idx {
+		sorted[i] = out[j]
+	}
+	return sorted
+}
+
+// merchBuryReranker moves buried products below every other candidate,
+// keeping the order the slot's steps gave both groups.
+type merchBuryReranker struct {
+	plan *merchPlan
+}
+
+func (merchBuryReranker) Name() string { return "merch_bury" }
+
+func (r merchBuryReranker) Rerank(items []RerankItem, k int) []RerankItem {
+	out := make([]RerankItem, 0, len(items))
+	var buried []RerankItem
+	for _, it := range items {
+		if r.plan.buries(it.ProductID, it.Product) {
+			buried = append(buried, it)
+			continue
+		}
+		out = append(out, it)
+	}
+	return append(out, buried...)
+}
+
+// merchPinReranker moves pinned products to their positions. When pins
+// compete for a position, the higher-priority pin takes it and the other
+// takes the next free one.
+type merchPinReranker struct {
+	plan *merchPlan
+}
+
+func (merchPinReranker) Name() string { return "merch_pin" }
+
+func (r merchPinReranker) Rerank(items []RerankItem, k int) []RerankItem {
+	at := make(map[uint64]int, len(items))
+	for i, it := range items {
+		at[it.ProductID] = i
+	}
+
+	placed := make([]*RerankItem, len(items))
+	pinned := make([]bool, len(items))
+	for _, rule := range r.plan.rules {
+		if rule.Action != domain.MerchRulePin || rule.ProductID == nil {
+			continue
+		}
+		i, ok := at[*rule.ProductID]
+		if !ok || pinned[i] {
+			continue
+		}
+		pos := rule.Position - 1
+		if pos < 0 {
+			pos = 0
+		}
+		for pos < len(placed) && placed[pos] != nil {
+			pos++
+		}
+		if pos >= len(placed) {
+			continue
+		}
+		placed[pos] = &items[i]
+		pinned[i] = true
+	}
+
+	out := make([]RerankItem, 0, len(items))
+	next := 0
+	for pos := range placed {
+		if placed[pos] != nil {
+			out = append(out, *placed[pos])
+			continue
+		}
+		for pinned[next] {
+			next++
+		}
+		out = append(out, items[next])
+		next++
+	}
+	return out
+}
+
+// ---- admin ----
+
+func (m *Merchandiser) ListRules(ctx context.Context, slot string) ([]domain.BanditMerchRule, error) {
+	return m.repo.ListRules(ctx, slot)
+}
+
+func (m *Merchandiser) GetRule(ctx context.Context, id uint) (domain.BanditMerchRule, error) {
+	rule, ok, err := m.repo.GetRule(ctx, id)
+	if err != nil {
+		return rule, err
+	}
+	if !ok {
+		return rule, ErrMerchRuleNotFound
+	}
+	return rule, nil
+}
+
+// CreateRule validates and stores a rule on behalf of actorID.
+func (m *Merchandiser) CreateRule(ctx context.Context, rule domain.BanditMerchRule, actorID uint) (domain.BanditMerchRule, error) {
+	if err := validateMerchRule(rule); err != nil {
+		return rule, err
+	}
+	rule.ID = 0
+
+	after := rule
+	audit := domain.BanditMerchRuleAudit{
+		Change:  domain.MerchRuleCreated,
+		ActorID: actorID,
+		After:   &after,
+	}
+	if err := m.repo.CreateRule(ctx, &rule, audit); err != nil {
+		return rule, err
+	}
+
+	m.invalidate(rule.Slot)
+	return rule, nil
+}
+
+// UpdateRule replaces a rule on behalf of actorID.
+func (m *Merchandiser) UpdateRule(ctx context.Context, id uint, rule domain.BanditMerchRule, actorID uint) (domain.BanditMerchRule, error) {
+	before, err := m.GetRule(ctx, id)
+	if err != nil {
+		return rule, err
+	}
+	if err := validateMerchRule(rule); err != nil {
+		return rule, err
+	}
+	rule.ID = id
+	rule.CreatedAt = before.CreatedAt
+
+	after := rule
+	audit := domain.BanditMerchRuleAudit{
+		RuleID:  id,
+		Change:  domain.MerchRuleUpdated,
+		ActorID: actorID,
+		Before:  &before,
+		After:   &after,
+	}
+	if err := m.repo.UpdateRule(ctx, &rule, audit); err != nil {
+		return rule, err
+	}
+
+	m.invalidate(before.Slot)
+	m.invalidate(rule.Slot)
+	return rule, nil
+}
+
+// DeleteRule removes a rule on behalf of actorID; its audit trail is kept.
+func (m *Merchandiser) DeleteRule(ctx context.Context, id uint, actorID uint) error {
+	before, err := m.GetRule(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	audit := domain.BanditMerchRuleAudit{
+		RuleID:  id,
+		Change:  domain.MerchRuleDeleted,
+		ActorID: actorID,
+		Before:  &before,
+	}
+	if err := m.repo.DeleteRule(ctx, id, audit); err != nil {
+		return err
+	}
+
+	m.invalidate(before.Slot)
+	return nil
+}
+
+// RuleAudit returns a rule's changes, newest first. It also works for
+// deleted rules.
+func (m *Merchandiser) RuleAudit(ctx context.Context, id uint) ([]domain.BanditMerchRuleAudit, error) {
+	return m.repo.ListRuleAudit(ctx, id)
+}
+
+func validateMerchRule(r domain.BanditMerchRule) error {
+	invalid := func(msg string) error {
+		return fmt.Errorf("%w: %s", ErrInvalidMerchRule, msg)
+	}
+
+	if r.Slot == "" {
+		return invalid("slot is required")
+	}
+	if r.ProductID != nil && r.CategoryID != nil {
+		return invalid("set either product_id or category_id, not both")
+	}
+	if r.ProductID == nil && r.CategoryID == nil {
+		return invalid("product_id or category_id is required")
+	}
+	if r.StartsAt != nil && r.EndsAt != nil && !r.EndsAt.After(*r.StartsAt) {
+		return invalid("ends_at must be after starts_at")
+	}
+
+	switch r.Action {
+	case domain.MerchRulePin:
+		if r.ProductID == nil {
+			return invalid("pin needs a product_id")
+		}
+		if r.Position < 1 {
+			return invalid("pin position must be >= 1")
+		}
+	case domain.MerchRuleBoost:
+		if r.Multiplier <= 0 {
+			return invalid("boost multiplier must be > 0")
+		}
+	case domain.MerchRuleBury, domain.MerchRuleBlock:
+	default:
+		return invalid("unknown action: " + r.Action)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+//go:build !integration
+
+package bandit
+
+import (
+	"slices"
+	"testing"
+
+	"myGreenMarket/domain"
+)
+
+// rerankWithPlan runs the slot's steps wrapped by the plan's rules and
+// returns the product IDs of the slate of k.
+func rerankWithPlan(t *testing.T, plan *merchPlan, items []RerankItem, k int, steps ...Reranker) []uint64 {
+	t.Helper()
+	for _, r := range plan.rerankers(steps) {
+		items = r.Rerank(items, k)
+	}
+	out := make([]uint64, 0, k)
+	for _, it := range items[:k] {
+		out = append(out, it.ProductID)
+	}
+	return out
+}
+
+// Three similar products and a dissimilar, buried one that diversity or a
+// sustainability objective would otherwise put in the slate.
+func buryCandidates() []RerankItem {
+	similar := func(id uint64, score float64) RerankItem {
+		return RerankItem{ProductID: id, Score: score, Product: &ProductAttributes{CategoryID: 1, EcoScore: 0.1}}
+	}
+	return []RerankItem{
+		similar(1, 10),
+		similar(2, 9),
+		similar(3, 8),
+		{ProductID: 4, Score: 1, Product: &ProductAttributes{CategoryID: 2, EcoScore: 1}},
+	}
+}
+
+func buryPlan() *merchPlan {
+	buried := uint64(4)
+	return &merchPlan{slot: "home_top", rules: []domain.BanditMerchRule{
+		{ID: 1, Slot: "home_top", Action: domain.MerchRuleBury, ProductID: &buried},
+	}}
+}
+
+// A buried product stays out of the slate when mmr or objectives reorder
+// the candidates by their own normalised scores.
+func TestMerchBury_SurvivesRerankSteps(t *testing.T) {
+	mmr, err := NewReranker(RerankMMR, map[string]float64{"lambda": 0.3})
+	if err != nil {
+		t.Fatalf("mmr: %v", err)
+	}
+	objectives, err := NewReranker(RerankObjectives, map[string]float64{"bandit": 0.1, "sustainability": 1})
+	if err != nil {
+		t.Fatalf("objectives: %v", err)
+	}
+
+	for _, step := range []Reranker{mmr, objectives} {
+		// the step alone does pick the buried product
+		var alone []uint64
+		for _, it := range step.Rerank(buryCandidates(), 3)[:3] {
+			alone = append(alone, it.ProductID)
+		}
+		if !slices.Contains(alone, 4) {
+			t.Fatalf("%s alone served %v, want product 4 in the slate", step.Name(), alone)
+		}
+
+		got := rerankWithPlan(t, buryPlan(), buryCandidates(), 3, step)
+		if slices.Contains(got, 4) {
+			t.Errorf("%s served buried product 4: %v", step.Name(), got)
+		}
+	}
+}
+
+// A pin still places a buried product: pins are applied last.
+func TestMerchBury_PinWins(t *testing.T) {
+	plan := buryPlan()
+	pinned := uint64(4)
+	plan.rules = append(plan.rules, domain.BanditMerchRule{
+		ID: 2, Slot: "home_top", Action: domain.MerchRulePin, ProductID: &pinned, Position: 1,
+	})
+
+	got := rerankWithPlan(t, plan, buryCandidates(), 3)
+	if got[0] != 4 {
+		t.Errorf("slate = %v, want pinned product 4 first", got)
+	}
+}
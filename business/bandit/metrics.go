@@ -12,8 +12,170 @@ var (
 		},
 		[]string{"slot", "event_type", "segment", "variant"},
 	)
+
+	BanditAttributedOrdersTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bandit_attributed_orders_total",
+			Help: "Count of paid orders credited to a slot by the attribution engine, by slot and rule.",
+		},
+		[]string{"slot", "rule"},
+	)
+
+	BanditStateConflictsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "bandit_state_conflicts_total",
+			Help: "Count of bandit state saves retried because another writer updated the state first.",
+		},
+	)
+
+	BanditFeedbackIngestTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bandit_feedback_ingest_total",
+			Help: "Count of queued feedback events by result (enqueued, rejected, invalid, applied, retried, dead_lettered).",
+		},
+		[]string{"result"},
+	)
+
+	BanditFeedbackIngestLatency = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "bandit_feedback_ingest_latency_seconds",
+			Help:    "Time from enqueueing a feedback event to applying it to the bandit state.",
+			Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300},
+		},
+	)
+
+	BanditFeedbackQueueDepth = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "bandit_feedback_queue_depth",
+			Help: "Feedback events waiting in the ingestion queue, including in-flight ones.",
+		},
+	)
+
+	BanditFeedbackQueueLagSeconds = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "bandit_feedback_queue_lag_seconds",
+			Help: "Age of the oldest feedback event in the ingestion queue.",
+		},
+	)
+
+	BanditFeedbackDeadLetters = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "bandit_feedback_dead_letters",
+			Help: "Feedback events in the dead-letter queue.",
+		},
+	)
+
+	BanditExperimentAssignmentsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bandit_experiment_assignments_total",
+			Help: "Count of new sticky experiment assignments by slot, experiment and bucket (treatment, holdout).",
+		},
+		[]string{"slot", "experiment", "bucket"},
+	)
+
+	BanditGuardrailPaused = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bandit_guardrail_paused",
+			Help: "1 while a slot variant is paused by the guardrail monitor and served offline-only, 0 otherwise.",
+		},
+		[]string{"slot", "variant"},
+	)
+
+	BanditGuardrailBreachesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bandit_guardrail_breaches_total",
+			Help: "Count of guardrail evaluations that found a variant significantly below the offline-only control, by slot, variant and metric.",
+		},
+		[]string{"slot", "variant", "metric"},
+	)
+
+	BanditMerchRulesAppliedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bandit_merch_rules_applied_total",
+			Help: "Count of merchandising rule applications, by slot and action: served products a pin/boost/bury rule targeted, and candidates blocked.",
+		},
+		[]string{"slot", "action"},
+	)
+
+	BanditScoringDegradedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bandit_scoring_degraded_total",
+			Help: "Count of recommendations served by offline score because bandit scoring missed its deadline, by slot.",
+		},
+		[]string{"slot"},
+	)
+
+	BanditFatigueCappedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bandit_fatigue_capped_total",
+			Help: "Count of candidates left out because the user reached the slot's impression cap for them, by slot.",
+		},
+		[]string{"slot"},
+	)
+
+	BanditRerankSlateScore = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "bandit_rerank_slate_score",
+			Help:    "Summed bandit score of the slate before re-ranking, by slot.",
+			Buckets: []float64{0, 0.5, 1, 2.5, 5, 10, 25, 50},
+		},
+		[]string{"slot"},
+	)
+
+	BanditRerankScoreCost = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "bandit_rerank_score_cost",
+			Help:    "Drop in the slate's summed bandit score caused by one re-ranking step, by slot and step; sum over bandit_rerank_slate_score sum is the share of engagement the step costs.",
+			Buckets: []float64{0, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5},
+		},
+		[]string{"slot", "step"},
+	)
+
+	BanditStateGCReclaimedBytesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bandit_state_gc_reclaimed_bytes_total",
+			Help: "Bytes of stored per-user bandit state reclaimed by compaction, by action: deleted_idle, deleted_empty or compacted.",
+		},
+		[]string{"action"},
+	)
+
+	BanditStateGCStatesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bandit_state_gc_states_total",
+			Help: "Count of per-user bandit states deleted or rewritten by compaction, by action: deleted_idle, deleted_empty or compacted.",
+		},
+		[]string{"action"},
+	)
+
+	BanditStateGCArmsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bandit_state_gc_arms_total",
+			Help: "Count of arms removed from per-user bandit states by compaction, by action: folded into the global state or dropped.",
+		},
+		[]string{"action"},
+	)
 )
 
 func init() {
-	prometheus.MustRegister(BanditFeedbackEventsTotal)
+	prometheus.MustRegister(
+		BanditFeedbackEventsTotal,
+		BanditAttributedOrdersTotal,
+		BanditStateConflictsTotal,
+		BanditFeedbackIngestTotal,
+		BanditFeedbackIngestLatency,
+		BanditFeedbackQueueDepth,
+		BanditFeedbackQueueLagSeconds,
+		BanditFeedbackDeadLetters,
+		BanditExperimentAssignmentsTotal,
+		BanditGuardrailPaused,
+		BanditGuardrailBreachesTotal,
+		BanditMerchRulesAppliedTotal,
+		BanditScoringDegradedTotal,
+		BanditFatigueCappedTotal,
+		BanditRerankSlateScore,
+		BanditRerankScoreCost,
+		BanditStateGCReclaimedBytesTotal,
+		BanditStateGCStatesTotal,
+		BanditStateGCArmsTotal,
+	)
 }
@@ -0,0 +1,244 @@
+package bandit
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const defaultNoveltyHalfLife = 30 * 24 * time.Hour
+
+// ---- objective scores, each in [0, 1] ----
+
+// sustainabilityScore is the product's eco rating when it has one, else 1
+// for green tagged products and 0 otherwise.
+func sustainabilityScore(p *ProductAttributes) float64 {
+	switch {
+	case p == nil:
+		return 0
+	case p.EcoScore > 0:
+		return math.Min(p.EcoScore, 1)
+	case p.IsGreenTag:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// marginScore is the product's margin rate at its sale price; 0 when the
+// cost is unknown.
+func marginScore(p *ProductAttributes) float64 {
+	if p == nil || p.CostPrice <= 0 || p.SalePrice <= 0 {
+		return 0
+	}
+	return clamp01((p.SalePrice - p.CostPrice) / p.SalePrice)
+}
+
+// noveltyScore halves every halfLife of catalogue age: 1 for a product
+// added now.
+func noveltyScore(p *ProductAttributes, now time.Time, halfLife time.Duration) float64 {
+	if p == nil || p.AddedAt.IsZero() {
+		return 0
+	}
+	age := now.Sub(p.AddedAt)
+	if age <= 0 {
+		return 1
+	}
+	return math.Pow(0.5, age.Hours()/halfLife.Hours())
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+// ---- multi-objective ranking ----
+
+// objectivesReranker ranks candidates on a weighted blend of the bandit
+// score, min-max normalised over the candidates, and the sustainability,
+// margin and novelty scores. In pareto mode candidates are ranked by
+// non-dominated front over the objectives with a positive weight, and by
+// the blend within a front.
+type objectivesReranker struct {
+	wBandit, wSustainability, wMargin, wNovelty float64
+
+	noveltyHalfLife time.Duration
+	pareto          bool
+}
+
+func newObjectivesReranker(params map[string]float64) (Reranker, error) {
+	r := &objectivesReranker{
+		wBandit:         param(params, "bandit", 1),
+		wSustainability: param(params, "sustainability", 0),
+		wMargin:         param(params, "margin", 0),
+		wNovelty:        param(params, "novelty", 0),
+		noveltyHalfLife: time.Duration(param(params, "novelty_half_life_days", defaultNoveltyHalfLife.Hours()/24) * float64(24*time.Hour)),
+		pareto:          param(params, "pareto", 0) != 0,
+	}
+	weights := []float64{r.wBandit, r.wSustainability, r.wMargin, r.wNovelty}
+	sum := 0.0
+	for _, w := range weights {
+		if w < 0 {
+			return nil, fmt.Errorf("objectives: weights must be >= 0")
+		}
+		sum += w
+	}
+	if sum == 0 {
+		return nil, fmt.Errorf("objectives: at least one weight must be > 0")
+	}
+	if r.noveltyHalfLife <= 0 {
+		return nil, fmt.Errorf("objectives: novelty_half_life_days must be > 0")
+	}
+	return r, nil
+}
+
+func (r *objectivesReranker) Name() string { return RerankObjectives }
+
+// objectives returns each item's objective vector, in weight order:
+// bandit, sustainability, margin, novelty.
+func (r *objectivesReranker) objectives(items []RerankItem) [][4]float64 {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, it := range items {
+		lo = math.Min(lo, it.Score)
+		hi = math.Max(hi, it.Score)
+	}
+	span := hi - lo
+	if span == 0 {
+		span = 1
+	}
+
+	now := time.Now()
+	out := make([][4]float64, len(items))
+	for i, it := range items {
+		out[i] = [4]float64{
+			(it.Score - lo) / span,
+			sustainabilityScore(it.Product),
+			marginScore(it.Product),
+			noveltyScore(it.Product, now, r.noveltyHalfLife),
+		}
+	}
+	return out
+}
+
+func (r *objectivesReranker) Rerank(items []RerankItem, k int) []RerankItem {
+	if len(items) == 0 {
+		return items
+	}
+
+	weights := [4]float64{r.wBandit, r.wSustainability, r.wMargin, r.wNovelty}
+	objs := r.objectives(items)
+
+	out := make([]RerankItem, len(items))
+	copy(out, items)
+	for i := range out {
+		blend := 0.0
+		for o, w := range weights {
+			blend += w * objs[i][o]
+		}
+		out[i].Score = blend
+	}
+	front := make([]int, len(items))
+	if r.pareto {
+		front = paretoFronts(objs, weights, k)
+	}
+
+	idx := make([]int, len(out))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		if front[idx[a]] != front[idx[b]] {
+			return front[idx[a]] < front[idx[b]]
+		}
+		return out[idx[a]].Score > out[idx[b]].Score
+	})
+
+	sorted := make([]RerankItem, len(out))
+	for i, j := range idx {
+		sorted[i] = out[j]
+	}
+	return sorted
+}
+
+// paretoFronts numbers the non-dominated fronts of the objective vectors,
+// comparing only objectives with a positive weight. Fronts are peeled until
+// at least k items are placed; the rest share the last front number.
+func paretoFronts(objs [][4]float64, weights [4]float64, k int) []int {
+	dominates := func(a, b [4]float64) bool {
+		better := false
+		for o, w := range weights {
+			if w <= 0 {
+				continue
+			}
+			if a[o] < b[o] {
+				return false
+			}
+			if a[o] > b[o] {
+				better = true
+			}
+		}
+		return better
+	}
+
+	front := make([]int, len(objs))
+	placed := make([]bool, len(objs))
+	n := 0
+	for f := 0; n < len(objs); f++ {
+		if n >= k {
+			for i := range objs {
+				if !placed[i] {
+					front[i] = f
+				}
+			}
+			break
+		}
+
+		current := make([]int, 0)
+		for i := range objs {
+			if placed[i] {
+				continue
+			}
+			dominated := false
+			for j := range objs {
+				if j != i && !placed[j] && dominates(objs[j], objs[i]) {
+					dominated = true
+					break
+				}
+			}
+			if !dominated {
+				current = append(current, i)
+			}
+		}
+		for _, i := range current {
+			front[i] = f
+			placed[i] = true
+		}
+		n += len(current)
+	}
+	return front
+}
+
+// ---- cost of the re-ranking steps ----
+
+// rerankCost returns an observer measuring what each re-ranking step costs
+// the slate in bandit score, the policy's engagement estimate: the drop in
+// the summed pre-rerank scores of the top k over the step. Dividing a step's cost by
+// the unconstrained slate score gives the share of engagement it trades
+// for its objective. A step that wins back score an earlier step gave up
+// reports a negative cost.
+func rerankCost(slot string, scores []float64, k int) rerankObserver {
+	before := 0.0
+	return func(step string, items []RerankItem) {
+		score := 0.0
+		for i := 0; i < k && i < len(items); i++ {
+			score += scores[items[i].index]
+		}
+
+		if step == "" {
+			BanditRerankSlateScore.WithLabelValues(slot).Observe(score)
+		} else {
+			BanditRerankScoreCost.WithLabelValues(slot, step).Observe(before - score)
+		}
+		before = score
+	}
+}
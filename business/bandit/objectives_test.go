@@ -0,0 +1,73 @@
+//go:build !integration
+
+package bandit
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func rerankIDs(items []RerankItem) []uint64 {
+	out := make([]uint64, len(items))
+	for i, it := range items {
+		out[i] = it.ProductID
+	}
+	return out
+}
+
+// withMargin prices a product at 100 with the given margin rate.
+func withMargin(id uint64, score, margin float64) RerankItem {
+	return RerankItem{ProductID: id, Score: score, Product: &ProductAttributes{SalePrice: 100, CostPrice: 100 - 100*margin}}
+}
+
+// Candidates are ordered by the weighted blend of the normalised bandit
+// score and the other objectives, which becomes their score.
+func TestObjectives_RanksByBlend(t *testing.T) {
+	r, err := NewReranker(RerankObjectives, map[string]float64{"bandit": 1, "sustainability": 1})
+	if err != nil {
+		t.Fatalf("NewReranker: %v", err)
+	}
+	items := []RerankItem{
+		{ProductID: 1, Score: 10, Product: &ProductAttributes{}},
+		{ProductID: 2, Score: 5, Product: &ProductAttributes{EcoScore: 1}},
+		{ProductID: 3, Score: 0, Product: &ProductAttributes{EcoScore: 0.5}},
+	}
+
+	got := r.Rerank(items, 2)
+	if want := []uint64{2, 1, 3}; !slices.Equal(rerankIDs(got), want) {
+		t.Fatalf("order = %v, want %v", rerankIDs(got), want)
+	}
+	for i, want := range []float64{1.5, 1, 0.5} {
+		if math.Abs(got[i].Score-want) > 1e-9 {
+			t.Errorf("blend of product %d = %v, want %v", got[i].ProductID, got[i].Score, want)
+		}
+	}
+}
+
+// With pareto, a dominated candidate ranks below the whole first front even
+// when its blend is higher than some of the front's.
+func TestObjectives_ParetoFrontsFirst(t *testing.T) {
+	items := []RerankItem{
+		withMargin(1, 1, 0),      // front 1, blend 1
+		withMargin(2, 0.95, 0.6), // front 1, blend 1.55
+		withMargin(3, 0.9, 0.55), // dominated by 2, blend 1.45
+		withMargin(4, 0, 0.7),    // front 1, blend 0.7
+	}
+
+	blend, err := NewReranker(RerankObjectives, map[string]float64{"bandit": 1, "margin": 1})
+	if err != nil {
+		t.Fatalf("NewReranker: %v", err)
+	}
+	if got, want := rerankIDs(blend.Rerank(items, 3)), []uint64{2, 3, 1, 4}; !slices.Equal(got, want) {
+		t.Fatalf("blend order = %v, want %v", got, want)
+	}
+
+	pareto, err := NewReranker(RerankObjectives, map[string]float64{"bandit": 1, "margin": 1, "pareto": 1})
+	if err != nil {
+		t.Fatalf("NewReranker: %v", err)
+	}
+	if got, want := rerankIDs(pareto.Rerank(items, 3)), []uint64{2, 1, 4, 3}; !slices.Equal(got, want) {
+		t.Errorf("pareto order = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,85 @@
+package bandit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+)
+
+// ErrInvalidPage marks page requests that name no slot or a slot twice.
+var ErrInvalidPage = errors.New("invalid page request")
+
+// RecommendPage fills every slot of a page in one call. The user is looked
+// up once; slots are filled by priority and each leaves out the products
+// already placed on the page, so no product appears twice. Every slot logs
+// its own impression. A slot that fails is served empty rather than
+// failing the page. Slates are returned in request order.
+func (s *BanditService) RecommendPage(
+	ctx context.Context,
+	userID uint,
+	slots []domain.PageSlot,
+	reqCtx map[string]any,
+) ([]domain.PageRecommendation, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+	if len(slots) == 0 {
+		return nil, fmt.Errorf("%w: no slots", ErrInvalidPage)
+	}
+	seen := make(map[string]struct{}, len(slots))
+	for _, ps := range slots {
+		if ps.Slot == "" {
+			return nil, fmt.Errorf("%w: slot is required", ErrInvalidPage)
+		}
+		if _, dup := seen[ps.Slot]; dup {
+			return nil, fmt.Errorf("%w: slot %s requested twice", ErrInvalidPage, ps.Slot)
+		}
+		seen[ps.Slot] = struct{}{}
+	}
+
+	order := make([]int, len(slots))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return slots[order[a]].Priority > slots[order[b]].Priority
+	})
+
+	user := s.loadRequestUser(ctx, userID)
+	shown := make(map[uint64]struct{})
+	out := make([]domain.PageRecommendation, len(slots))
+
+	for _, i := range order {
+		ps := slots[i]
+		limit := ps.N
+		if limit <= 0 {
+			limit = 10
+		}
+
+		recs, err := s.recommendSlot(ctx, user, ps.Slot, limit, reqCtx, shown)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, fmt.Errorf("context error: %w", ctxErr)
+			}
+			logger.Warn("bandit_page_slot_failed",
+				"trace_id", TraceIDFromContext(ctx),
+				"user_id", userID,
+				"slot", ps.Slot,
+				"error", err,
+			)
+			recs = []domain.BanditRecommendation{}
+		}
+
+		for _, r := range recs {
+			shown[r.ProductID] = struct{}{}
+		}
+		out[i] = domain.PageRecommendation{Slot: ps.Slot, Items: recs}
+	}
+
+	return out, nil
+}
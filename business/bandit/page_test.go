@@ -0,0 +1,73 @@
+//go:build !integration
+
+package bandit
+
+import (
+	"context"
+	"testing"
+
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+)
+
+// memOffline serves the same offline candidates, best first, for every slot.
+type memOffline struct {
+	products []uint64
+}
+
+func (r memOffline) GetBySlot(_ context.Context, slot string, limit int) ([]domain.MockRecommendation, error) {
+	out := make([]domain.MockRecommendation, 0, limit)
+	for i, pid := range r.products {
+		if i == limit {
+			break
+		}
+		out = append(out, domain.MockRecommendation{Slot: slot, ProductID: pid, Score: float64(len(r.products) - i)})
+	}
+	return out, nil
+}
+
+// Slots are filled by priority, so the higher-priority slot gets the best
+// candidates even when requested second, and no product is served twice.
+func TestRecommendPage_DedupsByPriority(t *testing.T) {
+	logger.Init("test")
+
+	cfg := DefaultConfig()
+	cfg.NumVariants = 1 // everyone on the deterministic UCB variant
+	cfg.ExploreNoise = 0
+	offline := memOffline{products: []uint64{1, 2, 3, 4, 5, 6}}
+	svc := NewBanditService(nil, nil, newMemStateRepo(), nil, offline, nil, nil, nil, cfg)
+
+	page, err := svc.RecommendPage(context.Background(), 7, []domain.PageSlot{
+		{Slot: "pdp_similar", N: 3, Priority: 1},
+		{Slot: "home_top", N: 3, Priority: 5},
+	}, nil)
+	if err != nil {
+		t.Fatalf("RecommendPage: %v", err)
+	}
+	if len(page) != 2 || page[0].Slot != "pdp_similar" || page[1].Slot != "home_top" {
+		t.Fatalf("page = %+v, want slates in request order", page)
+	}
+
+	ids := func(recs []domain.BanditRecommendation) map[uint64]bool {
+		out := make(map[uint64]bool, len(recs))
+		for _, r := range recs {
+			out[r.ProductID] = true
+		}
+		return out
+	}
+	home, pdp := ids(page[1].Items), ids(page[0].Items)
+	if len(home) != 3 || len(pdp) != 3 {
+		t.Fatalf("home %v, pdp %v: want 3 products each", home, pdp)
+	}
+	for pid := range home {
+		if pdp[pid] {
+			t.Errorf("product %d served in both slots", pid)
+		}
+	}
+	for _, pid := range []uint64{1, 2, 3} {
+		if !home[pid] {
+			t.Errorf("home_top (priority 5) = %v, want the top candidates 1, 2, 3", home)
+			break
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package bandit
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+func init() {
+	RegisterPolicy(PolicyLinUCB, newLinUCBPolicy)
+	RegisterPolicy(PolicyHybridLinUCB, newHybridLinUCBPolicy)
+	RegisterPolicy(PolicyThompson, newThompsonPolicy)
+	RegisterPolicy(PolicyThompsonDiag, newThompsonDiagPolicy)
+	RegisterPolicy(PolicyEpsilonGreedy, newEpsilonGreedyPolicy)
+	RegisterPolicy(PolicySoftmax, newSoftmaxPolicy)
+	RegisterPolicy(PolicyPopularity, newPopularityPolicy)
+	RegisterPolicy(PolicyOffline, newOfflinePolicy)
+}
+
+// param reads a policy parameter with a default.
+func param(params map[string]float64, key string, def float64) float64 {
+	if v, ok := params[key]; ok {
+		return v
+	}
+	return def
+}
+
+// ridgeUpdate is the shared LinUCB ridge-regression update.
+type ridgeUpdate struct{}
+
+func (ridgeUpdate) Update(arm *LinUCBArmState, x []float64, reward float64, now time.Time) {
+	updateArm(arm, x, reward, now)
+}
+
+// uncertainty = sqrt(x^T A^-1 x)
+func uncertainty(arm PolicyArm) float64 {
+	return math.Sqrt(math.Max(dot(arm.X, matVecMul(arm.AInv, arm.X)), 0))
+}
+
+// ---- LinUCB ----
+
+// linUCBPolicy scores theta·x + alpha * sqrt(x^T A^-1 x).
+type linUCBPolicy struct {
+	ridgeUpdate
+	alpha float64
+}
+
+func newLinUCBPolicy(params map[string]float64) (Policy, error) {
+	alpha := param(params, "alpha", defaultAlpha)
+	if alpha < 0 {
+		return nil, fmt.Errorf("linucb: alpha must be >= 0")
+	}
+	return &linUCBPolicy{alpha: alpha}, nil
+}
+
+func (p *linUCBPolicy) Name() string     { return PolicyLinUCB }
+func (p *linUCBPolicy) Stochastic() bool { return false }
+
+func (p *linUCBPolicy) Score(arms []PolicyArm) []float64 {
+	out := make([]float64, len(arms))
+	for i, a := range arms {
+		out[i] = ucbScore(a.Theta, a.X, a.AInv, p.alpha)
+	}
+	return out
+}
+
+func (p *linUCBPolicy) Explain(arm PolicyArm) map[string]float64 {
+	mean := arm.Mean()
+	u := uncertainty(arm)
+	return map[string]float64{
+		"mean":        mean,
+		"uncertainty": u,
+		"alpha":       p.alpha,
+		"score":       mean + p.alpha*u,
+	}
+}
+
+// ---- Thompson sampling (full covariance) ----
+
+// thompsonPolicy samples theta ~ N(theta_hat, v² A^-1) per arm.
+type thompsonPolicy struct {
+	ridgeUpdate
+	v float64
+}
+
+func newThompsonPolicy(params map[string]float64) (Policy, error) {
+	v := param(params, "v", 1.0)
+	if v < 0 {
+		return nil, fmt.Errorf("thompson: v must be >= 0")
+	}
+	return &thompsonPolicy{v: v}, nil
+}
+
+func (p *thompsonPolicy) Name() string     { return PolicyThompson }
+func (p *thompsonPolicy) Stochastic() bool { return true }
+
+func (p *thompsonPolicy) Score(arms []PolicyArm) []float64 {
+	out := make([]float64, len(arms))
+	for i, a := range arms {
+		L, ok := cholesky(a.AInv)
+		if !ok {
+			// not positive definite: degrade to the diagonal sampler
+			out[i] = thompsonScore(a.Theta, a.X, a.AInv)
+			continue
+		}
+
+		z := make([]float64, len(a.Theta))
+		for j := range z {
+			z[j] = rand.NormFloat64()
+		}
+		noise := matVecMul(L, z)
+
+		sample := make([]float64, len(a.Theta))
+		for j := range sample {
+			sample[j] = a.Theta[j] + p.v*noise[j]
+		}
+		out[i] = dot(sample, a.X)
+	}
+	return out
+}
+
+func (p *thompsonPolicy) Explain(arm PolicyArm) map[string]float64 {
+	return map[string]float64{
+		"mean":        arm.Mean(),
+		"uncertainty": uncertainty(arm),
+		"v":           p.v,
+	}
+}
+
+// ---- Thompson sampling (diagonal) ----
+
+type thompsonDiagPolicy struct {
+	ridgeUpdate
+}
+
+func newThompsonDiagPolicy(map[string]float64) (Policy, error) {
+	return &thompsonDiagPolicy{}, nil
+}
+
+func (p *thompsonDiagPolicy) Name() string     { return PolicyThompsonDiag }
+func (p *thompsonDiagPolicy) Stochastic() bool { return true }
+
+func (p *thompsonDiagPolicy) Score(arms []PolicyArm) []float64 {
+	out := make([]float64, len(arms))
+	for i, a := range arms {
+		out[i] = thompsonScore(a.Theta, a.X, a.AInv)
+	}
+	return out
+}
+
+func (p *thompsonDiagPolicy) Explain(arm PolicyArm) map[string]float64 {
+	return map[string]float64{
+		"mean":        arm.Mean(),
+		"uncertainty": uncertainty(arm),
+	}
+}
+
+// ---- epsilon-greedy ----
+
+// epsilonGreedyPolicy ranks by theta·x, except that with probability epsilon
+// a whole call is replaced by uniformly random scores.
+type epsilonGreedyPolicy struct {
+	ridgeUpdate
+	epsilon float64
+}
+
+func newEpsilonGreedyPolicy(params map[string]float64) (Policy, error) {
+	eps := param(params, "epsilon", 0.1)
+	if eps < 0 || eps > 1 {
+		return nil, fmt.Errorf("epsilon_greedy: epsilon must be in [0, 1]")
+	}
+	return &epsilonGreedyPolicy{epsilon: eps}, nil
+}
+
+func (p *epsilonGreedyPolicy) Name() string     { return PolicyEpsilonGreedy }
+func (p *epsilonGreedyPolicy) Stochastic() bool { return p.epsilon > 0 }
+
+func (p *epsilonGreedyPolicy) Score(arms []PolicyArm) []float64 {
+	out := make([]float64, len(arms))
+	explore := rand.Float64() < p.epsilon
+	for i, a := range arms {
+		if explore {
+			out[i] = rand.Float64()
+			continue
+		}
+		out[i] = a.Mean()
+	}
+	return out
+}
+
+func (p *epsilonGreedyPolicy) Explain(arm PolicyArm) map[string]float64 {
+	return map[string]float64{
+		"mean":    arm.Mean(),
+		"epsilon": p.epsilon,
+	}
+}
+
+// ---- softmax / Boltzmann ----
+
+// softmaxPolicy adds temperature-scaled Gumbel noise to theta·x. Taking the
+// top-N of the perturbed scores samples a slate without replacement with
+// probabilities proportional to exp(mean / temperature).
+type softmaxPolicy struct {
+	ridgeUpdate
+	temperature float64
+}
+
+func newSoftmaxPolicy(params map[string]float64) (Policy, error) {
+	t := param(params, "temperature", 0.1)
+	if t <= 0 {
+		return nil, fmt.Errorf("softmax: temperature must be > 0")
+	}
+	return &softmaxPolicy{temperature: t}, nil
+}
+
+func (p *softmaxPolicy) Name() string     { return PolicySoftmax }
+func (p *softmaxPolicy) Stochastic() bool { return true }
+
+func (p *softmaxPolicy) Score(arms []PolicyArm) []float64 {
+	out := make([]float64, len(arms))
+	for i, a := range arms {
+		u := rand.Float64()
+		for u == 0 {
+			u = rand.Float64()
+		}
+		gumbel := -math.Log(-math.Log(u))
+		out[i] = a.Mean() + p.temperature*gumbel
+	}
+	return out
+}
+
+func (p *softmaxPolicy) Explain(arm PolicyArm) map[string]float64 {
+	return map[string]float64{
+		"mean":        arm.Mean(),
+		"temperature": p.temperature,
+	}
+}
+
+// ---- popularity baseline ----
+
+// popularityPolicy ignores context and ranks by how often an arm was updated.
+type popularityPolicy struct {
+	ridgeUpdate
+}
+
+func newPopularityPolicy(map[string]float64) (Policy, error) {
+	return &popularityPolicy{}, nil
+}
+
+func (p *popularityPolicy) Name() string     { return PolicyPopularity }
+func (p *popularityPolicy) Stochastic() bool { return false }
+
+func (p *popularityPolicy) Score(arms []PolicyArm) []float64 {
+	out := make([]float64, len(arms))
+	for i, a := range arms {
+		out[i] = math.Log1p(float64(a.Count))
+	}
+	return out
+}
+
+func (p *popularityPolicy) Explain(arm PolicyArm) map[string]float64 {
+	return map[string]float64{
+		"count": float64(arm.Count),
+		"score": math.Log1p(float64(arm.Count)),
+	}
+}
+
+// ---- offline only ----
+
+// offlinePolicy contributes nothing; ranking is left to the offline score.
+type offlinePolicy struct {
+	ridgeUpdate
+}
+
+func newOfflinePolicy(map[string]float64) (Policy, error) {
+	return &offlinePolicy{}, nil
+}
+
+func (p *offlinePolicy) Name() string     { return PolicyOffline }
+func (p *offlinePolicy) Stochastic() bool { return false }
+
+func (p *offlinePolicy) Score(arms []PolicyArm) []float64 {
+	return make([]float64, len(arms))
+}
+
+func (p *offlinePolicy) Explain(PolicyArm) map[string]float64 {
+	return map[string]float64{}
+}
@@ -0,0 +1,246 @@
+package bandit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+)
+
+const (
+	PolicyLinUCB        = "linucb"
+	PolicyHybridLinUCB  = "hybrid_linucb" // shared + per-arm coefficients (Li et al. 2010)
+	PolicyThompson      = "thompson"      // full-covariance linear Thompson sampling
+	PolicyThompsonDiag  = "thompson_diag" // diagonal Thompson sampling (legacy VariantThompson)
+	PolicyEpsilonGreedy = "epsilon_greedy"
+	PolicySoftmax       = "softmax"
+	PolicyPopularity    = "popularity"
+	PolicyOffline       = "offline"
+)
+
+// PolicyArm is the read-only view of one arm a Policy scores.
+type PolicyArm struct {
+	ProductID uint64
+	X         []float64
+	Theta     []float64
+	AInv      [][]float64
+	Count     int
+
+	// set for SharedPolicy policies only: the cross features z, the arm's
+	// b and B_z blocks and the state's shared statistics. Theta is then
+	// the arm-specific part A⁻¹(b − B_z β).
+	Z      []float64
+	B      []float64
+	BZ     [][]float64
+	Shared *SharedStats
+}
+
+// Mean is the arm's estimated reward: θᵀx, plus βᵀz for shared policies.
+func (a PolicyArm) Mean() float64 {
+	m := dot(a.Theta, a.X)
+	if a.Shared != nil && len(a.Z) > 0 {
+		m += dot(a.Shared.Beta, a.Z)
+	}
+	return m
+}
+
+// Policy turns learned arm statistics into bandit scores.
+//
+// States are shared by every variant of a slot/segment, so Update must keep
+// the ridge statistics (A, b) consistent; policies differ in how they score.
+type Policy interface {
+	Name() string
+
+	// Score returns one bandit score per arm, in order. It is called once
+	// per state (global, user) for every request.
+	Score(arms []PolicyArm) []float64
+
+	// Update folds one observed reward into an arm.
+	Update(arm *LinUCBArmState, x []float64, reward float64, now time.Time)
+
+	// Explain breaks an arm's score into named components for DebugRecommend.
+	Explain(arm PolicyArm) map[string]float64
+
+	// Stochastic reports whether Score is randomised, in which case slate
+	// propensities are estimated by Monte Carlo.
+	Stochastic() bool
+}
+
+// SharedPolicy is a Policy that also learns a coefficient block shared by
+// every arm of a global state (LinUCBState.Hybrid), over cross features z.
+type SharedPolicy interface {
+	Policy
+
+	// UpdateShared folds one reward into the state's shared block and the
+	// arm, replacing Update.
+	UpdateShared(st *LinUCBState, arm *LinUCBArmState, x, z []float64, reward float64, now time.Time)
+}
+
+// PolicyFactory builds a Policy from the parameters stored in bandit_config.
+type PolicyFactory func(params map[string]float64) (Policy, error)
+
+var (
+	policyMu        sync.RWMutex
+	policyFactories = make(map[string]PolicyFactory)
+)
+
+// RegisterPolicy makes a policy selectable by name from bandit_config.
+func RegisterPolicy(name string, factory PolicyFactory) {
+	policyMu.Lock()
+	defer policyMu.Unlock()
+
+	if _, dup := policyFactories[name]; dup {
+		panic("bandit: RegisterPolicy called twice for " + name)
+	}
+	policyFactories[name] = factory
+}
+
+// NewPolicy builds a registered policy.
+func NewPolicy(name string, params map[string]float64) (Policy, error) {
+	policyMu.RLock()
+	factory, ok := policyFactories[name]
+	policyMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown bandit policy: %s", name)
+	}
+	return factory(params)
+}
+
+// RegisteredPolicies lists the selectable policy names.
+func RegisteredPolicies() []string {
+	policyMu.RLock()
+	defer policyMu.RUnlock()
+
+	names := make([]string, 0, len(policyFactories))
+	for name := range policyFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// defaultPolicyForVariant keeps configs without a policy on the behaviour
+// their variant number always had.
+func defaultPolicyForVariant(variant int) string {
+	switch variant {
+	case VariantOfflineOnly:
+		return PolicyOffline
+	case VariantThompson:
+		return PolicyThompsonDiag
+	default:
+		return PolicyLinUCB
+	}
+}
+
+// policyParams returns the config's policy params with Config.Alpha as the
+// default exploration weight.
+func policyParams(cfg Config) map[string]float64 {
+	params := make(map[string]float64, len(cfg.PolicyParams)+1)
+	params["alpha"] = cfg.Alpha
+	for k, v := range cfg.PolicyParams {
+		params[k] = v
+	}
+	return params
+}
+
+// policyFor resolves the policy serving a variant, falling back to LinUCB
+// with default params when the stored policy or its params are invalid.
+func policyFor(cfg Config, variant int) Policy {
+	name := cfg.Policy
+	if name == "" {
+		name = defaultPolicyForVariant(variant)
+	}
+
+	p, err := NewPolicy(name, policyParams(cfg))
+	if err != nil {
+		logger.Warn("bandit_policy_fallback",
+			"policy", name,
+			"variant", variant,
+			"error", err,
+		)
+		p = &linUCBPolicy{alpha: defaultAlpha}
+	}
+	return p
+}
+
+// ValidateConfig checks a BanditConfig before it is stored.
+func ValidateConfig(cfg domain.BanditConfig) error {
+	if cfg.Slot == "" {
+		return fmt.Errorf("slot is required")
+	}
+	if len(cfg.FeatureList) > 0 {
+		if _, err := newFeaturePipeline(Config{NumSegments: cfg.NumSegments}, cfg.FeatureList); err != nil {
+			return err
+		}
+	}
+	if cfg.Alpha < 0 {
+		return fmt.Errorf("alpha must be >= 0")
+	}
+	policy := cfg.Policy
+	if policy == "" {
+		policy = defaultPolicyForVariant(cfg.Variant)
+	}
+	if _, err := NewPolicy(policy, policyParams(Config{Alpha: cfg.Alpha, PolicyParams: cfg.PolicyParams})); err != nil {
+		return err
+	}
+	for _, step := range cfg.Rerank {
+		if _, err := NewReranker(step.Strategy, step.Params); err != nil {
+			return err
+		}
+	}
+	if err := ValidateRewardModel(cfg.RewardModel); err != nil {
+		return err
+	}
+	if f := cfg.Fatigue; f != (domain.BanditFatigue{}) {
+		if f.MaxImpressions < 0 || f.Penalty < 0 || f.DismissSeconds < 0 {
+			return fmt.Errorf("fatigue: max_impressions, penalty and dismiss_seconds must be >= 0")
+		}
+		if (f.MaxImpressions > 0 || f.Penalty > 0) && f.WindowSeconds <= 0 {
+			return fmt.Errorf("fatigue: window_seconds must be > 0")
+		}
+	}
+	return nil
+}
+
+// ErrFeatureLayoutConflict is returned for a config whose feature layout
+// differs from the other variants of its slot.
+var ErrFeatureLayoutConflict = errors.New("feature layout differs from the slot's other variants")
+
+// ValidateSlotLayout checks that cfg resolves to the same feature layout as
+// every stored variant of its slot. Global and user states are shared by
+// all variants, so variants on different layouts would migrate them back
+// and forth, each time discarding what the other layout learned.
+func ValidateSlotLayout(ctx context.Context, repo ConfigRepository, cfg domain.BanditConfig) error {
+	dims := pipelineFor(configFromDomain(DefaultConfig(), cfg)).dims
+
+	variants := cfg.NumVariants
+	if base, ok, err := repo.GetConfig(ctx, cfg.Slot, 0); err != nil {
+		return err
+	} else if ok && base.NumVariants > variants {
+		variants = base.NumVariants
+	}
+
+	for v := 0; v < variants; v++ {
+		if v == cfg.Variant {
+			continue
+		}
+		other, ok, err := repo.GetConfig(ctx, cfg.Slot, v)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if !slices.Equal(dims, pipelineFor(configFromDomain(DefaultConfig(), other)).dims) {
+			return fmt.Errorf("%w: variant %d", ErrFeatureLayoutConflict, v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package bandit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+)
+
+const defaultProductCacheTTL = 10 * time.Minute
+
+// ProductCatalog loads catalogue rows for a set of product IDs.
+type ProductCatalog interface {
+	FindByIDs(ctx context.Context, ids []uint64) ([]domain.Product, error)
+}
+
+// ProductFeatureSource supplies the attributes product features read.
+// Products it does not know are left out of the result.
+type ProductFeatureSource interface {
+	Attributes(ctx context.Context, ids []uint64) map[uint64]*ProductAttributes
+}
+
+// ProductFeatureProvider is a read-through TTL cache over the catalogue.
+// Products missing from the catalogue are cached too, so unknown IDs in the
+// offline candidates do not hit the database on every request.
+type ProductFeatureProvider struct {
+	catalog ProductCatalog
+	ttl     time.Duration
+
+	mu    sync.RWMutex
+	cache map[uint64]cachedProduct
+}
+
+type cachedProduct struct {
+	attrs   *ProductAttributes // nil when the product is unknown
+	expires time.Time
+}
+
+var _ ProductFeatureSource = (*ProductFeatureProvider)(nil)
+
+func NewProductFeatureProvider(catalog ProductCatalog, ttl time.Duration) *ProductFeatureProvider {
+	if ttl <= 0 {
+		ttl = defaultProductCacheTTL
+	}
+	return &ProductFeatureProvider{
+		catalog: catalog,
+		ttl:     ttl,
+		cache:   make(map[uint64]cachedProduct),
+	}
+}
+
+// Attributes returns the cached attributes of ids, loading expired or
+// missing entries in one catalogue query. On a catalogue error the products
+// are served without attributes rather than failing the request.
+func (p *ProductFeatureProvider) Attributes(ctx context.Context, ids []uint64) map[uint64]*ProductAttributes {
+	now := time.Now()
+	out := make(map[uint64]*ProductAttributes, len(ids))
+	missing := make([]uint64, 0)
+
+	p.mu.RLock()
+	for _, id := range ids {
+		c, ok := p.cache[id]
+		if ok && now.Before(c.expires) {
+			if c.attrs != nil {
+				out[id] = c.attrs
+			}
+			continue
+		}
+		missing = append(missing, id)
+	}
+	p.mu.RUnlock()
+
+	if len(missing) == 0 {
+		return out
+	}
+
+	rows, err := p.catalog.FindByIDs(ctx, missing)
+	if err != nil {
+		logger.Warn("bandit_product_features_load_failed",
+			"trace_id", TraceIDFromContext(ctx),
+			"products", len(missing),
+			"error", err,
+		)
+		return out
+	}
+
+	loaded := make(map[uint64]*ProductAttributes, len(rows))
+	for _, row := range rows {
+		loaded[row.ID] = &ProductAttributes{
+			IsGreenTag:  row.IsGreenTag,
+			CategoryID:  row.CategoryID,
+			NormalPrice: row.NormalPrice,
+			SalePrice:   row.SalePrice,
+			Discount:    row.Discount,
+			CostPrice:   row.CostPrice,
+			EcoScore:    row.EcoScore,
+			AddedAt:     row.CreatedAt,
+		}
+	}
+
+	expires := now.Add(p.ttl)
+	p.mu.Lock()
+	for _, id := range missing {
+		attrs := loaded[id]
+		p.cache[id] = cachedProduct{attrs: attrs, expires: expires}
+		if attrs != nil {
+			out[id] = attrs
+		}
+	}
+	p.mu.Unlock()
+
+	return out
+}
+
+// productAttributes looks up attributes for ids when a source is configured.
+func productAttributes(ctx context.Context, src ProductFeatureSource, ids ...uint64) map[uint64]*ProductAttributes {
+	if src == nil || len(ids) == 0 {
+		return nil
+	}
+	return src.Attributes(ctx, ids)
+}
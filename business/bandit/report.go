@@ -0,0 +1,480 @@
+package bandit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"myGreenMarket/domain"
+)
+
+const (
+	defaultReportWindow = 14 * 24 * time.Hour
+
+	// Monte Carlo draws for the Bayesian probability to beat control
+	beatControlSamples = 20000
+
+	srmAlpha         = 0.001
+	significantAlpha = 0.05
+)
+
+// VariantImpressions counts served slates per assigned variant; Rerouted
+// of them were served by another variant while this one was paused.
+type VariantImpressions struct {
+	Variant     int
+	Impressions int64
+	Users       int64
+	Rerouted    int64
+}
+
+// VariantEventStats aggregates one event type of one assigned variant;
+// ValueSum and ValueSqSum are over the events' business value.
+type VariantEventStats struct {
+	Variant    int
+	EventType  string
+	Events     int64
+	ValueSum   float64
+	ValueSqSum float64
+}
+
+type ImpressionStatsSource interface {
+	ImpressionStats(ctx context.Context, slot string, from, to time.Time) ([]VariantImpressions, error)
+}
+
+type EventStatsSource interface {
+	EventStats(ctx context.Context, slot string, from, to time.Time) ([]VariantEventStats, error)
+}
+
+// AssignmentCounter counts an experiment's treatment assignments per variant.
+type AssignmentCounter interface {
+	AssignmentCounts(ctx context.Context, experimentID uint) (map[int]int64, error)
+}
+
+// ExperimentReporter compares the variants of a slot on its logged
+// impressions and feedback events.
+type ExperimentReporter struct {
+	impressions ImpressionStatsSource
+	events      EventStatsSource
+	experiments ExperimentRepository
+	assignments AssignmentCounter
+}
+
+func NewExperimentReporter(
+	impressions ImpressionStatsSource,
+	events EventStatsSource,
+	experiments ExperimentRepository,
+	assignments AssignmentCounter,
+) *ExperimentReporter {
+	return &ExperimentReporter{
+		impressions: impressions,
+		events:      events,
+		experiments: experiments,
+		assignments: assignments,
+	}
+}
+
+// ReportRequest selects the window and control of a report. Zero values
+// default to the slot's latest experiment: its lifetime and its control
+// variant, or the last two weeks and variant 0 without one.
+type ReportRequest struct {
+	Slot    string
+	From    time.Time
+	To      time.Time
+	Control *int
+}
+
+// Report computes per-variant CTR, add-to-cart rate, conversion rate and
+// revenue per impression, compares each variant with control and checks for
+// sample-ratio mismatch.
+//
+// Traffic is grouped by the variant users were assigned, not the one that
+// served them: a paused variant keeps its rerouted users, so they neither
+// dilute the control nor skew the sample ratio.
+//
+// Rates are events per served slate; a slate that drew several clicks
+// counts them all, so rates are capped at 1 for the proportion tests.
+func (r *ExperimentReporter) Report(ctx context.Context, req ReportRequest) (domain.ExperimentReport, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.ExperimentReport{}, fmt.Errorf("context error: %w", err)
+	}
+	if req.Slot == "" {
+		return domain.ExperimentReport{}, fmt.Errorf("slot is required")
+	}
+
+	var exp *domain.BanditExperiment
+	if r.experiments != nil {
+		e, ok, err := r.experiments.LatestExperiment(ctx, req.Slot)
+		if err != nil {
+			return domain.ExperimentReport{}, err
+		}
+		if ok {
+			exp = &e
+		}
+	}
+
+	report := domain.ExperimentReport{Slot: req.Slot, From: req.From, To: req.To}
+	if exp != nil {
+		report.ExperimentID = &exp.ID
+		report.ControlVariant = exp.ControlVariant
+		if report.From.IsZero() {
+			report.From = exp.CreatedAt
+		}
+		if report.To.IsZero() && exp.StoppedAt != nil {
+			report.To = *exp.StoppedAt
+		}
+	}
+	if req.Control != nil {
+		report.ControlVariant = *req.Control
+	}
+	if report.To.IsZero() {
+		report.To = time.Now()
+	}
+	if report.From.IsZero() {
+		report.From = report.To.Add(-defaultReportWindow)
+	}
+
+	imps, err := r.impressions.ImpressionStats(ctx, req.Slot, report.From, report.To)
+	if err != nil {
+		return domain.ExperimentReport{}, fmt.Errorf("load impression stats: %w", err)
+	}
+	evs, err := r.events.EventStats(ctx, req.Slot, report.From, report.To)
+	if err != nil {
+		return domain.ExperimentReport{}, fmt.Errorf("load event stats: %w", err)
+	}
+
+	report.Variants = variantReports(imps, evs)
+	compareToControl(report.Variants, report.ControlVariant)
+
+	srm, err := r.sampleRatio(ctx, exp, imps)
+	if err != nil {
+		return domain.ExperimentReport{}, err
+	}
+	report.SampleRatio = srm
+
+	return report, nil
+}
+
+func variantReports(imps []VariantImpressions, evs []VariantEventStats) []domain.VariantReport {
+	byVariant := make(map[int]*domain.VariantReport)
+	revSq := make(map[int]float64)
+
+	get := func(v int) *domain.VariantReport {
+		vr, ok := byVariant[v]
+		if !ok {
+			vr = &domain.VariantReport{Variant: v}
+			byVariant[v] = vr
+		}
+		return vr
+	}
+
+	for _, row := range imps {
+		vr := get(row.Variant)
+		vr.Impressions += row.Impressions
+		vr.Users += row.Users
+		vr.Rerouted += row.Rerouted
+	}
+	for _, row := range evs {
+		vr := get(row.Variant)
+		switch row.EventType {
+		case "click":
+			vr.Clicks += row.Events
+		case "atc":
+			vr.ATCs += row.Events
+		case "order":
+			vr.Orders += row.Events
+			vr.Revenue += row.ValueSum
+			revSq[row.Variant] += row.ValueSqSum
+		}
+	}
+
+	out := make([]domain.VariantReport, 0, len(byVariant))
+	for v, vr := range byVariant {
+		n := vr.Impressions
+		vr.CTR = proportionEstimate(vr.Clicks, n)
+		vr.ATCRate = proportionEstimate(vr.ATCs, n)
+		vr.ConversionRate = proportionEstimate(vr.Orders, n)
+		vr.RevenuePerImpression = revenueEstimate(vr.Revenue, revSq[v], n)
+		out = append(out, *vr)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Variant < out[j].Variant })
+	return out
+}
+
+func compareToControl(variants []domain.VariantReport, control int) {
+	var ctl *domain.VariantReport
+	for i := range variants {
+		if variants[i].Variant == control {
+			ctl = &variants[i]
+		}
+	}
+	if ctl == nil {
+		return
+	}
+
+	// one generator per report keeps the Monte Carlo estimates reproducible
+	rng := rand.New(rand.NewSource(1))
+
+	for i := range variants {
+		vr := &variants[i]
+		if vr.Variant == control {
+			continue
+		}
+		vr.VsControl = map[string]domain.MetricComparison{
+			"ctr":             compareProportions(rng, vr.Clicks, vr.Impressions, ctl.Clicks, ctl.Impressions),
+			"atc_rate":        compareProportions(rng, vr.ATCs, vr.Impressions, ctl.ATCs, ctl.Impressions),
+			"conversion_rate": compareProportions(rng, vr.Orders, vr.Impressions, ctl.Orders, ctl.Impressions),
+			"revenue_per_impression": compareMeans(
+				vr.RevenuePerImpression, ctl.RevenuePerImpression,
+			),
+		}
+	}
+}
+
+// sampleRatio checks the split of treatment assignments against the arm
+// weights when the slot runs an experiment, and otherwise the split of
+// users across variants against an even split.
+func (r *ExperimentReporter) sampleRatio(
+	ctx context.Context,
+	exp *domain.BanditExperiment,
+	imps []VariantImpressions,
+) (domain.SampleRatioCheck, error) {
+	observed := make(map[int]int64)
+	weights := make(map[int]float64)
+	source := "impressions"
+
+	if exp != nil && r.assignments != nil && len(exp.Arms) > 1 {
+		counts, err := r.assignments.AssignmentCounts(ctx, exp.ID)
+		if err != nil {
+			return domain.SampleRatioCheck{}, fmt.Errorf("load assignment counts: %w", err)
+		}
+		source = "assignments"
+		for _, arm := range exp.Arms {
+			observed[arm.Variant] = counts[arm.Variant]
+			weights[arm.Variant] = arm.Weight
+		}
+	} else {
+		for _, row := range imps {
+			observed[row.Variant] += row.Users
+			weights[row.Variant] = 1
+		}
+	}
+
+	return chiSquareSRM(source, observed, weights), nil
+}
+
+func chiSquareSRM(source string, observed map[int]int64, weights map[int]float64) domain.SampleRatioCheck {
+	check := domain.SampleRatioCheck{
+		Source:   source,
+		Observed: observed,
+		Expected: make(map[int]float64, len(weights)),
+		PValue:   1,
+	}
+
+	var total int64
+	wsum := 0.0
+	for v, w := range weights {
+		total += observed[v]
+		wsum += w
+	}
+	if total == 0 || wsum <= 0 || len(weights) < 2 {
+		return check
+	}
+
+	df := 0
+	for v, w := range weights {
+		exp := float64(total) * w / wsum
+		check.Expected[v] = exp
+		if exp <= 0 {
+			continue
+		}
+		d := float64(observed[v]) - exp
+		check.ChiSquare += d * d / exp
+		df++
+	}
+	if df < 2 {
+		return check
+	}
+
+	check.PValue = chiSquareSurvival(check.ChiSquare, df-1)
+	check.Mismatch = check.PValue < srmAlpha
+	return check
+}
+
+// ---- statistics ----
+
+// proportionEstimate is x/n with a Wilson score interval.
+func proportionEstimate(x, n int64) domain.MetricEstimate {
+	if n <= 0 {
+		return domain.MetricEstimate{}
+	}
+	p := float64(x) / float64(n)
+	pc := math.Min(p, 1)
+
+	nf := float64(n)
+	z2 := z95 * z95
+	denom := 1 + z2/nf
+	centre := (pc + z2/(2*nf)) / denom
+	half := z95 * math.Sqrt(pc*(1-pc)/nf+z2/(4*nf*nf)) / denom
+
+	return domain.MetricEstimate{
+		Value:  p,
+		CILow:  math.Max(centre-half, 0),
+		CIHigh: math.Min(centre+half, 1),
+	}
+}
+
+// revenueEstimate is sum/n with a normal interval from the sum of squares.
+func revenueEstimate(sum, sqSum float64, n int64) domain.MetricEstimate {
+	if n <= 0 {
+		return domain.MetricEstimate{}
+	}
+	nf := float64(n)
+	mean := sum / nf
+	half := z95 * meanStdErr(mean, sqSum, nf)
+	return domain.MetricEstimate{Value: mean, CILow: mean - half, CIHigh: mean + half}
+}
+
+func meanStdErr(mean, sqSum, n float64) float64 {
+	variance := math.Max(sqSum/n-mean*mean, 0)
+	return math.Sqrt(variance / n)
+}
+
+// compareProportions runs a pooled two-proportion z-test and estimates
+// P(p_variant > p_control) under independent Beta(1+x, 1+n-x) posteriors.
+func compareProportions(rng *rand.Rand, x1, n1, x0, n0 int64) domain.MetricComparison {
+	var c domain.MetricComparison
+	if n1 <= 0 || n0 <= 0 {
+		return c
+	}
+	x1, x0 = min(x1, n1), min(x0, n0)
+
+	p1 := float64(x1) / float64(n1)
+	p0 := float64(x0) / float64(n0)
+	if p0 > 0 {
+		c.Lift = (p1 - p0) / p0
+	}
+
+	pool := float64(x1+x0) / float64(n1+n0)
+	se := math.Sqrt(pool * (1 - pool) * (1/float64(n1) + 1/float64(n0)))
+	if se > 0 {
+		c.ZScore = (p1 - p0) / se
+		c.PValue = math.Erfc(math.Abs(c.ZScore) / math.Sqrt2)
+	} else {
+		c.PValue = 1
+	}
+	c.Significant = c.PValue < significantAlpha
+
+	wins := 0
+	for i := 0; i < beatControlSamples; i++ {
+		if betaSample(rng, x1, n1) > betaSample(rng, x0, n0) {
+			wins++
+		}
+	}
+	c.ProbBeatControl = float64(wins) / beatControlSamples
+	return c
+}
+
+// compareMeans is a z-test on two means; the probability to beat control
+// uses the normal approximation of their difference.
+func compareMeans(m1, m0 domain.MetricEstimate) domain.MetricComparison {
+	var c domain.MetricComparison
+	if m0.Value != 0 {
+		c.Lift = (m1.Value - m0.Value) / math.Abs(m0.Value)
+	}
+
+	// the interval half-widths are z95 standard errors
+	se1 := (m1.CIHigh - m1.Value) / z95
+	se0 := (m0.CIHigh - m0.Value) / z95
+	se := math.Sqrt(se1*se1 + se0*se0)
+	if se <= 0 {
+		c.PValue = 1
+		c.ProbBeatControl = 0.5
+		return c
+	}
+
+	c.ZScore = (m1.Value - m0.Value) / se
+	c.PValue = math.Erfc(math.Abs(c.ZScore) / math.Sqrt2)
+	c.Significant = c.PValue < significantAlpha
+	c.ProbBeatControl = 0.5 * math.Erfc(-c.ZScore/math.Sqrt2)
+	return c
+}
+
+// betaSample draws from Beta(1+x, 1+n-x).
+func betaSample(rng *rand.Rand, x, n int64) float64 {
+	a := gammaSample(rng, float64(1+x))
+	b := gammaSample(rng, float64(1+n-x))
+	return a / (a + b)
+}
+
+// gammaSample draws from Gamma(shape, 1) for shape >= 1 (Marsaglia–Tsang).
+func gammaSample(rng *rand.Rand, shape float64) float64 {
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := rng.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := rng.Float64()
+		if math.Log(u) < 0.5*x*x+d-d*v+d*math.Log(v) {
+			return d * v
+		}
+	}
+}
+
+// chiSquareSurvival is P(X > x) for X ~ χ²(df).
+func chiSquareSurvival(x float64, df int) float64 {
+	if x <= 0 {
+		return 1
+	}
+	return gammaQ(float64(df)/2, x/2)
+}
+
+// gammaQ is the regularised upper incomplete gamma function Q(a, x).
+func gammaQ(a, x float64) float64 {
+	lg, _ := math.Lgamma(a)
+	if x < a+1 {
+		// series for P(a, x)
+		sum := 1 / a
+		term := sum
+		for n := 1; n < 500; n++ {
+			term *= x / (a + float64(n))
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*1e-14 {
+				break
+			}
+		}
+		return 1 - sum*math.Exp(-x+a*math.Log(x)-lg)
+	}
+
+	// continued fraction for Q(a, x) (modified Lentz)
+	const tiny = 1e-300
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+	for i := 1; i < 500; i++ {
+		an := -float64(i) * (float64(i) - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < 1e-14 {
+			break
+		}
+	}
+	return math.Exp(-x+a*math.Log(x)-lg) * h
+}
@@ -0,0 +1,178 @@
+//go:build !integration
+
+package bandit
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"myGreenMarket/domain"
+)
+
+// fixedReportStats serves fixed impression and event aggregates.
+type fixedReportStats struct {
+	imps []VariantImpressions
+	evs  []VariantEventStats
+}
+
+func (s fixedReportStats) ImpressionStats(context.Context, string, time.Time, time.Time) ([]VariantImpressions, error) {
+	return s.imps, nil
+}
+
+func (s fixedReportStats) EventStats(context.Context, string, time.Time, time.Time) ([]VariantEventStats, error) {
+	return s.evs, nil
+}
+
+// fixedAssignments serves fixed assignment counts.
+type fixedAssignments map[int]int64
+
+func (a fixedAssignments) AssignmentCounts(context.Context, uint) (map[int]int64, error) {
+	return a, nil
+}
+
+// The chi-square survival function matches critical values from the
+// χ² table, on both the series and the continued-fraction branch.
+func TestChiSquareSurvival(t *testing.T) {
+	cases := []struct {
+		x    float64
+		df   int
+		want float64
+	}{
+		{3.841, 1, 0.05},
+		{6.635, 1, 0.01},
+		{10.828, 1, 0.001},
+		{5.991, 2, 0.05},
+		{7.815, 3, 0.05},
+		{18.307, 10, 0.05},
+		{3.940, 10, 0.95},
+		{9.342, 10, 0.50},
+		{0, 1, 1},
+	}
+	for _, c := range cases {
+		got := chiSquareSurvival(c.x, c.df)
+		if math.Abs(got-c.want) > 5e-4 {
+			t.Errorf("chiSquareSurvival(%v, %d) = %.5f, want %.3f", c.x, c.df, got, c.want)
+		}
+	}
+}
+
+// A variant with a clearly higher CTR is reported as a significant lift
+// over control, an identical one is not, and an even user split passes
+// the sample-ratio check.
+func TestReport_ComparesVariantsWithControl(t *testing.T) {
+	control := VariantOfflineOnly
+	stats := fixedReportStats{
+		imps: []VariantImpressions{
+			{Variant: VariantOfflineOnly, Impressions: 10000, Users: 5000},
+			{Variant: VariantUCB, Impressions: 10000, Users: 5050},
+			{Variant: VariantThompson, Impressions: 10000, Users: 4980},
+		},
+		evs: []VariantEventStats{
+			{Variant: VariantOfflineOnly, EventType: "click", Events: 500},
+			{Variant: VariantUCB, EventType: "click", Events: 650},
+			{Variant: VariantThompson, EventType: "click", Events: 500},
+			{Variant: VariantOfflineOnly, EventType: "order", Events: 100, ValueSum: 5000, ValueSqSum: 300000},
+			{Variant: VariantUCB, EventType: "order", Events: 100, ValueSum: 5000, ValueSqSum: 300000},
+		},
+	}
+	reporter := NewExperimentReporter(stats, stats, nil, nil)
+
+	report, err := reporter.Report(context.Background(), ReportRequest{Slot: "home_top", Control: &control})
+	if err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+	if len(report.Variants) != 3 {
+		t.Fatalf("variants = %d, want 3", len(report.Variants))
+	}
+
+	byVariant := make(map[int]domain.VariantReport)
+	for _, vr := range report.Variants {
+		byVariant[vr.Variant] = vr
+	}
+	if ctl := byVariant[control]; ctl.VsControl != nil {
+		t.Errorf("control has comparisons: %v", ctl.VsControl)
+	}
+
+	// 6.5% vs 5% CTR: pooled z = 0.015 / sqrt(0.0575·0.9425·2/10000) ≈ 4.556
+	ucb := byVariant[VariantUCB].VsControl["ctr"]
+	if math.Abs(ucb.Lift-0.3) > 1e-9 {
+		t.Errorf("ucb ctr lift = %v, want 0.3", ucb.Lift)
+	}
+	if math.Abs(ucb.ZScore-4.556) > 1e-3 {
+		t.Errorf("ucb ctr z = %v, want ≈4.556", ucb.ZScore)
+	}
+	if ucb.PValue > 1e-5 || ucb.PValue < 1e-6 || !ucb.Significant {
+		t.Errorf("ucb ctr p = %v (significant %v), want ≈5.2e-6", ucb.PValue, ucb.Significant)
+	}
+	if ucb.ProbBeatControl < 0.999 {
+		t.Errorf("ucb prob to beat control = %v, want > 0.999", ucb.ProbBeatControl)
+	}
+	if ci := byVariant[VariantUCB].CTR; ci.CILow >= 0.065 || ci.CIHigh <= 0.065 {
+		t.Errorf("ucb ctr interval [%v, %v] does not contain 0.065", ci.CILow, ci.CIHigh)
+	}
+
+	ts := byVariant[VariantThompson].VsControl["ctr"]
+	if ts.Lift != 0 || ts.PValue != 1 || ts.Significant {
+		t.Errorf("thompson ctr = %+v, want no lift and p = 1", ts)
+	}
+	if math.Abs(ts.ProbBeatControl-0.5) > 0.05 {
+		t.Errorf("thompson prob to beat control = %v, want ≈0.5", ts.ProbBeatControl)
+	}
+
+	rev := byVariant[VariantUCB].VsControl["revenue_per_impression"]
+	if rev.Lift != 0 || rev.Significant || math.Abs(rev.ProbBeatControl-0.5) > 1e-9 {
+		t.Errorf("ucb revenue = %+v, want no difference", rev)
+	}
+
+	srm := report.SampleRatio
+	if srm.Source != "impressions" || srm.Mismatch {
+		t.Errorf("sample ratio = %+v, want an impressions check without mismatch", srm)
+	}
+	if srm.PValue < 0.1 {
+		t.Errorf("sample ratio p = %v for a near-even split", srm.PValue)
+	}
+}
+
+// Assignment counts far from the arm weights are flagged as a sample-ratio
+// mismatch.
+func TestReport_FlagsSampleRatioMismatch(t *testing.T) {
+	repo := &memExperimentRepo{
+		exp: domain.BanditExperiment{
+			ID:             1,
+			Slot:           "home_top",
+			Status:         domain.ExperimentRunning,
+			ControlVariant: VariantOfflineOnly,
+			Arms: []domain.ExperimentArm{
+				{Variant: VariantOfflineOnly, Weight: 1},
+				{Variant: VariantUCB, Weight: 3},
+			},
+			CreatedAt: time.Now().Add(-24 * time.Hour),
+		},
+	}
+	stats := fixedReportStats{imps: []VariantImpressions{
+		{Variant: VariantOfflineOnly, Impressions: 2000, Users: 2000},
+		{Variant: VariantUCB, Impressions: 2000, Users: 2000},
+	}}
+
+	// an even split where the weights ask for 1:3
+	assignments := fixedAssignments{VariantOfflineOnly: 2000, VariantUCB: 2000}
+	report, err := NewExperimentReporter(stats, stats, repo, assignments).
+		Report(context.Background(), ReportRequest{Slot: "home_top"})
+	if err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+
+	srm := report.SampleRatio
+	if srm.Source != "assignments" || !srm.Mismatch {
+		t.Fatalf("sample ratio = %+v, want an assignments mismatch", srm)
+	}
+	// expected 1000 / 3000: χ² = 1000²/1000 + 1000²/3000
+	if math.Abs(srm.ChiSquare-4000.0/3) > 1e-6 {
+		t.Errorf("chi-square = %v, want %v", srm.ChiSquare, 4000.0/3)
+	}
+	if srm.Expected[VariantUCB] != 3000 {
+		t.Errorf("expected ucb = %v, want 3000", srm.Expected[VariantUCB])
+	}
+}
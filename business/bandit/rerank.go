@@ -0,0 +1,408 @@
+package bandit
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"myGreenMarket/pkg/logger"
+)
+
+const (
+	RerankMMR         = "mmr"          // maximal marginal relevance over category & price band
+	RerankCategoryCap = "category_cap" // at most N products per category
+	RerankGreenShare  = "green_share"  // at least a share of IsGreenTag products
+	RerankObjectives  = "objectives"   // bandit score blended with sustainability, margin & novelty
+)
+
+func init() {
+	RegisterReranker(RerankMMR, newMMRReranker)
+	RegisterReranker(RerankCategoryCap, newCategoryCapReranker)
+	RegisterReranker(RerankGreenShare, newGreenShareReranker)
+	RegisterReranker(RerankObjectives, newObjectivesReranker)
+}
+
+// RerankItem is one scored candidate as a Reranker sees it.
+type RerankItem struct {
+	ProductID uint64
+	Score     float64
+
+	// nil when the product's attributes are unknown
+	Product *ProductAttributes
+
+	// position in the scored candidate list
+	index int
+}
+
+// Reranker reorders scored candidates to trade some relevance for slate
+// diversity or business constraints.
+type Reranker interface {
+	Name() string
+
+	// Rerank receives every candidate, best score first, and returns a
+	// permutation of them whose first k items form the slate.
+	Rerank(items []RerankItem, k int) []RerankItem
+}
+
+// RerankerFactory builds a Reranker from the parameters stored in bandit_config.
+type RerankerFactory func(params map[string]float64) (Reranker, error)
+
+var (
+	rerankMu        sync.RWMutex
+	rerankFactories = make(map[string]RerankerFactory)
+)
+
+// RegisterReranker makes a re-ranking strategy selectable by name from bandit_config.
+func RegisterReranker(name string, factory RerankerFactory) {
+	rerankMu.Lock()
+	defer rerankMu.Unlock()
+
+	if _, dup := rerankFactories[name]; dup {
+		panic("bandit: RegisterReranker called twice for " + name)
+	}
+	rerankFactories[name] = factory
+}
+
+// NewReranker builds a registered re-ranking strategy.
+func NewReranker(name string, params map[string]float64) (Reranker, error) {
+	rerankMu.RLock()
+	factory, ok := rerankFactories[name]
+	rerankMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown bandit rerank strategy: %s", name)
+	}
+	return factory(params)
+}
+
+// RegisteredRerankers lists the selectable re-ranking strategies.
+func RegisteredRerankers() []string {
+	rerankMu.RLock()
+	defer rerankMu.RUnlock()
+
+	names := make([]string, 0, len(rerankFactories))
+	for name := range rerankFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// rerankersFor builds the config's re-ranking steps. Steps that fail to
+// build are skipped: a bad step must not take the slot down.
+func rerankersFor(cfg Config) []Reranker {
+	if len(cfg.Rerank) == 0 {
+		return nil
+	}
+	out := make([]Reranker, 0, len(cfg.Rerank))
+	for _, step := range cfg.Rerank {
+		r, err := NewReranker(step.Strategy, step.Params)
+		if err != nil {
+			logger.Warn("bandit_rerank_skipped",
+				"strategy", step.Strategy,
+				"error", err,
+			)
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// rerankObserver is shown the candidates before re-ranking, with step "",
+// and after every re-ranking step.
+type rerankObserver func(step string, items []RerankItem)
+
+// rankCandidates orders every arm best first: by score, then through the
+// re-ranking steps for a slate of k. The first k entries are the slate.
+// observe may be nil.
+func rankCandidates(arms []preparedArm, scores []float64, k int, rerankers []Reranker, observe rerankObserver) []int {
+	order := topKIndices(scores, len(scores))
+	if len(rerankers) == 0 {
+		return order
+	}
+
+	items := make([]RerankItem, len(order))
+	for i, j := range order {
+		items[i] = RerankItem{
+			ProductID: arms[j].productID,
+			Score:     scores[j],
+			Product:   arms[j].product,
+			index:     j,
+		}
+	}
+	if observe != nil {
+		observe("", items)
+	}
+	for _, r := range rerankers {
+		items = r.Rerank(items, k)
+		if observe != nil {
+			observe(r.Name(), items)
+		}
+	}
+
+	out := make([]int, len(items))
+	for i, it := range items {
+		out[i] = it.index
+	}
+	return out
+}
+
+// rankSlate returns the indices of the k arms served, best first.
+func rankSlate(arms []preparedArm, scores []float64, k int, rerankers []Reranker) []int {
+	return rankSlateObserved(arms, scores, k, rerankers, nil)
+}
+
+// rankSlateObserved is rankSlate showing every re-ranking step to observe.
+func rankSlateObserved(arms []preparedArm, scores []float64, k int, rerankers []Reranker, observe rerankObserver) []int {
+	if len(rerankers) == 0 {
+		return topKIndices(scores, k)
+	}
+	order := rankCandidates(arms, scores, k, rerankers, observe)
+	if k > len(order) {
+		k = len(order)
+	}
+	return order[:k]
+}
+
+// withSlate returns the picked items (by position in items) in the order
+// given, followed by the others in their original order.
+func withSlate(items []RerankItem, picked []int) []RerankItem {
+	out := make([]RerankItem, 0, len(items))
+	taken := make([]bool, len(items))
+	for _, i := range picked {
+		out = append(out, items[i])
+		taken[i] = true
+	}
+	for i, it := range items {
+		if !taken[i] {
+			out = append(out, it)
+		}
+	}
+	return out
+}
+
+func categoryOf(p *ProductAttributes) (uint64, bool) {
+	if p == nil || p.CategoryID == 0 {
+		return 0, false
+	}
+	return p.CategoryID, true
+}
+
+// ---- maximal marginal relevance ----
+
+// mmrReranker greedily picks the candidate maximising
+// λ·relevance − (1−λ)·max similarity to the products already picked.
+// Similarity is a weighted match of category and price band; relevance is
+// the score min-max normalised over the candidates.
+type mmrReranker struct {
+	lambda    float64
+	wCategory float64
+	wPrice    float64
+}
+
+func newMMRReranker(params map[string]float64) (Reranker, error) {
+	r := &mmrReranker{
+		lambda:    param(params, "lambda", 0.7),
+		wCategory: param(params, "category", 1.0),
+		wPrice:    param(params, "price_band", 0.5),
+	}
+	if r.lambda < 0 || r.lambda > 1 {
+		return nil, fmt.Errorf("mmr: lambda must be in [0, 1]")
+	}
+	if r.wCategory < 0 || r.wPrice < 0 || r.wCategory+r.wPrice == 0 {
+		return nil, fmt.Errorf("mmr: category and price_band weights must be >= 0 and not both 0")
+	}
+	return r, nil
+}
+
+func (r *mmrReranker) Name() string { return RerankMMR }
+
+func (r *mmrReranker) similarity(a, b *ProductAttributes) float64 {
+	s := 0.0
+	if ca, ok := categoryOf(a); ok {
+		if cb, ok := categoryOf(b); ok && ca == cb {
+			s += r.wCategory
+		}
+	}
+	if pa, ok := priceBand(a); ok {
+		if pb, ok := priceBand(b); ok && pa == pb {
+			s += r.wPrice
+		}
+	}
+	return s / (r.wCategory + r.wPrice)
+}
+
+func (r *mmrReranker) Rerank(items []RerankItem, k int) []RerankItem {
+	if k > len(items) {
+		k = len(items)
+	}
+	if k <= 1 {
+		return items
+	}
+
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, it := range items {
+		lo = math.Min(lo, it.Score)
+		hi = math.Max(hi, it.Score)
+	}
+	span := hi - lo
+	if span == 0 {
+		span = 1
+	}
+
+	picked := make([]int, 0, k)
+	used := make([]bool, len(items))
+	// highest similarity of every candidate to the picked set
+	maxSim := make([]float64, len(items))
+
+	for len(picked) < k {
+		best, bestVal := -1, math.Inf(-1)
+		for i, it := range items {
+			if used[i] {
+				continue
+			}
+			rel := (it.Score - lo) / span
+			v := r.lambda*rel - (1-r.lambda)*maxSim[i]
+			if v > bestVal {
+				best, bestVal = i, v
+			}
+		}
+
+		picked = append(picked, best)
+		used[best] = true
+		for i, it := range items {
+			if !used[i] {
+				maxSim[i] = math.Max(maxSim[i], r.similarity(it.Product, items[best].Product))
+			}
+		}
+	}
+
+	return withSlate(items, picked)
+}
+
+// ---- per-category cap ----
+
+// categoryCapReranker keeps at most max products of a category in the
+// slate. When the cap leaves the slate short, the skipped products fill it
+// back in score order. Products without a category are never capped.
+type categoryCapReranker struct {
+	max int
+}
+
+func newCategoryCapReranker(params map[string]float64) (Reranker, error) {
+	max := param(params, "max_per_category", 2)
+	if max < 1 {
+		return nil, fmt.Errorf("category_cap: max_per_category must be >= 1")
+	}
+	return &categoryCapReranker{max: int(max)}, nil
+}
+
+func (r *categoryCapReranker) Name() string { return RerankCategoryCap }
+
+func (r *categoryCapReranker) Rerank(items []RerankItem, k int) []RerankItem {
+	if k > len(items) {
+		k = len(items)
+	}
+
+	picked := make([]int, 0, k)
+	skipped := make([]int, 0)
+	perCategory := make(map[uint64]int)
+
+	for i, it := range items {
+		if len(picked) == k {
+			break
+		}
+		cat, ok := categoryOf(it.Product)
+		if ok && perCategory[cat] >= r.max {
+			skipped = append(skipped, i)
+			continue
+		}
+		if ok {
+			perCategory[cat]++
+		}
+		picked = append(picked, i)
+	}
+	for _, i := range skipped {
+		if len(picked) == k {
+			break
+		}
+		picked = append(picked, i)
+	}
+
+	return withSlate(items, picked)
+}
+
+// ---- minimum green share ----
+
+// greenShareReranker makes at least ⌈min_share·k⌉ slate products green
+// tagged, swapping the lowest-ranked non-green products for the best green
+// ones outside the slate. The slate keeps the candidates' relative order.
+// With top set, the share applies to the first top positions only.
+type greenShareReranker struct {
+	minShare float64
+	top      int
+}
+
+func newGreenShareReranker(params map[string]float64) (Reranker, error) {
+	share := param(params, "min_share", 0.2)
+	if share < 0 || share > 1 {
+		return nil, fmt.Errorf("green_share: min_share must be in [0, 1]")
+	}
+	top := param(params, "top", 0)
+	if top < 0 {
+		return nil, fmt.Errorf("green_share: top must be >= 0")
+	}
+	return &greenShareReranker{minShare: share, top: int(top)}, nil
+}
+
+func (r *greenShareReranker) Name() string { return RerankGreenShare }
+
+func isGreen(it RerankItem) bool {
+	return it.Product != nil && it.Product.IsGreenTag
+}
+
+func (r *greenShareReranker) Rerank(items []RerankItem, k int) []RerankItem {
+	if r.top > 0 && r.top < k {
+		k = r.top
+	}
+	if k > len(items) {
+		k = len(items)
+	}
+	need := int(math.Ceil(r.minShare * float64(k)))
+
+	inSlate := make([]bool, len(items))
+	green := 0
+	for i := 0; i < k; i++ {
+		inSlate[i] = true
+		if isGreen(items[i]) {
+			green++
+		}
+	}
+
+	// best green outside the slate replaces the worst non-green inside
+	out, in := k, k-1
+	for green < need {
+		for out < len(items) && !isGreen(items[out]) {
+			out++
+		}
+		for in >= 0 && (!inSlate[in] || isGreen(items[in])) {
+			in--
+		}
+		if out >= len(items) || in < 0 {
+			break
+		}
+		inSlate[in], inSlate[out] = false, true
+		green++
+		out++
+	}
+
+	picked := make([]int, 0, k)
+	for i := range items {
+		if inSlate[i] {
+			picked = append(picked, i)
+		}
+	}
+	return withSlate(items, picked)
+}
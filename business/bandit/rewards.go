@@ -2,11 +2,28 @@ package bandit
 
 import (
 	"fmt"
+	"math"
 	"myGreenMarket/domain"
+	"slices"
+	"strings"
+	"time"
 )
 
+// builtinEventTypes are rewarded by every config, with or without a
+// reward model.
+var builtinEventTypes = []string{"impression", "click", "atc", "order", "dismiss"}
+
+// attributedEventTypes are the event types order attribution logs with the
+// touch they credit, the only ones a half-life can decay.
+var attributedEventTypes = []string{"order"}
+
 // RewardForEvent turns a BanditEvent into a numeric reward using the current config.
 func (cfg Config) RewardForEvent(ev domain.BanditEvent) (float64, error) {
+	if rule, ok := cfg.RewardModel.Events[ev.EventType]; ok {
+		return ruleReward(rule, ev), nil
+	}
+
+	// base scaled by the event's attribution credit, like its value
 	var base float64
 
 	switch ev.EventType {
@@ -18,9 +35,12 @@ func (cfg Config) RewardForEvent(ev domain.BanditEvent) (float64, error) {
 		base = cfg.RewardATC
 	case "order":
 		base = cfg.RewardOrder
+	case "dismiss":
+		base = cfg.RewardDismiss
 	default:
 		return 0, fmt.Errorf("unknown event type: %s", ev.EventType)
 	}
+	base *= attributionCredit(ev)
 
 	// business value component (dynamic, from DB)
 	if ev.Value > 0 {
@@ -29,3 +49,109 @@ func (cfg Config) RewardForEvent(ev domain.BanditEvent) (float64, error) {
 
 	return base, nil
 }
+
+// RewardTable lists what each event type on a product is worth under the
+// config, taking the product's price as the event value.
+func (cfg Config) RewardTable(price float64) map[string]float64 {
+	types := append([]string(nil), builtinEventTypes...)
+	for t := range cfg.RewardModel.Events {
+		types = append(types, t)
+	}
+
+	out := make(map[string]float64, len(types))
+	for _, t := range types {
+		if r, err := cfg.RewardForEvent(domain.BanditEvent{EventType: t, Value: price}); err == nil {
+			out[t] = r
+		}
+	}
+	return out
+}
+
+// attributionCredit is the share of an order credited to the event's slot;
+// the attributed value is already scaled by it. 1 for unattributed events.
+func attributionCredit(ev domain.BanditEvent) float64 {
+	if c, ok := ev.Context["attribution_credit"].(float64); ok && c >= 0 && c <= 1 {
+		return c
+	}
+	return 1
+}
+
+// ruleReward applies a reward model rule to one event.
+func ruleReward(r domain.BanditRewardRule, ev domain.BanditEvent) float64 {
+	reward := r.Base * attributionCredit(ev)
+	if r.ValueWeight != 0 {
+		reward += r.ValueWeight * ruleValue(r, ev)
+	}
+	return reward * ruleDecay(r, ev)
+}
+
+// ruleValue is the event's business value after the rule's transform.
+func ruleValue(r domain.BanditRewardRule, ev domain.BanditEvent) float64 {
+	v := math.Max(ev.Value, 0)
+
+	switch r.Transform {
+	case domain.RewardValueLog:
+		return math.Log1p(v)
+	case domain.RewardValueCapped:
+		return math.Min(v, r.Cap)
+	case domain.RewardValueMargin:
+		if m, ok := ev.Context["margin"].(float64); ok {
+			return m
+		}
+		return v * r.MarginRate
+	default:
+		return v
+	}
+}
+
+// ruleDecay halves the credit every HalfLifeSeconds between the attributed
+// touch and the event.
+func ruleDecay(r domain.BanditRewardRule, ev domain.BanditEvent) float64 {
+	if r.HalfLifeSeconds <= 0 {
+		return 1
+	}
+	raw, _ := ev.Context["attributed_touch_at"].(string)
+	touch, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return 1
+	}
+
+	at := ev.CreatedAt
+	if at.IsZero() {
+		at = time.Now()
+	}
+	delay := at.Sub(touch).Seconds()
+	if delay <= 0 {
+		return 1
+	}
+	return math.Pow(0.5, delay/float64(r.HalfLifeSeconds))
+}
+
+// ValidateRewardModel checks the rules' transforms and parameters.
+func ValidateRewardModel(m domain.BanditRewardModel) error {
+	for event, r := range m.Events {
+		if event == "" {
+			return fmt.Errorf("reward_model: event type is required")
+		}
+		switch r.Transform {
+		case "", domain.RewardValueLinear, domain.RewardValueLog, domain.RewardValueMargin:
+		case domain.RewardValueCapped:
+			if r.Cap <= 0 {
+				return fmt.Errorf("reward_model: %s: cap must be > 0", event)
+			}
+		default:
+			return fmt.Errorf("reward_model: %s: unknown transform %q", event, r.Transform)
+		}
+		if r.MarginRate < 0 || r.MarginRate > 1 {
+			return fmt.Errorf("reward_model: %s: margin_rate must be in [0, 1]", event)
+		}
+		if r.HalfLifeSeconds < 0 {
+			return fmt.Errorf("reward_model: %s: half_life_seconds must be >= 0", event)
+		}
+		if r.HalfLifeSeconds > 0 && !slices.Contains(attributedEventTypes, event) {
+			return fmt.Errorf("reward_model: %s: half_life_seconds needs an attributed event type (%s)",
+				event, strings.Join(attributedEventTypes, ", "))
+		}
+	}
+	return nil
+}
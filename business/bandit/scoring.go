@@ -1,12 +1,15 @@
 package bandit
 
 import (
+	"context"
 	"math"
 	"math/rand"
+	"sync"
+	"time"
 )
 
 // ucbScore = theta·x + alpha * sqrt(x^T A^-1 x)
-func ucbScore(theta, x [linUCBFeatureDim]float64, AInv [linUCBFeatureDim][linUCBFeatureDim]float64, alpha float64) float64 {
+func ucbScore(theta, x []float64, AInv [][]float64, alpha float64) float64 {
 	mean := dot(theta, x)
 	tmp := matVecMul(AInv, x)
 	uncertainty := math.Sqrt(dot(x, tmp))
@@ -14,9 +17,9 @@ func ucbScore(theta, x [linUCBFeatureDim]float64, AInv [linUCBFeatureDim][linUCB
 }
 
 // thompsonScore: diagonal Gaussian sampling of theta
-func thompsonScore(theta, x [linUCBFeatureDim]float64, AInv [linUCBFeatureDim][linUCBFeatureDim]float64) float64 {
-	var thetaSample [linUCBFeatureDim]float64
-	for i := 0; i < linUCBFeatureDim; i++ {
+func thompsonScore(theta, x []float64, AInv [][]float64) float64 {
+	thetaSample := make([]float64, len(theta))
+	for i := range theta {
 		varVar := AInv[i][i]
 		if varVar < 0 {
 			varVar = 0
@@ -26,3 +29,266 @@ func thompsonScore(theta, x [linUCBFeatureDim]float64, AInv [linUCBFeatureDim][l
 	}
 	return dot(thetaSample, x)
 }
+
+// armStats returns A^-1 and theta = A^-1 b for an arm: the cached ones,
+// or, for an arm that has none, freshly computed without touching the arm.
+func armStats(arm *LinUCBArmState) ([][]float64, []float64) {
+	if arm.hasInverse() {
+		return arm.AInv, arm.Theta
+	}
+	AInv, ok := invertSPD(arm.A)
+	if !ok {
+		fresh := newArmState(len(arm.B))
+		return fresh.AInv, fresh.Theta
+	}
+	return AInv, matVecMul(AInv, arm.B)
+}
+
+// blendWeights returns how much the global vs user bandit scores matter.
+func blendWeights(cfg Config) (float64, float64) {
+	if cfg.WGlobal == 0 && cfg.WUser == 0 {
+		return 0.7, 0.3
+	}
+	return cfg.WGlobal, cfg.WUser
+}
+
+// finalScore combines the global + user bandit scores with the normalised
+// offline score, adding exploration noise unless the policy is offline-only.
+func finalScore(cfg Config, policy Policy, gBandit, uBandit, offlineNorm float64) float64 {
+	wGlobal, wUser := blendWeights(cfg)
+	banditScore := wGlobal*gBandit + wUser*uBandit
+	final := cfg.WBandit*banditScore + cfg.WOffline*offlineNorm
+
+	// optional: exploration noise only for bandit policies
+	if policy.Name() != PolicyOffline && cfg.ExploreNoise > 0 {
+		final += cfg.ExploreNoise * rand.Float64()
+	}
+	return final
+}
+
+// Monte Carlo draws used to estimate slate propensities of stochastic variants
+const propensitySamples = 32
+
+// preparedArm holds everything needed to (re)score one candidate, so
+// stochastic policies can be sampled many times without re-inverting A.
+type preparedArm struct {
+	productID   uint64
+	product     *ProductAttributes // for re-ranking; nil when unknown
+	global      PolicyArm
+	user        PolicyArm
+	offlineNorm float64
+}
+
+// scoringStates are the global and user states of one request, with the
+// shared statistics of shared policies inverted once. Only global states
+// carry a shared block; user arms are scored as plain ridge arms.
+type scoringStates struct {
+	global       *LinUCBState
+	user         *LinUCBState
+	globalShared *SharedStats
+	useSharedArm bool
+}
+
+func newScoringStates(policy Policy, cfg Config, globalState, userState *LinUCBState) scoringStates {
+	return scoringStates{
+		global:       globalState,
+		user:         userState,
+		globalShared: sharedStats(policy, globalState),
+		useSharedArm: cfg.Features.UseSharedArm,
+	}
+}
+
+// prepare builds the scoring view of one candidate; z are the cross
+// features of shared policies, nil otherwise.
+func (s scoringStates) prepare(productID uint64, product *ProductAttributes, x, z []float64, offlineNorm float64) preparedArm {
+	gArm := s.global.scoringArm(productID, s.useSharedArm)
+	uArm := s.user.arm(productID)
+	return preparedArm{
+		productID:   productID,
+		product:     product,
+		global:      policyArm(productID, x, z, gArm, s.globalShared),
+		user:        policyArm(productID, x, z, uArm, nil),
+		offlineNorm: offlineNorm,
+	}
+}
+
+func policyArm(productID uint64, x, z []float64, arm *LinUCBArmState, shared *SharedStats) PolicyArm {
+	AInv, theta := armStats(arm)
+	pa := PolicyArm{
+		ProductID: productID,
+		X:         x,
+		Theta:     theta,
+		AInv:      AInv,
+		Count:     arm.Count,
+	}
+	if shared == nil || len(z) == 0 {
+		return pa
+	}
+
+	pa.Z = z
+	pa.B = arm.B
+	pa.BZ = arm.BZ
+	pa.Shared = shared
+
+	// θ = A⁻¹(b − B_z β)
+	if len(arm.BZ) == len(arm.B) {
+		Bb := matVecMul(arm.BZ, shared.Beta)
+		r := make([]float64, len(arm.B))
+		for i := range r {
+			r[i] = arm.B[i] - Bb[i]
+		}
+		pa.Theta = matVecMul(AInv, r)
+	}
+	return pa
+}
+
+// mean is the blended global + user estimate θᵀx, without exploration.
+func (p preparedArm) mean(cfg Config) float64 {
+	wGlobal, wUser := blendWeights(cfg)
+	return wGlobal*p.global.Mean() + wUser*p.user.Mean()
+}
+
+// scoreArms draws one final score per arm under the policy.
+func scoreArms(policy Policy, cfg Config, arms []preparedArm) []float64 {
+	gArms := make([]PolicyArm, len(arms))
+	uArms := make([]PolicyArm, len(arms))
+	for i, a := range arms {
+		gArms[i] = a.global
+		uArms[i] = a.user
+	}
+
+	gScores := policy.Score(gArms)
+	uScores := policy.Score(uArms)
+
+	out := make([]float64, len(arms))
+	for i, a := range arms {
+		out[i] = finalScore(cfg, policy, gScores[i], uScores[i], a.offlineNorm)
+	}
+	return out
+}
+
+// isStochastic reports whether ranking under this policy is randomised.
+func isStochastic(cfg Config, policy Policy) bool {
+	if policy.Name() == PolicyOffline {
+		return false
+	}
+	return policy.Stochastic() || cfg.ExploreNoise > 0
+}
+
+// slateInclusion estimates for every arm the probability that it lands in
+// the (re-ranked) top-k, by Monte Carlo for stochastic policies. served,
+// when not nil, is the slate actually served and counts as one of the
+// draws, so every served arm has a propensity of at least 1/samples.
+func slateInclusion(arms []preparedArm, cfg Config, policy Policy, rerankers []Reranker, k int, served []int) []float64 {
+	samples := 1
+	if isStochastic(cfg, policy) {
+		samples = propensitySamples
+	}
+
+	inclusion := make([]float64, len(arms))
+	for m := 0; m < samples; m++ {
+		slate := served
+		if m > 0 || served == nil {
+			slate = rankSlate(arms, scoreArms(policy, cfg, arms), k, rerankers)
+		}
+		for _, j := range slate {
+			inclusion[j] += 1.0 / float64(samples)
+		}
+	}
+	return inclusion
+}
+
+// topKIndices returns the indices of the k highest scores, best first.
+func topKIndices(scores []float64, k int) []int {
+	idx := make([]int, len(scores))
+	for i := range idx {
+		idx[i] = i
+	}
+	if k > len(idx) {
+		k = len(idx)
+	}
+	for i := 0; i < k; i++ {
+		maxIdx := i
+		for j := i + 1; j < len(idx); j++ {
+			if scores[idx[j]] > scores[idx[maxIdx]] {
+				maxIdx = j
+			}
+		}
+		idx[i], idx[maxIdx] = idx[maxIdx], idx[i]
+	}
+	return idx[:k]
+}
+
+// ScoringConfig bounds the work of scoring one request.
+type ScoringConfig struct {
+	// candidate sets of at least ParallelMin products are prepared by up
+	// to Workers goroutines; Workers <= 1 prepares them sequentially
+	Workers     int
+	ParallelMin int
+
+	// past Timeout the slate is served by offline score; 0 disables
+	Timeout time.Duration
+}
+
+// withDeadline returns the context scoring runs under.
+func (sc ScoringConfig) withDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if sc.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, sc.Timeout)
+}
+
+// prepareArms builds the scoring view of every candidate. Large candidate
+// sets are split into contiguous chunks, one per worker, so arms keep the
+// candidates' order. Preparation stops with the context's error once ctx
+// is done.
+func (sc ScoringConfig) prepareArms(
+	ctx context.Context,
+	cands []preparedArm,
+	build func(preparedArm) preparedArm,
+) ([]preparedArm, error) {
+
+	arms := make([]preparedArm, len(cands))
+	workers := min(sc.Workers, len(cands))
+
+	if workers <= 1 || len(cands) < sc.ParallelMin {
+		for i, c := range cands {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			arms[i] = build(c)
+		}
+		return arms, nil
+	}
+
+	chunk := (len(cands) + workers - 1) / workers
+	var wg sync.WaitGroup
+	for lo := 0; lo < len(cands); lo += chunk {
+		hi := min(lo+chunk, len(cands))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := lo; i < hi; i++ {
+				if ctx.Err() != nil {
+					return
+				}
+				arms[i] = build(cands[i])
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return arms, nil
+}
+
+// offlineScores are the candidates' normalised offline scores.
+func offlineScores(arms []preparedArm) []float64 {
+	out := make([]float64, len(arms))
+	for i, a := range arms {
+		out[i] = a.offlineNorm
+	}
+	return out
+}
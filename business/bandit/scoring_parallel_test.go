@@ -0,0 +1,58 @@
+//go:build !integration
+
+package bandit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func buildTestArm(c preparedArm) preparedArm {
+	c.offlineNorm *= 2
+	return c
+}
+
+// Parallel preparation must give the same arms, in the same order, as
+// sequential preparation.
+func TestPrepareArmsParallelKeepsOrder(t *testing.T) {
+	cands := make([]preparedArm, 301)
+	for i := range cands {
+		cands[i] = preparedArm{productID: uint64(i + 1), offlineNorm: float64(i)}
+	}
+
+	seq, err := ScoringConfig{}.prepareArms(context.Background(), cands, buildTestArm)
+	if err != nil {
+		t.Fatalf("sequential: %v", err)
+	}
+	par, err := ScoringConfig{Workers: 8, ParallelMin: 10}.prepareArms(context.Background(), cands, buildTestArm)
+	if err != nil {
+		t.Fatalf("parallel: %v", err)
+	}
+
+	if len(par) != len(seq) {
+		t.Fatalf("parallel prepared %d arms, want %d", len(par), len(seq))
+	}
+	for i := range seq {
+		if par[i].productID != seq[i].productID || par[i].offlineNorm != seq[i].offlineNorm {
+			t.Fatalf("arm %d: parallel %+v, sequential %+v", i, par[i], seq[i])
+		}
+	}
+}
+
+func TestPrepareArmsStopsAtDeadline(t *testing.T) {
+	cands := make([]preparedArm, 64)
+	sc := ScoringConfig{Workers: 4, Timeout: 20 * time.Millisecond}
+
+	ctx, cancel := sc.withDeadline(context.Background())
+	defer cancel()
+
+	slow := func(c preparedArm) preparedArm {
+		time.Sleep(5 * time.Millisecond)
+		return c
+	}
+	if _, err := sc.prepareArms(ctx, cands, slow); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+}
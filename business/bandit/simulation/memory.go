@@ -0,0 +1,270 @@
+package simulation
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"myGreenMarket/business/bandit"
+	"myGreenMarket/domain"
+)
+
+var (
+	_ bandit.BanditStateRepository           = (*StateRepository)(nil)
+	_ bandit.ConfigRepository                = (*ConfigRepository)(nil)
+	_ bandit.SegmentRepository               = (*SegmentRepository)(nil)
+	_ bandit.OfflineRecommendationRepository = (*OfflineRepository)(nil)
+	_ bandit.BanditRepository                = (*EventRepository)(nil)
+	_ bandit.ProductFeatureSource            = (*Catalog)(nil)
+)
+
+// StateRepository is an in-memory BanditStateRepository with the same
+// compare-and-swap semantics as the Postgres one. States are deep-copied on
+// the way in and out, so writers never share memory.
+type StateRepository struct {
+	mu   sync.Mutex
+	rows map[string]*bandit.LinUCBState
+}
+
+func NewStateRepository() *StateRepository {
+	return &StateRepository{rows: make(map[string]*bandit.LinUCBState)}
+}
+
+func (r *StateRepository) GetState(_ context.Context, key string) (*bandit.LinUCBState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	st, ok := r.rows[key]
+	if !ok {
+		return nil, nil
+	}
+	return cloneState(st), nil
+}
+
+func (r *StateRepository) SaveState(_ context.Context, key string, st *bandit.LinUCBState) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var current int64
+	if row, ok := r.rows[key]; ok {
+		current = row.Revision
+	}
+	if current != st.Revision {
+		return bandit.ErrStateConflict
+	}
+	st.Revision++
+	r.rows[key] = cloneState(st)
+	return nil
+}
+
+// StateStats summarises what the repository holds.
+type StateStats struct {
+	States int
+	Arms   int
+
+	// total size of the states as stored in bandit_state.state (JSON)
+	Bytes int
+}
+
+// Stats walks every stored state. It marshals them all, so call it at
+// checkpoints rather than per round.
+func (r *StateRepository) Stats() StateStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var out StateStats
+	for _, st := range r.rows {
+		out.States++
+		out.Arms += len(st.Arms)
+		if raw, err := json.Marshal(st); err == nil {
+			out.Bytes += len(raw)
+		}
+	}
+	return out
+}
+
+func cloneState(st *bandit.LinUCBState) *bandit.LinUCBState {
+	out := *st
+	out.Features = append([]string(nil), st.Features...)
+	out.Arms = make(map[uint64]*bandit.LinUCBArmState, len(st.Arms))
+	for pid, arm := range st.Arms {
+		out.Arms[pid] = cloneArm(arm)
+	}
+	if st.Shared != nil {
+		out.Shared = cloneArm(st.Shared)
+	}
+	if st.Hybrid != nil {
+		out.Hybrid = &bandit.HybridState{
+			A0:    cloneMatrix(st.Hybrid.A0),
+			B0:    cloneVector(st.Hybrid.B0),
+			A0Inv: cloneMatrix(st.Hybrid.A0Inv),
+			Beta:  cloneVector(st.Hybrid.Beta),
+		}
+	}
+	return &out
+}
+
+func cloneArm(arm *bandit.LinUCBArmState) *bandit.LinUCBArmState {
+	out := *arm
+	out.A = cloneMatrix(arm.A)
+	out.B = cloneVector(arm.B)
+	out.BZ = cloneMatrix(arm.BZ)
+	out.AInv = cloneMatrix(arm.AInv)
+	out.Theta = cloneVector(arm.Theta)
+	return &out
+}
+
+func cloneMatrix(m [][]float64) [][]float64 {
+	if m == nil {
+		return nil
+	}
+	out := make([][]float64, len(m))
+	for i := range m {
+		out[i] = cloneVector(m[i])
+	}
+	return out
+}
+
+func cloneVector(v []float64) []float64 {
+	if v == nil {
+		return nil
+	}
+	return append([]float64(nil), v...)
+}
+
+// ConfigRepository is an in-memory bandit_config table.
+type ConfigRepository struct {
+	mu   sync.RWMutex
+	rows map[configKey]domain.BanditConfig
+}
+
+type configKey struct {
+	slot    string
+	variant int
+}
+
+func NewConfigRepository() *ConfigRepository {
+	return &ConfigRepository{rows: make(map[configKey]domain.BanditConfig)}
+}
+
+func (r *ConfigRepository) GetConfig(_ context.Context, slot string, variant int) (domain.BanditConfig, bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	cfg, ok := r.rows[configKey{slot, variant}]
+	return cfg, ok, nil
+}
+
+func (r *ConfigRepository) UpsertConfig(_ context.Context, cfg domain.BanditConfig) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rows[configKey{cfg.Slot, cfg.Variant}] = cfg
+	return nil
+}
+
+// SegmentRepository is an in-memory user_bandit_segment table.
+type SegmentRepository struct {
+	mu   sync.RWMutex
+	rows map[uint]int
+}
+
+func NewSegmentRepository() *SegmentRepository {
+	return &SegmentRepository{rows: make(map[uint]int)}
+}
+
+func (r *SegmentRepository) GetSegment(_ context.Context, userID uint) (int, bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	seg, ok := r.rows[userID]
+	return seg, ok, nil
+}
+
+func (r *SegmentRepository) UpsertSegment(_ context.Context, userID uint, segment int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rows[userID] = segment
+	return nil
+}
+
+// OfflineRepository is an in-memory mock_recommendations table. GetBySlot
+// returns the best-scored rows first, like the Postgres query.
+type OfflineRepository struct {
+	mu   sync.RWMutex
+	rows map[string][]domain.MockRecommendation
+}
+
+func NewOfflineRepository() *OfflineRepository {
+	return &OfflineRepository{rows: make(map[string][]domain.MockRecommendation)}
+}
+
+// Put replaces a slot's offline recommendations.
+func (r *OfflineRepository) Put(slot string, rows []domain.MockRecommendation) {
+	sorted := append([]domain.MockRecommendation(nil), rows...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Score > sorted[j].Score
+	})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rows[slot] = sorted
+}
+
+func (r *OfflineRepository) GetBySlot(_ context.Context, slot string, limit int) ([]domain.MockRecommendation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rows := r.rows[slot]
+	if limit > 0 && limit < len(rows) {
+		rows = rows[:limit]
+	}
+	return append([]domain.MockRecommendation(nil), rows...), nil
+}
+
+// EventRepository counts saved bandit events by type instead of storing them.
+type EventRepository struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func NewEventRepository() *EventRepository {
+	return &EventRepository{counts: make(map[string]int)}
+}
+
+func (r *EventRepository) SaveEvent(_ context.Context, event domain.BanditEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.counts[event.EventType]++
+	return nil
+}
+
+// Count returns how many events of a type were saved.
+func (r *EventRepository) Count(eventType string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.counts[eventType]
+}
+
+// Catalog serves fixed product attributes to the product feature extractors.
+type Catalog struct {
+	attrs map[uint64]*bandit.ProductAttributes
+}
+
+func NewCatalog(attrs map[uint64]*bandit.ProductAttributes) *Catalog {
+	return &Catalog{attrs: attrs}
+}
+
+func (c *Catalog) Attributes(_ context.Context, ids []uint64) map[uint64]*bandit.ProductAttributes {
+	out := make(map[uint64]*bandit.ProductAttributes, len(ids))
+	for _, id := range ids {
+		if a, ok := c.attrs[id]; ok {
+			out[id] = a
+		}
+	}
+	return out
+}
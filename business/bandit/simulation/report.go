@@ -0,0 +1,45 @@
+package simulation
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+var csvHeader = []string{
+	"policy", "round", "impressions", "clicks", "ctr", "window_ctr",
+	"cumulative_regret", "states", "arms", "state_bytes",
+}
+
+// WriteCSV writes one row per policy checkpoint, ready to be plotted as
+// regret, CTR and state-size curves.
+func WriteCSV(w io.Writer, results []Result) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', 6, 64) }
+	for _, res := range results {
+		for _, pt := range res.Points {
+			row := []string{
+				res.Policy,
+				strconv.Itoa(pt.Round),
+				strconv.Itoa(pt.Impressions),
+				strconv.Itoa(pt.Clicks),
+				f(pt.CTR),
+				f(pt.WindowCTR),
+				f(pt.Regret),
+				strconv.Itoa(pt.States),
+				strconv.Itoa(pt.Arms),
+				strconv.Itoa(pt.StateBytes),
+			}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
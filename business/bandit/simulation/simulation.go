@@ -0,0 +1,304 @@
+// Package simulation replays synthetic traffic through a real BanditService
+// backed by in-memory repositories. Users have latent preferences, clicks
+// are sampled from a known model, and every policy is scored against the
+// best slate it could have served, so configs can be compared on cumulative
+// regret, CTR and state growth before they reach production.
+package simulation
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"myGreenMarket/business/bandit"
+	"myGreenMarket/domain"
+)
+
+// Scenario describes the synthetic market a simulation runs in.
+type Scenario struct {
+	Slot string
+
+	Users    int
+	Products int
+
+	// latent preference clusters; users are stored with their cluster as
+	// bandit segment
+	Segments  int
+	LatentDim int
+
+	// how far users stray from their cluster's preferences
+	UserSpread float64
+
+	// standard deviation of product popularity (in logits)
+	PopularitySpread float64
+
+	// weight of user·product affinity in the click logit
+	Affinity float64
+
+	// click probability of an average product at the top position
+	BaseCTR float64
+
+	// noise (in logits) between true popularity and the offline score
+	OfflineNoise float64
+
+	Rounds    int
+	SlateSize int
+
+	// rounds between two reported points
+	Checkpoint int
+
+	Seed int64
+}
+
+func DefaultScenario() Scenario {
+	return Scenario{
+		Slot:             "sim_home",
+		Users:            300,
+		Products:         60,
+		Segments:         3,
+		LatentDim:        4,
+		UserSpread:       0.3,
+		PopularitySpread: 0.5,
+		Affinity:         1.5,
+		BaseCTR:          0.05,
+		OfflineNoise:     1.0,
+		Rounds:           5000,
+		SlateSize:        5,
+		Checkpoint:       250,
+		Seed:             1,
+	}
+}
+
+func (sc Scenario) validate() error {
+	switch {
+	case sc.Slot == "":
+		return fmt.Errorf("slot is required")
+	case sc.Users <= 0 || sc.Products <= 0:
+		return fmt.Errorf("users and products must be > 0")
+	case sc.Segments <= 0 || sc.LatentDim <= 0:
+		return fmt.Errorf("segments and latent_dim must be > 0")
+	case sc.BaseCTR <= 0 || sc.BaseCTR >= 1:
+		return fmt.Errorf("base_ctr must be in (0, 1)")
+	case sc.Rounds <= 0 || sc.SlateSize <= 0:
+		return fmt.Errorf("rounds and slate_size must be > 0")
+	}
+	return nil
+}
+
+// Policy is one bandit config under test. Name labels its results, so the
+// same policy with different parameters can be compared.
+type Policy struct {
+	Name   string              `json:"name"`
+	Config domain.BanditConfig `json:"config"`
+}
+
+// BaseConfig is bandit.DefaultConfig as a stored config, with features a
+// simulated user can actually be told apart by.
+func BaseConfig(slot string) domain.BanditConfig {
+	def := bandit.DefaultConfig()
+	return domain.BanditConfig{
+		Slot:             slot,
+		WBandit:          def.WBandit,
+		WOffline:         def.WOffline,
+		ExploreNoise:     def.ExploreNoise,
+		Alpha:            def.Alpha,
+		ValueWeight:      def.ValueWeight,
+		RewardImpression: def.RewardImpression,
+		RewardClick:      def.RewardClick,
+		RewardATC:        def.RewardATC,
+		RewardOrder:      def.RewardOrder,
+		RewardDismiss:    def.RewardDismiss,
+		NumSegments:      def.NumSegments,
+		NumVariants:      1,
+		FeatureList:      []string{bandit.FeatureBias, bandit.FeatureSegment, bandit.FeatureCategory},
+	}
+}
+
+// DefaultPolicies compares the registered policies on the base config, with
+// the offline ranking alone as the baseline.
+func DefaultPolicies(slot string) []Policy {
+	with := func(name string, params map[string]float64) Policy {
+		cfg := BaseConfig(slot)
+		cfg.Policy = name
+		cfg.PolicyParams = params
+		return Policy{Name: name, Config: cfg}
+	}
+
+	offline := with(bandit.PolicyOffline, nil)
+	offline.Config.WBandit = 0
+	offline.Config.WOffline = 1
+	offline.Config.ExploreNoise = 0
+
+	return []Policy{
+		offline,
+		with(bandit.PolicyPopularity, nil),
+		with(bandit.PolicyLinUCB, nil),
+		with(bandit.PolicyHybridLinUCB, nil),
+		with(bandit.PolicyThompson, nil),
+		with(bandit.PolicyEpsilonGreedy, nil),
+		with(bandit.PolicySoftmax, nil),
+	}
+}
+
+// Point is a policy's progress at one checkpoint.
+type Point struct {
+	Round       int
+	Impressions int
+	Clicks      int
+
+	// cumulative CTR, and CTR since the previous checkpoint
+	CTR       float64
+	WindowCTR float64
+
+	// cumulative expected clicks lost against the best slate of the pool
+	Regret float64
+
+	States     int
+	Arms       int
+	StateBytes int
+}
+
+// Result is the learning curve of one policy.
+type Result struct {
+	Policy string
+	Points []Point
+}
+
+// Final returns the last checkpoint.
+func (r Result) Final() Point {
+	if len(r.Points) == 0 {
+		return Point{}
+	}
+	return r.Points[len(r.Points)-1]
+}
+
+// Run simulates every policy on the same scenario. Each policy learns from
+// scratch on its own service, and sees the same sequence of users and the
+// same click draws.
+func Run(ctx context.Context, sc Scenario, policies []Policy) ([]Result, error) {
+	if err := sc.validate(); err != nil {
+		return nil, fmt.Errorf("invalid scenario: %w", err)
+	}
+	if sc.Checkpoint <= 0 || sc.Checkpoint > sc.Rounds {
+		sc.Checkpoint = sc.Rounds
+	}
+	if len(policies) == 0 {
+		policies = DefaultPolicies(sc.Slot)
+	}
+
+	w := newWorld(sc)
+
+	results := make([]Result, 0, len(policies))
+	for _, p := range policies {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("context error: %w", err)
+		}
+		res, err := runPolicy(ctx, w, p)
+		if err != nil {
+			return nil, fmt.Errorf("policy %s: %w", p.Name, err)
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+func runPolicy(ctx context.Context, w *world, p Policy) (Result, error) {
+	sc := w.sc
+
+	cfg := p.Config
+	cfg.Slot = sc.Slot
+	cfg.Variant = 0
+	cfg.NumVariants = 1
+	cfg.NumSegments = sc.Segments
+	if err := bandit.ValidateConfig(cfg); err != nil {
+		return Result{}, fmt.Errorf("invalid config: %w", err)
+	}
+
+	configs := NewConfigRepository()
+	_ = configs.UpsertConfig(ctx, cfg)
+	states := NewStateRepository()
+
+	svc := bandit.NewBanditService(
+		NewEventRepository(),
+		nil,
+		states,
+		nil,
+		w.offline,
+		configs,
+		w.segments,
+		nil,
+		bandit.DefaultConfig(),
+		bandit.WithProductFeatures(w.catalog),
+	)
+
+	users := rand.New(rand.NewSource(sc.Seed + 1))
+	clicks := rand.New(rand.NewSource(sc.Seed + 2))
+
+	res := Result{Policy: p.Name}
+	var (
+		impressions, clicked     int
+		windowImps, windowClicks int
+		regret                   float64
+	)
+
+	for round := 1; round <= sc.Rounds; round++ {
+		userID := uint(users.Intn(sc.Users) + 1)
+
+		recs, err := svc.Recommend(ctx, userID, sc.Slot, sc.SlateSize, nil)
+		if err != nil {
+			return Result{}, fmt.Errorf("round %d: recommend: %w", round, err)
+		}
+
+		expected := 0.0
+		for pos, rec := range recs {
+			prob := w.clickProb(userID, rec.ProductID, pos)
+			expected += prob
+
+			event := domain.BanditEvent{
+				UserID:    userID,
+				Slot:      sc.Slot,
+				ProductID: rec.ProductID,
+				EventType: "impression",
+				CreatedAt: time.Now(),
+			}
+			if clicks.Float64() < prob {
+				event.EventType = "click"
+				clicked++
+				windowClicks++
+			}
+			impressions++
+			windowImps++
+
+			if err := svc.LogFeedback(ctx, event); err != nil {
+				return Result{}, fmt.Errorf("round %d: log feedback: %w", round, err)
+			}
+		}
+		regret += w.best[userID-1] - expected
+
+		if round%sc.Checkpoint == 0 || round == sc.Rounds {
+			stats := states.Stats()
+			res.Points = append(res.Points, Point{
+				Round:       round,
+				Impressions: impressions,
+				Clicks:      clicked,
+				CTR:         ratio(clicked, impressions),
+				WindowCTR:   ratio(windowClicks, windowImps),
+				Regret:      regret,
+				States:      stats.States,
+				Arms:        stats.Arms,
+				StateBytes:  stats.Bytes,
+			})
+			windowImps, windowClicks = 0, 0
+		}
+	}
+
+	return res, nil
+}
+
+func ratio(num, den int) float64 {
+	if den == 0 {
+		return 0
+	}
+	return float64(num) / float64(den)
+}
@@ -0,0 +1,124 @@
+//go:build !integration
+
+package simulation
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"testing"
+
+	"myGreenMarket/business/bandit"
+	"myGreenMarket/pkg/logger"
+)
+
+// simScenario is small enough to keep `go test ./...` fast while leaving
+// LinUCB enough rounds to pull away from the offline ranking.
+func simScenario() Scenario {
+	sc := DefaultScenario()
+	sc.Users = 100
+	sc.Products = 40
+	sc.Rounds = 1500
+	sc.Checkpoint = 500
+	return sc
+}
+
+func policiesNamed(slot string, names ...string) []Policy {
+	out := make([]Policy, 0, len(names))
+	for _, p := range DefaultPolicies(slot) {
+		for _, name := range names {
+			if p.Name == name {
+				out = append(out, p)
+			}
+		}
+	}
+	return out
+}
+
+func TestSimLinUCBBeatsOfflineRanking(t *testing.T) {
+	logger.Init("test")
+
+	sc := simScenario()
+	results, err := Run(context.Background(), sc, policiesNamed(sc.Slot, bandit.PolicyOffline, bandit.PolicyLinUCB))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+
+	offline, linucb := results[0].Final(), results[1].Final()
+	t.Logf("offline: regret=%.1f ctr=%.4f", offline.Regret, offline.CTR)
+	t.Logf("linucb:  regret=%.1f ctr=%.4f", linucb.Regret, linucb.CTR)
+
+	if linucb.Regret >= offline.Regret {
+		t.Errorf("linucb regret %.1f is not below the offline ranking's %.1f", linucb.Regret, offline.Regret)
+	}
+	if linucb.CTR <= offline.CTR {
+		t.Errorf("linucb ctr %.4f is not above the offline ranking's %.4f", linucb.CTR, offline.CTR)
+	}
+
+	// the learning curve should rise: the last window beats the first
+	points := results[1].Points
+	if first, last := points[0].WindowCTR, points[len(points)-1].WindowCTR; last <= first {
+		t.Errorf("linucb window ctr did not improve: first %.4f, last %.4f", first, last)
+	}
+}
+
+func TestSimStateGrowthIsBounded(t *testing.T) {
+	logger.Init("test")
+
+	sc := simScenario()
+	results, err := Run(context.Background(), sc, policiesNamed(sc.Slot, bandit.PolicyLinUCB))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	pool := sc.SlateSize * 3
+	prev := Point{}
+	for _, pt := range results[0].Points {
+		// one global state per segment plus one state per user seen
+		if pt.States > sc.Segments+sc.Users {
+			t.Errorf("round %d: %d states, want <= %d", pt.Round, pt.States, sc.Segments+sc.Users)
+		}
+		// arms are only created for products that were served
+		if pt.Arms > pt.States*pool {
+			t.Errorf("round %d: %d arms in %d states, want <= %d per state", pt.Round, pt.Arms, pt.States, pool)
+		}
+		if pt.States < prev.States || pt.StateBytes < prev.StateBytes {
+			t.Errorf("round %d: state shrank from %+v to %+v", pt.Round, prev, pt)
+		}
+		prev = pt
+	}
+}
+
+func TestSimWriteCSV(t *testing.T) {
+	results := []Result{
+		{Policy: "a", Points: []Point{{Round: 10, Impressions: 50, Clicks: 5, CTR: 0.1}, {Round: 20}}},
+		{Policy: "b", Points: []Point{{Round: 10}}},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, results); err != nil {
+		t.Fatalf("WriteCSV: %v", err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("read csv: %v", err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("got %d rows, want header + 3", len(rows))
+	}
+	if rows[0][0] != "policy" || rows[1][0] != "a" || rows[1][1] != "10" || rows[1][4] != "0.100000" {
+		t.Errorf("unexpected rows: %v", rows[:2])
+	}
+}
+
+func TestSimRejectsInvalidScenario(t *testing.T) {
+	sc := simScenario()
+	sc.BaseCTR = 0
+	if _, err := Run(context.Background(), sc, nil); err == nil {
+		t.Fatal("expected an error for base_ctr = 0")
+	}
+}
@@ -0,0 +1,179 @@
+package simulation
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sort"
+
+	"myGreenMarket/business/bandit"
+	"myGreenMarket/domain"
+)
+
+// world is the ground truth of a scenario: users with latent preferences,
+// products with latent traits and a popularity, and the click model tying
+// them together. Everything is drawn from Scenario.Seed, so every policy
+// faces the same users and products.
+type world struct {
+	sc Scenario
+
+	// preference vector of user i+1
+	users [][]float64
+
+	products []simProduct
+	byID     map[uint64]int
+
+	// candidates Recommend sees, and the expected clicks of each user's
+	// best slate among them
+	pool []uint64
+	best []float64
+
+	offline  *OfflineRepository
+	segments *SegmentRepository
+	catalog  *Catalog
+}
+
+type simProduct struct {
+	id         uint64
+	traits     []float64
+	popularity float64
+}
+
+func newWorld(sc Scenario) *world {
+	rng := rand.New(rand.NewSource(sc.Seed))
+
+	w := &world{
+		sc:       sc,
+		byID:     make(map[uint64]int, sc.Products),
+		offline:  NewOfflineRepository(),
+		segments: NewSegmentRepository(),
+	}
+
+	// one preference centroid per segment; users scatter around theirs
+	centroids := make([][]float64, sc.Segments)
+	for s := range centroids {
+		centroids[s] = gaussianVector(rng, sc.LatentDim, 1)
+	}
+
+	w.users = make([][]float64, sc.Users)
+	for i := range w.users {
+		seg := i % sc.Segments
+		noise := gaussianVector(rng, sc.LatentDim, sc.UserSpread)
+		pref := make([]float64, sc.LatentDim)
+		for d := range pref {
+			pref[d] = centroids[seg][d] + noise[d]
+		}
+		w.users[i] = pref
+		_ = w.segments.UpsertSegment(context.Background(), uint(i+1), seg)
+	}
+
+	attrs := make(map[uint64]*bandit.ProductAttributes, sc.Products)
+	rows := make([]domain.MockRecommendation, 0, sc.Products)
+	scale := 1 / math.Sqrt(float64(sc.LatentDim))
+
+	w.products = make([]simProduct, sc.Products)
+	for i := range w.products {
+		p := simProduct{
+			id:         uint64(i + 1),
+			traits:     gaussianVector(rng, sc.LatentDim, scale),
+			popularity: rng.NormFloat64() * sc.PopularitySpread,
+		}
+		w.products[i] = p
+		w.byID[p.id] = i
+
+		// the product's category is its dominant latent trait
+		attrs[p.id] = &bandit.ProductAttributes{CategoryID: uint64(argmax(p.traits) + 1)}
+
+		// the offline model only sees a noisy popularity
+		rows = append(rows, domain.MockRecommendation{
+			Slot:      sc.Slot,
+			ProductID: p.id,
+			Score:     sigmoid(p.popularity + rng.NormFloat64()*sc.OfflineNoise),
+		})
+	}
+
+	w.offline.Put(sc.Slot, rows)
+	w.catalog = NewCatalog(attrs)
+
+	// Recommend asks for three candidates per slate position
+	pool, _ := w.offline.GetBySlot(context.Background(), sc.Slot, sc.SlateSize*3)
+	w.pool = make([]uint64, len(pool))
+	for i, row := range pool {
+		w.pool[i] = row.ProductID
+	}
+
+	w.best = make([]float64, sc.Users)
+	for i := range w.best {
+		w.best[i] = w.bestExpectedClicks(uint(i + 1))
+	}
+
+	return w
+}
+
+// clickProb is the true probability that user clicks product at a slate
+// position: a logistic model of popularity and affinity, discounted by
+// position like DCG.
+func (w *world) clickProb(userID uint, productID uint64, position int) float64 {
+	i, ok := w.byID[productID]
+	if !ok || userID == 0 || int(userID) > len(w.users) {
+		return 0
+	}
+	p := w.products[i]
+
+	logit := logitOf(w.sc.BaseCTR) + p.popularity + w.sc.Affinity*dot(w.users[userID-1], p.traits)
+	return sigmoid(logit) * positionBias(position)
+}
+
+// bestExpectedClicks is the expected clicks of the best slate the pool
+// allows for a user; regret is measured against it.
+func (w *world) bestExpectedClicks(userID uint) float64 {
+	probs := make([]float64, len(w.pool))
+	for i, pid := range w.pool {
+		probs[i] = w.clickProb(userID, pid, 0)
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(probs)))
+
+	total := 0.0
+	for pos := 0; pos < w.sc.SlateSize && pos < len(probs); pos++ {
+		total += probs[pos] * positionBias(pos)
+	}
+	return total
+}
+
+func positionBias(position int) float64 {
+	return 1 / math.Log2(float64(position)+2)
+}
+
+func gaussianVector(rng *rand.Rand, n int, scale float64) []float64 {
+	v := make([]float64, n)
+	for i := range v {
+		v[i] = rng.NormFloat64() * scale
+	}
+	return v
+}
+
+func argmax(v []float64) int {
+	best := 0
+	for i := range v {
+		if v[i] > v[best] {
+			best = i
+		}
+	}
+	return best
+}
+
+func dot(a, b []float64) float64 {
+	s := 0.0
+	for i := range a {
+		s += a[i] * b[i]
+	}
+	return s
+}
+
+func sigmoid(x float64) float64 {
+	return 1 / (1 + math.Exp(-x))
+}
+
+func logitOf(p float64) float64 {
+	return math.Log(p / (1 - p))
+}
@@ -0,0 +1,371 @@
+package bandit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+)
+
+const (
+	defaultSnapshotInterval = 6 * time.Hour
+	defaultSnapshotMaxAge   = 14 * 24 * time.Hour
+	defaultSnapshotKeepLast = 10
+)
+
+var (
+	ErrSnapshotNotFound = errors.New("bandit state snapshot not found")
+	ErrInvalidSnapshot  = errors.New("invalid bandit state snapshot request")
+)
+
+// SnapshotRepository stores copies of the slots' bandit states.
+type SnapshotRepository interface {
+	// CreateSnapshot copies every state of snap.Slot in one transaction and
+	// fills in snap's ID, States and CreatedAt.
+	CreateSnapshot(ctx context.Context, snap *domain.BanditStateSnapshot) error
+
+	// ListSnapshots returns the slot's snapshots, newest first.
+	ListSnapshots(ctx context.Context, slot string) ([]domain.BanditStateSnapshot, error)
+
+	GetSnapshot(ctx context.Context, id uint) (domain.BanditStateSnapshot, bool, error)
+
+	// SnapshotStates returns the snapshot's states by key.
+	SnapshotStates(ctx context.Context, id uint) (map[string]*LinUCBState, error)
+
+	// RestoreSnapshot copies the slot's current states into backup, then
+	// replaces them with the snapshot's, all in one transaction. Restored
+	// states get a new revision, so saves racing the restore conflict and
+	// retry on the restored state.
+	RestoreSnapshot(ctx context.Context, id uint, backup *domain.BanditStateSnapshot) error
+
+	// PruneSnapshots deletes the slot's snapshots created before `before`,
+	// except the newest keep.
+	PruneSnapshots(ctx context.Context, slot string, before time.Time, keep int) (int64, error)
+
+	// StateSlots lists the slots that have stored states.
+	StateSlots(ctx context.Context) ([]string, error)
+}
+
+// SlotConfigHasher identifies the config a slot serves.
+type SlotConfigHasher interface {
+	SlotConfigHash(ctx context.Context, slot string) string
+}
+
+type SnapshotConfig struct {
+	// how often every slot's states are snapshotted and pruned
+	Interval time.Duration
+
+	// retention: snapshots older than MaxAge are pruned, but the newest
+	// KeepLast of a slot are always kept
+	MaxAge   time.Duration
+	KeepLast int
+}
+
+// StateSnapshotter takes, compares and restores snapshots of the slots'
+// bandit states, so a bad config or reward bug can be rolled back.
+type StateSnapshotter struct {
+	repo   SnapshotRepository
+	hasher SlotConfigHasher
+	jobs   JobRunClaimer
+	cfg    SnapshotConfig
+}
+
+// NewStateSnapshotter builds a snapshotter; with jobs, scheduled snapshots
+// are taken by one replica per Interval.
+func NewStateSnapshotter(repo SnapshotRepository, hasher SlotConfigHasher, jobs JobRunClaimer, cfg SnapshotConfig) *StateSnapshotter {
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultSnapshotInterval
+	}
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = defaultSnapshotMaxAge
+	}
+	if cfg.KeepLast <= 0 {
+		cfg.KeepLast = defaultSnapshotKeepLast
+	}
+	return &StateSnapshotter{
+		repo:   repo,
+		hasher: hasher,
+		jobs:   jobs,
+		cfg:    cfg,
+	}
+}
+
+// SlotConfigHash hashes the slot's control config, with which snapshots
+// are tagged.
+func (s *BanditService) SlotConfigHash(ctx context.Context, slot string) string {
+	return configHash(s.loadConfig(ctx, slot, 0))
+}
+
+func (s *StateSnapshotter) configHash(ctx context.Context, slot string) string {
+	if s.hasher == nil {
+		return ""
+	}
+	return s.hasher.SlotConfigHash(ctx, slot)
+}
+
+// Snapshot copies the slot's states now.
+func (s *StateSnapshotter) Snapshot(ctx context.Context, slot, reason string, actorID uint, note string) (domain.BanditStateSnapshot, error) {
+	if slot == "" || strings.Contains(slot, "|") {
+		return domain.BanditStateSnapshot{}, fmt.Errorf("%w: slot is required and may not contain '|'", ErrInvalidSnapshot)
+	}
+
+	snap := domain.BanditStateSnapshot{
+		Slot:       slot,
+		ConfigHash: s.configHash(ctx, slot),
+		Reason:     reason,
+		ActorID:    actorID,
+		Note:       note,
+	}
+	if err := s.repo.CreateSnapshot(ctx, &snap); err != nil {
+		return domain.BanditStateSnapshot{}, err
+	}
+
+	logger.Info("bandit_state_snapshot_created",
+		"trace_id", TraceIDFromContext(ctx),
+		"slot", slot,
+		"snapshot_id", snap.ID,
+		"reason", reason,
+		"states", snap.States,
+	)
+	return snap, nil
+}
+
+func (s *StateSnapshotter) ListSnapshots(ctx context.Context, slot string) ([]domain.BanditStateSnapshot, error) {
+	return s.repo.ListSnapshots(ctx, slot)
+}
+
+func (s *StateSnapshotter) GetSnapshot(ctx context.Context, id uint) (domain.BanditStateSnapshot, error) {
+	snap, ok, err := s.repo.GetSnapshot(ctx, id)
+	if err != nil {
+		return snap, err
+	}
+	if !ok {
+		return snap, ErrSnapshotNotFound
+	}
+	return snap, nil
+}
+
+// Restore puts the snapshot's states back in place of the slot's current
+// ones, which are kept as a pre-restore snapshot and returned, so a restore
+// can itself be undone.
+func (s *StateSnapshotter) Restore(ctx context.Context, id uint, actorID uint) (domain.BanditStateSnapshot, error) {
+	snap, err := s.GetSnapshot(ctx, id)
+	if err != nil {
+		return domain.BanditStateSnapshot{}, err
+	}
+
+	backup := domain.BanditStateSnapshot{
+		Slot:       snap.Slot,
+		ConfigHash: s.configHash(ctx, snap.Slot),
+		Reason:     domain.SnapshotPreRestore,
+		ActorID:    actorID,
+		Note:       fmt.Sprintf("before restoring snapshot %d", snap.ID),
+	}
+	if err := s.repo.RestoreSnapshot(ctx, snap.ID, &backup); err != nil {
+		return domain.BanditStateSnapshot{}, err
+	}
+
+	logger.Warn("bandit_state_snapshot_restored",
+		"trace_id", TraceIDFromContext(ctx),
+		"slot", snap.Slot,
+		"snapshot_id", snap.ID,
+		"backup_id", backup.ID,
+		"actor_id", actorID,
+	)
+	return backup, nil
+}
+
+// Prune applies the retention policy to the slot's snapshots.
+func (s *StateSnapshotter) Prune(ctx context.Context, slot string) (int64, error) {
+	return s.repo.PruneSnapshots(ctx, slot, time.Now().Add(-s.cfg.MaxAge), s.cfg.KeepLast)
+}
+
+// Run snapshots and prunes every slot with stored states each Interval
+// until ctx is cancelled. Only the replica that claims a run takes it.
+func (s *StateSnapshotter) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if claimJobRun(ctx, s.jobs, "bandit_state_snapshots", s.cfg.Interval) {
+				s.snapshotAll(ctx)
+			}
+		}
+	}
+}
+
+func (s *StateSnapshotter) snapshotAll(ctx context.Context) {
+	slots, err := s.repo.StateSlots(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Error("bandit_state_snapshot_slots_failed", "error", err)
+		}
+		return
+	}
+
+	for _, slot := range slots {
+		if ctx.Err() != nil {
+			return
+		}
+		if _, err := s.Snapshot(ctx, slot, domain.SnapshotScheduled, 0, ""); err != nil {
+			logger.Error("bandit_state_snapshot_failed", "slot", slot, "error", err)
+			continue
+		}
+		if _, err := s.Prune(ctx, slot); err != nil {
+			logger.Error("bandit_state_snapshot_prune_failed", "slot", slot, "error", err)
+		}
+	}
+}
+
+// Diff compares two snapshots of the same slot. Both are loaded whole.
+func (s *StateSnapshotter) Diff(ctx context.Context, fromID, toID uint) (domain.SnapshotDiff, error) {
+	from, err := s.GetSnapshot(ctx, fromID)
+	if err != nil {
+		return domain.SnapshotDiff{}, err
+	}
+	to, err := s.GetSnapshot(ctx, toID)
+	if err != nil {
+		return domain.SnapshotDiff{}, err
+	}
+	if from.Slot != to.Slot {
+		return domain.SnapshotDiff{}, fmt.Errorf("%w: snapshots %d and %d are of different slots", ErrInvalidSnapshot, fromID, toID)
+	}
+
+	fromStates, err := s.repo.SnapshotStates(ctx, fromID)
+	if err != nil {
+		return domain.SnapshotDiff{}, err
+	}
+	toStates, err := s.repo.SnapshotStates(ctx, toID)
+	if err != nil {
+		return domain.SnapshotDiff{}, err
+	}
+
+	return diffStates(fromID, toID, fromStates, toStates), nil
+}
+
+func diffStates(fromID, toID uint, from, to map[string]*LinUCBState) domain.SnapshotDiff {
+	diff := domain.SnapshotDiff{FromID: fromID, ToID: toID}
+
+	var driftSum float64
+	var drifted int
+	for key, a := range from {
+		diff.ArmsFrom += len(a.Arms)
+		if _, ok := to[key]; !ok {
+			diff.StatesRemoved++
+			diff.ArmsRemoved += len(a.Arms)
+		}
+	}
+	for key, b := range to {
+		diff.ArmsTo += len(b.Arms)
+
+		a, ok := from[key]
+		if !ok {
+			diff.StatesAdded++
+			diff.ArmsAdded += len(b.Arms)
+			if strings.HasSuffix(key, "|global") {
+				diff.Global = append(diff.Global, domain.StateDiff{Key: key, ArmsTo: len(b.Arms), UpdatesTo: stateUpdates(b)})
+			}
+			continue
+		}
+
+		sd := diffState(key, a, b)
+		for pid := range b.Arms {
+			if _, ok := a.Arms[pid]; !ok {
+				diff.ArmsAdded++
+			}
+		}
+		for pid := range a.Arms {
+			if _, ok := b.Arms[pid]; !ok {
+				diff.ArmsRemoved++
+			}
+		}
+		if sd.changed {
+			diff.StatesChanged++
+		}
+		driftSum += sd.driftSum
+		drifted += sd.drifted
+		diff.MaxThetaDrift = math.Max(diff.MaxThetaDrift, sd.MaxThetaDrift)
+		if strings.HasSuffix(key, "|global") {
+			diff.Global = append(diff.Global, sd.StateDiff)
+		}
+	}
+	if drifted > 0 {
+		diff.MeanThetaDrift = driftSum / float64(drifted)
+	}
+
+	sort.Slice(diff.Global, func(i, j int) bool {
+		return diff.Global[i].Key < diff.Global[j].Key
+	})
+	return diff
+}
+
+type stateDiff struct {
+	domain.StateDiff
+	changed  bool
+	driftSum float64
+	drifted  int
+}
+
+func diffState(key string, a, b *LinUCBState) stateDiff {
+	sd := stateDiff{StateDiff: domain.StateDiff{
+		Key:         key,
+		ArmsFrom:    len(a.Arms),
+		ArmsTo:      len(b.Arms),
+		UpdatesFrom: stateUpdates(a),
+		UpdatesTo:   stateUpdates(b),
+	}}
+	sd.changed = sd.ArmsFrom != sd.ArmsTo || sd.UpdatesFrom != sd.UpdatesTo
+
+	for pid, armB := range b.Arms {
+		armA, ok := a.Arms[pid]
+		if !ok {
+			continue
+		}
+		d, ok := thetaDrift(armA, armB)
+		if !ok {
+			continue
+		}
+		sd.driftSum += d
+		sd.drifted++
+		sd.MaxThetaDrift = math.Max(sd.MaxThetaDrift, d)
+	}
+	if sd.drifted > 0 {
+		sd.MeanThetaDrift = sd.driftSum / float64(sd.drifted)
+		sd.changed = sd.changed || sd.MaxThetaDrift > 0
+	}
+	return sd
+}
+
+func stateUpdates(st *LinUCBState) int {
+	n := 0
+	for _, arm := range st.Arms {
+		n += arm.Count
+	}
+	return n
+}
+
+// thetaDrift is ‖θ_b − θ_a‖; false when the arms' layouts differ.
+func thetaDrift(a, b *LinUCBArmState) (float64, bool) {
+	if len(a.B) != len(b.B) {
+		return 0, false
+	}
+	ensureInverse(a)
+	ensureInverse(b)
+
+	sum := 0.0
+	for i := range a.Theta {
+		d := b.Theta[i] - a.Theta[i]
+		sum += d * d
+	}
+	return math.Sqrt(sum), true
+}
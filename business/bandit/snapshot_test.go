@@ -0,0 +1,179 @@
+//go:build !integration
+
+package bandit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+)
+
+// memSnapshotRepo keeps the live states of one slot and copies of them.
+type memSnapshotRepo struct {
+	t      *testing.T
+	live   map[string]*LinUCBState
+	snaps  map[uint]domain.BanditStateSnapshot
+	copies map[uint]map[string]*LinUCBState
+	nextID uint
+}
+
+func newMemSnapshotRepo(t *testing.T) *memSnapshotRepo {
+	return &memSnapshotRepo{
+		t:      t,
+		live:   make(map[string]*LinUCBState),
+		snaps:  make(map[uint]domain.BanditStateSnapshot),
+		copies: make(map[uint]map[string]*LinUCBState),
+	}
+}
+
+// copyStates deep-copies states the way storing them as JSON does.
+func copyStates(t *testing.T, states map[string]*LinUCBState) map[string]*LinUCBState {
+	t.Helper()
+	raw, err := json.Marshal(states)
+	if err != nil {
+		t.Fatalf("marshal states: %v", err)
+	}
+	out := make(map[string]*LinUCBState)
+	if err := json.Unmarshal(raw, &out); err != nil {
+		t.Fatalf("unmarshal states: %v", err)
+	}
+	return out
+}
+
+func (r *memSnapshotRepo) create(snap *domain.BanditStateSnapshot, states map[string]*LinUCBState) {
+	r.nextID++
+	snap.ID = r.nextID
+	snap.States = len(states)
+	snap.CreatedAt = time.Now()
+	r.snaps[snap.ID] = *snap
+	r.copies[snap.ID] = states
+}
+
+func (r *memSnapshotRepo) CreateSnapshot(_ context.Context, snap *domain.BanditStateSnapshot) error {
+	r.create(snap, copyStates(r.t, r.live))
+	return nil
+}
+
+func (r *memSnapshotRepo) ListSnapshots(context.Context, string) ([]domain.BanditStateSnapshot, error) {
+	return nil, nil
+}
+
+func (r *memSnapshotRepo) GetSnapshot(_ context.Context, id uint) (domain.BanditStateSnapshot, bool, error) {
+	snap, ok := r.snaps[id]
+	return snap, ok, nil
+}
+
+func (r *memSnapshotRepo) SnapshotStates(_ context.Context, id uint) (map[string]*LinUCBState, error) {
+	return copyStates(r.t, r.copies[id]), nil
+}
+
+func (r *memSnapshotRepo) RestoreSnapshot(_ context.Context, id uint, backup *domain.BanditStateSnapshot) error {
+	r.create(backup, copyStates(r.t, r.live))
+	r.live = copyStates(r.t, r.copies[id])
+	return nil
+}
+
+func (r *memSnapshotRepo) PruneSnapshots(context.Context, string, time.Time, int) (int64, error) {
+	return 0, nil
+}
+
+func (r *memSnapshotRepo) StateSlots(context.Context) ([]string, error) {
+	return []string{"home_top"}, nil
+}
+
+// trainedState is a state whose arms learned n rewarded events each.
+func trainedState(pids []uint64, n int, reward float64) *LinUCBState {
+	cfg := DefaultConfig()
+	dims := pipelineFor(cfg).dims
+	policy := policyFor(cfg, VariantUCB)
+	st := newDefaultState(dims)
+	x := make([]float64, len(dims))
+	x[0] = 1
+	for _, pid := range pids {
+		for i := 0; i < n; i++ {
+			learnState(policy, cfg, st, true, pid, x, nil, reward, time.Now())
+		}
+	}
+	return st
+}
+
+// Restoring a snapshot puts its states back, removes states created since,
+// and keeps the replaced states as a backup that undoes the restore.
+func TestSnapshotRestore_ReplacesStatesAndKeepsBackup(t *testing.T) {
+	logger.Init("test")
+	ctx := context.Background()
+
+	repo := newMemSnapshotRepo(t)
+	repo.live["home_top|seg=0|global"] = trainedState([]uint64{1, 2}, 3, 1)
+	s := NewStateSnapshotter(repo, nil, nil, SnapshotConfig{})
+
+	before, err := s.Snapshot(ctx, "home_top", domain.SnapshotManual, 1, "")
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+
+	// learning continues: an arm changes and a user state appears
+	repo.live["home_top|seg=0|global"] = trainedState([]uint64{1, 2, 3}, 6, 0)
+	repo.live["home_top|seg=0|user=7"] = trainedState([]uint64{1}, 1, 1)
+
+	backup, err := s.Restore(ctx, before.ID, 1)
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if backup.Reason != domain.SnapshotPreRestore || backup.States != 2 {
+		t.Fatalf("backup = %+v, want a pre-restore snapshot of 2 states", backup)
+	}
+	if len(repo.live) != 1 || len(repo.live["home_top|seg=0|global"].Arms) != 2 {
+		t.Fatalf("live states after restore = %d, want the snapshot's single global state with 2 arms", len(repo.live))
+	}
+
+	if _, err := s.Restore(ctx, backup.ID, 1); err != nil {
+		t.Fatalf("Restore backup: %v", err)
+	}
+	if len(repo.live) != 2 || len(repo.live["home_top|seg=0|global"].Arms) != 3 {
+		t.Errorf("live states after undo = %d, want the 2 states learned since", len(repo.live))
+	}
+}
+
+// Diff counts added states and arms and reports how far the shared arms'
+// coefficients moved.
+func TestSnapshotDiff_CountsChangesAndDrift(t *testing.T) {
+	logger.Init("test")
+	ctx := context.Background()
+
+	repo := newMemSnapshotRepo(t)
+	repo.live["home_top|seg=0|global"] = trainedState([]uint64{1, 2}, 3, 1)
+	s := NewStateSnapshotter(repo, nil, nil, SnapshotConfig{})
+
+	from, err := s.Snapshot(ctx, "home_top", domain.SnapshotManual, 1, "")
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	repo.live["home_top|seg=0|global"] = trainedState([]uint64{1, 2, 3}, 3, 0)
+	repo.live["home_top|seg=0|user=7"] = trainedState([]uint64{1}, 1, 1)
+	to, err := s.Snapshot(ctx, "home_top", domain.SnapshotManual, 1, "")
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+
+	diff, err := s.Diff(ctx, from.ID, to.ID)
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	got := fmt.Sprintf("added %d changed %d removed %d, arms %d→%d (+%d −%d)",
+		diff.StatesAdded, diff.StatesChanged, diff.StatesRemoved, diff.ArmsFrom, diff.ArmsTo, diff.ArmsAdded, diff.ArmsRemoved)
+	if want := "added 1 changed 1 removed 0, arms 2→4 (+2 −0)"; got != want {
+		t.Errorf("diff = %s, want %s", got, want)
+	}
+	if diff.MaxThetaDrift <= 0 || diff.MeanThetaDrift <= 0 {
+		t.Errorf("θ drift = mean %v max %v, want > 0 for arms that learned opposite rewards", diff.MeanThetaDrift, diff.MaxThetaDrift)
+	}
+	if len(diff.Global) != 1 || diff.Global[0].ArmsFrom != 2 || diff.Global[0].ArmsTo != 3 {
+		t.Errorf("global diff = %+v, want the one global state going from 2 to 3 arms", diff.Global)
+	}
+}
@@ -2,40 +2,247 @@ package bandit
 
 import "time"
 
-const linUCBFeatureDim = 7
+// stateVersion 1 sizes the arm matrices by the slot's feature pipeline and
+// stores the per-dimension feature names next to them. Version 0 is the
+// original fixed 7-dim layout, see legacyFeatureDims.
+const stateVersion = 1
+
+// ridge prior on the diagonal of A for a fresh arm / a new feature dimension
+const armPrior = 0.1
 
 // Per arm/product LinUCB parameters.
 type LinUCBArmState struct {
-	A           [linUCBFeatureDim][linUCBFeatureDim]float64 `json:"A"`
-	B           [linUCBFeatureDim]float64                   `json:"b"`
-	Count       int                                         `json:"count"`
-	LastUpdated time.Time                                   `json:"last_updated"`
+	A           [][]float64 `json:"A"`
+	B           []float64   `json:"b"`
+	Count       int         `json:"count"`
+	LastUpdated time.Time   `json:"last_updated"`
+
+	// hybrid LinUCB coupling to the state's shared block (d×k)
+	BZ [][]float64 `json:"B_z,omitempty"`
+
+	// A⁻¹ and θ = A⁻¹b kept up to date incrementally (see inverse.go), and
+	// the number of updates since A⁻¹ was last recomputed from A
+	AInv   [][]float64 `json:"A_inv,omitempty"`
+	Theta  []float64   `json:"theta,omitempty"`
+	InvAge int         `json:"inv_age,omitempty"`
 }
 
 // Overall state for a slot.
 type LinUCBState struct {
-	Alpha float64                    `json:"alpha"`
-	Arms  map[uint64]*LinUCBArmState `json:"arms"` // key: productID
+	Version  int                        `json:"version"`
+	Features []string                   `json:"features"` // feature name per dimension
+	Alpha    float64                    `json:"alpha"`
+	Arms     map[uint64]*LinUCBArmState `json:"arms"` // key: productID
+
+	// one arm learned from every product's events; only kept in global
+	// states of configs with UseSharedArm
+	Shared *LinUCBArmState `json:"shared,omitempty"`
+
+	// shared coefficient block of hybrid LinUCB; only kept in global states
+	Hybrid *HybridState `json:"hybrid,omitempty"`
+
+	// storage version the state was read at, for compare-and-swap saves;
+	// 0 for a state that has never been saved
+	Revision int64 `json:"-"`
 }
 
-// Create a new arm with A initialized to identity.
-func newArmState() *LinUCBArmState {
-	var A [linUCBFeatureDim][linUCBFeatureDim]float64
-	for i := 0; i < linUCBFeatureDim; i++ {
-		A[i][i] = 0.1
+// Create a new arm with A initialized to a scaled identity.
+func newArmState(dim int) *LinUCBArmState {
+	A := newMatrix(dim)
+	AInv := newMatrix(dim)
+	for i := 0; i < dim; i++ {
+		A[i][i] = armPrior
+		AInv[i][i] = 1 / armPrior
 	}
 	return &LinUCBArmState{
 		A:           A,
-		B:           [linUCBFeatureDim]float64{},
+		B:           make([]float64, dim),
 		Count:       0,
 		LastUpdated: time.Now(),
+		AInv:        AInv,
+		Theta:       make([]float64, dim),
 	}
 }
 
 // Create a default state for a new slot.
-func newDefaultState() *LinUCBState {
+func newDefaultState(features []string) *LinUCBState {
 	return &LinUCBState{
-		Alpha: 1.0,
-		Arms:  make(map[uint64]*LinUCBArmState),
+		Version:  stateVersion,
+		Features: append([]string(nil), features...),
+		Alpha:    1.0,
+		Arms:     make(map[uint64]*LinUCBArmState),
+	}
+}
+
+// arm returns the product's arm, or a fresh one (not added to the state).
+func (s *LinUCBState) arm(productID uint64) *LinUCBArmState {
+	if a, ok := s.Arms[productID]; ok {
+		return a
+	}
+	return newArmState(len(s.Features))
+}
+
+// armForUpdate returns the product's arm, adding a fresh one if missing.
+func (s *LinUCBState) armForUpdate(productID uint64) *LinUCBArmState {
+	a, ok := s.Arms[productID]
+	if !ok {
+		a = newArmState(len(s.Features))
+		s.Arms[productID] = a
+	}
+	return a
+}
+
+// arms with fewer updates than this are scored with the shared arm
+const sharedArmMinCount = 5
+
+// scoringArm returns the arm to score a product with. With useShared,
+// products the state has seen fewer than sharedArmMinCount times borrow the
+// shared arm, so new SKUs are ranked by what their attributes predict.
+func (s *LinUCBState) scoringArm(productID uint64, useShared bool) *LinUCBArmState {
+	a, ok := s.Arms[productID]
+	if useShared && s.Shared != nil && (!ok || a.Count < sharedArmMinCount) {
+		return s.Shared
+	}
+	if ok {
+		return a
+	}
+	return newArmState(len(s.Features))
+}
+
+// learnState folds one reward into the product's arm of one state. shared
+// marks the global state, which also carries the shared arm and the hybrid
+// block; user states learn their arms on their own.
+func learnState(
+	policy Policy,
+	cfg Config,
+	st *LinUCBState,
+	shared bool,
+	productID uint64,
+	x, z []float64,
+	reward float64,
+	now time.Time,
+) {
+	if !shared {
+		dropHybrid(st)
+	}
+
+	arm := st.armForUpdate(productID)
+	if sp, ok := policy.(SharedPolicy); ok && shared && len(z) > 0 {
+		sp.UpdateShared(st, arm, x, z, reward, now)
+	} else {
+		policy.Update(arm, x, reward, now)
+	}
+
+	if shared && cfg.Features.UseSharedArm {
+		if st.Shared == nil {
+			st.Shared = newArmState(len(st.Features))
+		}
+		policy.Update(st.Shared, x, reward, now)
+	}
+
+	capArms(st, cfg.MaxArmsPerState)
+}
+
+// learn folds one reward into the product's global and user arms, and into
+// the global shared arm when the config enables it. z are the cross features
+// of shared policies, nil otherwise.
+func learn(
+	policy Policy,
+	cfg Config,
+	globalState, userState *LinUCBState,
+	productID uint64,
+	x, z []float64,
+	reward float64,
+	now time.Time,
+) {
+	learnState(policy, cfg, globalState, true, productID, x, z, reward, now)
+	learnState(policy, cfg, userState, false, productID, x, z, reward, now)
+}
+
+// migrateState brings a stored state onto the feature layout features.
+// Dimensions are matched by name: statistics of features present in both
+// layouts are kept, new features start from the prior and dropped features
+// are discarded. It reports whether the state was changed.
+func migrateState(st *LinUCBState, flags FeatureFlags, features []string) bool {
+	changed := false
+	if st.Arms == nil {
+		st.Arms = make(map[uint64]*LinUCBArmState)
+	}
+	if st.Version == 0 && len(st.Features) == 0 {
+		st.Features = legacyFeatureDims(flags)
+		changed = true
+	}
+	if st.Version != stateVersion {
+		st.Version = stateVersion
+		changed = true
+	}
+	if equalStrings(st.Features, features) {
+		return changed
+	}
+
+	// old index of every new dimension, -1 when the feature is new
+	oldIdx := make(map[string]int, len(st.Features))
+	for i, name := range st.Features {
+		oldIdx[name] = i
+	}
+	src := make([]int, len(features))
+	for i, name := range features {
+		if j, ok := oldIdx[name]; ok {
+			src[i] = j
+		} else {
+			src[i] = -1
+		}
+	}
+
+	oldDim := len(st.Features)
+	for pid, arm := range st.Arms {
+		st.Arms[pid] = remapArm(arm, src, oldDim)
+	}
+	if st.Shared != nil {
+		st.Shared = remapArm(st.Shared, src, oldDim)
+	}
+	// z = x ⊗ p changes with x: the shared block and every arm's B_z
+	// (dropped by remapArm) start over
+	st.Hybrid = nil
+
+	st.Features = append([]string(nil), features...)
+	return true
+}
+
+// remapArm copies an arm onto a new layout; src[i] is the old index of new
+// dimension i, or -1 for a new feature.
+func remapArm(arm *LinUCBArmState, src []int, oldDim int) *LinUCBArmState {
+	next := newArmState(len(src))
+	next.Count = arm.Count
+	next.LastUpdated = arm.LastUpdated
+
+	// arms that do not match their own layout cannot be remapped
+	if len(arm.B) != oldDim || len(arm.A) != oldDim {
+		return next
+	}
+	for i, si := range src {
+		if si < 0 {
+			continue
+		}
+		next.B[i] = arm.B[si]
+		for j, sj := range src {
+			if sj >= 0 {
+				next.A[i][j] = arm.A[si][sj]
+			}
+		}
+	}
+	refreshInverse(next)
+	return next
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
 	}
+	return true
 }
@@ -0,0 +1,205 @@
+//go:build !integration
+
+package bandit
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+)
+
+// memStateRepo is an in-memory BanditStateRepository with the same
+// compare-and-swap semantics as the Postgres one: a save at revision 0 is an
+// insert, and only overwrites an existing row still at version 0. States
+// round-trip through JSON so writers never share memory.
+type memStateRepo struct {
+	mu        sync.Mutex
+	rows      map[string]memStateRow
+	conflicts atomic.Int64
+}
+
+type memStateRow struct {
+	raw     []byte
+	version int64
+}
+
+func newMemStateRepo() *memStateRepo {
+	return &memStateRepo{rows: make(map[string]memStateRow)}
+}
+
+func (r *memStateRepo) GetState(_ context.Context, key string) (*LinUCBState, error) {
+	r.mu.Lock()
+	row, ok := r.rows[key]
+	r.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+
+	var st LinUCBState
+	if err := json.Unmarshal(row.raw, &st); err != nil {
+		return nil, err
+	}
+	st.Revision = row.version
+	return &st, nil
+}
+
+func (r *memStateRepo) SaveState(_ context.Context, key string, st *LinUCBState) error {
+	raw, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	row, ok := r.rows[key]
+	if ok && row.version != st.Revision || !ok && st.Revision != 0 {
+		r.conflicts.Add(1)
+		return ErrStateConflict
+	}
+	st.Revision++
+	r.rows[key] = memStateRow{raw: raw, version: st.Revision}
+	return nil
+}
+
+type countingEventRepo struct {
+	saved atomic.Int64
+}
+
+func (r *countingEventRepo) SaveEvent(context.Context, domain.BanditEvent) error {
+	r.saved.Add(1)
+	return nil
+}
+
+const (
+	concurrentWriters        = 16
+	concurrentEventsPerUser  = 60
+	concurrentProducts       = 20
+	concurrentSlot           = "home_top"
+	concurrentUsersPerWriter = 2
+)
+
+// TestLogFeedback_ParallelWritersLoseNoUpdates hammers the same global
+// states from many goroutines and checks that every event's update is in
+// the final state: the arm counts must add up exactly.
+func TestLogFeedback_ParallelWritersLoseNoUpdates(t *testing.T) {
+	logger.Init("test")
+
+	stateRepo := newMemStateRepo()
+	eventRepo := &countingEventRepo{}
+
+	cfg := DefaultConfig()
+	svc := NewBanditService(eventRepo, nil, stateRepo, nil, nil, nil, nil, nil, cfg)
+
+	ctx := context.Background()
+	expected := make(map[string]map[uint64]int) // global key -> product -> events
+
+	jobs := make([][]domain.BanditEvent, concurrentWriters)
+	for w := 0; w < concurrentWriters; w++ {
+		for u := 0; u < concurrentUsersPerWriter; u++ {
+			userID := uint(w*concurrentUsersPerWriter + u + 1)
+			seg := svc.userSegment(ctx, userID, cfg)
+			gKey := stateGlobalKey(concurrentSlot, seg)
+			if expected[gKey] == nil {
+				expected[gKey] = make(map[uint64]int)
+			}
+
+			for i := 0; i < concurrentEventsPerUser; i++ {
+				pid := uint64(i%concurrentProducts + 1)
+				expected[gKey][pid]++
+				jobs[w] = append(jobs[w], domain.BanditEvent{
+					UserID:    userID,
+					Slot:      concurrentSlot,
+					ProductID: pid,
+					EventType: "click",
+				})
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, concurrentWriters)
+	for w := 0; w < concurrentWriters; w++ {
+		wg.Add(1)
+		go func(events []domain.BanditEvent) {
+			defer wg.Done()
+			for _, ev := range events {
+				if err := svc.LogFeedback(ctx, ev); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(jobs[w])
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("LogFeedback: %v", err)
+	}
+
+	total := concurrentWriters * concurrentUsersPerWriter * concurrentEventsPerUser
+	if got := int(eventRepo.saved.Load()); got != total {
+		t.Fatalf("saved events = %d, want %d", got, total)
+	}
+
+	for gKey, perProduct := range expected {
+		st, err := stateRepo.GetState(ctx, gKey)
+		if err != nil || st == nil {
+			t.Fatalf("global state %s missing: %v", gKey, err)
+		}
+		for pid, want := range perProduct {
+			arm, ok := st.Arms[pid]
+			if !ok {
+				t.Fatalf("%s: product %d has no arm", gKey, pid)
+			}
+			if arm.Count != want {
+				t.Errorf("%s: product %d count = %d, want %d (lost updates)", gKey, pid, arm.Count, want)
+			}
+		}
+	}
+
+	t.Logf("events=%d states=%d conflicts retried=%d", total, len(stateRepo.rows), stateRepo.conflicts.Load())
+}
+
+// TestLogFeedback_SavesVersionZeroState checks that states stored before
+// versioning, still at version 0, keep learning.
+func TestLogFeedback_SavesVersionZeroState(t *testing.T) {
+	logger.Init("test")
+
+	stateRepo := newMemStateRepo()
+	cfg := DefaultConfig()
+	svc := NewBanditService(&countingEventRepo{}, nil, stateRepo, nil, nil, nil, nil, nil, cfg)
+
+	ctx := context.Background()
+	seg := svc.userSegment(ctx, 1, cfg)
+	gKey := stateGlobalKey(concurrentSlot, seg)
+
+	legacy := newDefaultState(pipelineFor(cfg).dims)
+	legacy.Arms[1] = newArmState(len(legacy.Features))
+	legacy.Arms[1].Count = 5
+	raw, err := json.Marshal(legacy)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	stateRepo.rows[gKey] = memStateRow{raw: raw, version: 0}
+
+	for i := 0; i < 3; i++ {
+		ev := domain.BanditEvent{UserID: 1, Slot: concurrentSlot, ProductID: 1, EventType: "click"}
+		if err := svc.LogFeedback(ctx, ev); err != nil {
+			t.Fatalf("LogFeedback on a version-0 state: %v", err)
+		}
+	}
+
+	st, err := stateRepo.GetState(ctx, gKey)
+	if err != nil || st == nil {
+		t.Fatalf("global state missing: %v", err)
+	}
+	if st.Revision != 3 || st.Arms[1].Count != 8 {
+		t.Errorf("revision = %d, count = %d, want 3 and 8", st.Revision, st.Arms[1].Count)
+	}
+}
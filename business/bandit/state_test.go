@@ -0,0 +1,92 @@
+//go:build !integration
+
+package bandit
+
+import (
+	"math"
+	"testing"
+)
+
+// A legacy state, stored before dimensions were named, is moved onto a
+// named layout: kept features carry their A and b entries to their new
+// positions, a new feature starts from the prior, and θ solves the
+// remapped system.
+func TestMigrateState_LegacyToNamedDims(t *testing.T) {
+	const oldDim = 7
+	arm := newArmState(oldDim)
+	for n, x := range [][]float64{
+		{1, 0.2, 0.5, 0.1, 0.3, 0.4, 0.9},
+		{1, 0.6, 0.1, 0.7, 0.3, 0.2, 0.5},
+		{1, 0.4, 0.8, 0.2, 0.3, 0.6, 0.1},
+	} {
+		addOuter(arm.A, x)
+		for i := range x {
+			arm.B[i] += float64(n+1) * x[i]
+		}
+	}
+	arm.Count = 3
+	oldA := cloneMatrix(arm.A)
+	oldB := append([]float64(nil), arm.B...)
+
+	st := &LinUCBState{Arms: map[uint64]*LinUCBArmState{42: arm}}
+	flags := FeatureFlags{UseBias: true}
+	features := []string{FeatureSegment, FeatureBias, FeaturePriceBand, FeatureTimeBucket}
+
+	if !migrateState(st, flags, features) {
+		t.Fatal("migrateState reported no change for a legacy state")
+	}
+	if st.Version != stateVersion || !equalStrings(st.Features, features) {
+		t.Fatalf("state = v%d %v, want v%d %v", st.Version, st.Features, stateVersion, features)
+	}
+
+	// legacy layout: bias 0, time_bucket 1, dow 2, platform_hash 3,
+	// slot_hash 4, segment 5, product_hash 6
+	src := []int{5, 0, -1, 1}
+	got := st.Arms[42]
+	if got.Count != 3 {
+		t.Errorf("count = %d, want 3", got.Count)
+	}
+	for i, si := range src {
+		wantB := 0.0
+		if si >= 0 {
+			wantB = oldB[si]
+		}
+		if got.B[i] != wantB {
+			t.Errorf("b[%d] = %v, want %v", i, got.B[i], wantB)
+		}
+		for j, sj := range src {
+			var wantA float64
+			switch {
+			case si >= 0 && sj >= 0:
+				wantA = oldA[si][sj]
+			case i == j:
+				wantA = armPrior
+			}
+			if got.A[i][j] != wantA {
+				t.Errorf("A[%d][%d] = %v, want %v", i, j, got.A[i][j], wantA)
+			}
+		}
+	}
+
+	// θ = A⁻¹b: A·θ reproduces b
+	for i, v := range matVecMul(got.A, got.Theta) {
+		if math.Abs(v-got.B[i]) > 1e-9 {
+			t.Errorf("(Aθ)[%d] = %v, want b[%d] = %v", i, v, i, got.B[i])
+		}
+	}
+	if got.Theta[2] != 0 {
+		t.Errorf("θ of the new feature = %v, want 0", got.Theta[2])
+	}
+
+	if migrateState(st, flags, features) {
+		t.Error("migrateState changed a state already on the layout")
+	}
+}
+
+func cloneMatrix(A [][]float64) [][]float64 {
+	out := make([][]float64, len(A))
+	for i := range A {
+		out[i] = append([]float64(nil), A[i]...)
+	}
+	return out
+}
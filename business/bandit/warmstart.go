@@ -0,0 +1,349 @@
+package bandit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+)
+
+const (
+	// StateExportFormat versions the portable state export.
+	StateExportFormat = "bandit-state/v1"
+
+	defaultRebuildLookback = 30 * 24 * time.Hour
+
+	// events are read from the log one window at a time
+	rebuildWindow = 24 * time.Hour
+)
+
+var ErrInvalidStateRequest = errors.New("invalid bandit state request")
+
+// SlotStateLister reads every stored state of a slot.
+type SlotStateLister interface {
+	// ListStates returns the slot's states by key: the global states and,
+	// with users, the per-user states.
+	ListStates(ctx context.Context, slot string, users bool) (map[string]*LinUCBState, error)
+}
+
+// StateExport is a portable copy of a slot's states. Arms are keyed by
+// product ID, so environments importing it must share product IDs.
+type StateExport struct {
+	Format     string                  `json:"format"`
+	Slot       string                  `json:"slot"`
+	ConfigHash string                  `json:"config_hash"`
+	ExportedAt time.Time               `json:"exported_at"`
+	States     map[string]*LinUCBState `json:"states"` // key: state key
+}
+
+// StateWarmStarter bootstraps bandit states: it rebuilds them from the
+// event log, and exports and imports them between environments.
+type StateWarmStarter struct {
+	svc    *BanditService
+	events EventLogRepository
+	states SlotStateLister
+}
+
+func NewStateWarmStarter(svc *BanditService, events EventLogRepository, states SlotStateLister) *StateWarmStarter {
+	return &StateWarmStarter{
+		svc:    svc,
+		events: events,
+		states: states,
+	}
+}
+
+// replayConfig is what one variant learns with during a rebuild.
+type replayConfig struct {
+	cfg    Config
+	pipe   *featurePipeline
+	policy Policy
+}
+
+// rebuiltState is a state being rebuilt, on the layout of the config that
+// last learned into it.
+type rebuiltState struct {
+	st     *LinUCBState
+	global bool
+}
+
+// Rebuild replays the slot's logged events, oldest first, through the same
+// feature pipeline, reward model and policy update as live feedback, under
+// each event's variant config and its logged context. Segment and variant
+// are taken from the context; products are featurised with today's
+// catalogue. The rebuilt states replace the stored ones; events logged
+// while the rebuild runs are not in them.
+func (w *StateWarmStarter) Rebuild(ctx context.Context, req domain.StateRebuildRequest) (domain.StateRebuildReport, error) {
+	if req.Slot == "" {
+		return domain.StateRebuildReport{}, fmt.Errorf("%w: slot is required", ErrInvalidStateRequest)
+	}
+	if req.To.IsZero() {
+		req.To = time.Now()
+	}
+	if req.From.IsZero() {
+		req.From = req.To.Add(-defaultRebuildLookback)
+	}
+	if !req.From.Before(req.To) {
+		return domain.StateRebuildReport{}, fmt.Errorf("%w: from must be before to", ErrInvalidStateRequest)
+	}
+
+	report := domain.StateRebuildReport{Slot: req.Slot, From: req.From, To: req.To}
+	configs := make(map[int]replayConfig)
+	states := make(map[string]*rebuiltState)
+
+	stateFor := func(key string, global bool, rc replayConfig) *LinUCBState {
+		rs, ok := states[key]
+		if !ok {
+			rs = &rebuiltState{st: newDefaultState(rc.pipe.dims), global: global}
+			states[key] = rs
+		}
+		migrateState(rs.st, rc.cfg.Features, rc.pipe.dims)
+		return rs.st
+	}
+
+	for from := req.From; from.Before(req.To); from = from.Add(rebuildWindow) {
+		to := from.Add(rebuildWindow)
+		if to.After(req.To) {
+			to = req.To
+		}
+
+		events, err := w.events.ListEvents(ctx, req.Slot, from, to)
+		if err != nil {
+			return report, err
+		}
+		ids := make([]uint64, 0, len(events))
+		for _, ev := range events {
+			ids = append(ids, ev.ProductID)
+		}
+		products := productAttributes(ctx, w.svc.productFeatures, ids...)
+
+		for _, ev := range events {
+			ctxMap := map[string]any{}
+			for k, v := range ev.Context {
+				ctxMap[k] = v
+			}
+			if v, ok := ctxMap["value"].(float64); ok {
+				ev.Value = v
+			}
+
+			seg, ok := intFromContext(ctxMap, "segment")
+			if !ok {
+				report.Skipped++
+				continue
+			}
+			if req.Segment != nil && seg != *req.Segment {
+				continue
+			}
+			variant, _ := intFromContext(ctxMap, "variant")
+
+			rc, ok := configs[variant]
+			if !ok {
+				cfg := w.svc.loadConfig(ctx, req.Slot, variant)
+				rc = replayConfig{cfg: cfg, pipe: pipelineFor(cfg), policy: policyFor(cfg, variant)}
+				configs[variant] = rc
+			}
+			reward, err := rc.cfg.RewardForEvent(ev)
+			if err != nil {
+				report.Skipped++
+				continue
+			}
+
+			product := products[ev.ProductID]
+			x := rc.pipe.vector(FeatureInput{
+				UserID:    ev.UserID,
+				Slot:      ev.Slot,
+				ProductID: ev.ProductID,
+				Segment:   seg,
+				Now:       ev.CreatedAt,
+				Ctx:       ctxMap,
+				Product:   product,
+			})
+			z := crossFeatures(rc.policy, x, product)
+
+			global := stateFor(stateGlobalKey(req.Slot, seg), true, rc)
+			learnState(rc.policy, rc.cfg, global, true, ev.ProductID, x, z, reward, ev.CreatedAt)
+			if req.IncludeUsers {
+				user := stateFor(stateUserKey(req.Slot, seg, ev.UserID), false, rc)
+				learnState(rc.policy, rc.cfg, user, false, ev.ProductID, x, z, reward, ev.CreatedAt)
+			}
+			report.Events++
+		}
+	}
+
+	for _, rs := range states {
+		if rs.global {
+			report.GlobalStates++
+		} else {
+			report.UserStates++
+		}
+		report.Arms += len(rs.st.Arms)
+	}
+	if req.DryRun {
+		return report, nil
+	}
+
+	for key, rs := range states {
+		if err := w.svc.replaceState(ctx, key, rs.st); err != nil {
+			return report, fmt.Errorf("save rebuilt state %s: %w", key, err)
+		}
+	}
+	report.Saved = true
+
+	logger.Info("bandit_states_rebuilt",
+		"trace_id", TraceIDFromContext(ctx),
+		"slot", req.Slot,
+		"events", report.Events,
+		"skipped", report.Skipped,
+		"global_states", report.GlobalStates,
+		"user_states", report.UserStates,
+	)
+	return report, nil
+}
+
+// Export copies the slot's stored states into the portable format.
+func (w *StateWarmStarter) Export(ctx context.Context, slot string, users bool) (StateExport, error) {
+	if slot == "" {
+		return StateExport{}, fmt.Errorf("%w: slot is required", ErrInvalidStateRequest)
+	}
+
+	states, err := w.states.ListStates(ctx, slot, users)
+	if err != nil {
+		return StateExport{}, err
+	}
+	return StateExport{
+		Format:     StateExportFormat,
+		Slot:       slot,
+		ConfigHash: w.svc.SlotConfigHash(ctx, slot),
+		ExportedAt: time.Now(),
+		States:     states,
+	}, nil
+}
+
+// Import writes an export's states, replacing stored ones with the same
+// key. With slot set the states are moved to that slot. States are
+// migrated onto the slot's feature layout when next read.
+func (w *StateWarmStarter) Import(ctx context.Context, exp StateExport, slot string) (int, error) {
+	if exp.Format != StateExportFormat {
+		return 0, fmt.Errorf("%w: unsupported format %q", ErrInvalidStateRequest, exp.Format)
+	}
+	if exp.Slot == "" {
+		return 0, fmt.Errorf("%w: slot is required", ErrInvalidStateRequest)
+	}
+	if slot == "" {
+		slot = exp.Slot
+	}
+	if strings.Contains(slot, "|") {
+		return 0, fmt.Errorf("%w: slot may not contain '|'", ErrInvalidStateRequest)
+	}
+
+	prefix := exp.Slot + "|"
+	states := make(map[string]*LinUCBState, len(exp.States))
+	for key, st := range exp.States {
+		if !strings.HasPrefix(key, prefix) {
+			return 0, fmt.Errorf("%w: state %s is not of slot %s", ErrInvalidStateRequest, key, exp.Slot)
+		}
+		if err := validateImportedState(st); err != nil {
+			return 0, fmt.Errorf("%w: state %s: %v", ErrInvalidStateRequest, key, err)
+		}
+		states[slot+"|"+strings.TrimPrefix(key, prefix)] = st
+	}
+
+	for key, st := range states {
+		if err := w.svc.replaceState(ctx, key, st); err != nil {
+			return 0, fmt.Errorf("save imported state %s: %w", key, err)
+		}
+	}
+
+	logger.Info("bandit_states_imported",
+		"trace_id", TraceIDFromContext(ctx),
+		"slot", slot,
+		"from_slot", exp.Slot,
+		"states", len(states),
+	)
+	return len(states), nil
+}
+
+// validateImportedState checks that every arm is sized to the state's
+// feature layout.
+func validateImportedState(st *LinUCBState) error {
+	if st == nil {
+		return fmt.Errorf("state is empty")
+	}
+	d := len(st.Features)
+	k := d * productCrossDim
+	check := func(arm *LinUCBArmState) error {
+		if len(arm.A) != d || len(arm.B) != d {
+			return fmt.Errorf("arm sized %d×%d, want %d features", len(arm.A), len(arm.B), d)
+		}
+		if !isMatrix(arm.A, d, d) {
+			return fmt.Errorf("arm A is not %d×%d", d, d)
+		}
+		if arm.AInv != nil && !isMatrix(arm.AInv, d, d) || arm.Theta != nil && len(arm.Theta) != d {
+			return fmt.Errorf("arm inverse is not %d×%d", d, d)
+		}
+		if arm.BZ != nil && !isMatrix(arm.BZ, d, k) {
+			return fmt.Errorf("arm B_z is not %d×%d", d, k)
+		}
+		return nil
+	}
+	for pid, arm := range st.Arms {
+		if arm == nil {
+			return fmt.Errorf("arm %d is empty", pid)
+		}
+		if err := check(arm); err != nil {
+			return fmt.Errorf("arm %d: %w", pid, err)
+		}
+	}
+	if st.Shared != nil {
+		if err := check(st.Shared); err != nil {
+			return fmt.Errorf("shared arm: %w", err)
+		}
+	}
+	if h := st.Hybrid; h != nil {
+		if !isMatrix(h.A0, k, k) || len(h.B0) != k {
+			return fmt.Errorf("hybrid block is not %d×%d", k, k)
+		}
+		// a stale inverse is recomputed on load, a misshapen one is not
+		if h.A0Inv != nil && !isMatrix(h.A0Inv, k, k) || h.Beta != nil && len(h.Beta) != k {
+			return fmt.Errorf("hybrid inverse is not %d×%d", k, k)
+		}
+	}
+	return nil
+}
+
+// isMatrix reports whether m has rows rows of cols columns each.
+func isMatrix(m [][]float64, rows, cols int) bool {
+	if len(m) != rows {
+		return false
+	}
+	for _, row := range m {
+		if len(row) != cols {
+			return false
+		}
+	}
+	return true
+}
+
+// replaceState overwrites a stored state regardless of its contents,
+// retrying when a concurrent save moves its revision.
+func (s *BanditService) replaceState(ctx context.Context, key string, st *LinUCBState) error {
+	for attempt := 0; ; attempt++ {
+		cur, err := s.stateRepo.GetState(ctx, key)
+		if err != nil {
+			return fmt.Errorf("load state: %w", err)
+		}
+		st.Revision = 0
+		if cur != nil {
+			st.Revision = cur.Revision
+		}
+
+		err = s.stateRepo.SaveState(ctx, key, st)
+		if err == nil || !errors.Is(err, ErrStateConflict) || attempt >= maxStateRetries {
+			return err
+		}
+		BanditStateConflictsTotal.Inc()
+	}
+}
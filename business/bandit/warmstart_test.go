@@ -0,0 +1,139 @@
+//go:build !integration
+
+package bandit
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+)
+
+// logRepo keeps the persisted events for replay.
+type logRepo struct {
+	events []domain.BanditEvent
+}
+
+func (r *logRepo) SaveEvent(_ context.Context, ev domain.BanditEvent) error {
+	r.events = append(r.events, ev)
+	return nil
+}
+
+func (r *logRepo) ListEvents(_ context.Context, slot string, from, to time.Time) ([]domain.BanditEvent, error) {
+	var out []domain.BanditEvent
+	for _, ev := range r.events {
+		if ev.Slot == slot && !ev.CreatedAt.Before(from) && ev.CreatedAt.Before(to) {
+			out = append(out, ev)
+		}
+	}
+	return out, nil
+}
+
+// Rebuilding from the event log must learn the same global states as the
+// live feedback that wrote the log.
+func TestRebuildMatchesLiveFeedback(t *testing.T) {
+	logger.Init("test")
+	ctx := context.Background()
+	cfg := DefaultConfig()
+
+	events := &logRepo{}
+	live := newMemStateRepo()
+	svc := NewBanditService(events, nil, live, nil, nil, nil, nil, nil, cfg)
+
+	start := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	types := []string{"impression", "click", "atc", "order"}
+	for i := 0; i < 200; i++ {
+		ev := domain.BanditEvent{
+			UserID:    uint(i%7 + 1),
+			Slot:      "home_top",
+			ProductID: uint64(i%5 + 1),
+			EventType: types[i%len(types)],
+			CreatedAt: start.Add(time.Duration(i) * 10 * time.Minute),
+		}
+		if ev.EventType == "order" {
+			ev.Value = 25
+		}
+		if err := svc.LogFeedback(ctx, ev); err != nil {
+			t.Fatalf("LogFeedback: %v", err)
+		}
+	}
+
+	rebuilt := newMemStateRepo()
+	rsvc := NewBanditService(events, nil, rebuilt, nil, nil, nil, nil, nil, cfg)
+	report, err := NewStateWarmStarter(rsvc, events, nil).Rebuild(ctx, domain.StateRebuildRequest{
+		Slot: "home_top",
+		From: start,
+		To:   start.Add(48 * time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Rebuild: %v", err)
+	}
+	if report.Events != 200 || report.Skipped != 0 || report.GlobalStates == 0 {
+		t.Fatalf("report = %+v", report)
+	}
+
+	for key := range live.rows {
+		if !strings.HasSuffix(key, "|global") {
+			continue
+		}
+		want, _ := live.GetState(ctx, key)
+		got, _ := rebuilt.GetState(ctx, key)
+		if got == nil {
+			t.Fatalf("%s: not rebuilt", key)
+		}
+		for pid, w := range want.Arms {
+			g, ok := got.Arms[pid]
+			if !ok || g.Count != w.Count {
+				t.Fatalf("%s arm %d: rebuilt %+v, live count %d", key, pid, g, w.Count)
+			}
+			for i := range w.Theta {
+				if math.Abs(g.Theta[i]-w.Theta[i]) > 1e-9 {
+					t.Fatalf("%s arm %d θ[%d] = %v, live %v", key, pid, i, g.Theta[i], w.Theta[i])
+				}
+			}
+		}
+	}
+}
+
+// An imported state whose hybrid parts do not match its feature layout
+// would panic the first request that scores it.
+func TestValidateImportedState_Hybrid(t *testing.T) {
+	dims := pipelineFor(DefaultConfig()).dims
+	d, k := len(dims), len(dims)*productCrossDim
+
+	build := func() *LinUCBState {
+		st := newDefaultState(dims)
+		arm := newArmState(d)
+		arm.BZ = make([][]float64, d)
+		for i := range arm.BZ {
+			arm.BZ[i] = make([]float64, k)
+		}
+		st.Arms[1] = arm
+		st.Hybrid = newHybridState(k)
+		return st
+	}
+
+	if err := validateImportedState(build()); err != nil {
+		t.Fatalf("valid state rejected: %v", err)
+	}
+
+	cases := map[string]func(st *LinUCBState){
+		"B_z rows":   func(st *LinUCBState) { st.Arms[1].BZ = st.Arms[1].BZ[1:] },
+		"B_z cols":   func(st *LinUCBState) { st.Arms[1].BZ[2] = make([]float64, k-1) },
+		"A0 size":    func(st *LinUCBState) { st.Hybrid = newHybridState(k + 1) },
+		"A0 row":     func(st *LinUCBState) { st.Hybrid.A0[3] = make([]float64, 2) },
+		"b0 size":    func(st *LinUCBState) { st.Hybrid.B0 = st.Hybrid.B0[1:] },
+		"A0 inverse": func(st *LinUCBState) { st.Hybrid.A0Inv[0] = nil },
+	}
+	for name, breakIt := range cases {
+		st := build()
+		breakIt(st)
+		if err := validateImportedState(st); err == nil {
+			t.Errorf("%s: misshapen state accepted", name)
+		}
+	}
+}
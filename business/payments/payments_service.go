@@ -9,6 +9,7 @@ import (
 	"myGreenMarket/domain"
 	"myGreenMarket/internal/repository/xendit"
 	"myGreenMarket/internal/rest"
+	"myGreenMarket/pkg/logger"
 	"strconv"
 	"strings"
 	"time"
@@ -23,21 +24,40 @@ type PaymentsRepository interface {
 	GetPaymentByOrderID(order_id int) (domain.Payments, error)
 }
 
+// OrderAttributor credits a paid order back to the recommendations that led to it.
+type OrderAttributor interface {
+	AttributeOrder(ctx context.Context, order domain.Orders) error
+}
+
 type PaymentsService struct {
 	paymentRepo PaymentsRepository
 	xenditRepo  *xendit.XenditRepository
 	userRepo    user.UserRepository
 	orderRepo   orders.OrdersRepository
 	productRepo product.ProductRepository
+	attributor  OrderAttributor
 }
 
-func NewPaymentsService(paymentRepo PaymentsRepository, xenditRepo *xendit.XenditRepository, userRepo user.UserRepository, orderRepo orders.OrdersRepository, productRepo product.ProductRepository) *PaymentsService {
+func NewPaymentsService(paymentRepo PaymentsRepository, xenditRepo *xendit.XenditRepository, userRepo user.UserRepository, orderRepo orders.OrdersRepository, productRepo product.ProductRepository, attributor OrderAttributor) *PaymentsService {
 	return &PaymentsService{
 		paymentRepo: paymentRepo,
 		xenditRepo:  xenditRepo,
 		userRepo:    userRepo,
 		orderRepo:   orderRepo,
 		productRepo: productRepo,
+		attributor:  attributor,
+	}
+}
+
+// attributeOrder feeds a freshly paid order to the bandit. Attribution is
+// best-effort and never fails the payment; the attributor bounds how long it
+// takes, and queues the rewards when feedback ingestion is asynchronous.
+func (s *PaymentsService) attributeOrder(order domain.Orders) {
+	if s.attributor == nil {
+		return
+	}
+	if err := s.attributor.AttributeOrder(context.Background(), order); err != nil {
+		logger.Warn("Failed to attribute paid order", "order_id", order.ID, "error", err)
 	}
 }
 
@@ -104,6 +124,8 @@ func (s *PaymentsService) CreatePayment(data domain.Payments, isWallet bool, use
 			return domain.PaymentWithLink{}, err
 		}
 
+		s.attributeOrder(order)
+
 		return domain.PaymentWithLink{
 			ID:            payment.ID,
 			UserID:        payment.UserID,
@@ -236,6 +258,9 @@ func (s *PaymentsService) ReceivePaymentWebhook(request rest.WebhookRequest) err
 			}
 
 			errUpdate = s.paymentRepo.UpdatePayment(payment)
+			if errUpdate == nil {
+				s.attributeOrder(order)
+			}
 		case "EXPIRED":
 			order.OrderStatus = "PENDING"
 			order.UpdatedAt = time.Now()
@@ -24,6 +24,21 @@ type BanditRecommendation struct {
 	Score     float64 `json:"score"`
 }
 
+// PageSlot asks for one slate of a page. When several slots would show a
+// product, the slot with the highest Priority keeps it; ties go to the
+// slot listed first.
+type PageSlot struct {
+	Slot     string `json:"slot"`
+	N        int    `json:"n"`
+	Priority int    `json:"priority"`
+}
+
+// PageRecommendation is the slate served to one slot of a page.
+type PageRecommendation struct {
+	Slot  string                 `json:"slot"`
+	Items []BanditRecommendation `json:"items"`
+}
+
 type UserBanditSegment struct {
 	UserID    uint      `gorm:"column:user_id;primaryKey"`
 	Segment   int       `gorm:"column:segment;not null"`
@@ -8,6 +8,7 @@ type BanditFeatureFlags struct {
 	UseSegment     bool `json:"use_segment"`
 	UseProductHash bool `json:"use_product_hash"`
 	UseUserHash    bool `json:"use_user_hash"`
+	UseSharedArm   bool `json:"use_shared_arm"`
 }
 
 type BanditConfig struct {
@@ -28,9 +29,84 @@ type BanditConfig struct {
 	RewardATC        float64 `json:"reward_atc" gorm:"column:reward_atc"`
 	RewardOrder      float64 `json:"reward_order" gorm:"column:reward_order"`
 
+	// ALTER TABLE public.bandit_config ADD COLUMN reward_dismiss DOUBLE PRECISION NOT NULL DEFAULT -1;
+	RewardDismiss float64 `json:"reward_dismiss" gorm:"column:reward_dismiss"`
+
 	NumSegments int `json:"num_segments" gorm:"column:num_segments"`
 	NumVariants int `json:"num_variants" gorm:"column:num_variants"`
 
 	FeaturesRaw []byte             `json:"-" gorm:"column:features"`
 	Features    BanditFeatureFlags `json:"features" gorm:"-"`
+
+	// ALTER TABLE public.bandit_config ADD COLUMN feature_list JSONB;
+	FeatureListRaw []byte   `json:"-" gorm:"column:feature_list"`
+	FeatureList    []string `json:"feature_list" gorm:"-"`
+
+	// ALTER TABLE public.bandit_config ADD COLUMN policy TEXT, ADD COLUMN policy_params JSONB;
+	Policy          string             `json:"policy" gorm:"column:policy"`
+	PolicyParamsRaw []byte             `json:"-" gorm:"column:policy_params"`
+	PolicyParams    map[string]float64 `json:"policy_params" gorm:"-"`
+
+	// ALTER TABLE public.bandit_config ADD COLUMN rerank JSONB;
+	RerankRaw []byte             `json:"-" gorm:"column:rerank"`
+	Rerank    []BanditRerankStep `json:"rerank" gorm:"-"`
+
+	// ALTER TABLE public.bandit_config ADD COLUMN reward_model JSONB;
+	RewardModelRaw []byte            `json:"-" gorm:"column:reward_model"`
+	RewardModel    BanditRewardModel `json:"reward_model" gorm:"-"`
+
+	// ALTER TABLE public.bandit_config ADD COLUMN fatigue JSONB;
+	FatigueRaw []byte        `json:"-" gorm:"column:fatigue"`
+	Fatigue    BanditFatigue `json:"fatigue" gorm:"-"`
+}
+
+// BanditRerankStep is one re-ranking stage applied to a scored slate, by
+// registered strategy name. Steps run in order.
+type BanditRerankStep struct {
+	Strategy string             `json:"strategy"`
+	Params   map[string]float64 `json:"params,omitempty"`
+}
+
+// BanditFatigue limits how often a slot shows a user the same product,
+// counting the user's impressions of it over a sliding window, and how long
+// it keeps a product the user dismissed in the slot out. The zero value
+// disables it.
+type BanditFatigue struct {
+	WindowSeconds  int     `json:"window_seconds"`
+	MaxImpressions int     `json:"max_impressions,omitempty"` // products shown this often are left out; 0 = no cap
+	Penalty        float64 `json:"penalty,omitempty"`         // subtracted from the final score per impression
+	DismissSeconds int     `json:"dismiss_seconds,omitempty"` // products dismissed in the slot this recently are left out; 0 = off
+}
+
+func (f BanditFatigue) Enabled() bool {
+	return f.WindowSeconds > 0 && (f.MaxImpressions > 0 || f.Penalty > 0)
+}
+
+const (
+	RewardValueLinear = "linear" // value as sent (GMV)
+	RewardValueLog    = "log"    // log(1 + value), damping large baskets
+	RewardValueCapped = "capped" // value, at most Cap
+	RewardValueMargin = "margin" // the event's "margin" context value, else value × MarginRate
+)
+
+// BanditRewardModel maps feedback event types to rewards. Event types
+// without a rule keep the flat reward_* columns and value_weight.
+type BanditRewardModel struct {
+	Events map[string]BanditRewardRule `json:"events,omitempty"`
+}
+
+// BanditRewardRule scores one event type:
+//
+//	reward = (Base + ValueWeight × transform(value)) × 0.5^(delay / HalfLife)
+//
+// where delay is the time from the attributed touch to the event; events
+// without one get full credit. Only attributed order events have a touch,
+// so HalfLife is accepted for "order" only. Base may be negative.
+type BanditRewardRule struct {
+	Base            float64 `json:"base"`
+	ValueWeight     float64 `json:"value_weight,omitempty"`
+	Transform       string  `json:"transform,omitempty"` // RewardValueLinear when empty
+	Cap             float64 `json:"cap,omitempty"`
+	MarginRate      float64 `json:"margin_rate,omitempty"`
+	HalfLifeSeconds int     `json:"half_life_seconds,omitempty"`
 }
@@ -9,8 +9,22 @@ type DebugRecommendation struct {
 	BanditUCB         float64 `json:"bandit_ucb"`         // mean + α·uncertainty
 	FinalScore        float64 `json:"final_score"`        // wBandit*UCB + wOffline*offline_norm
 
+	// 0-based slate position by final score and after re-ranking; -1 when
+	// the product is not in that slate
+	RankBeforeRerank int `json:"rank_before_rerank"`
+	RankAfterRerank  int `json:"rank_after_rerank"`
+
 	Features []float64      `json:"features,omitempty"` // raw feature vector
 	Context  map[string]any `json:"context,omitempty"`  // time_bucket, dow, platform, dll
 	Segment  int            `json:"segment"`            // which segment used
 	Variant  int            `json:"variant"`            // which variant used
+
+	Policy        string             `json:"policy"`                   // scoring policy name
+	GlobalExplain map[string]float64 `json:"global_explain,omitempty"` // policy breakdown, global arm
+	UserExplain   map[string]float64 `json:"user_explain,omitempty"`   // policy breakdown, user arm
+
+	MerchRules []uint `json:"merch_rules,omitempty"` // IDs of the merchandising rules acting on the product
+	Exposures  int    `json:"exposures,omitempty"`   // user's impressions of the product in the slot's fatigue window
+
+	Rewards map[string]float64 `json:"rewards,omitempty"` // reward per event type, valued at the product's sale price
 }
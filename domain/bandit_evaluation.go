@@ -0,0 +1,46 @@
+package domain
+
+import "time"
+
+// OffPolicyEvalRequest asks for counterfactual estimates of one or more
+// candidate configs replayed over the logged impressions and bandit_events
+// of a slot.
+type OffPolicyEvalRequest struct {
+	Slot       string         `json:"slot"`
+	From       time.Time      `json:"from"`
+	To         time.Time      `json:"to"`
+	Candidates []BanditConfig `json:"candidates"`
+
+	SlateSize int     `json:"slate_size"` // top-N shown per request, default 10
+	MaxWeight float64 `json:"max_weight"` // importance weight clipping, default 20
+}
+
+type OffPolicyEstimate struct {
+	Estimator string  `json:"estimator"` // ips | snips | dr
+	Value     float64 `json:"value"`     // estimated reward per served item
+	CILow     float64 `json:"ci_low"`    // 95% confidence interval
+	CIHigh    float64 `json:"ci_high"`
+}
+
+type OffPolicyCandidateResult struct {
+	Slot                string              `json:"slot"`
+	Variant             int                 `json:"variant"`
+	Policy              string              `json:"policy"`
+	EffectiveSampleSize float64             `json:"effective_sample_size"` // (Σw)² / Σw²
+	Estimates           []OffPolicyEstimate `json:"estimates"`
+}
+
+type OffPolicyEvalReport struct {
+	Slot         string                     `json:"slot"`
+	From         time.Time                  `json:"from"`
+	To           time.Time                  `json:"to"`
+	Impressions  int                        `json:"impressions"`   // served slates replayed
+	Samples      int                        `json:"samples"`       // served items: one estimate term each
+	Events       int                        `json:"events"`        // events learned from
+	LoggedReward float64                    `json:"logged_reward"` // on-policy mean reward per served item
+	Candidates   []OffPolicyCandidateResult `json:"candidates"`
+
+	// events joined to the served item they reward; the others are only
+	// learned from
+	MatchedEvents int `json:"matched_events"`
+}
@@ -0,0 +1,91 @@
+package domain
+
+import "time"
+
+const (
+	ExperimentRunning = "running"
+	ExperimentStopped = "stopped"
+
+	AssignmentTreatment = "treatment"
+	AssignmentHoldout   = "holdout"
+)
+
+// CREATE TABLE public.bandit_experiments (
+//     id              BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+//     slot            TEXT NOT NULL,
+//     name            TEXT NOT NULL,
+//     salt            TEXT NOT NULL,
+//     status          TEXT NOT NULL,
+//     control_variant INT NOT NULL DEFAULT 0,
+//     holdout_pct     DOUBLE PRECISION NOT NULL DEFAULT 0,
+//     arms            JSONB NOT NULL,
+//     ramp            JSONB,
+//     created_at      TIMESTAMPTZ DEFAULT NOW(),
+//     updated_at      TIMESTAMPTZ DEFAULT NOW(),
+//     stopped_at      TIMESTAMPTZ
+// );
+// CREATE INDEX ON public.bandit_experiments (slot, created_at);
+
+// BanditExperiment splits a slot's traffic across config variants.
+//
+// Users are hashed with the experiment's salt into a holdout group, which
+// always gets the control variant, and an exposure position; users whose
+// position is under the current ramp percentage enter the experiment and
+// are bucketed across Arms by weight. Holdout and treatment assignments are
+// stored, so users keep their bucket when weights or the ramp change.
+// A stopped experiment sends all of the slot's traffic to ControlVariant.
+type BanditExperiment struct {
+	ID             uint            `gorm:"primaryKey" json:"id"`
+	Slot           string          `gorm:"column:slot;not null" json:"slot"`
+	Name           string          `gorm:"column:name;not null" json:"name"`
+	Salt           string          `gorm:"column:salt;not null" json:"salt"`
+	Status         string          `gorm:"column:status;not null" json:"status"`
+	ControlVariant int             `gorm:"column:control_variant;not null" json:"control_variant"`
+	HoldoutPct     float64         `gorm:"column:holdout_pct;not null" json:"holdout_pct"` // 0-100
+	Arms           []ExperimentArm `gorm:"column:arms;type:jsonb;serializer:json" json:"arms"`
+	Ramp           []RampStep      `gorm:"column:ramp;type:jsonb;serializer:json" json:"ramp"`
+	CreatedAt      time.Time       `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time       `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+	StoppedAt      *time.Time      `gorm:"column:stopped_at" json:"stopped_at,omitempty"`
+}
+
+func (BanditExperiment) TableName() string {
+	return "bandit_experiments"
+}
+
+// ExperimentArm is one variant of an experiment and its share of exposed
+// traffic; weights are relative.
+type ExperimentArm struct {
+	Variant int     `json:"variant"`
+	Weight  float64 `json:"weight"`
+}
+
+// RampStep exposes Pct percent of non-holdout traffic from At onwards.
+type RampStep struct {
+	At  time.Time `json:"at"`
+	Pct float64   `json:"pct"`
+}
+
+// CREATE TABLE public.bandit_assignments (
+//     experiment_id BIGINT NOT NULL,
+//     user_id       BIGINT NOT NULL,
+//     slot          TEXT NOT NULL,
+//     variant       INT NOT NULL,
+//     bucket        TEXT NOT NULL,
+//     created_at    TIMESTAMPTZ DEFAULT NOW(),
+//     PRIMARY KEY (experiment_id, user_id)
+// );
+
+// BanditAssignment is a user's sticky bucket in an experiment.
+type BanditAssignment struct {
+	ExperimentID uint      `gorm:"column:experiment_id;primaryKey" json:"experiment_id"`
+	UserID       uint      `gorm:"column:user_id;primaryKey" json:"user_id"`
+	Slot         string    `gorm:"column:slot;not null" json:"slot"`
+	Variant      int       `gorm:"column:variant;not null" json:"variant"`
+	Bucket       string    `gorm:"column:bucket;not null" json:"bucket"` // AssignmentTreatment | AssignmentHoldout
+	CreatedAt    time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+func (BanditAssignment) TableName() string {
+	return "bandit_assignments"
+}
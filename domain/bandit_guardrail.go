@@ -0,0 +1,32 @@
+package domain
+
+import "time"
+
+// CREATE TABLE public.bandit_variant_overrides (
+//     id         BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+//     slot       TEXT NOT NULL,
+//     variant    INT NOT NULL,
+//     route_to   INT NOT NULL,
+//     metric     TEXT NOT NULL,
+//     reason     TEXT NOT NULL,
+//     created_at TIMESTAMPTZ DEFAULT NOW(),
+//     cleared_at TIMESTAMPTZ
+// );
+// CREATE UNIQUE INDEX ON public.bandit_variant_overrides (slot, variant) WHERE cleared_at IS NULL;
+
+// BanditVariantOverride pauses a variant of a slot: its users are served
+// RouteTo instead until the override is cleared.
+type BanditVariantOverride struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	Slot      string     `gorm:"column:slot;not null" json:"slot"`
+	Variant   int        `gorm:"column:variant;not null" json:"variant"`
+	RouteTo   int        `gorm:"column:route_to;not null" json:"route_to"`
+	Metric    string     `gorm:"column:metric;not null" json:"metric"`
+	Reason    string     `gorm:"column:reason;not null" json:"reason"`
+	CreatedAt time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	ClearedAt *time.Time `gorm:"column:cleared_at" json:"cleared_at,omitempty"`
+}
+
+func (BanditVariantOverride) TableName() string {
+	return "bandit_variant_overrides"
+}
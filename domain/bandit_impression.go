@@ -0,0 +1,47 @@
+package domain
+
+import "time"
+
+// CREATE TABLE public.bandit_impressions (
+//     id          BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+//     trace_id    TEXT,
+//     user_id     BIGINT NOT NULL,
+//     slot        TEXT NOT NULL,
+//     segment     INT NOT NULL,
+//     variant     INT NOT NULL,
+//     config_hash TEXT NOT NULL,
+//     items       JSONB NOT NULL,
+//     created_at  TIMESTAMPTZ DEFAULT NOW()
+// );
+// CREATE INDEX ON public.bandit_impressions (user_id, slot, created_at);
+// CREATE INDEX ON public.bandit_impressions (slot, created_at);
+// -- the experiment variant the user was assigned; differs from variant
+// -- while the assigned one is paused. NULL on rows logged before it:
+// ALTER TABLE public.bandit_impressions ADD COLUMN assigned_variant INT;
+
+// RecommendationImpression records what one Recommend call served and how
+// likely the serving policy was to show each candidate.
+type RecommendationImpression struct {
+	ID              uint             `gorm:"primaryKey" json:"id"`
+	TraceID         string           `gorm:"column:trace_id" json:"trace_id"`
+	UserID          uint             `gorm:"column:user_id;not null" json:"user_id"`
+	Slot            string           `gorm:"column:slot;not null" json:"slot"`
+	Segment         int              `gorm:"column:segment;not null" json:"segment"`
+	Variant         int              `gorm:"column:variant;not null" json:"variant"` // served
+	AssignedVariant int              `gorm:"column:assigned_variant" json:"assigned_variant"`
+	ConfigHash      string           `gorm:"column:config_hash;not null" json:"config_hash"`
+	Items           []ImpressionItem `gorm:"column:items;type:jsonb;serializer:json" json:"items"`
+	CreatedAt       time.Time        `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+func (RecommendationImpression) TableName() string {
+	return "bandit_impressions"
+}
+
+// ImpressionItem is one scored candidate of an impression.
+type ImpressionItem struct {
+	ProductID  uint64  `json:"product_id"`
+	Position   int     `json:"position"`   // 0-based slate position, -1 when not shown
+	Score      float64 `json:"score"`      // final score used for ranking
+	Propensity float64 `json:"propensity"` // P(product in the top-N) under the serving policy
+}
@@ -0,0 +1,90 @@
+package domain
+
+import "time"
+
+const (
+	MerchRulePin   = "pin"   // serve ProductID at Position
+	MerchRuleBoost = "boost" // multiply the score of ProductID / CategoryID
+	MerchRuleBury  = "bury"  // rank ProductID / CategoryID below everything else
+	MerchRuleBlock = "block" // never serve ProductID / CategoryID
+
+	MerchRuleCreated = "create"
+	MerchRuleUpdated = "update"
+	MerchRuleDeleted = "delete"
+)
+
+// CREATE TABLE public.bandit_merch_rules (
+//     id          BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+//     slot        TEXT NOT NULL,
+//     segment     INT,
+//     campaign_id TEXT NOT NULL DEFAULT '',
+//     action      TEXT NOT NULL,
+//     product_id  BIGINT,
+//     category_id BIGINT,
+//     position    INT NOT NULL DEFAULT 0,
+//     multiplier  DOUBLE PRECISION NOT NULL DEFAULT 0,
+//     priority    INT NOT NULL DEFAULT 0,
+//     starts_at   TIMESTAMPTZ,
+//     ends_at     TIMESTAMPTZ,
+//     disabled    BOOLEAN NOT NULL DEFAULT FALSE,
+//     note        TEXT NOT NULL DEFAULT '',
+//     created_at  TIMESTAMPTZ DEFAULT NOW(),
+//     updated_at  TIMESTAMPTZ DEFAULT NOW()
+// );
+// CREATE INDEX ON public.bandit_merch_rules (slot);
+
+// BanditMerchRule is a merchandiser's override of what a slot serves.
+//
+// A rule targets one product or, except for pins, a whole category, and
+// applies to requests of its slot whose segment and campaign_id match
+// (nil / empty match everything) between StartsAt and EndsAt (nil is
+// open-ended). When pins compete for a position the higher Priority wins.
+type BanditMerchRule struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Slot       string     `gorm:"column:slot;not null" json:"slot"`
+	Segment    *int       `gorm:"column:segment" json:"segment,omitempty"`
+	CampaignID string     `gorm:"column:campaign_id;not null" json:"campaign_id,omitempty"`
+	Action     string     `gorm:"column:action;not null" json:"action"`
+	ProductID  *uint64    `gorm:"column:product_id" json:"product_id,omitempty"`
+	CategoryID *uint64    `gorm:"column:category_id" json:"category_id,omitempty"`
+	Position   int        `gorm:"column:position;not null" json:"position,omitempty"`     // pin: 1-based slate position
+	Multiplier float64    `gorm:"column:multiplier;not null" json:"multiplier,omitempty"` // boost: score multiplier
+	Priority   int        `gorm:"column:priority;not null" json:"priority"`
+	StartsAt   *time.Time `gorm:"column:starts_at" json:"starts_at,omitempty"`
+	EndsAt     *time.Time `gorm:"column:ends_at" json:"ends_at,omitempty"`
+	Disabled   bool       `gorm:"column:disabled;not null" json:"disabled"`
+	Note       string     `gorm:"column:note;not null" json:"note,omitempty"`
+	CreatedAt  time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+func (BanditMerchRule) TableName() string {
+	return "bandit_merch_rules"
+}
+
+// CREATE TABLE public.bandit_merch_rule_audit (
+//     id         BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+//     rule_id    BIGINT NOT NULL,
+//     change     TEXT NOT NULL,
+//     actor_id   BIGINT NOT NULL DEFAULT 0,
+//     before     JSONB,
+//     after      JSONB,
+//     created_at TIMESTAMPTZ DEFAULT NOW()
+// );
+// CREATE INDEX ON public.bandit_merch_rule_audit (rule_id, created_at);
+
+// BanditMerchRuleAudit records one change to a rule: who made it and the
+// rule before and after. Entries outlive deleted rules.
+type BanditMerchRuleAudit struct {
+	ID        uint             `gorm:"primaryKey" json:"id"`
+	RuleID    uint             `gorm:"column:rule_id;not null" json:"rule_id"`
+	Change    string           `gorm:"column:change;not null" json:"change"` // MerchRuleCreated | MerchRuleUpdated | MerchRuleDeleted
+	ActorID   uint             `gorm:"column:actor_id;not null" json:"actor_id"`
+	Before    *BanditMerchRule `gorm:"column:before;type:jsonb;serializer:json" json:"before,omitempty"`
+	After     *BanditMerchRule `gorm:"column:after;type:jsonb;serializer:json" json:"after,omitempty"`
+	CreatedAt time.Time        `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+func (BanditMerchRuleAudit) TableName() string {
+	return "bandit_merch_rule_audit"
+}
@@ -0,0 +1,63 @@
+package domain
+
+import "time"
+
+// MetricEstimate is a per-impression rate or mean with its 95% interval.
+type MetricEstimate struct {
+	Value  float64 `json:"value"`
+	CILow  float64 `json:"ci_low"`
+	CIHigh float64 `json:"ci_high"`
+}
+
+// MetricComparison compares one metric of a variant against control.
+type MetricComparison struct {
+	Lift            float64 `json:"lift"` // relative: (variant - control) / control
+	ZScore          float64 `json:"z_score"`
+	PValue          float64 `json:"p_value"` // two-sided
+	ProbBeatControl float64 `json:"prob_beat_control"`
+	Significant     bool    `json:"significant"` // p < 0.05
+}
+
+type VariantReport struct {
+	Variant     int   `json:"variant"`     // assigned
+	Impressions int64 `json:"impressions"` // served slates
+	Users       int64 `json:"users"`
+
+	// slates served by another variant while this one was paused
+	Rerouted int64 `json:"rerouted_impressions"`
+
+	Clicks  int64   `json:"clicks"`
+	ATCs    int64   `json:"atcs"`
+	Orders  int64   `json:"orders"`
+	Revenue float64 `json:"revenue"`
+
+	CTR                  MetricEstimate `json:"ctr"`
+	ATCRate              MetricEstimate `json:"atc_rate"`
+	ConversionRate       MetricEstimate `json:"conversion_rate"`
+	RevenuePerImpression MetricEstimate `json:"revenue_per_impression"`
+
+	// by metric name (ctr, atc_rate, conversion_rate, revenue_per_impression);
+	// empty for the control variant
+	VsControl map[string]MetricComparison `json:"vs_control,omitempty"`
+}
+
+// SampleRatioCheck tests whether traffic reached the variants in the
+// proportions it was allocated with.
+type SampleRatioCheck struct {
+	Source    string          `json:"source"` // assignments | impressions
+	Observed  map[int]int64   `json:"observed"`
+	Expected  map[int]float64 `json:"expected"`
+	ChiSquare float64         `json:"chi_square"`
+	PValue    float64         `json:"p_value"`
+	Mismatch  bool            `json:"mismatch"` // p < 0.001
+}
+
+type ExperimentReport struct {
+	Slot           string           `json:"slot"`
+	ExperimentID   *uint            `json:"experiment_id,omitempty"`
+	From           time.Time        `json:"from"`
+	To             time.Time        `json:"to"`
+	ControlVariant int              `json:"control_variant"`
+	Variants       []VariantReport  `json:"variants"`
+	SampleRatio    SampleRatioCheck `json:"sample_ratio"`
+}
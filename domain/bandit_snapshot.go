@@ -0,0 +1,80 @@
+package domain
+
+import "time"
+
+const (
+	SnapshotScheduled  = "scheduled"   // taken by the periodic snapshotter
+	SnapshotManual     = "manual"      // taken on demand by an admin
+	SnapshotPreRestore = "pre_restore" // the states a restore replaced
+)
+
+// CREATE TABLE public.bandit_state_snapshots (
+//     id          BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+//     slot        TEXT NOT NULL,
+//     config_hash TEXT NOT NULL DEFAULT '',
+//     reason      TEXT NOT NULL,
+//     actor_id    BIGINT NOT NULL DEFAULT 0,
+//     states      INT NOT NULL DEFAULT 0,
+//     note        TEXT NOT NULL DEFAULT '',
+//     created_at  TIMESTAMPTZ DEFAULT NOW()
+// );
+// CREATE INDEX ON public.bandit_state_snapshots (slot, created_at);
+//
+// CREATE TABLE public.bandit_state_snapshot_items (
+//     snapshot_id BIGINT NOT NULL REFERENCES public.bandit_state_snapshots (id) ON DELETE CASCADE,
+//     key         TEXT NOT NULL,
+//     state_json  JSONB NOT NULL,
+//     PRIMARY KEY (snapshot_id, key)
+// );
+
+// BanditStateSnapshot is a point-in-time copy of every bandit_state row of
+// a slot: its global and user states of all segments. ConfigHash identifies
+// the slot's control config when the copy was taken.
+type BanditStateSnapshot struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Slot       string    `gorm:"column:slot;not null" json:"slot"`
+	ConfigHash string    `gorm:"column:config_hash;not null" json:"config_hash"`
+	Reason     string    `gorm:"column:reason;not null" json:"reason"`
+	ActorID    uint      `gorm:"column:actor_id;not null" json:"actor_id,omitempty"`
+	States     int       `gorm:"column:states;not null" json:"states"`
+	Note       string    `gorm:"column:note;not null" json:"note,omitempty"`
+	CreatedAt  time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+func (BanditStateSnapshot) TableName() string {
+	return "bandit_state_snapshots"
+}
+
+// SnapshotDiff compares two snapshots of a slot, From before To. θ drift is
+// the Euclidean distance between an arm's coefficients in the two
+// snapshots, over the arms both have with the same feature layout.
+type SnapshotDiff struct {
+	FromID uint `json:"from_id"`
+	ToID   uint `json:"to_id"`
+
+	StatesAdded   int `json:"states_added"`
+	StatesRemoved int `json:"states_removed"`
+	StatesChanged int `json:"states_changed"`
+
+	ArmsFrom    int `json:"arms_from"`
+	ArmsTo      int `json:"arms_to"`
+	ArmsAdded   int `json:"arms_added"`
+	ArmsRemoved int `json:"arms_removed"`
+
+	MeanThetaDrift float64 `json:"mean_theta_drift"`
+	MaxThetaDrift  float64 `json:"max_theta_drift"`
+
+	// global states, one per segment; user states are only counted above
+	Global []StateDiff `json:"global"`
+}
+
+// StateDiff compares one state key across two snapshots.
+type StateDiff struct {
+	Key            string  `json:"key"`
+	ArmsFrom       int     `json:"arms_from"`
+	ArmsTo         int     `json:"arms_to"`
+	UpdatesFrom    int     `json:"updates_from"` // summed arm counts
+	UpdatesTo      int     `json:"updates_to"`
+	MeanThetaDrift float64 `json:"mean_theta_drift"`
+	MaxThetaDrift  float64 `json:"max_theta_drift"`
+}
@@ -0,0 +1,31 @@
+package domain
+
+import "time"
+
+// StateRebuildRequest asks for a slot's bandit states to be learned again
+// from its logged bandit_events, under the slot's current configs.
+type StateRebuildRequest struct {
+	Slot    string    `json:"slot"`
+	Segment *int      `json:"segment,omitempty"` // nil rebuilds every segment
+	From    time.Time `json:"from"`              // default 30 days before To
+	To      time.Time `json:"to"`                // default now
+
+	// rebuild the per-user states too, not only the global ones
+	IncludeUsers bool `json:"include_users"`
+
+	// replay without saving the rebuilt states
+	DryRun bool `json:"dry_run"`
+}
+
+type StateRebuildReport struct {
+	Slot    string    `json:"slot"`
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Events  int       `json:"events"`  // events learned from
+	Skipped int       `json:"skipped"` // events without a segment or with an unknown event type
+
+	GlobalStates int  `json:"global_states"`
+	UserStates   int  `json:"user_states"`
+	Arms         int  `json:"arms"`
+	Saved        bool `json:"saved"`
+}
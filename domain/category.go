@@ -9,10 +9,12 @@ import (
 //     product_category    TEXT NOT NULL,
 //     created_at          TIMESTAMPTZ DEFAULT NOW()
 // );
+// ALTER TABLE public.categories ADD COLUMN is_hidden BOOLEAN NOT NULL DEFAULT FALSE;
 
 type Category struct {
 	CategoryID      uint64    `gorm:"primaryKey;column:category_id;autoIncrement:true"`
 	ProductCategory string    `gorm:"column:product_category;type:text;not null"`
+	IsHidden        bool      `gorm:"column:is_hidden;default:false"`
 	CreatedAt       time.Time `gorm:"column:created_at;autoCreateTime"`
 }
 
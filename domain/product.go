@@ -18,21 +18,29 @@ import (
 //     quantity        NUMERIC,
 //     created_at      TIMESTAMPTZ DEFAULT NOW()
 // );
+// ALTER TABLE public.products ADD COLUMN is_hidden BOOLEAN NOT NULL DEFAULT FALSE;
+// ALTER TABLE public.products ADD COLUMN deleted_at TIMESTAMPTZ;
+// ALTER TABLE public.products ADD COLUMN cost_price NUMERIC NOT NULL DEFAULT 0;
+// ALTER TABLE public.products ADD COLUMN eco_score NUMERIC NOT NULL DEFAULT 0;
 
 type Product struct {
-	ID              uint64    `gorm:"primaryKey;autoIncrement"`
-	ProductID       uint64    `gorm:"column:product_id"`
-	ProductSKUID    uint64    `gorm:"column:product_skuid"`
-	CategoryID      uint64    `gorm:"column:category_id;default:0"`
-	IsGreenTag      bool      `gorm:"column:is_green_tag;default:false"`
-	ProductName     string    `gorm:"column:product_name;type:text"`
-	ProductCategory string    `gorm:"column:product_category;type:text"`
-	Unit            string    `gorm:"column:unit;type:text"`
-	NormalPrice     float64   `gorm:"column:normal_price;type:numeric"`
-	SalePrice       float64   `gorm:"column:sale_price;type:numeric"`
-	Discount        float64   `gorm:"column:discount;type:numeric"`
-	Quantity        float64   `gorm:"column:quantity;type:numeric"`
-	CreatedAt       time.Time `gorm:"column:created_at"`
+	ID              uint64     `gorm:"primaryKey;autoIncrement"`
+	ProductID       uint64     `gorm:"column:product_id"`
+	ProductSKUID    uint64     `gorm:"column:product_skuid"`
+	CategoryID      uint64     `gorm:"column:category_id;default:0"`
+	IsGreenTag      bool       `gorm:"column:is_green_tag;default:false"`
+	ProductName     string     `gorm:"column:product_name;type:text"`
+	ProductCategory string     `gorm:"column:product_category;type:text"`
+	Unit            string     `gorm:"column:unit;type:text"`
+	NormalPrice     float64    `gorm:"column:normal_price;type:numeric"`
+	SalePrice       float64    `gorm:"column:sale_price;type:numeric"`
+	Discount        float64    `gorm:"column:discount;type:numeric"`
+	Quantity        float64    `gorm:"column:quantity;type:numeric"`
+	CostPrice       float64    `gorm:"column:cost_price;type:numeric;default:0"`
+	EcoScore        float64    `gorm:"column:eco_score;type:numeric;default:0"`
+	IsHidden        bool       `gorm:"column:is_hidden;default:false"`
+	DeletedAt       *time.Time `gorm:"column:deleted_at"`
+	CreatedAt       time.Time  `gorm:"column:created_at"`
 }
 
 func (Product) TableName() string {
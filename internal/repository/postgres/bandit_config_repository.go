@@ -36,6 +36,21 @@ func (r *BanditConfigRepository) GetConfig(ctx context.Context, slot string, var
 	if len(cfg.FeaturesRaw) > 0 {
 		_ = json.Unmarshal(cfg.FeaturesRaw, &cfg.Features)
 	}
+	if len(cfg.FeatureListRaw) > 0 {
+		_ = json.Unmarshal(cfg.FeatureListRaw, &cfg.FeatureList)
+	}
+	if len(cfg.PolicyParamsRaw) > 0 {
+		_ = json.Unmarshal(cfg.PolicyParamsRaw, &cfg.PolicyParams)
+	}
+	if len(cfg.RerankRaw) > 0 {
+		_ = json.Unmarshal(cfg.RerankRaw, &cfg.Rerank)
+	}
+	if len(cfg.RewardModelRaw) > 0 {
+		_ = json.Unmarshal(cfg.RewardModelRaw, &cfg.RewardModel)
+	}
+	if len(cfg.FatigueRaw) > 0 {
+		_ = json.Unmarshal(cfg.FatigueRaw, &cfg.Fatigue)
+	}
 	return cfg, true, nil
 }
 
@@ -45,6 +60,26 @@ func (r *BanditConfigRepository) UpsertConfig(ctx context.Context, cfg domain.Ba
 		raw, _ := json.Marshal(cfg.Features)
 		cfg.FeaturesRaw = raw
 	}
+	if len(cfg.FeatureListRaw) == 0 && len(cfg.FeatureList) > 0 {
+		raw, _ := json.Marshal(cfg.FeatureList)
+		cfg.FeatureListRaw = raw
+	}
+	if len(cfg.PolicyParamsRaw) == 0 && len(cfg.PolicyParams) > 0 {
+		raw, _ := json.Marshal(cfg.PolicyParams)
+		cfg.PolicyParamsRaw = raw
+	}
+	if len(cfg.RerankRaw) == 0 && len(cfg.Rerank) > 0 {
+		raw, _ := json.Marshal(cfg.Rerank)
+		cfg.RerankRaw = raw
+	}
+	if len(cfg.RewardModelRaw) == 0 && len(cfg.RewardModel.Events) > 0 {
+		raw, _ := json.Marshal(cfg.RewardModel)
+		cfg.RewardModelRaw = raw
+	}
+	if len(cfg.FatigueRaw) == 0 && cfg.Fatigue != (domain.BanditFatigue{}) {
+		raw, _ := json.Marshal(cfg.Fatigue)
+		cfg.FatigueRaw = raw
+	}
 	return r.DB.WithContext(ctx).
 		Clauses(clause.OnConflict{
 			Columns: []clause.Column{{Name: "slot"}, {Name: "variant"}},
@@ -60,7 +95,14 @@ func (r *BanditConfigRepository) UpsertConfig(ctx context.Context, cfg domain.Ba
 				"reward_click",
 				"reward_atc",
 				"reward_order",
+				"reward_dismiss",
 				"features",
+				"feature_list",
+				"policy",
+				"policy_params",
+				"rerank",
+				"reward_model",
+				"fatigue",
 				"updated_at",
 			}),
 		}).
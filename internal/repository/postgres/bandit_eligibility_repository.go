@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"myGreenMarket/business/bandit"
+
+	"gorm.io/gorm"
+)
+
+type BanditEligibilityRepository struct {
+	DB *gorm.DB
+}
+
+var (
+	_ bandit.EligibilityRepository = (*BanditEligibilityRepository)(nil)
+	_ bandit.DismissalReader       = (*BanditEligibilityRepository)(nil)
+)
+
+func NewBanditEligibilityRepository(db *gorm.DB) *BanditEligibilityRepository {
+	return &BanditEligibilityRepository{DB: db}
+}
+
+func (r *BanditEligibilityRepository) AvailableProducts(ctx context.Context, ids []uint64) ([]uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var out []uint64
+	err := r.DB.WithContext(ctx).
+		Table("products AS p").
+		Joins("LEFT JOIN categories AS c ON c.category_id = p.category_id").
+		Where("p.id IN ?", ids).
+		Where("p.quantity > 0 AND p.deleted_at IS NULL AND NOT p.is_hidden").
+		Where("c.is_hidden IS NOT TRUE").
+		Pluck("p.id", &out).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to query products: %w", err)
+	}
+	return out, nil
+}
+
+// UserExclusions returns the products the user paid for since purchasedSince.
+func (r *BanditEligibilityRepository) UserExclusions(
+	ctx context.Context,
+	userID uint,
+	purchasedSince time.Time,
+) ([]uint64, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	var out []uint64
+	if err := r.DB.WithContext(ctx).
+		Table("orders").
+		Where("user_id = ? AND order_status = ? AND created_at >= ?", userID, "PAID", purchasedSince).
+		Distinct().
+		Pluck("product_id", &out).Error; err != nil {
+		return nil, fmt.Errorf("failed to query orders: %w", err)
+	}
+
+	return out, nil
+}
+
+func (r *BanditEligibilityRepository) Dismissed(ctx context.Context, userID uint, slot string, since time.Time) ([]uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	var out []uint64
+	if err := r.DB.WithContext(ctx).
+		Table("bandit_events").
+		Where("user_id = ? AND slot = ? AND event_type = ? AND created_at >= ?", userID, slot, "dismiss", since).
+		Distinct().
+		Pluck("product_id", &out).Error; err != nil {
+		return nil, fmt.Errorf("failed to query bandit_events: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,178 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"myGreenMarket/business/bandit"
+	"myGreenMarket/domain"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type BanditExperimentRepository struct {
+	DB *gorm.DB
+}
+
+var (
+	_ bandit.ExperimentRepository = (*BanditExperimentRepository)(nil)
+	_ bandit.AssignmentCounter    = (*BanditExperimentRepository)(nil)
+)
+
+func NewBanditExperimentRepository(db *gorm.DB) *BanditExperimentRepository {
+	return &BanditExperimentRepository{DB: db}
+}
+
+func (r *BanditExperimentRepository) LatestExperiment(ctx context.Context, slot string) (domain.BanditExperiment, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.BanditExperiment{}, false, fmt.Errorf("context error: %w", err)
+	}
+
+	var exp domain.BanditExperiment
+	err := r.DB.WithContext(ctx).
+		Where("slot = ?", slot).
+		Order("created_at DESC, id DESC").
+		First(&exp).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return domain.BanditExperiment{}, false, nil
+	}
+	if err != nil {
+		return domain.BanditExperiment{}, false, fmt.Errorf("failed to query bandit_experiments: %w", err)
+	}
+	return exp, true, nil
+}
+
+func (r *BanditExperimentRepository) GetExperiment(ctx context.Context, id uint) (domain.BanditExperiment, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.BanditExperiment{}, false, fmt.Errorf("context error: %w", err)
+	}
+
+	var exp domain.BanditExperiment
+	err := r.DB.WithContext(ctx).First(&exp, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return domain.BanditExperiment{}, false, nil
+	}
+	if err != nil {
+		return domain.BanditExperiment{}, false, fmt.Errorf("failed to query bandit_experiments: %w", err)
+	}
+	return exp, true, nil
+}
+
+// ListExperiments returns the slot's experiments, or every experiment when
+// slot is empty, newest first.
+func (r *BanditExperimentRepository) ListExperiments(ctx context.Context, slot string) ([]domain.BanditExperiment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	q := r.DB.WithContext(ctx).Order("created_at DESC, id DESC")
+	if slot != "" {
+		q = q.Where("slot = ?", slot)
+	}
+
+	var exps []domain.BanditExperiment
+	if err := q.Find(&exps).Error; err != nil {
+		return nil, fmt.Errorf("failed to query bandit_experiments: %w", err)
+	}
+	return exps, nil
+}
+
+func (r *BanditExperimentRepository) CreateExperiment(ctx context.Context, exp *domain.BanditExperiment) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	if err := r.DB.WithContext(ctx).Create(exp).Error; err != nil {
+		return fmt.Errorf("failed to create bandit experiment: %w", err)
+	}
+	return nil
+}
+
+func (r *BanditExperimentRepository) UpdateExperiment(ctx context.Context, exp domain.BanditExperiment) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	err := r.DB.WithContext(ctx).
+		Model(&domain.BanditExperiment{}).
+		Where("id = ?", exp.ID).
+		Select("status", "control_variant", "arms", "ramp", "stopped_at", "updated_at").
+		Updates(&exp).Error
+	if err != nil {
+		return fmt.Errorf("failed to update bandit experiment: %w", err)
+	}
+	return nil
+}
+
+func (r *BanditExperimentRepository) GetAssignment(ctx context.Context, experimentID uint, userID uint) (domain.BanditAssignment, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.BanditAssignment{}, false, fmt.Errorf("context error: %w", err)
+	}
+
+	var a domain.BanditAssignment
+	err := r.DB.WithContext(ctx).
+		Where("experiment_id = ? AND user_id = ?", experimentID, userID).
+		First(&a).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return domain.BanditAssignment{}, false, nil
+	}
+	if err != nil {
+		return domain.BanditAssignment{}, false, fmt.Errorf("failed to query bandit_assignments: %w", err)
+	}
+	return a, true, nil
+}
+
+// CreateAssignment inserts the assignment unless one exists; concurrent
+// first requests of a user all read back the same winner.
+func (r *BanditExperimentRepository) CreateAssignment(ctx context.Context, a domain.BanditAssignment) (domain.BanditAssignment, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.BanditAssignment{}, fmt.Errorf("context error: %w", err)
+	}
+
+	res := r.DB.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&a)
+	if res.Error != nil {
+		return domain.BanditAssignment{}, fmt.Errorf("failed to save bandit assignment: %w", res.Error)
+	}
+	if res.RowsAffected == 1 {
+		return a, nil
+	}
+
+	stored, ok, err := r.GetAssignment(ctx, a.ExperimentID, a.UserID)
+	if err != nil {
+		return domain.BanditAssignment{}, err
+	}
+	if !ok {
+		return domain.BanditAssignment{}, fmt.Errorf("bandit assignment for user %d vanished", a.UserID)
+	}
+	return stored, nil
+}
+
+// AssignmentCounts counts the experiment's treatment assignments per variant.
+func (r *BanditExperimentRepository) AssignmentCounts(ctx context.Context, experimentID uint) (map[int]int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	var rows []struct {
+		Variant int
+		Users   int64
+	}
+	if err := r.DB.WithContext(ctx).
+		Model(&domain.BanditAssignment{}).
+		Select("variant, COUNT(*) AS users").
+		Where("experiment_id = ? AND bucket = ?", experimentID, domain.AssignmentTreatment).
+		Group("variant").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to count bandit_assignments: %w", err)
+	}
+
+	out := make(map[int]int64, len(rows))
+	for _, row := range rows {
+		out[row.Variant] = row.Users
+	}
+	return out, nil
+}
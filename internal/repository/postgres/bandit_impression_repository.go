@@ -0,0 +1,135 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"myGreenMarket/business/bandit"
+	"myGreenMarket/domain"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type BanditImpressionRepository struct {
+	DB *gorm.DB
+}
+
+var (
+	_ bandit.ImpressionRepository    = (*BanditImpressionRepository)(nil)
+	_ bandit.ImpressionLookup        = (*BanditImpressionRepository)(nil)
+	_ bandit.ImpressionStatsSource   = (*BanditImpressionRepository)(nil)
+	_ bandit.SlotLister              = (*BanditImpressionRepository)(nil)
+	_ bandit.ImpressionLogRepository = (*BanditImpressionRepository)(nil)
+)
+
+func NewBanditImpressionRepository(db *gorm.DB) *BanditImpressionRepository {
+	return &BanditImpressionRepository{DB: db}
+}
+
+func (r *BanditImpressionRepository) SaveImpression(ctx context.Context, imp domain.RecommendationImpression) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	if err := r.DB.WithContext(ctx).Create(&imp).Error; err != nil {
+		return fmt.Errorf("failed to save bandit impression: %w", err)
+	}
+
+	return nil
+}
+
+// ListRecentForProduct returns the user's impressions since `since` whose
+// candidate list contains the product, newest first.
+func (r *BanditImpressionRepository) ListRecentForProduct(
+	ctx context.Context,
+	userID uint,
+	productID uint64,
+	since time.Time,
+) ([]domain.RecommendationImpression, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	var imps []domain.RecommendationImpression
+	if err := r.DB.WithContext(ctx).
+		Where("user_id = ? AND created_at >= ?", userID, since).
+		Where("items @> ?::jsonb", fmt.Sprintf(`[{"product_id": %d}]`, productID)).
+		Order("created_at DESC").
+		Limit(100).
+		Find(&imps).Error; err != nil {
+		return nil, fmt.Errorf("failed to query bandit_impressions: %w", err)
+	}
+
+	return imps, nil
+}
+
+// ImpressionStats counts the slot's served slates and distinct users per
+// assigned variant in [from, to), and how many slates a paused variant's
+// users were served by another one.
+func (r *BanditImpressionRepository) ImpressionStats(
+	ctx context.Context,
+	slot string,
+	from, to time.Time,
+) ([]bandit.VariantImpressions, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	var rows []bandit.VariantImpressions
+	if err := r.DB.WithContext(ctx).
+		Model(&domain.RecommendationImpression{}).
+		Select(`COALESCE(assigned_variant, variant) AS variant,
+			COUNT(*) AS impressions,
+			COUNT(DISTINCT user_id) AS users,
+			COUNT(*) FILTER (WHERE variant <> COALESCE(assigned_variant, variant)) AS rerouted`).
+		Where("slot = ? AND created_at >= ? AND created_at < ?", slot, from, to).
+		Group("1").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to aggregate bandit_impressions: %w", err)
+	}
+
+	return rows, nil
+}
+
+// ActiveSlots lists the slots that served recommendations since `since`.
+func (r *BanditImpressionRepository) ActiveSlots(ctx context.Context, since time.Time) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	var slots []string
+	if err := r.DB.WithContext(ctx).
+		Model(&domain.RecommendationImpression{}).
+		Distinct("slot").
+		Where("created_at >= ?", since).
+		Order("slot").
+		Pluck("slot", &slots).Error; err != nil {
+		return nil, fmt.Errorf("failed to list bandit slots: %w", err)
+	}
+
+	return slots, nil
+}
+
+// ListImpressions returns the slot's impressions in [from, to), oldest first.
+func (r *BanditImpressionRepository) ListImpressions(
+	ctx context.Context,
+	slot string,
+	from, to time.Time,
+) ([]domain.RecommendationImpression, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	var imps []domain.RecommendationImpression
+	if err := r.DB.WithContext(ctx).
+		Where("slot = ? AND created_at >= ? AND created_at < ?", slot, from, to).
+		Order("created_at ASC").
+		Find(&imps).Error; err != nil {
+		return nil, fmt.Errorf("failed to query bandit_impressions: %w", err)
+	}
+
+	return imps, nil
+}
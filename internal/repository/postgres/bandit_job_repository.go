@@ -0,0 +1,43 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"myGreenMarket/business/bandit"
+
+	"gorm.io/gorm"
+)
+
+// CREATE TABLE public.bandit_job_runs (
+//     job         TEXT PRIMARY KEY,
+//     last_run_at TIMESTAMPTZ NOT NULL
+// );
+
+type BanditJobRepository struct {
+	DB *gorm.DB
+}
+
+var _ bandit.JobRunClaimer = (*BanditJobRepository)(nil)
+
+func NewBanditJobRepository(db *gorm.DB) *BanditJobRepository {
+	return &BanditJobRepository{DB: db}
+}
+
+// ClaimJobRun records a run of job unless one was recorded within the last
+// `every`. Times are the database's, so replicas' clocks do not matter.
+func (r *BanditJobRepository) ClaimJobRun(ctx context.Context, job string, every time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, fmt.Errorf("context error: %w", err)
+	}
+
+	res := r.DB.WithContext(ctx).Exec(`INSERT INTO bandit_job_runs (job, last_run_at) VALUES (?, NOW())
+		ON CONFLICT (job) DO UPDATE SET last_run_at = EXCLUDED.last_run_at
+		WHERE bandit_job_runs.last_run_at <= NOW() - ? * INTERVAL '1 second'`,
+		job, every.Seconds())
+	if res.Error != nil {
+		return false, fmt.Errorf("failed to claim bandit_job_runs: %w", res.Error)
+	}
+	return res.RowsAffected == 1, nil
+}
@@ -0,0 +1,143 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"myGreenMarket/business/bandit"
+	"myGreenMarket/domain"
+
+	"gorm.io/gorm"
+)
+
+type BanditMerchRuleRepository struct {
+	DB *gorm.DB
+}
+
+var _ bandit.MerchRuleRepository = (*BanditMerchRuleRepository)(nil)
+
+func NewBanditMerchRuleRepository(db *gorm.DB) *BanditMerchRuleRepository {
+	return &BanditMerchRuleRepository{DB: db}
+}
+
+// ListRules returns the slot's rules, or every rule when slot is empty.
+func (r *BanditMerchRuleRepository) ListRules(ctx context.Context, slot string) ([]domain.BanditMerchRule, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	q := r.DB.WithContext(ctx).Order("priority DESC, id ASC")
+	if slot != "" {
+		q = q.Where("slot = ?", slot)
+	}
+
+	var rules []domain.BanditMerchRule
+	if err := q.Find(&rules).Error; err != nil {
+		return nil, fmt.Errorf("failed to query bandit_merch_rules: %w", err)
+	}
+	return rules, nil
+}
+
+func (r *BanditMerchRuleRepository) GetRule(ctx context.Context, id uint) (domain.BanditMerchRule, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.BanditMerchRule{}, false, fmt.Errorf("context error: %w", err)
+	}
+
+	var rule domain.BanditMerchRule
+	err := r.DB.WithContext(ctx).First(&rule, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return domain.BanditMerchRule{}, false, nil
+	}
+	if err != nil {
+		return domain.BanditMerchRule{}, false, fmt.Errorf("failed to query bandit_merch_rules: %w", err)
+	}
+	return rule, true, nil
+}
+
+func (r *BanditMerchRuleRepository) CreateRule(ctx context.Context, rule *domain.BanditMerchRule, audit domain.BanditMerchRuleAudit) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(rule).Error; err != nil {
+			return fmt.Errorf("failed to create bandit merch rule: %w", err)
+		}
+
+		audit.RuleID = rule.ID
+		if audit.After != nil {
+			audit.After.ID = rule.ID
+			audit.After.CreatedAt = rule.CreatedAt
+			audit.After.UpdatedAt = rule.UpdatedAt
+		}
+		if err := tx.Create(&audit).Error; err != nil {
+			return fmt.Errorf("failed to save bandit merch rule audit: %w", err)
+		}
+		return nil
+	})
+}
+
+func (r *BanditMerchRuleRepository) UpdateRule(ctx context.Context, rule *domain.BanditMerchRule, audit domain.BanditMerchRuleAudit) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&domain.BanditMerchRule{}).
+			Where("id = ?", rule.ID).
+			Select(
+				"slot", "segment", "campaign_id", "action", "product_id", "category_id",
+				"position", "multiplier", "priority", "starts_at", "ends_at", "disabled",
+				"note", "updated_at",
+			).
+			Updates(rule)
+		if res.Error != nil {
+			return fmt.Errorf("failed to update bandit merch rule: %w", res.Error)
+		}
+		if res.RowsAffected == 0 {
+			return bandit.ErrMerchRuleNotFound
+		}
+
+		if err := tx.Create(&audit).Error; err != nil {
+			return fmt.Errorf("failed to save bandit merch rule audit: %w", err)
+		}
+		return nil
+	})
+}
+
+func (r *BanditMerchRuleRepository) DeleteRule(ctx context.Context, id uint, audit domain.BanditMerchRuleAudit) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Delete(&domain.BanditMerchRule{}, "id = ?", id)
+		if res.Error != nil {
+			return fmt.Errorf("failed to delete bandit merch rule: %w", res.Error)
+		}
+		if res.RowsAffected == 0 {
+			return bandit.ErrMerchRuleNotFound
+		}
+
+		if err := tx.Create(&audit).Error; err != nil {
+			return fmt.Errorf("failed to save bandit merch rule audit: %w", err)
+		}
+		return nil
+	})
+}
+
+func (r *BanditMerchRuleRepository) ListRuleAudit(ctx context.Context, ruleID uint) ([]domain.BanditMerchRuleAudit, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	var rows []domain.BanditMerchRuleAudit
+	if err := r.DB.WithContext(ctx).
+		Where("rule_id = ?", ruleID).
+		Order("created_at DESC, id DESC").
+		Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to query bandit_merch_rule_audit: %w", err)
+	}
+	return rows, nil
+}
@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"myGreenMarket/business/bandit"
+	"myGreenMarket/domain"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type BanditOverrideRepository struct {
+	DB *gorm.DB
+}
+
+var _ bandit.OverrideRepository = (*BanditOverrideRepository)(nil)
+
+func NewBanditOverrideRepository(db *gorm.DB) *BanditOverrideRepository {
+	return &BanditOverrideRepository{DB: db}
+}
+
+func (r *BanditOverrideRepository) ActiveOverrides(ctx context.Context) ([]domain.BanditVariantOverride, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	var rows []domain.BanditVariantOverride
+	if err := r.DB.WithContext(ctx).
+		Where("cleared_at IS NULL").
+		Order("created_at ASC").
+		Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to query bandit_variant_overrides: %w", err)
+	}
+	return rows, nil
+}
+
+// CreateOverride relies on the partial unique index on (slot, variant) of
+// active overrides, so concurrent monitors pause a variant once.
+func (r *BanditOverrideRepository) CreateOverride(ctx context.Context, o domain.BanditVariantOverride) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, fmt.Errorf("context error: %w", err)
+	}
+
+	res := r.DB.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&o)
+	if res.Error != nil {
+		return false, fmt.Errorf("failed to save bandit override: %w", res.Error)
+	}
+	return res.RowsAffected == 1, nil
+}
+
+func (r *BanditOverrideRepository) ClearOverride(ctx context.Context, slot string, variant int) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	if err := r.DB.WithContext(ctx).
+		Model(&domain.BanditVariantOverride{}).
+		Where("slot = ? AND variant = ? AND cleared_at IS NULL", slot, variant).
+		Update("cleared_at", time.Now()).Error; err != nil {
+		return fmt.Errorf("failed to clear bandit override: %w", err)
+	}
+	return nil
+}
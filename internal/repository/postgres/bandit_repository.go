@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"myGreenMarket/business/bandit"
 	"myGreenMarket/domain"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -15,6 +17,17 @@ type BanditRepository struct {
 	DB *gorm.DB
 }
 
+var (
+	_ bandit.EventLogRepository    = (*BanditRepository)(nil)
+	_ bandit.UserEventLookup       = (*BanditRepository)(nil)
+	_ bandit.BanditStateRepository = (*BanditRepository)(nil)
+	_ bandit.BatchEventRepository  = (*BanditRepository)(nil)
+	_ bandit.EventStatsSource      = (*BanditRepository)(nil)
+	_ bandit.SlotStateLister       = (*BanditRepository)(nil)
+	_ bandit.StateGCRepository     = (*BanditRepository)(nil)
+	_ bandit.AttributedOrderStore  = (*BanditRepository)(nil)
+)
+
 func NewBanditRepository(db *gorm.DB) *BanditRepository {
 	return &BanditRepository{DB: db}
 }
@@ -33,11 +46,150 @@ func (r *BanditRepository) SaveEvent(ctx context.Context, event domain.BanditEve
 	return nil
 }
 
+// SaveEvents inserts a batch of events in as few statements as possible.
+func (r *BanditRepository) SaveEvents(ctx context.Context, events []domain.BanditEvent) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	if err := r.DB.WithContext(ctx).CreateInBatches(&events, 500).Error; err != nil {
+		return fmt.Errorf("failed to save bandit events: %w", err)
+	}
+
+	return nil
+}
+
+// EventStats aggregates the slot's events in [from, to) by assigned variant
+// and event type. Variants and value live in the event context; events
+// logged before assigned_variant was recorded fall back to the served one.
+func (r *BanditRepository) EventStats(ctx context.Context, slot string, from, to time.Time) ([]bandit.VariantEventStats, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	var rows []bandit.VariantEventStats
+	if err := r.DB.WithContext(ctx).
+		Model(&domain.BanditEvent{}).
+		Select(`COALESCE((context->>'assigned_variant')::int, (context->>'variant')::int, 0) AS variant,
+			event_type,
+			COUNT(*) AS events,
+			COALESCE(SUM((context->>'value')::float8), 0) AS value_sum,
+			COALESCE(SUM(((context->>'value')::float8) ^ 2), 0) AS value_sq_sum`).
+		Where("slot = ? AND created_at >= ? AND created_at < ?", slot, from, to).
+		Group("1, event_type").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to aggregate bandit_events: %w", err)
+	}
+
+	return rows, nil
+}
+
+// ListEvents returns the slot's events in [from, to), oldest first.
+func (r *BanditRepository) ListEvents(ctx context.Context, slot string, from, to time.Time) ([]domain.BanditEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	var events []domain.BanditEvent
+	if err := r.DB.WithContext(ctx).
+		Where("slot = ? AND created_at >= ? AND created_at < ?", slot, from, to).
+		Order("created_at ASC, id ASC").
+		Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("failed to query bandit_events: %w", err)
+	}
+
+	return events, nil
+}
+
+// ListUserEvents returns a user's events on a product since `since`, newest first.
+func (r *BanditRepository) ListUserEvents(
+	ctx context.Context,
+	userID uint,
+	productID uint64,
+	since time.Time,
+	eventTypes []string,
+) ([]domain.BanditEvent, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	q := r.DB.WithContext(ctx).
+		Where("user_id = ? AND product_id = ? AND created_at >= ?", userID, productID, since)
+	if len(eventTypes) > 0 {
+		q = q.Where("event_type IN ?", eventTypes)
+	}
+
+	var events []domain.BanditEvent
+	if err := q.Order("created_at DESC").Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("failed to query bandit_events: %w", err)
+	}
+
+	return events, nil
+}
+
+// ---- Attributed orders ----
+
+// CREATE TABLE public.bandit_attributed_orders (
+//     order_id      BIGINT NOT NULL,
+//     slot          TEXT NOT NULL,
+//     attributed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+//     PRIMARY KEY (order_id, slot)
+// );
+// -- tables created with one claim per order; those rows keep slot '' and
+// -- still mark the whole order as attributed:
+// ALTER TABLE public.bandit_attributed_orders ADD COLUMN slot TEXT NOT NULL DEFAULT '';
+// ALTER TABLE public.bandit_attributed_orders DROP CONSTRAINT bandit_attributed_orders_pkey;
+// ALTER TABLE public.bandit_attributed_orders ADD PRIMARY KEY (order_id, slot);
+
+// MarkOrderAttributed claims the order's credit for a slot and reports
+// whether it was not claimed before.
+func (r *BanditRepository) MarkOrderAttributed(ctx context.Context, orderID int, slot string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, fmt.Errorf("context error: %w", err)
+	}
+
+	res := r.DB.WithContext(ctx).Exec(`INSERT INTO bandit_attributed_orders (order_id, slot, attributed_at)
+		SELECT ?, ?, ?
+		WHERE NOT EXISTS (SELECT 1 FROM bandit_attributed_orders WHERE order_id = ? AND slot = '')
+		ON CONFLICT (order_id, slot) DO NOTHING`,
+		orderID, slot, time.Now(), orderID)
+	if res.Error != nil {
+		return false, fmt.Errorf("failed to save bandit_attributed_orders: %w", res.Error)
+	}
+	return res.RowsAffected == 1, nil
+}
+
+// UnmarkOrderAttributed releases a slot's claim on the order.
+func (r *BanditRepository) UnmarkOrderAttributed(ctx context.Context, orderID int, slot string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	err := r.DB.WithContext(ctx).
+		Exec(`DELETE FROM bandit_attributed_orders WHERE order_id = ? AND slot = ?`, orderID, slot).
+		Error
+	if err != nil {
+		return fmt.Errorf("failed to delete bandit_attributed_orders: %w", err)
+	}
+	return nil
+}
+
 // ---- State ----
 
+// ALTER TABLE public.bandit_state ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
+// -- rows migrated while the default was 0:
+// UPDATE public.bandit_state SET version = 1 WHERE version = 0;
+// ALTER TABLE public.bandit_state ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+// CREATE INDEX ON public.bandit_state (updated_at);
 type banditStateRow struct {
-	Slot      string `gorm:"column:slot;primaryKey"`
-	StateJSON []byte `gorm:"column:state_json"`
+	Slot      string    `gorm:"column:slot;primaryKey"`
+	StateJSON []byte    `gorm:"column:state_json"`
+	Version   int64     `gorm:"column:version"`
+	UpdatedAt time.Time `gorm:"column:updated_at"`
 }
 
 func (banditStateRow) TableName() string {
@@ -62,10 +214,16 @@ func (r *BanditRepository) GetState(ctx context.Context, slot string) (*bandit.L
 	if err := json.Unmarshal(row.StateJSON, &state); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal state_json: %w", err)
 	}
+	state.Revision = row.Version
 
 	return &state, nil
 }
 
+// SaveState writes the state only if the row is still at state.Revision
+// (compare-and-swap); otherwise it returns bandit.ErrStateConflict. A state
+// with Revision 0 is inserted, and conflicts if the row already exists
+// unless the row is itself still at version 0 (rows from before versioning).
+// The write holds the slot's shared state lock, so it waits for a restore.
 func (r *BanditRepository) SaveState(ctx context.Context, slot string, state *bandit.LinUCBState) error {
 	if err := ctx.Err(); err != nil {
 		return fmt.Errorf("context error: %w", err)
@@ -76,19 +234,180 @@ func (r *BanditRepository) SaveState(ctx context.Context, slot string, state *ba
 		return fmt.Errorf("failed to marshal state: %w", err)
 	}
 
-	row := banditStateRow{
-		Slot:      slot,
-		StateJSON: raw,
+	var res *gorm.DB
+	err = r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockSlotStates(tx, strings.SplitN(slot, "|", 2)[0], false); err != nil {
+			return err
+		}
+		if state.Revision == 0 {
+			res = tx.Clauses(
+				clause.OnConflict{
+					Columns:   []clause.Column{{Name: "slot"}},
+					DoUpdates: clause.AssignmentColumns([]string{"state_json", "version", "updated_at"}),
+					Where: clause.Where{Exprs: []clause.Expression{
+						clause.Expr{SQL: "bandit_state.version = 0"},
+					}},
+				},
+			).Create(&banditStateRow{
+				Slot:      slot,
+				StateJSON: raw,
+				Version:   1,
+				UpdatedAt: time.Now(),
+			})
+		} else {
+			res = tx.
+				Model(&banditStateRow{}).
+				Where("slot = ? AND version = ?", slot, state.Revision).
+				Updates(map[string]any{
+					"state_json": raw,
+					"version":    gorm.Expr("version + 1"),
+					"updated_at": time.Now(),
+				})
+		}
+		if res.Error != nil {
+			return fmt.Errorf("failed to save bandit_state: %w", res.Error)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected == 0 {
+		return bandit.ErrStateConflict
+	}
+
+	state.Revision++
+	return nil
+}
+
+// ListStates returns the slot's global states and, with users, its user
+// states, by key.
+func (r *BanditRepository) ListStates(ctx context.Context, slot string, users bool) (map[string]*bandit.LinUCBState, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	q := r.DB.WithContext(ctx).Where("starts_with(slot, ?)", slot+"|")
+	if !users {
+		q = q.Where("slot LIKE ?", "%|global")
+	}
+
+	var rows []banditStateRow
+	if err := q.Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to query bandit_state: %w", err)
+	}
+
+	states := make(map[string]*bandit.LinUCBState, len(rows))
+	for _, row := range rows {
+		var st bandit.LinUCBState
+		if err := json.Unmarshal(row.StateJSON, &st); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal state_json of %s: %w", row.Slot, err)
+		}
+		states[row.Slot] = &st
+	}
+	return states, nil
+}
+
+// ---- State GC ----
+
+// user state keys look like "<slot>|seg=<n>|user=<id>"
+const userStateKeyPattern = "%|user=%"
+
+// DeleteIdleUserStates deletes the user states not saved since `before`.
+func (r *BanditRepository) DeleteIdleUserStates(ctx context.Context, before time.Time) (int64, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, 0, fmt.Errorf("context error: %w", err)
+	}
+
+	var res struct {
+		States int64
+		Bytes  int64
+	}
+	if err := r.DB.WithContext(ctx).Raw(`WITH deleted AS (
+			DELETE FROM bandit_state WHERE slot LIKE ? AND updated_at < ?
+			RETURNING octet_length(state_json) AS size
+		)
+		SELECT COUNT(*) AS states, COALESCE(SUM(size), 0) AS bytes FROM deleted`,
+		userStateKeyPattern, before).
+		Scan(&res).Error; err != nil {
+		return 0, 0, fmt.Errorf("failed to delete bandit_state: %w", err)
+	}
+	return res.States, res.Bytes, nil
+}
+
+// ListUserStates returns up to limit user states with keys after afterKey,
+// in key order.
+func (r *BanditRepository) ListUserStates(ctx context.Context, afterKey string, limit int) ([]bandit.StoredState, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	var rows []banditStateRow
+	if err := r.DB.WithContext(ctx).
+		Where("slot LIKE ? AND slot > ?", userStateKeyPattern, afterKey).
+		Order("slot ASC").
+		Limit(limit).
+		Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to query bandit_state: %w", err)
 	}
 
-	if err := r.DB.WithContext(ctx).Clauses(
-		clause.OnConflict{
-			Columns:   []clause.Column{{Name: "slot"}},
-			UpdateAll: true,
-		},
-	).Create(&row).Error; err != nil {
-		return fmt.Errorf("failed to upsert bandit_state: %w", err)
+	out := make([]bandit.StoredState, 0, len(rows))
+	for _, row := range rows {
+		var st bandit.LinUCBState
+		if err := json.Unmarshal(row.StateJSON, &st); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal state_json of %s: %w", row.Slot, err)
+		}
+		st.Revision = row.Version
+		out = append(out, bandit.StoredState{Key: row.Slot, State: &st, Bytes: len(row.StateJSON)})
 	}
+	return out, nil
+}
 
+// CompactState rewrites the state if it is still at state.Revision, like
+// SaveState, but keeps updated_at: compaction is not activity.
+func (r *BanditRepository) CompactState(ctx context.Context, key string, state *bandit.LinUCBState) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("context error: %w", err)
+	}
+
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal state: %w", err)
+	}
+
+	res := r.DB.WithContext(ctx).
+		Model(&banditStateRow{}).
+		Where("slot = ? AND version = ?", key, state.Revision).
+		Updates(map[string]any{
+			"state_json": raw,
+			"version":    gorm.Expr("version + 1"),
+		})
+	if res.Error != nil {
+		return 0, fmt.Errorf("failed to save bandit_state: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return 0, bandit.ErrStateConflict
+	}
+
+	state.Revision++
+	return len(raw), nil
+}
+
+// DeleteState deletes the state if it is still at revision; otherwise it
+// returns bandit.ErrStateConflict.
+func (r *BanditRepository) DeleteState(ctx context.Context, key string, revision int64) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	res := r.DB.WithContext(ctx).
+		Where("slot = ? AND version = ?", key, revision).
+		Delete(&banditStateRow{})
+	if res.Error != nil {
+		return fmt.Errorf("failed to delete bandit_state: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return bandit.ErrStateConflict
+	}
 	return nil
 }
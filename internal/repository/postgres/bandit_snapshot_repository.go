@@ -0,0 +1,207 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"myGreenMarket/business/bandit"
+	"myGreenMarket/domain"
+
+	"gorm.io/gorm"
+)
+
+type BanditSnapshotRepository struct {
+	DB *gorm.DB
+}
+
+var _ bandit.SnapshotRepository = (*BanditSnapshotRepository)(nil)
+
+func NewBanditSnapshotRepository(db *gorm.DB) *BanditSnapshotRepository {
+	return &BanditSnapshotRepository{DB: db}
+}
+
+type banditSnapshotItemRow struct {
+	SnapshotID uint   `gorm:"column:snapshot_id;primaryKey"`
+	Key        string `gorm:"column:key;primaryKey"`
+	StateJSON  []byte `gorm:"column:state_json"`
+}
+
+func (banditSnapshotItemRow) TableName() string {
+	return "bandit_state_snapshot_items"
+}
+
+// state keys of a slot all start with "<slot>|"
+func slotKeyPrefix(slot string) string {
+	return slot + "|"
+}
+
+// lockSlotStates takes a transaction-scoped advisory lock on the slot's
+// state keys: shared for a single save, exclusive for a restore. Unlike row
+// locks it also covers keys that do not exist yet.
+func lockSlotStates(tx *gorm.DB, slot string, exclusive bool) error {
+	fn := "pg_advisory_xact_lock_shared"
+	if exclusive {
+		fn = "pg_advisory_xact_lock"
+	}
+	if err := tx.Exec("SELECT "+fn+"(hashtext(?))", "bandit_state:"+slot).Error; err != nil {
+		return fmt.Errorf("failed to lock bandit_state: %w", err)
+	}
+	return nil
+}
+
+// createSnapshot inserts snap and copies the slot's states into it.
+func createSnapshot(tx *gorm.DB, snap *domain.BanditStateSnapshot) error {
+	if err := tx.Create(snap).Error; err != nil {
+		return fmt.Errorf("failed to create bandit state snapshot: %w", err)
+	}
+
+	res := tx.Exec(`INSERT INTO bandit_state_snapshot_items (snapshot_id, key, state_json)
+		SELECT ?, slot, state_json FROM bandit_state WHERE starts_with(slot, ?)`,
+		snap.ID, slotKeyPrefix(snap.Slot))
+	if res.Error != nil {
+		return fmt.Errorf("failed to copy bandit_state: %w", res.Error)
+	}
+
+	snap.States = int(res.RowsAffected)
+	if err := tx.Model(snap).Update("states", snap.States).Error; err != nil {
+		return fmt.Errorf("failed to update bandit state snapshot: %w", err)
+	}
+	return nil
+}
+
+func (r *BanditSnapshotRepository) CreateSnapshot(ctx context.Context, snap *domain.BanditStateSnapshot) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return createSnapshot(tx, snap)
+	})
+}
+
+func (r *BanditSnapshotRepository) ListSnapshots(ctx context.Context, slot string) ([]domain.BanditStateSnapshot, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	var snaps []domain.BanditStateSnapshot
+	if err := r.DB.WithContext(ctx).
+		Where("slot = ?", slot).
+		Order("created_at DESC, id DESC").
+		Find(&snaps).Error; err != nil {
+		return nil, fmt.Errorf("failed to query bandit_state_snapshots: %w", err)
+	}
+	return snaps, nil
+}
+
+func (r *BanditSnapshotRepository) GetSnapshot(ctx context.Context, id uint) (domain.BanditStateSnapshot, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.BanditStateSnapshot{}, false, fmt.Errorf("context error: %w", err)
+	}
+
+	var snap domain.BanditStateSnapshot
+	err := r.DB.WithContext(ctx).First(&snap, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return domain.BanditStateSnapshot{}, false, nil
+	}
+	if err != nil {
+		return domain.BanditStateSnapshot{}, false, fmt.Errorf("failed to query bandit_state_snapshots: %w", err)
+	}
+	return snap, true, nil
+}
+
+func (r *BanditSnapshotRepository) SnapshotStates(ctx context.Context, id uint) (map[string]*bandit.LinUCBState, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	var rows []banditSnapshotItemRow
+	if err := r.DB.WithContext(ctx).Where("snapshot_id = ?", id).Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to query bandit_state_snapshot_items: %w", err)
+	}
+
+	states := make(map[string]*bandit.LinUCBState, len(rows))
+	for _, row := range rows {
+		var st bandit.LinUCBState
+		if err := json.Unmarshal(row.StateJSON, &st); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal snapshot state %s: %w", row.Key, err)
+		}
+		states[row.Key] = &st
+	}
+	return states, nil
+}
+
+// RestoreSnapshot overwrites the states the snapshot has, bumping their
+// version, inserts the ones that no longer exist and deletes the slot's
+// states the snapshot does not have.
+func (r *BanditSnapshotRepository) RestoreSnapshot(ctx context.Context, id uint, backup *domain.BanditStateSnapshot) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	prefix := slotKeyPrefix(backup.Slot)
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// no feedback may save a state of the slot, existing or new,
+		// between the backup and the restore
+		if err := lockSlotStates(tx, backup.Slot, true); err != nil {
+			return err
+		}
+		if err := createSnapshot(tx, backup); err != nil {
+			return err
+		}
+
+		if err := tx.Exec(`UPDATE bandit_state AS s
+			SET state_json = i.state_json, version = s.version + 1, updated_at = NOW()
+			FROM bandit_state_snapshot_items AS i
+			WHERE i.snapshot_id = ? AND s.slot = i.key`, id).Error; err != nil {
+			return fmt.Errorf("failed to restore bandit_state: %w", err)
+		}
+		if err := tx.Exec(`INSERT INTO bandit_state (slot, state_json, version)
+			SELECT i.key, i.state_json, 1 FROM bandit_state_snapshot_items AS i
+			WHERE i.snapshot_id = ?
+			ON CONFLICT (slot) DO NOTHING`, id).Error; err != nil {
+			return fmt.Errorf("failed to restore bandit_state: %w", err)
+		}
+		if err := tx.Exec(`DELETE FROM bandit_state AS s
+			WHERE starts_with(s.slot, ?)
+			AND NOT EXISTS (SELECT 1 FROM bandit_state_snapshot_items AS i WHERE i.snapshot_id = ? AND i.key = s.slot)`,
+			prefix, id).Error; err != nil {
+			return fmt.Errorf("failed to restore bandit_state: %w", err)
+		}
+		return nil
+	})
+}
+
+func (r *BanditSnapshotRepository) PruneSnapshots(ctx context.Context, slot string, before time.Time, keep int) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("context error: %w", err)
+	}
+
+	res := r.DB.WithContext(ctx).Exec(`DELETE FROM bandit_state_snapshots
+		WHERE slot = ? AND created_at < ?
+		AND id NOT IN (
+			SELECT id FROM bandit_state_snapshots WHERE slot = ?
+			ORDER BY created_at DESC, id DESC LIMIT ?
+		)`, slot, before, slot, keep)
+	if res.Error != nil {
+		return 0, fmt.Errorf("failed to prune bandit_state_snapshots: %w", res.Error)
+	}
+	return res.RowsAffected, nil
+}
+
+func (r *BanditSnapshotRepository) StateSlots(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	var slots []string
+	if err := r.DB.WithContext(ctx).
+		Raw(`SELECT DISTINCT split_part(slot, '|', 1) FROM bandit_state`).
+		Scan(&slots).Error; err != nil {
+		return nil, fmt.Errorf("failed to query bandit_state: %w", err)
+	}
+	return slots, nil
+}
@@ -49,6 +49,25 @@ func (r *ProductRepository) FindByID(ctx context.Context, id uint64) (domain.Pro
 	return product, nil
 }
 
+// FindByIDs returns the products with the given primary keys; unknown IDs
+// are skipped.
+func (r *ProductRepository) FindByIDs(ctx context.Context, ids []uint64) ([]domain.Product, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+	if len(ids) == 0 {
+		return []domain.Product{}, nil
+	}
+
+	var products []domain.Product
+	err := r.DB.WithContext(ctx).Where("id IN ?", ids).Find(&products).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find products by ids: %w", err)
+	}
+
+	return products, nil
+}
+
 func (r *ProductRepository) FindAll(ctx context.Context) ([]domain.Product, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, fmt.Errorf("context error: %w", err)
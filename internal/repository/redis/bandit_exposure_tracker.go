@@ -0,0 +1,84 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"myGreenMarket/business/bandit"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// BanditExposureTracker is a bandit.ExposureTracker keeping one sorted set
+// per user and slot, "bandit:exposure:<slot>:<user_id>". Members are
+// "<product_id>:<unix_nano>" scored by impression time in milliseconds, so
+// a window is a score range. Keys expire one window after their last write.
+type BanditExposureTracker struct {
+	client *redis.Client
+}
+
+var _ bandit.ExposureTracker = (*BanditExposureTracker)(nil)
+
+func NewBanditExposureTracker(client *redis.Client) *BanditExposureTracker {
+	return &BanditExposureTracker{client: client}
+}
+
+func exposureKey(userID uint, slot string) string {
+	return fmt.Sprintf("bandit:exposure:%s:%d", slot, userID)
+}
+
+func (t *BanditExposureTracker) Exposures(ctx context.Context, userID uint, slot string, since time.Time) (map[uint64]int, error) {
+	members, err := t.client.ZRangeByScore(ctx, exposureKey(userID, slot), &redis.ZRangeBy{
+		Min: strconv.FormatInt(since.UnixMilli(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exposures: %w", err)
+	}
+
+	counts := make(map[uint64]int)
+	for _, m := range members {
+		pid, _, _ := strings.Cut(m, ":")
+		id, err := strconv.ParseUint(pid, 10, 64)
+		if err != nil {
+			continue
+		}
+		counts[id]++
+	}
+	return counts, nil
+}
+
+func (t *BanditExposureTracker) RecordExposures(
+	ctx context.Context,
+	userID uint,
+	slot string,
+	productIDs []uint64,
+	at time.Time,
+	window time.Duration,
+) error {
+
+	if len(productIDs) == 0 {
+		return nil
+	}
+
+	key := exposureKey(userID, slot)
+	members := make([]redis.Z, len(productIDs))
+	for i, id := range productIDs {
+		members[i] = redis.Z{
+			Score:  float64(at.UnixMilli()),
+			Member: fmt.Sprintf("%d:%d", id, at.UnixNano()),
+		}
+	}
+
+	pipe := t.client.TxPipeline()
+	pipe.ZAdd(ctx, key, members...)
+	pipe.ZRemRangeByScore(ctx, key, "-inf", "("+strconv.FormatInt(at.Add(-window).UnixMilli(), 10))
+	pipe.Expire(ctx, key, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to record exposures: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"myGreenMarket/business/bandit"
+	"myGreenMarket/domain"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// messages a consumer read but never acknowledged (crash, restart) are
+	// claimed by another consumer after this long
+	feedbackClaimIdle = 30 * time.Second
+
+	// a retried message waits feedbackRetryBase, doubled for every earlier
+	// attempt and capped at feedbackRetryMax, before it is read again
+	feedbackRetryBase = 2 * time.Second
+	feedbackRetryMax  = 5 * time.Minute
+)
+
+// promoteDueFeedback moves up to ARGV[2] retries due by ARGV[1] (unix ms)
+// from the delay set KEYS[2] back onto the stream KEYS[1], atomically so a
+// retry is neither lost nor promoted twice by concurrent readers.
+var promoteDueFeedback = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[2]))
+for _, member in ipairs(due) do
+	local m = cjson.decode(member)
+	redis.call('XADD', KEYS[1], '*', 'event', m.event, 'attempts', m.attempts, 'enqueued_at', m.enqueued_at, 'applied', m.applied)
+	redis.call('ZREM', KEYS[2], member)
+end
+return #due
+`)
+
+// BanditFeedbackQueue is a bandit.FeedbackQueue on a Redis stream read
+// through a consumer group. Acknowledged entries are deleted, so the stream
+// length is the backlog. Retries wait in the sorted set "<stream>:delayed",
+// scored by when they are due, and dead letters go to "<stream>:dead".
+type BanditFeedbackQueue struct {
+	client  *redis.Client
+	stream  string
+	delayed string
+	dead    string
+	group   string
+}
+
+// delayedFeedback is a retry waiting in the delay set.
+type delayedFeedback struct {
+	SourceID   string `json:"source_id"` // keeps members unique
+	Event      string `json:"event"`
+	Attempts   int    `json:"attempts,string"`
+	EnqueuedAt int64  `json:"enqueued_at,string"`
+	Applied    string `json:"applied"`
+}
+
+var _ bandit.FeedbackQueue = (*BanditFeedbackQueue)(nil)
+
+func NewBanditFeedbackQueue(client *redis.Client, stream, group string) *BanditFeedbackQueue {
+	return &BanditFeedbackQueue{
+		client:  client,
+		stream:  stream,
+		delayed: stream + ":delayed",
+		dead:    stream + ":dead",
+		group:   group,
+	}
+}
+
+// EnsureGroup creates the stream and consumer group if they do not exist.
+func (q *BanditFeedbackQueue) EnsureGroup(ctx context.Context) error {
+	err := q.client.XGroupCreateMkStream(ctx, q.stream, q.group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create feedback consumer group: %w", err)
+	}
+	return nil
+}
+
+func (q *BanditFeedbackQueue) Enqueue(ctx context.Context, event domain.BanditEvent) error {
+	return q.add(ctx, q.client, event, 0)
+}
+
+func (q *BanditFeedbackQueue) add(ctx context.Context, c redis.Cmdable, event domain.BanditEvent, attempts int) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal feedback event: %w", err)
+	}
+
+	err = c.XAdd(ctx, &redis.XAddArgs{
+		Stream: q.stream,
+		Values: map[string]any{
+			"event":       payload,
+			"attempts":    attempts,
+			"enqueued_at": time.Now().UnixMilli(),
+		},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to enqueue feedback event: %w", err)
+	}
+	return nil
+}
+
+func (q *BanditFeedbackQueue) Read(ctx context.Context, consumer string, count int, block time.Duration) ([]bandit.QueuedFeedback, error) {
+	err := promoteDueFeedback.Run(ctx, q.client, []string{q.stream, q.delayed},
+		time.Now().UnixMilli(), count).Err()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("failed to promote retried feedback: %w", err)
+	}
+
+	// stale deliveries first, so a crashed worker's batch is not lost
+	claimed, _, err := q.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   q.stream,
+		Group:    q.group,
+		Consumer: consumer,
+		MinIdle:  feedbackClaimIdle,
+		Start:    "0-0",
+		Count:    int64(count),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim pending feedback: %w", err)
+	}
+	if len(claimed) > 0 {
+		return decodeFeedback(claimed), nil
+	}
+
+	streams, err := q.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    q.group,
+		Consumer: consumer,
+		Streams:  []string{q.stream, ">"},
+		Count:    int64(count),
+		Block:    block,
+	}).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read feedback: %w", err)
+	}
+
+	out := make([]bandit.QueuedFeedback, 0)
+	for _, s := range streams {
+		out = append(out, decodeFeedback(s.Messages)...)
+	}
+	return out, nil
+}
+
+func (q *BanditFeedbackQueue) Ack(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	pipe := q.client.TxPipeline()
+	pipe.XAck(ctx, q.stream, q.group, ids...)
+	pipe.XDel(ctx, q.stream, ids...)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to ack feedback: %w", err)
+	}
+	return nil
+}
+
+// Retry parks the message in the delay set until its backoff has passed;
+// Read moves it back onto the stream once it is due.
+func (q *BanditFeedbackQueue) Retry(ctx context.Context, msg bandit.QueuedFeedback) error {
+	payload, err := json.Marshal(msg.Event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal feedback event: %w", err)
+	}
+
+	// the retried copy keeps its original enqueue time so lag stays honest,
+	// and the parts already applied so they are not applied again
+	member, err := json.Marshal(delayedFeedback{
+		SourceID:   msg.ID,
+		Event:      string(payload),
+		Attempts:   msg.Attempts + 1,
+		EnqueuedAt: msg.EnqueuedAt.UnixMilli(),
+		Applied:    strings.Join(msg.Applied, ","),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal feedback retry: %w", err)
+	}
+	due := time.Now().Add(retryBackoff(msg.Attempts))
+
+	pipe := q.client.TxPipeline()
+	pipe.ZAdd(ctx, q.delayed, redis.Z{Score: float64(due.UnixMilli()), Member: member})
+	pipe.XAck(ctx, q.stream, q.group, msg.ID)
+	pipe.XDel(ctx, q.stream, msg.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to retry feedback: %w", err)
+	}
+	return nil
+}
+
+// retryBackoff is how long a message waits after its attempts+1'th failure.
+func retryBackoff(attempts int) time.Duration {
+	d := feedbackRetryBase
+	for i := 0; i < attempts && d < feedbackRetryMax; i++ {
+		d *= 2
+	}
+	return min(d, feedbackRetryMax)
+}
+
+func (q *BanditFeedbackQueue) DeadLetter(ctx context.Context, msg bandit.QueuedFeedback, reason string) error {
+	values := map[string]any{
+		"source_id": msg.ID,
+		"attempts":  msg.Attempts + 1,
+		"reason":    reason,
+		"failed_at": time.Now().UnixMilli(),
+	}
+	if msg.DecodeErr == nil {
+		payload, err := json.Marshal(msg.Event)
+		if err != nil {
+			return fmt.Errorf("failed to marshal feedback event: %w", err)
+		}
+		values["event"] = payload
+	}
+
+	pipe := q.client.TxPipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{Stream: q.dead, Values: values})
+	pipe.XAck(ctx, q.stream, q.group, msg.ID)
+	pipe.XDel(ctx, q.stream, msg.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to dead-letter feedback: %w", err)
+	}
+	return nil
+}
+
+func (q *BanditFeedbackQueue) Stats(ctx context.Context) (bandit.QueueStats, error) {
+	var stats bandit.QueueStats
+
+	pipe := q.client.Pipeline()
+	depth := pipe.XLen(ctx, q.stream)
+	delayed := pipe.ZCard(ctx, q.delayed)
+	dead := pipe.XLen(ctx, q.dead)
+	oldest := pipe.XRangeN(ctx, q.stream, "-", "+", 1)
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return stats, fmt.Errorf("failed to read feedback queue stats: %w", err)
+	}
+
+	stats.Depth = depth.Val() + delayed.Val()
+	stats.DeadLetters = dead.Val()
+	if msgs := oldest.Val(); len(msgs) > 0 {
+		if at, ok := enqueuedAt(msgs[0]); ok {
+			stats.OldestAge = time.Since(at)
+		}
+	}
+	return stats, nil
+}
+
+func decodeFeedback(msgs []redis.XMessage) []bandit.QueuedFeedback {
+	out := make([]bandit.QueuedFeedback, 0, len(msgs))
+	for _, m := range msgs {
+		qf := bandit.QueuedFeedback{ID: m.ID}
+
+		if v, ok := m.Values["attempts"].(string); ok {
+			qf.Attempts, _ = strconv.Atoi(v)
+		}
+		if at, ok := enqueuedAt(m); ok {
+			qf.EnqueuedAt = at
+		}
+		if v, ok := m.Values["applied"].(string); ok && v != "" {
+			qf.Applied = strings.Split(v, ",")
+		}
+
+		raw, ok := m.Values["event"].(string)
+		if !ok {
+			qf.DecodeErr = errors.New("feedback message has no event payload")
+		} else if err := json.Unmarshal([]byte(raw), &qf.Event); err != nil {
+			qf.DecodeErr = fmt.Errorf("failed to decode feedback event: %w", err)
+		}
+
+		out = append(out, qf)
+	}
+	return out
+}
+
+// enqueuedAt reads a message's enqueue time, falling back to the time
+// encoded in its stream ID.
+func enqueuedAt(m redis.XMessage) (time.Time, bool) {
+	if v, ok := m.Values["enqueued_at"].(string); ok {
+		if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return time.UnixMilli(ms), true
+		}
+	}
+	if ms, _, ok := strings.Cut(m.ID, "-"); ok {
+		if n, err := strconv.ParseInt(ms, 10, 64); err == nil {
+			return time.UnixMilli(n), true
+		}
+	}
+	return time.Time{}, false
+}
@@ -2,6 +2,8 @@ package rest
 
 import (
 	"context"
+	"errors"
+	"myGreenMarket/business/bandit"
 	"myGreenMarket/domain"
 	"myGreenMarket/pkg/metrics"
 	"net/http"
@@ -17,12 +19,20 @@ type (
 	BanditHandler struct {
 		validate      *validator.Validate
 		banditService BanditService
+		feedback      FeedbackSink
 	}
 
 	BanditService interface {
 		Recommend(ctx context.Context, userID uint, slot string, limit int, ctxMap map[string]any) ([]domain.BanditRecommendation, error)
 		LogFeedback(ctx context.Context, event domain.BanditEvent) error
 		DebugRecommend(ctx context.Context, userID uint, slot string, limit int, ctxMap map[string]any) ([]domain.DebugRecommendation, error)
+		RecommendPage(ctx context.Context, userID uint, slots []domain.PageSlot, ctxMap map[string]any) ([]domain.PageRecommendation, error)
+	}
+
+	// FeedbackSink receives feedback events: the bandit service itself, or
+	// the asynchronous ingestion queue in front of it.
+	FeedbackSink interface {
+		LogFeedback(ctx context.Context, event domain.BanditEvent) error
 	}
 
 	RecommendQuery struct {
@@ -31,18 +41,48 @@ type (
 		Platform string `query:"platform"`
 	}
 
+	PageSlotRequest struct {
+		Slot     string `json:"slot" validate:"required"`
+		N        int    `json:"n" validate:"gte=0,lte=100"`
+		Priority int    `json:"priority"`
+	}
+
+	PageRequest struct {
+		Slots      []PageSlotRequest `json:"slots" validate:"required,min=1,max=20,dive"`
+		PageName   string            `json:"page_name"`
+		DeviceType string            `json:"device_type"`
+	}
+
 	FeedbackRequest struct {
 		Slot      string  `json:"slot" validate:"required"`
 		ProductID uint64  `json:"product_id" validate:"required"`
-		EventType string  `json:"event_type" validate:"required,oneof=impression click atc order"`
+		EventType string  `json:"event_type" validate:"required,max=32"` // built-in or reward_model event type, checked by the sink
 		Value     float64 `json:"value"`
 	}
 )
 
-func NewBanditHandler(svc BanditService) *BanditHandler {
+// NewBanditHandler builds the handler; a nil feedback sink logs feedback
+// synchronously through svc.
+func NewBanditHandler(svc BanditService, feedback FeedbackSink) *BanditHandler {
+	if feedback == nil {
+		feedback = svc
+	}
 	return &BanditHandler{
 		validate:      validator.New(),
 		banditService: svc,
+		feedback:      feedback,
+	}
+}
+
+// feedbackStatus maps a feedback sink error to an HTTP status.
+func feedbackStatus(err error) int {
+	switch {
+	case errors.Is(err, bandit.ErrQueueFull):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, bandit.ErrInvalidFeedback):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
 	}
 }
 
@@ -82,6 +122,49 @@ func (h *BanditHandler) Recommend(c echo.Context) error {
 	return c.JSON(http.StatusOK, fres.Response.StatusOK(recs))
 }
 
+// POST /api/v1/recommendations/page
+// body: { "page_name": "home", "slots": [{"slot": "home_top", "n": 6, "priority": 2},
+//
+//	{"slot": "home_row1", "n": 10, "priority": 1}, {"slot": "pdp_similar", "n": 8}] }
+func (h *BanditHandler) RecommendPage(c echo.Context) error {
+	start := time.Now()
+	uidVal := c.Get("user_id")
+	userID, ok := uidVal.(uint)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, ResponseError{Message: "unauthorized"})
+	}
+
+	var req PageRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+	if err := h.validate.Struct(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	slots := make([]domain.PageSlot, len(req.Slots))
+	for i, s := range req.Slots {
+		slots[i] = domain.PageSlot{Slot: s.Slot, N: s.N, Priority: s.Priority}
+	}
+	reqCtx := map[string]any{
+		"platform":    c.Request().Header.Get("X-Platform"),
+		"page_name":   req.PageName,
+		"device_type": req.DeviceType,
+	}
+	page, err := h.banditService.RecommendPage(c.Request().Context(), userID, slots, reqCtx)
+	elapsed := time.Since(start).Seconds()
+	metrics.BanditRecommendLatency.Observe(elapsed)
+	metrics.BanditRecommendRequests.Inc()
+	if errors.Is(err, bandit.ErrInvalidPage) {
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK(page))
+}
+
 func (h *BanditHandler) Feedback(c echo.Context) error {
 	uidVal := c.Get("user_id")
 	userID, ok := uidVal.(uint)
@@ -107,8 +190,8 @@ func (h *BanditHandler) Feedback(c echo.Context) error {
 		Value:     req.Value, // business value
 	}
 
-	if err := h.banditService.LogFeedback(c.Request().Context(), event); err != nil {
-		return c.JSON(http.StatusInternalServerError, ResponseError{Message: err.Error()})
+	if err := h.feedback.LogFeedback(c.Request().Context(), event); err != nil {
+		return c.JSON(feedbackStatus(err), ResponseError{Message: err.Error()})
 	}
 
 	return c.JSON(http.StatusOK, fres.Response.StatusOK(nil))
@@ -197,7 +280,7 @@ type BanditFeedbackRequest struct {
 	UserID    uint   `json:"user_id"`
 	Slot      string `json:"slot"`
 	ProductID uint64 `json:"product_id"`
-	EventType string `json:"event_type"` // "impression" | "click" | "atc" | "order"
+	EventType string `json:"event_type"` // "impression" | "click" | "atc" | "dismiss" | reward_model event
 
 	Value float64 `json:"value"`
 }
@@ -208,9 +291,10 @@ func (h *BanditHandler) BanditFeedback(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid payload"})
 	}
 
-	businessValue := req.Value
-	if businessValue == 0 && req.EventType == "order" {
-		businessValue = 1.0
+	// orders are credited by attribution when they are paid; a posted
+	// order would be counted twice
+	if req.EventType == "order" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "order feedback is attributed from paid orders and cannot be posted"})
 	}
 
 	ev := domain.BanditEvent{
@@ -218,11 +302,11 @@ func (h *BanditHandler) BanditFeedback(c echo.Context) error {
 		Slot:      req.Slot,
 		ProductID: req.ProductID,
 		EventType: req.EventType,
-		Value:     businessValue,
+		Value:     req.Value,
 	}
 
-	if err := h.banditService.LogFeedback(c.Request().Context(), ev); err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	if err := h.feedback.LogFeedback(c.Request().Context(), ev); err != nil {
+		return c.JSON(feedbackStatus(err), echo.Map{"error": err.Error()})
 	}
 
 	return c.JSON(http.StatusAccepted, echo.Map{"status": "ok"})
@@ -1,6 +1,8 @@
 package rest
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -10,18 +12,43 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
+type BanditEvaluator interface {
+	Evaluate(ctx context.Context, req domain.OffPolicyEvalRequest) (domain.OffPolicyEvalReport, error)
+}
+
 type BanditAdminHandler struct {
 	cfgRepo     bandit.ConfigRepository
 	segmentRepo bandit.SegmentRepository
+	evaluator   BanditEvaluator
+	experiments ExperimentManager
+	reporter    ExperimentReporter
+	guardrails  GuardrailManager
+	merch       MerchRuleManager
+	snapshots   SnapshotManager
+	states      StateManager
 }
 
 func NewBanditAdminHandler(
 	cfgRepo bandit.ConfigRepository,
 	segmentRepo bandit.SegmentRepository,
+	evaluator BanditEvaluator,
+	experiments ExperimentManager,
+	reporter ExperimentReporter,
+	guardrails GuardrailManager,
+	merch MerchRuleManager,
+	snapshots SnapshotManager,
+	states StateManager,
 ) *BanditAdminHandler {
 	return &BanditAdminHandler{
 		cfgRepo:     cfgRepo,
 		segmentRepo: segmentRepo,
+		evaluator:   evaluator,
+		experiments: experiments,
+		reporter:    reporter,
+		guardrails:  guardrails,
+		merch:       merch,
+		snapshots:   snapshots,
+		states:      states,
 	}
 }
 
@@ -70,9 +97,18 @@ func (h *BanditAdminHandler) UpsertConfig(c echo.Context) error {
 			"error": "invalid body: " + err.Error(),
 		})
 	}
-	if body.Slot == "" {
+	if err := bandit.ValidateConfig(body); err != nil {
 		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "slot is required",
+			"error": err.Error(),
+		})
+	}
+	if err := bandit.ValidateSlotLayout(ctx, h.cfgRepo, body); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, bandit.ErrFeatureLayoutConflict) {
+			status = http.StatusBadRequest
+		}
+		return c.JSON(status, echo.Map{
+			"error": err.Error(),
 		})
 	}
 
@@ -154,3 +190,39 @@ func (h *BanditAdminHandler) UpsertSegment(c echo.Context) error {
 		"status": "ok",
 	})
 }
+
+// POST /api/v1/admin/bandit/evaluate
+// body: { "slot": "home_top", "from": "...", "to": "...", "candidates": [BanditConfig, ...] }
+func (h *BanditAdminHandler) Evaluate(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var body domain.OffPolicyEvalRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error": "invalid body: " + err.Error(),
+		})
+	}
+	if body.Slot == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error": "slot is required",
+		})
+	}
+	if len(body.Candidates) == 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error": "candidates are required",
+		})
+	}
+
+	report, err := h.evaluator.Evaluate(ctx, body)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, bandit.ErrInvalidEvalRequest) {
+			status = http.StatusBadRequest
+		}
+		return c.JSON(status, echo.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
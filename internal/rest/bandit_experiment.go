@@ -0,0 +1,279 @@
+package rest
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"myGreenMarket/business/bandit"
+	"myGreenMarket/domain"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ExperimentManager interface {
+	ListExperiments(ctx context.Context, slot string) ([]domain.BanditExperiment, error)
+	GetExperiment(ctx context.Context, id uint) (domain.BanditExperiment, error)
+	CreateExperiment(ctx context.Context, exp domain.BanditExperiment) (domain.BanditExperiment, error)
+	RampExperiment(ctx context.Context, id uint, req bandit.RampRequest) (domain.BanditExperiment, error)
+	StopExperiment(ctx context.Context, id uint, winner *int) (domain.BanditExperiment, error)
+}
+
+// createExperimentRequest is a BanditExperiment whose arms may also be given
+// as a VariantConfig split across the built-in variants.
+type createExperimentRequest struct {
+	domain.BanditExperiment
+	Variants *bandit.VariantConfig `json:"variants"`
+}
+
+type stopExperimentRequest struct {
+	WinnerVariant *int `json:"winner_variant"`
+}
+
+// experimentStatus maps experiment errors to HTTP statuses.
+func experimentStatus(err error) int {
+	switch {
+	case errors.Is(err, bandit.ErrExperimentNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, bandit.ErrExperimentRunning):
+		return http.StatusConflict
+	case errors.Is(err, bandit.ErrInvalidExperiment):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func experimentID(c echo.Context) (uint, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint(id), nil
+}
+
+// GET /api/v1/admin/bandit/experiments?slot=home_top
+func (h *BanditAdminHandler) ListExperiments(c echo.Context) error {
+	exps, err := h.experiments.ListExperiments(c.Request().Context(), c.QueryParam("slot"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"data": exps,
+	})
+}
+
+// GET /api/v1/admin/bandit/experiments/:id
+func (h *BanditAdminHandler) GetExperiment(c echo.Context) error {
+	id, err := experimentID(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error": "invalid experiment id",
+		})
+	}
+
+	exp, err := h.experiments.GetExperiment(c.Request().Context(), id)
+	if err != nil {
+		return c.JSON(experimentStatus(err), echo.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, exp)
+}
+
+// POST /api/v1/admin/bandit/experiments
+// body: { "slot": "home_top", "name": "ts_vs_ucb", "control_variant": 0,
+//
+//	"holdout_pct": 5, "arms": [{"variant": 0, "weight": 50}, {"variant": 1, "weight": 50}],
+//	"ramp": [{"at": "...", "pct": 5}, {"at": "...", "pct": 25}, {"at": "...", "pct": 50}] }
+func (h *BanditAdminHandler) CreateExperiment(c echo.Context) error {
+	var body createExperimentRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error": "invalid body: " + err.Error(),
+		})
+	}
+
+	exp := body.BanditExperiment
+	if len(exp.Arms) == 0 && body.Variants != nil {
+		exp.Arms = body.Variants.Arms()
+	}
+
+	created, err := h.experiments.CreateExperiment(c.Request().Context(), exp)
+	if err != nil {
+		return c.JSON(experimentStatus(err), echo.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusCreated, created)
+}
+
+// POST /api/v1/admin/bandit/experiments/:id/ramp
+// body: { "pct": 25 } or { "schedule": [{"at": "...", "pct": 50}] }, optionally "arms"
+func (h *BanditAdminHandler) RampExperiment(c echo.Context) error {
+	id, err := experimentID(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error": "invalid experiment id",
+		})
+	}
+
+	var body bandit.RampRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error": "invalid body: " + err.Error(),
+		})
+	}
+	if body.Pct == nil && len(body.Schedule) == 0 && len(body.Arms) == 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error": "pct, schedule or arms is required",
+		})
+	}
+
+	exp, err := h.experiments.RampExperiment(c.Request().Context(), id, body)
+	if err != nil {
+		return c.JSON(experimentStatus(err), echo.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, exp)
+}
+
+// POST /api/v1/admin/bandit/experiments/:id/stop
+// body (optional): { "winner_variant": 1 }
+func (h *BanditAdminHandler) StopExperiment(c echo.Context) error {
+	id, err := experimentID(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error": "invalid experiment id",
+		})
+	}
+
+	var body stopExperimentRequest
+	if c.Request().ContentLength > 0 {
+		if err := c.Bind(&body); err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{
+				"error": "invalid body: " + err.Error(),
+			})
+		}
+	}
+
+	exp, err := h.experiments.StopExperiment(c.Request().Context(), id, body.WinnerVariant)
+	if err != nil {
+		return c.JSON(experimentStatus(err), echo.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, exp)
+}
+
+type ExperimentReporter interface {
+	Report(ctx context.Context, req bandit.ReportRequest) (domain.ExperimentReport, error)
+}
+
+// GET /api/v1/admin/bandit/experiments/:slot/report?from=...&to=...&control=0&format=csv
+func (h *BanditAdminHandler) ExperimentReport(c echo.Context) error {
+	req := bandit.ReportRequest{Slot: c.Param("slot")}
+
+	var err error
+	if v := c.QueryParam("from"); v != "" {
+		if req.From, err = time.Parse(time.RFC3339, v); err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{
+				"error": "invalid from, want RFC3339",
+			})
+		}
+	}
+	if v := c.QueryParam("to"); v != "" {
+		if req.To, err = time.Parse(time.RFC3339, v); err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{
+				"error": "invalid to, want RFC3339",
+			})
+		}
+	}
+	if v := c.QueryParam("control"); v != "" {
+		control, err := strconv.Atoi(v)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{
+				"error": "invalid control",
+			})
+		}
+		req.Control = &control
+	}
+
+	report, err := h.reporter.Report(c.Request().Context(), req)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if c.QueryParam("format") == "csv" {
+		c.Response().Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+		c.Response().Header().Set(echo.HeaderContentDisposition,
+			fmt.Sprintf(`attachment; filename="%s_report.csv"`, report.Slot))
+		c.Response().WriteHeader(http.StatusOK)
+		return writeReportCSV(c.Response(), report)
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+var reportMetrics = []string{"ctr", "atc_rate", "conversion_rate", "revenue_per_impression"}
+
+// writeReportCSV writes one row per variant and metric.
+func writeReportCSV(w io.Writer, report domain.ExperimentReport) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{
+		"slot", "variant", "is_control", "impressions", "users", "metric",
+		"value", "ci_low", "ci_high", "lift", "z_score", "p_value", "prob_beat_control",
+		"significant", "srm_p_value",
+	})
+
+	f := func(v float64) string { return strconv.FormatFloat(v, 'g', 6, 64) }
+
+	for _, vr := range report.Variants {
+		estimates := map[string]domain.MetricEstimate{
+			"ctr":                    vr.CTR,
+			"atc_rate":               vr.ATCRate,
+			"conversion_rate":        vr.ConversionRate,
+			"revenue_per_impression": vr.RevenuePerImpression,
+		}
+		for _, metric := range reportMetrics {
+			est := estimates[metric]
+			row := []string{
+				report.Slot,
+				strconv.Itoa(vr.Variant),
+				strconv.FormatBool(vr.Variant == report.ControlVariant),
+				strconv.FormatInt(vr.Impressions, 10),
+				strconv.FormatInt(vr.Users, 10),
+				metric,
+				f(est.Value), f(est.CILow), f(est.CIHigh),
+			}
+			if cmp, ok := vr.VsControl[metric]; ok {
+				row = append(row,
+					f(cmp.Lift), f(cmp.ZScore), f(cmp.PValue), f(cmp.ProbBeatControl),
+					strconv.FormatBool(cmp.Significant),
+				)
+			} else {
+				row = append(row, "", "", "", "", "")
+			}
+			row = append(row, f(report.SampleRatio.PValue))
+			_ = cw.Write(row)
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
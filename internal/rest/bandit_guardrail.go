@@ -0,0 +1,51 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"myGreenMarket/domain"
+
+	"github.com/labstack/echo/v4"
+)
+
+type GuardrailManager interface {
+	Overrides(ctx context.Context) ([]domain.BanditVariantOverride, error)
+	Resume(ctx context.Context, slot string, variant int) error
+}
+
+// GET /api/v1/admin/bandit/guardrails
+func (h *BanditAdminHandler) ListGuardrailOverrides(c echo.Context) error {
+	overrides, err := h.guardrails.Overrides(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"data": overrides,
+	})
+}
+
+// DELETE /api/v1/admin/bandit/guardrails/:slot/:variant
+func (h *BanditAdminHandler) ResumeVariant(c echo.Context) error {
+	slot := c.Param("slot")
+	variant, err := strconv.Atoi(c.Param("variant"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error": "invalid variant",
+		})
+	}
+
+	if err := h.guardrails.Resume(c.Request().Context(), slot, variant); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"status": "ok",
+	})
+}
@@ -0,0 +1,168 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"myGreenMarket/business/bandit"
+	"myGreenMarket/domain"
+
+	"github.com/labstack/echo/v4"
+)
+
+type MerchRuleManager interface {
+	ListRules(ctx context.Context, slot string) ([]domain.BanditMerchRule, error)
+	GetRule(ctx context.Context, id uint) (domain.BanditMerchRule, error)
+	CreateRule(ctx context.Context, rule domain.BanditMerchRule, actorID uint) (domain.BanditMerchRule, error)
+	UpdateRule(ctx context.Context, id uint, rule domain.BanditMerchRule, actorID uint) (domain.BanditMerchRule, error)
+	DeleteRule(ctx context.Context, id uint, actorID uint) error
+	RuleAudit(ctx context.Context, id uint) ([]domain.BanditMerchRuleAudit, error)
+}
+
+// merchRuleStatus maps merchandising rule errors to HTTP statuses.
+func merchRuleStatus(err error) int {
+	switch {
+	case errors.Is(err, bandit.ErrMerchRuleNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, bandit.ErrInvalidMerchRule):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func merchRuleID(c echo.Context) (uint, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint(id), nil
+}
+
+// GET /api/v1/admin/bandit/merch-rules?slot=home_top
+func (h *BanditAdminHandler) ListMerchRules(c echo.Context) error {
+	rules, err := h.merch.ListRules(c.Request().Context(), c.QueryParam("slot"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"data": rules,
+	})
+}
+
+// GET /api/v1/admin/bandit/merch-rules/:id
+func (h *BanditAdminHandler) GetMerchRule(c echo.Context) error {
+	id, err := merchRuleID(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error": "invalid rule id",
+		})
+	}
+
+	rule, err := h.merch.GetRule(c.Request().Context(), id)
+	if err != nil {
+		return c.JSON(merchRuleStatus(err), echo.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, rule)
+}
+
+// POST /api/v1/admin/bandit/merch-rules
+// body: { "slot": "home_top", "action": "pin", "product_id": 42, "position": 1,
+//
+//	"segment": 3, "campaign_id": "spring", "starts_at": "...", "ends_at": "..." }
+func (h *BanditAdminHandler) CreateMerchRule(c echo.Context) error {
+	var body domain.BanditMerchRule
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error": "invalid body: " + err.Error(),
+		})
+	}
+
+	actorID, _ := c.Get("user_id").(uint)
+	created, err := h.merch.CreateRule(c.Request().Context(), body, actorID)
+	if err != nil {
+		return c.JSON(merchRuleStatus(err), echo.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusCreated, created)
+}
+
+// PUT /api/v1/admin/bandit/merch-rules/:id
+// body: the full rule, as for POST
+func (h *BanditAdminHandler) UpdateMerchRule(c echo.Context) error {
+	id, err := merchRuleID(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error": "invalid rule id",
+		})
+	}
+
+	var body domain.BanditMerchRule
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error": "invalid body: " + err.Error(),
+		})
+	}
+
+	actorID, _ := c.Get("user_id").(uint)
+	updated, err := h.merch.UpdateRule(c.Request().Context(), id, body, actorID)
+	if err != nil {
+		return c.JSON(merchRuleStatus(err), echo.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, updated)
+}
+
+// DELETE /api/v1/admin/bandit/merch-rules/:id
+func (h *BanditAdminHandler) DeleteMerchRule(c echo.Context) error {
+	id, err := merchRuleID(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error": "invalid rule id",
+		})
+	}
+
+	actorID, _ := c.Get("user_id").(uint)
+	if err := h.merch.DeleteRule(c.Request().Context(), id, actorID); err != nil {
+		return c.JSON(merchRuleStatus(err), echo.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"status": "ok",
+	})
+}
+
+// GET /api/v1/admin/bandit/merch-rules/:id/audit
+func (h *BanditAdminHandler) MerchRuleAudit(c echo.Context) error {
+	id, err := merchRuleID(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error": "invalid rule id",
+		})
+	}
+
+	entries, err := h.merch.RuleAudit(c.Request().Context(), id)
+	if err != nil {
+		return c.JSON(merchRuleStatus(err), echo.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"data": entries,
+	})
+}
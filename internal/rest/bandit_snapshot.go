@@ -0,0 +1,156 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"myGreenMarket/business/bandit"
+	"myGreenMarket/domain"
+
+	"github.com/labstack/echo/v4"
+)
+
+type SnapshotManager interface {
+	Snapshot(ctx context.Context, slot, reason string, actorID uint, note string) (domain.BanditStateSnapshot, error)
+	ListSnapshots(ctx context.Context, slot string) ([]domain.BanditStateSnapshot, error)
+	GetSnapshot(ctx context.Context, id uint) (domain.BanditStateSnapshot, error)
+	Diff(ctx context.Context, fromID, toID uint) (domain.SnapshotDiff, error)
+	Restore(ctx context.Context, id uint, actorID uint) (domain.BanditStateSnapshot, error)
+}
+
+type SnapshotRequest struct {
+	Slot string `json:"slot"`
+	Note string `json:"note"`
+}
+
+// snapshotStatus maps snapshot errors to HTTP statuses.
+func snapshotStatus(err error) int {
+	switch {
+	case errors.Is(err, bandit.ErrSnapshotNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, bandit.ErrInvalidSnapshot):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func snapshotID(s string) (uint, error) {
+	id, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint(id), nil
+}
+
+// GET /api/v1/admin/bandit/snapshots?slot=home_top
+func (h *BanditAdminHandler) ListSnapshots(c echo.Context) error {
+	slot := c.QueryParam("slot")
+	if slot == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error": "slot is required",
+		})
+	}
+
+	snaps, err := h.snapshots.ListSnapshots(c.Request().Context(), slot)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"data": snaps,
+	})
+}
+
+// POST /api/v1/admin/bandit/snapshots
+// body: { "slot": "home_top", "note": "before reward model change" }
+func (h *BanditAdminHandler) CreateSnapshot(c echo.Context) error {
+	var body SnapshotRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error": "invalid body: " + err.Error(),
+		})
+	}
+
+	actorID, _ := c.Get("user_id").(uint)
+	snap, err := h.snapshots.Snapshot(c.Request().Context(), body.Slot, domain.SnapshotManual, actorID, body.Note)
+	if err != nil {
+		return c.JSON(snapshotStatus(err), echo.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusCreated, snap)
+}
+
+// GET /api/v1/admin/bandit/snapshots/:id
+func (h *BanditAdminHandler) GetSnapshot(c echo.Context) error {
+	id, err := snapshotID(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error": "invalid snapshot id",
+		})
+	}
+
+	snap, err := h.snapshots.GetSnapshot(c.Request().Context(), id)
+	if err != nil {
+		return c.JSON(snapshotStatus(err), echo.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, snap)
+}
+
+// GET /api/v1/admin/bandit/snapshots/:id/diff?to=42
+func (h *BanditAdminHandler) DiffSnapshots(c echo.Context) error {
+	fromID, err := snapshotID(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error": "invalid snapshot id",
+		})
+	}
+	toID, err := snapshotID(c.QueryParam("to"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error": "invalid or missing to",
+		})
+	}
+
+	diff, err := h.snapshots.Diff(c.Request().Context(), fromID, toID)
+	if err != nil {
+		return c.JSON(snapshotStatus(err), echo.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, diff)
+}
+
+// POST /api/v1/admin/bandit/snapshots/:id/restore
+// responds with the pre-restore snapshot of the replaced states
+func (h *BanditAdminHandler) RestoreSnapshot(c echo.Context) error {
+	id, err := snapshotID(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error": "invalid snapshot id",
+		})
+	}
+
+	actorID, _ := c.Get("user_id").(uint)
+	backup, err := h.snapshots.Restore(c.Request().Context(), id, actorID)
+	if err != nil {
+		return c.JSON(snapshotStatus(err), echo.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"status": "ok",
+		"backup": backup,
+	})
+}
@@ -0,0 +1,94 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"myGreenMarket/business/bandit"
+	"myGreenMarket/domain"
+
+	"github.com/labstack/echo/v4"
+)
+
+type StateManager interface {
+	Rebuild(ctx context.Context, req domain.StateRebuildRequest) (domain.StateRebuildReport, error)
+	Export(ctx context.Context, slot string, users bool) (bandit.StateExport, error)
+	Import(ctx context.Context, exp bandit.StateExport, slot string) (int, error)
+}
+
+func stateStatus(err error) int {
+	if errors.Is(err, bandit.ErrInvalidStateRequest) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// POST /api/v1/admin/bandit/states/rebuild
+// body: { "slot": "home_top", "segment": 2, "from": "...", "to": "...",
+//
+//	"include_users": true, "dry_run": false }
+func (h *BanditAdminHandler) RebuildStates(c echo.Context) error {
+	var body domain.StateRebuildRequest
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error": "invalid body: " + err.Error(),
+		})
+	}
+
+	report, err := h.states.Rebuild(c.Request().Context(), body)
+	if err != nil {
+		return c.JSON(stateStatus(err), echo.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+// GET /api/v1/admin/bandit/states/export?slot=home_top&users=true
+func (h *BanditAdminHandler) ExportStates(c echo.Context) error {
+	users := false
+	if v := c.QueryParam("users"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{
+				"error": "invalid users",
+			})
+		}
+		users = b
+	}
+
+	exp, err := h.states.Export(c.Request().Context(), c.QueryParam("slot"), users)
+	if err != nil {
+		return c.JSON(stateStatus(err), echo.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, exp)
+}
+
+// POST /api/v1/admin/bandit/states/import?slot=home_top
+// body: an export; slot, when given, moves the states to another slot
+func (h *BanditAdminHandler) ImportStates(c echo.Context) error {
+	var body bandit.StateExport
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error": "invalid body: " + err.Error(),
+		})
+	}
+
+	n, err := h.states.Import(c.Request().Context(), body, c.QueryParam("slot"))
+	if err != nil {
+		return c.JSON(stateStatus(err), echo.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"status": "ok",
+		"states": n,
+	})
+}
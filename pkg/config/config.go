@@ -4,6 +4,7 @@ import (
 	"errors"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -16,6 +17,7 @@ type Config struct {
 	Mailjet  MailjetConfig
 	Xendit   XenditConfig
 	Redis    RedisConfig
+	Bandit   BanditConfig
 }
 
 type MailjetConfig struct {
@@ -65,6 +67,69 @@ type RedisConfig struct {
 	RedisDB       int
 }
 
+type BanditConfig struct {
+	AttributionLookback time.Duration
+	AttributionRule     string
+
+	// how long attributing a paid order may hold up the payment response
+	AttributionTimeout time.Duration
+
+	// how long catalogue attributes used as bandit features are cached
+	ProductCacheTTL time.Duration
+
+	// how long a slot's running experiment is cached by the allocator
+	ExperimentCacheTTL time.Duration
+
+	// how long a slot's merchandising rules are cached
+	MerchRuleCacheTTL time.Duration
+
+	// products out of stock, hidden or deleted are never recommended, nor
+	// products the user recently bought; dismissals are per slot, in the
+	// slot's fatigue settings
+	EligibilityCacheTTL         time.Duration
+	EligibilityPurchaseLookback time.Duration
+
+	// large candidate sets are scored in parallel; past the timeout the
+	// slate is served by offline score
+	ScoringWorkers     int
+	ScoringParallelMin int
+	ScoringTimeout     time.Duration
+
+	// variants doing significantly worse than offline-only are paused
+	GuardrailEnabled        bool
+	GuardrailInterval       time.Duration
+	GuardrailWindow         time.Duration
+	GuardrailMinImpressions int
+	GuardrailMaxDrop        float64
+	GuardrailAlertEmail     string
+
+	// feedback is queued on a Redis stream and applied by workers in batches
+	FeedbackAsync       bool
+	FeedbackStream      string
+	FeedbackWorkers     int
+	FeedbackBatchSize   int
+	FeedbackMaxBacklog  int
+	FeedbackMaxAttempts int
+
+	// every slot's states are snapshotted each SnapshotInterval; snapshots
+	// older than SnapshotMaxAge are pruned, except a slot's newest
+	// SnapshotKeepLast
+	SnapshotEnabled  bool
+	SnapshotInterval time.Duration
+	SnapshotMaxAge   time.Duration
+	SnapshotKeepLast int
+
+	// each StateGCInterval, user states idle for StateGCIdleTTL are deleted;
+	// the rest lose arms not updated for StateGCArmTTL (folded into the
+	// global state with StateGCFoldArms) and are shrunk to StateGCMaxArms
+	StateGCEnabled  bool
+	StateGCInterval time.Duration
+	StateGCIdleTTL  time.Duration
+	StateGCArmTTL   time.Duration
+	StateGCFoldArms bool
+	StateGCMaxArms  int
+}
+
 func Load() (*Config, error) {
 	_ = godotenv.Load()
 
@@ -114,6 +179,45 @@ func Load() (*Config, error) {
 			RedisPassword: getEnv("REDIS_PASSWORD", ""),
 			RedisDB:       redisDB,
 		},
+		Bandit: BanditConfig{
+			AttributionLookback:     getEnvDuration("BANDIT_ATTRIBUTION_LOOKBACK", 7*24*time.Hour),
+			AttributionRule:         getEnv("BANDIT_ATTRIBUTION_RULE", "last_touch"),
+			AttributionTimeout:      getEnvDuration("BANDIT_ATTRIBUTION_TIMEOUT", 2*time.Second),
+			ProductCacheTTL:         getEnvDuration("BANDIT_PRODUCT_CACHE_TTL", 10*time.Minute),
+			ExperimentCacheTTL:      getEnvDuration("BANDIT_EXPERIMENT_CACHE_TTL", 30*time.Second),
+			MerchRuleCacheTTL:       getEnvDuration("BANDIT_MERCH_RULE_CACHE_TTL", 30*time.Second),
+			GuardrailEnabled:        getEnvBool("BANDIT_GUARDRAIL_ENABLED", false),
+			GuardrailInterval:       getEnvDuration("BANDIT_GUARDRAIL_INTERVAL", 10*time.Minute),
+			GuardrailWindow:         getEnvDuration("BANDIT_GUARDRAIL_WINDOW", 24*time.Hour),
+			GuardrailMinImpressions: getEnvInt("BANDIT_GUARDRAIL_MIN_IMPRESSIONS", 1000),
+			GuardrailMaxDrop:        getEnvFloat("BANDIT_GUARDRAIL_MAX_DROP", 0.2),
+			GuardrailAlertEmail:     getEnv("BANDIT_GUARDRAIL_EMAIL", ""),
+			FeedbackAsync:           getEnvBool("BANDIT_FEEDBACK_ASYNC", false),
+			FeedbackStream:          getEnv("BANDIT_FEEDBACK_STREAM", "bandit:feedback"),
+			FeedbackWorkers:         getEnvInt("BANDIT_FEEDBACK_WORKERS", 4),
+			FeedbackBatchSize:       getEnvInt("BANDIT_FEEDBACK_BATCH", 100),
+			FeedbackMaxBacklog:      getEnvInt("BANDIT_FEEDBACK_MAX_BACKLOG", 100000),
+			FeedbackMaxAttempts:     getEnvInt("BANDIT_FEEDBACK_MAX_ATTEMPTS", 5),
+
+			EligibilityCacheTTL:         getEnvDuration("BANDIT_ELIGIBILITY_CACHE_TTL", 30*time.Second),
+			EligibilityPurchaseLookback: getEnvDuration("BANDIT_ELIGIBILITY_PURCHASE_LOOKBACK", 7*24*time.Hour),
+
+			ScoringWorkers:     getEnvInt("BANDIT_SCORING_WORKERS", 4),
+			ScoringParallelMin: getEnvInt("BANDIT_SCORING_PARALLEL_MIN", 64),
+			ScoringTimeout:     getEnvDuration("BANDIT_SCORING_TIMEOUT", 150*time.Millisecond),
+
+			SnapshotEnabled:  getEnvBool("BANDIT_SNAPSHOT_ENABLED", true),
+			SnapshotInterval: getEnvDuration("BANDIT_SNAPSHOT_INTERVAL", 6*time.Hour),
+			SnapshotMaxAge:   getEnvDuration("BANDIT_SNAPSHOT_MAX_AGE", 14*24*time.Hour),
+			SnapshotKeepLast: getEnvInt("BANDIT_SNAPSHOT_KEEP_LAST", 10),
+
+			StateGCEnabled:  getEnvBool("BANDIT_STATE_GC_ENABLED", true),
+			StateGCInterval: getEnvDuration("BANDIT_STATE_GC_INTERVAL", time.Hour),
+			StateGCIdleTTL:  getEnvDuration("BANDIT_STATE_GC_IDLE_TTL", 30*24*time.Hour),
+			StateGCArmTTL:   getEnvDuration("BANDIT_STATE_GC_ARM_TTL", 7*24*time.Hour),
+			StateGCFoldArms: getEnvBool("BANDIT_STATE_GC_FOLD_ARMS", false),
+			StateGCMaxArms:  getEnvInt("BANDIT_STATE_GC_MAX_ARMS", 50),
+		},
 	}
 
 	if cfg.JWT.SecretKey == "" {
@@ -142,3 +246,43 @@ func getEnv(key, defaultVal string) string {
 
 	return defaultVal
 }
+
+func getEnvDuration(key string, defaultVal time.Duration) time.Duration {
+	if val := os.Getenv(key); val != "" {
+		if d, err := time.ParseDuration(val); err == nil {
+			return d
+		}
+	}
+
+	return defaultVal
+}
+
+func getEnvInt(key string, defaultVal int) int {
+	if val := os.Getenv(key); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			return n
+		}
+	}
+
+	return defaultVal
+}
+
+func getEnvBool(key string, defaultVal bool) bool {
+	if val := os.Getenv(key); val != "" {
+		if b, err := strconv.ParseBool(val); err == nil {
+			return b
+		}
+	}
+
+	return defaultVal
+}
+
+func getEnvFloat(key string, defaultVal float64) float64 {
+	if val := os.Getenv(key); val != "" {
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			return f
+		}
+	}
+
+	return defaultVal
+}